@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/web"
+)
+
+func runConfigValidate(_ context.Context, args []string, out io.Writer) error {
+	fs := newFlags("config validate")
+	asJSON := fs.Bool("json", false, "print only the configuration as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := web.Check(cfg); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if !*asJSON {
+		fmt.Fprintln(out, "Configuration is valid. Effective settings, secrets redacted:")
+	}
+	return printJSON(out, cfg.Redacted())
+}
@@ -1,55 +1,105 @@
+// Command payit runs the payit server and the operational commands on-call
+// engineers use against it. Run `payit help` for the list.
 package main
 
 import (
 	"context"
-	"log"
-	"net/http"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
-	"time"
-
-	"github.com/rjNemo/payit/config"
-	"github.com/rjNemo/payit/internal/web"
+	"text/tabwriter"
 )
 
+// command is one CLI subcommand; name may span several words such as
+// "orders list".
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string, out io.Writer) error
+}
+
+var commands = []command{
+	{"serve", "start the HTTP server (the default)", runServe},
+	{"config validate", "load the configuration and print it with secrets redacted", runConfigValidate},
+	{"checkout create", "start a checkout session and print its URL", runCheckoutCreate},
+	{"orders list", "list orders, newest first", runOrdersList},
+	{"orders show", "show one order and its timeline", runOrdersShow},
+	{"refund", "refund a paid order, in full unless -amount-cents is given", runRefund},
+	{"webhooks replay", "re-sign saved Stripe events and send them to the server", runWebhooksReplay},
+	{"migrate", "prepare on-disk state for this version of payit", runMigrate},
+	{"audit verify", "check the audit log hash chain", runAuditVerify},
+}
+
 func main() {
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("failed to load configuration: %v", err)
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	handler := web.NewServer(cfg)
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "payit: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
 
-	srv := &http.Server{
-		Addr:         ":8080",
-		Handler:      handler,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return runServe(ctx, nil, out)
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(out)
+		return nil
 	}
+	for _, c := range commands {
+		words := strings.Fields(c.name)
+		if len(args) >= len(words) && slices.Equal(args[:len(words)], words) {
+			return c.run(ctx, args[len(words):], out)
+		}
+	}
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", strings.Join(args, " "))
+}
 
-	log.Printf("Starting PayIt server on %s", srv.Addr)
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: payit <command> [flags]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.usage)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands that talk to a running server read PAYIT_URL and PAYIT_API_KEY.")
+	fmt.Fprintln(w, "Pass -json for machine-readable output.")
+}
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+// newFlags returns a flag set for the named command whose errors are returned
+// rather than exiting the process.
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("payit "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
 
-	errCh := make(chan error, 1)
-	go func() {
-		errCh <- srv.ListenAndServe()
-	}()
-
-	select {
-	case <-ctx.Done():
-		log.Println("Shutting down server...")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := srv.Shutdown(shutdownCtx); err != nil {
-			log.Fatalf("server shutdown failed: %v", err)
+// parseArgs parses flags that may appear before or after positional
+// arguments, as in `payit refund cs_123 -amount-cents 500`.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
 		}
-		log.Println("Server stopped cleanly")
-	case err := <-errCh:
-		if err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server error: %v", err)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
 		}
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
 }
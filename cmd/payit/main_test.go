@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+func TestRunRejectsUnknownCommand(t *testing.T) {
+	if err := run(context.Background(), []string{"orders", "delete"}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatalf("expected unknown command error, got %v", err)
+	}
+}
+
+// setTestConfig sets the environment of a minimal valid configuration that
+// keeps its state under a temporary directory.
+func setTestConfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("PAYIT_STRIPE_SECRET_KEY", "sk_test_secret")
+	t.Setenv("PAYIT_STRIPE_PUBLISHABLE_KEY", "pk_test")
+	t.Setenv("PAYIT_PRODUCT_NAME", "Demo product")
+	t.Setenv("PAYIT_PRODUCT_DESCRIPTION", "Example description")
+	t.Setenv("PAYIT_PRODUCT_PRICE_CENTS", "2500")
+	t.Setenv("PAYIT_PRODUCT_CURRENCY", "usd")
+	t.Setenv("PAYIT_PRODUCT_SUCCESS_URL", "https://example.com/success")
+	t.Setenv("PAYIT_PRODUCT_CANCEL_URL", "https://example.com/cancel")
+	t.Setenv("PAYIT_STATE_DIR", dir)
+	t.Setenv("PAYIT_AUDIT_LOG", filepath.Join(dir, "audit.log"))
+	t.Setenv("PAYIT_JOBS_FILE", filepath.Join(dir, "jobs.json"))
+	return dir
+}
+
+func TestConfigValidateRedactsSecrets(t *testing.T) {
+	setTestConfig(t)
+
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"config", "validate", "-json"}, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var cfg struct{ StripeSecretKey, StripePublishableKey string }
+	if err := json.Unmarshal(out.Bytes(), &cfg); err != nil {
+		t.Fatalf("expected JSON output, got %s", out.String())
+	}
+	if cfg.StripeSecretKey != "[redacted]" || cfg.StripePublishableKey != "pk_test" {
+		t.Fatalf("unexpected config output: %+v", cfg)
+	}
+}
+
+func TestConfigValidateRejectsRoutesToDisabledProviders(t *testing.T) {
+	dir := setTestConfig(t)
+	routes := filepath.Join(dir, "routes.json")
+	if err := os.WriteFile(routes, []byte(`[{"provider":"paypal"}]`), 0o600); err != nil {
+		t.Fatalf("write routes: %v", err)
+	}
+	t.Setenv("PAYIT_ROUTES_FILE", routes)
+
+	err := run(context.Background(), []string{"config", "validate"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "paypal") {
+		t.Fatalf("expected a route to the disabled PayPal to be rejected, got %v", err)
+	}
+}
+
+func TestMigrateReadsEveryStateFile(t *testing.T) {
+	dir := setTestConfig(t)
+	t.Setenv("PAYIT_DUNNING", "true")
+
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"migrate"}, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "jobs not written yet") {
+		t.Fatalf("expected the missing jobs file to be reported, got %q", out.String())
+	}
+
+	jobsPath := filepath.Join(dir, "jobs.json")
+	if err := os.WriteFile(jobsPath, []byte(`{"not":"a list"}`), 0o600); err != nil {
+		t.Fatalf("write jobs: %v", err)
+	}
+	err := run(context.Background(), []string{"migrate"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), jobsPath) {
+		t.Fatalf("expected the unreadable jobs file to be reported, got %v", err)
+	}
+}
+
+func TestRefundUsesAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/orders/cs_1/refunds" || r.Header.Get("Authorization") != "Bearer key_1" || r.Header.Get("Idempotency-Key") != "retry-1" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		var req payit.RefundRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(payit.Refund{
+			OrderID:     "cs_1",
+			AmountCents: req.AmountCents,
+			Currency:    "eur",
+			Order:       payit.Order{ID: "cs_1", Status: payit.OrderStatusPaid},
+		})
+	}))
+	defer srv.Close()
+	t.Setenv("PAYIT_URL", srv.URL)
+	t.Setenv("PAYIT_API_KEY", "key_1")
+
+	var out bytes.Buffer
+	args := []string{"refund", "cs_1", "-amount-cents", "1250", "-idempotency-key", "retry-1"}
+	if err := run(context.Background(), args, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := out.String(); got != "Refunded 12.50 EUR on order cs_1; order is now paid.\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
+
+func TestReadEventsAcceptsArrays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	if err := os.WriteFile(path, []byte(`[{"id":"evt_1"},{"id":"evt_2"}]`), 0o600); err != nil {
+		t.Fatalf("write events: %v", err)
+	}
+
+	events, err := readEvents(path)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("expected two events, got %d: %v", len(events), err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/audit"
+	"github.com/rjNemo/payit/internal/jobs"
+	"github.com/rjNemo/payit/internal/payments/coupon"
+	"github.com/rjNemo/payit/internal/payments/inventory"
+	"github.com/rjNemo/payit/internal/payments/metering"
+	"github.com/rjNemo/payit/internal/store"
+)
+
+// stateCheck is the outcome of preparing one piece of persisted state.
+type stateCheck struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Records int    `json:"records"`
+	// Missing marks state that has not been written yet.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// runMigrate prepares on-disk state before a new version starts. Every file
+// payit keeps is loaded with this version's code, so a file it can no longer
+// read is reported before the server starts; stock levels are reconciled with
+// the configured ones, and the audit log's hash chain is checked so a damaged
+// log is noticed before the server appends to it.
+func runMigrate(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlags("migrate")
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	var checks []stateCheck
+	for _, migrate := range []func(context.Context, config.Config) (stateCheck, error){
+		migrateAuditLog, migrateOrders, migrateJobs, migrateCoupons, migrateInventory, migrateMetering,
+	} {
+		check, err := migrate(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		if check.Name != "" {
+			checks = append(checks, check)
+		}
+	}
+
+	if *asJSON {
+		return printJSON(out, map[string]any{"state": checks, "migrations_applied": 0})
+	}
+	for _, c := range checks {
+		if c.Missing {
+			fmt.Fprintf(out, "%s: %s not written yet\n", c.Path, c.Name)
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s readable, %d records\n", c.Path, c.Name, c.Records)
+	}
+	fmt.Fprintln(out, "Nothing to migrate.")
+	return nil
+}
+
+func migrateAuditLog(ctx context.Context, cfg config.Config) (stateCheck, error) {
+	path := cfg.AuditLogPath
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return stateCheck{}, fmt.Errorf("create audit log directory: %w", err)
+	}
+	store, err := audit.NewFileStore(path)
+	if err != nil {
+		return stateCheck{}, err
+	}
+	entries, err := store.Entries(ctx)
+	if err != nil {
+		return stateCheck{}, err
+	}
+	head, err := store.Head(ctx)
+	if err != nil {
+		return stateCheck{}, err
+	}
+	if err := audit.Verify(entries, head, []byte(cfg.AuditKey)); err != nil {
+		return stateCheck{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return stateCheck{Name: "audit log", Path: path, Records: len(entries)}, nil
+}
+
+func migrateOrders(_ context.Context, cfg config.Config) (stateCheck, error) {
+	path := cfg.StatePath(config.OrdersStateFile)
+	if !exists(path) {
+		return stateCheck{Name: "orders", Path: path, Missing: true}, nil
+	}
+	records, err := store.Open(path)
+	if err != nil {
+		return stateCheck{}, err
+	}
+	return stateCheck{Name: "orders", Path: path, Records: records.Records()}, nil
+}
+
+func migrateJobs(ctx context.Context, cfg config.Config) (stateCheck, error) {
+	path := cfg.Dunning.JobsPath
+	if !cfg.Dunning.Enabled {
+		return stateCheck{}, nil
+	}
+	if !exists(path) {
+		return stateCheck{Name: "jobs", Path: path, Missing: true}, nil
+	}
+	queue, err := jobs.Open(path)
+	if err != nil {
+		return stateCheck{}, err
+	}
+	scheduled, err := queue.Jobs(ctx)
+	if err != nil {
+		return stateCheck{}, err
+	}
+	return stateCheck{Name: "jobs", Path: path, Records: len(scheduled)}, nil
+}
+
+func migrateCoupons(_ context.Context, cfg config.Config) (stateCheck, error) {
+	path := cfg.StatePath(config.CouponsStateFile)
+	if len(cfg.Coupons) == 0 {
+		return stateCheck{}, nil
+	}
+	if !exists(path) {
+		return stateCheck{Name: "coupon redemptions", Path: path, Missing: true}, nil
+	}
+	if _, err := coupon.Open(path, cfg.Product, cfg.Coupons, cfg.CheckoutSessionTTL); err != nil {
+		return stateCheck{}, err
+	}
+	return stateCheck{Name: "coupon redemptions", Path: path, Records: len(cfg.Coupons)}, nil
+}
+
+func migrateInventory(_ context.Context, cfg config.Config) (stateCheck, error) {
+	path := cfg.StatePath(config.InventoryStateFile)
+	if len(cfg.Inventory) == 0 {
+		return stateCheck{}, nil
+	}
+	// Opening reconciles the stored stock with the configured levels.
+	if _, err := inventory.Open(path, cfg.Inventory, cfg.CheckoutSessionTTL); err != nil {
+		return stateCheck{}, err
+	}
+	return stateCheck{Name: "stock", Path: path, Records: len(cfg.Inventory)}, nil
+}
+
+func migrateMetering(_ context.Context, cfg config.Config) (stateCheck, error) {
+	path := cfg.StatePath(config.MeteringStateFile)
+	if len(cfg.Metering.Prices) == 0 {
+		return stateCheck{}, nil
+	}
+	if !exists(path) {
+		return stateCheck{Name: "usage batches", Path: path, Missing: true}, nil
+	}
+	meter, err := metering.Open(path, cfg.Metering, nil, nil)
+	if err != nil {
+		return stateCheck{}, err
+	}
+	return stateCheck{Name: "usage batches", Path: path, Records: meter.Batches()}, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
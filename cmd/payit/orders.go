@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/client"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+func runCheckoutCreate(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlags("checkout create")
+	var api apiFlags
+	api.register(fs)
+	var req payit.CheckoutSessionRequest
+	fs.Int64Var(&req.Quantity, "quantity", 1, "units to buy")
+	fs.StringVar(&req.PromoCode, "promo", "", "promotion code")
+	fs.StringVar(&req.Country, "country", "", "buyer country for tax (ISO 3166-1 alpha-2)")
+	fs.StringVar(&req.Region, "region", "", "buyer region for tax")
+	fs.StringVar(&req.TaxID, "tax-id", "", "business buyer tax ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	session, err := api.client().CreateCheckoutSession(ctx, req)
+	if err != nil {
+		return err
+	}
+	if api.json {
+		return printJSON(out, session)
+	}
+	fmt.Fprintf(out, "%s\n%s\n", session.ID, session.URL)
+	return nil
+}
+
+func runOrdersList(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlags("orders list")
+	var api apiFlags
+	api.register(fs)
+	var params client.ListOrdersParams
+	status := fs.String("status", "", "only orders in this status")
+	fs.StringVar(&params.Email, "email", "", "only orders whose customer email contains this")
+	since := fs.String("since", "", "only orders created on or after this date (YYYY-MM-DD)")
+	fs.IntVar(&params.Limit, "limit", 20, "maximum number of orders to print")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	params.Status = payit.OrderStatus(*status)
+	if *since != "" {
+		from, err := time.Parse(time.DateOnly, *since)
+		if err != nil {
+			return errors.New("-since must be a date formatted as YYYY-MM-DD")
+		}
+		params.CreatedFrom = from
+	}
+
+	orders := []payit.Order{}
+	for order, err := range api.client().AllOrders(ctx, params) {
+		if err != nil {
+			return err
+		}
+		orders = append(orders, order)
+		if len(orders) == params.Limit {
+			break
+		}
+	}
+	if api.json {
+		return printJSON(out, orders)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tTOTAL\tREFUNDED\tEMAIL\tCREATED")
+	for _, o := range orders {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", o.ID, o.Status, payments.FormatMoney(o.TotalCents, o.Currency),
+			payments.FormatMoney(o.RefundedCents, o.Currency), o.CustomerEmail, o.CreatedAt.UTC().Format(time.DateTime))
+	}
+	return tw.Flush()
+}
+
+func runOrdersShow(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlags("orders show")
+	var api apiFlags
+	api.register(fs)
+	ids, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return errors.New("usage: payit orders show <order-id>")
+	}
+
+	order, err := api.client().Order(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+	if api.json {
+		return printJSON(out, order)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Order\t%s\n", order.ID)
+	fmt.Fprintf(tw, "Status\t%s\n", order.Status)
+	fmt.Fprintf(tw, "Customer\t%s\n", order.CustomerEmail)
+	fmt.Fprintf(tw, "Quantity\t%d × %s\n", order.Quantity, order.SKU)
+	fmt.Fprintf(tw, "Total\t%s\n", payments.FormatMoney(order.TotalCents, order.Currency))
+	fmt.Fprintf(tw, "Refunded\t%s\n", payments.FormatMoney(order.RefundedCents, order.Currency))
+	fmt.Fprintf(tw, "Provider\t%s\n", order.Provider)
+	fmt.Fprintf(tw, "Payment\t%s\n", order.PaymentIntentID)
+	fmt.Fprintf(tw, "Created\t%s\n", order.CreatedAt.UTC().Format(time.DateTime))
+	for _, step := range order.Timeline {
+		fmt.Fprintf(tw, "  %s\t%s %s\n", step.At.UTC().Format(time.DateTime), step.Action, step.Detail)
+	}
+	return tw.Flush()
+}
+
+func runRefund(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlags("refund")
+	var api apiFlags
+	api.register(fs)
+	amount := fs.Int64("amount-cents", 0, "amount to refund in cents; everything left when omitted")
+	key := fs.String("idempotency-key", "", "reuse to retry a refund without issuing it twice")
+	ids, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return errors.New("usage: payit refund <order-id> [-amount-cents N]")
+	}
+	if *amount < 0 {
+		return errors.New("-amount-cents must not be negative")
+	}
+	if *key != "" {
+		ctx = client.WithIdempotencyKey(ctx, *key)
+	}
+
+	refund, err := api.client().Refund(ctx, ids[0], *amount)
+	if err != nil {
+		return err
+	}
+	if api.json {
+		return printJSON(out, refund)
+	}
+	fmt.Fprintf(out, "Refunded %s on order %s; order is now %s.\n",
+		payments.FormatMoney(refund.AmountCents, refund.Currency), refund.OrderID, refund.Order.Status)
+	return nil
+}
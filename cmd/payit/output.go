@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rjNemo/payit/pkg/client"
+)
+
+// printJSON writes v as indented JSON for scripts.
+func printJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// apiFlags are shared by commands that talk to a running server.
+type apiFlags struct {
+	url  string
+	json bool
+}
+
+func (f *apiFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.url, "url", serverURL(), "payit server URL (PAYIT_URL)")
+	fs.BoolVar(&f.json, "json", false, "print JSON")
+}
+
+// client builds an API client authenticated with PAYIT_API_KEY. The key is
+// only read from the environment so it never lands in shell history.
+func (f *apiFlags) client() *client.Client {
+	return client.New(f.url, os.Getenv("PAYIT_API_KEY"))
+}
+
+func serverURL() string {
+	for _, name := range []string{"PAYIT_URL", "PAYIT_PUBLIC_URL"} {
+		if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+			return v
+		}
+	}
+	return "http://localhost:8080"
+}
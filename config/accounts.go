@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccountConfig controls the customer self-service area, where buyers sign
+// in with emailed magic links.
+type AccountConfig struct {
+	// Enabled mounts the account area at /account. It is off unless
+	// PAYIT_ACCOUNTS is set.
+	Enabled bool
+	// SigningKey signs magic links. When empty, payit generates a key at
+	// startup, so links already sent stop working after a restart.
+	SigningKey string
+	// LinkTTL bounds how long a magic link can be used to sign in.
+	LinkTTL time.Duration
+	// SessionTTL bounds how long a customer stays signed in.
+	SessionTTL time.Duration
+}
+
+const (
+	defaultAccountLinkTTL    = 15 * time.Minute
+	defaultAccountSessionTTL = 30 * 24 * time.Hour
+	minAccountSigningKey     = 32
+)
+
+func loadAccounts() (AccountConfig, error) {
+	cfg := AccountConfig{
+		SigningKey: strings.TrimSpace(os.Getenv("PAYIT_ACCOUNT_SIGNING_KEY")),
+		LinkTTL:    defaultAccountLinkTTL,
+		SessionTTL: defaultAccountSessionTTL,
+	}
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_ACCOUNTS")); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return AccountConfig{}, fmt.Errorf("PAYIT_ACCOUNTS must be a boolean: %w", err)
+		}
+		cfg.Enabled = enabled
+	}
+	if cfg.SigningKey != "" && len(cfg.SigningKey) < minAccountSigningKey {
+		return AccountConfig{}, fmt.Errorf("PAYIT_ACCOUNT_SIGNING_KEY must be at least %d characters", minAccountSigningKey)
+	}
+
+	durations := []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"PAYIT_ACCOUNT_LINK_TTL", &cfg.LinkTTL},
+		{"PAYIT_ACCOUNT_SESSION_TTL", &cfg.SessionTTL},
+	}
+	for _, d := range durations {
+		if raw := strings.TrimSpace(os.Getenv(d.name)); raw != "" {
+			ttl, err := time.ParseDuration(raw)
+			if err != nil || ttl <= 0 {
+				return AccountConfig{}, fmt.Errorf("%s must be a positive duration", d.name)
+			}
+			*d.dst = ttl
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// AdminConfig lists who may use the dashboard and management endpoints.
+// Nothing under /admin is served when no users or API keys are configured.
+type AdminConfig struct {
+	Users   []AdminUserConfig
+	APIKeys []APIKeyConfig
+	// SessionTTL bounds how long a dashboard login stays valid.
+	SessionTTL time.Duration
+}
+
+// AdminUserConfig is a dashboard login. PasswordHash is a bcrypt hash. A user
+// without scopes is an administrator and holds every scope.
+type AdminUserConfig struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"password_hash"`
+	Scopes       []string `json:"scopes"`
+}
+
+// APIKeyConfig is a machine credential. Hash is "sha256:" followed by the hex
+// digest of the key, so the key itself never appears in configuration.
+type APIKeyConfig struct {
+	ID     string   `json:"id"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+}
+
+const defaultAdminSessionTTL = 12 * time.Hour
+
+func loadAdmin() (AdminConfig, error) {
+	cfg := AdminConfig{SessionTTL: defaultAdminSessionTTL}
+
+	// A single administrator can be configured inline; they get every scope.
+	if hash := strings.TrimSpace(os.Getenv("PAYIT_ADMIN_PASSWORD_HASH")); hash != "" {
+		cfg.Users = append(cfg.Users, AdminUserConfig{
+			Username:     envOrDefault("PAYIT_ADMIN_USERNAME", "admin"),
+			PasswordHash: hash,
+		})
+	}
+
+	if path := strings.TrimSpace(os.Getenv("PAYIT_ADMIN_USERS_FILE")); path != "" {
+		var users []AdminUserConfig
+		if err := readJSONFile("PAYIT_ADMIN_USERS_FILE", path, &users); err != nil {
+			return AdminConfig{}, err
+		}
+		cfg.Users = append(cfg.Users, users...)
+	}
+	seen := make(map[string]bool, len(cfg.Users))
+	for i, u := range cfg.Users {
+		switch {
+		case u.Username == "":
+			return AdminConfig{}, fmt.Errorf("admin user %d: username is required", i)
+		case seen[u.Username]:
+			return AdminConfig{}, fmt.Errorf("admin user %s: duplicate username", u.Username)
+		case !strings.HasPrefix(u.PasswordHash, "$2"):
+			return AdminConfig{}, fmt.Errorf("admin user %s: password_hash must be a bcrypt hash", u.Username)
+		}
+		seen[u.Username] = true
+	}
+
+	if path := strings.TrimSpace(os.Getenv("PAYIT_API_KEYS_FILE")); path != "" {
+		if err := readJSONFile("PAYIT_API_KEYS_FILE", path, &cfg.APIKeys); err != nil {
+			return AdminConfig{}, err
+		}
+	}
+	for i, k := range cfg.APIKeys {
+		switch {
+		case k.ID == "":
+			return AdminConfig{}, fmt.Errorf("api key %d: id is required", i)
+		case !strings.HasPrefix(k.Hash, "sha256:"):
+			return AdminConfig{}, fmt.Errorf("api key %s: hash must start with sha256:", k.ID)
+		case len(k.Scopes) == 0:
+			return AdminConfig{}, fmt.Errorf("api key %s: at least one scope is required", k.ID)
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_ADMIN_SESSION_TTL")); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl <= 0 {
+			return AdminConfig{}, fmt.Errorf("PAYIT_ADMIN_SESSION_TTL must be a positive duration")
+		}
+		cfg.SessionTTL = ttl
+	}
+
+	return cfg, nil
+}
+
+func readJSONFile(name, path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s could not be read: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s must contain a JSON array: %w", name, err)
+	}
+	return nil
+}
@@ -2,21 +2,42 @@ package config
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ProductConfig holds metadata for the single demo product.
 type ProductConfig struct {
+	SKU         string
 	Name        string
 	Description string
 	PriceCents  int64
 	Currency    string
 	SuccessURL  string
 	CancelURL   string
+	// Physical products need a shipping address and shipping rates.
+	Physical    bool
+	WeightGrams int64
+	// MinQuantity and MaxQuantity bound how many units one checkout may buy.
+	MinQuantity int64
+	MaxQuantity int64
+}
+
+// CouponConfig describes a locally managed promotion code.
+type CouponConfig struct {
+	Code               string    `json:"code"`
+	PercentOff         int64     `json:"percent_off,omitempty"`
+	AmountOffCents     int64     `json:"amount_off_cents,omitempty"`
+	ExpiresAt          time.Time `json:"expires_at,omitzero"`
+	MaxRedemptions     int64     `json:"max_redemptions,omitempty"`
+	SKUs               []string  `json:"skus,omitempty"`
+	MinimumAmountCents int64     `json:"minimum_amount_cents,omitempty"`
+	StripeCouponID     string    `json:"stripe_coupon_id,omitempty"`
 }
 
 // Config aggregates all runtime configuration required by the server.
@@ -24,6 +45,55 @@ type Config struct {
 	StripeSecretKey      string
 	StripePublishableKey string
 	Product              ProductConfig
+	// AllowPromotionCodes lets customers enter Stripe-managed promotion codes
+	// on the hosted checkout page when no local code was applied.
+	AllowPromotionCodes bool
+	Coupons             []CouponConfig
+	Tax                 TaxConfig
+	Shipping            ShippingConfig
+	// PublicURL is the externally reachable base URL used in links payit sends out.
+	PublicURL string
+	// CheckoutSessionTTL bounds how long a checkout session stays payable.
+	CheckoutSessionTTL time.Duration
+	// CheckoutUI is CheckoutUIHosted to redirect buyers to Stripe,
+	// CheckoutUIEmbedded to mount Stripe's checkout on the checkout page, or
+	// CheckoutUIElements to take payment on payit's own Stripe Elements form.
+	CheckoutUI string
+	Mail       MailConfig
+	// EventWebhook receives signed notifications of payments and refunds.
+	EventWebhook EventWebhookConfig
+	// Inventory maps SKUs to units on hand; SKUs not listed are unlimited.
+	Inventory map[string]int64
+	// PayPal is a second payment provider, offered through Routes.
+	PayPal PayPalConfig
+	// Routes choose between payment providers per checkout; empty sends
+	// everything to Stripe.
+	Routes []RouteConfig
+	// Limits bound order totals and currencies for every checkout.
+	Limits LimitsConfig
+	// Resilience tunes timeouts, retries and the circuit breaker around
+	// payment provider calls.
+	Resilience ResilienceConfig
+	// StripeWebhookSecret verifies webhook signatures; the webhook endpoint is
+	// only served when it is set.
+	StripeWebhookSecret string
+	// ManualCapture only authorizes payments at checkout; staff capture them
+	// from the dashboard.
+	ManualCapture bool
+	Admin         AdminConfig
+	Accounts      AccountConfig
+	// Metering lists usage-based prices and how recorded usage is reported.
+	Metering MeteringConfig
+	// Dunning chases subscription renewals that failed to pay.
+	Dunning DunningConfig
+	// AuditLogPath is the append-only file holding the audit trail.
+	AuditLogPath string
+	// AuditKey signs the audit trail so that only its holders can rewrite
+	// it undetected. Without it the hash chain only catches accidental damage.
+	AuditKey string
+	// StateDir holds the records, counts and holds payit keeps across
+	// restarts, such as orders and coupon redemptions.
+	StateDir string
 }
 
 // Load reads configuration from environment variables, optionally sourcing
@@ -35,7 +105,14 @@ func Load() (Config, error) {
 	cfg := Config{
 		StripeSecretKey:      os.Getenv("PAYIT_STRIPE_SECRET_KEY"),
 		StripePublishableKey: os.Getenv("PAYIT_STRIPE_PUBLISHABLE_KEY"),
+		StripeWebhookSecret:  os.Getenv("PAYIT_STRIPE_WEBHOOK_SECRET"),
+		PublicURL:            strings.TrimRight(envOrDefault("PAYIT_PUBLIC_URL", defaultPublicURL), "/"),
+		CheckoutSessionTTL:   defaultCheckoutSessionTTL,
+		AuditLogPath:         envOrDefault("PAYIT_AUDIT_LOG", DefaultAuditLogPath),
+		AuditKey:             strings.TrimSpace(os.Getenv("PAYIT_AUDIT_KEY")),
+		StateDir:             envOrDefault("PAYIT_STATE_DIR", DefaultStateDir),
 		Product: ProductConfig{
+			SKU:         envOrDefault("PAYIT_PRODUCT_SKU", defaultProductSKU),
 			Name:        os.Getenv("PAYIT_PRODUCT_NAME"),
 			Description: os.Getenv("PAYIT_PRODUCT_DESCRIPTION"),
 			Currency:    os.Getenv("PAYIT_PRODUCT_CURRENCY"),
@@ -54,9 +131,244 @@ func Load() (Config, error) {
 	}
 	cfg.Product.PriceCents = price
 
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_ALLOW_PROMOTION_CODES")); raw != "" {
+		allow, err := strconv.ParseBool(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("PAYIT_ALLOW_PROMOTION_CODES must be a boolean: %w", err)
+		}
+		cfg.AllowPromotionCodes = allow
+	}
+
+	if path := strings.TrimSpace(os.Getenv("PAYIT_COUPONS_FILE")); path != "" {
+		coupons, err := loadCoupons(path)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Coupons = coupons
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_PRODUCT_PHYSICAL")); raw != "" {
+		physical, err := strconv.ParseBool(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("PAYIT_PRODUCT_PHYSICAL must be a boolean: %w", err)
+		}
+		cfg.Product.Physical = physical
+	}
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_PRODUCT_WEIGHT_GRAMS")); raw != "" {
+		weight, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || weight < 0 {
+			return Config{}, fmt.Errorf("PAYIT_PRODUCT_WEIGHT_GRAMS must be a non-negative integer")
+		}
+		cfg.Product.WeightGrams = weight
+	}
+
+	if err := loadQuantityBounds(&cfg.Product); err != nil {
+		return Config{}, err
+	}
+	limitsCfg, err := loadLimits(cfg.Product)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Limits = limitsCfg
+
+	shippingCfg, err := loadShipping(cfg.Product.Physical)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Shipping = shippingCfg
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_CHECKOUT_SESSION_TTL")); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("PAYIT_CHECKOUT_SESSION_TTL must be a duration: %w", err)
+		}
+		if ttl < minCheckoutSessionTTL || ttl > maxCheckoutSessionTTL {
+			return Config{}, fmt.Errorf("PAYIT_CHECKOUT_SESSION_TTL must be between %s and %s", minCheckoutSessionTTL, maxCheckoutSessionTTL)
+		}
+		cfg.CheckoutSessionTTL = ttl
+	}
+
+	if path := strings.TrimSpace(os.Getenv("PAYIT_INVENTORY_FILE")); path != "" {
+		inventory, err := loadInventory(path)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Inventory = inventory
+	}
+
+	taxCfg, err := loadTax()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Tax = taxCfg
+
+	mailCfg, err := loadMail()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Mail = mailCfg
+
+	paypalCfg, err := loadPayPal()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.PayPal = paypalCfg
+
+	routes, err := loadRoutes()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Routes = routes
+
+	resilienceCfg, err := loadResilience()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Resilience = resilienceCfg
+
+	eventWebhookCfg, err := loadEventWebhook()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.EventWebhook = eventWebhookCfg
+
+	switch ui := strings.ToLower(envOrDefault("PAYIT_CHECKOUT_UI", CheckoutUIHosted)); ui {
+	case CheckoutUIHosted, CheckoutUIEmbedded, CheckoutUIElements:
+		cfg.CheckoutUI = ui
+	default:
+		return Config{}, fmt.Errorf("PAYIT_CHECKOUT_UI must be %s, %s or %s", CheckoutUIHosted, CheckoutUIEmbedded, CheckoutUIElements)
+	}
+
+	switch method := strings.ToLower(envOrDefault("PAYIT_CAPTURE_METHOD", "automatic")); method {
+	case "automatic":
+	case "manual":
+		cfg.ManualCapture = true
+	default:
+		return Config{}, fmt.Errorf("PAYIT_CAPTURE_METHOD must be automatic or manual")
+	}
+
+	adminCfg, err := loadAdmin()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Admin = adminCfg
+
+	if cfg.Accounts, err = loadAccounts(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Metering, err = loadMetering(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Dunning, err = loadDunning(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.AuditKey != "" && len(cfg.AuditKey) < minAuditKey {
+		return Config{}, fmt.Errorf("PAYIT_AUDIT_KEY must be at least %d characters", minAuditKey)
+	}
+
 	return cfg, nil
 }
 
+// Checkout page modes accepted by PAYIT_CHECKOUT_UI.
+const (
+	CheckoutUIHosted   = "hosted"
+	CheckoutUIEmbedded = "embedded"
+	CheckoutUIElements = "elements"
+)
+
+// DefaultAuditLogPath is where the audit trail is kept unless PAYIT_AUDIT_LOG says otherwise.
+const DefaultAuditLogPath = "data/audit.log"
+
+// DefaultStateDir is where payit keeps its state unless PAYIT_STATE_DIR says otherwise.
+const DefaultStateDir = "data"
+
+// Files payit keeps in StateDir.
+const (
+	CouponsStateFile   = "coupons.json"
+	InventoryStateFile = "inventory.json"
+	MeteringStateFile  = "metering.json"
+	// OrdersStateFile also holds customers and subscriptions.
+	OrdersStateFile = "orders.json"
+)
+
+// StatePath returns where the state file name is kept.
+func (c Config) StatePath(name string) string {
+	return filepath.Join(c.StateDir, name)
+}
+
+const (
+	defaultProductSKU = "demo"
+	defaultPublicURL  = "http://localhost:8080"
+	minAuditKey       = 32
+
+	// Stripe accepts Checkout Session expiries between 30 minutes and 24 hours.
+	minCheckoutSessionTTL     = 30 * time.Minute
+	maxCheckoutSessionTTL     = 24 * time.Hour
+	defaultCheckoutSessionTTL = maxCheckoutSessionTTL
+)
+
+func envOrDefault(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func loadInventory(path string) (map[string]int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("PAYIT_INVENTORY_FILE could not be read: %w", err)
+	}
+
+	var stock map[string]int64
+	if err := json.Unmarshal(data, &stock); err != nil {
+		return nil, fmt.Errorf("PAYIT_INVENTORY_FILE must contain a JSON object of SKU to units: %w", err)
+	}
+	for sku, units := range stock {
+		if units < 0 {
+			return nil, fmt.Errorf("inventory %s: units must not be negative", sku)
+		}
+	}
+
+	return stock, nil
+}
+
+func loadCoupons(path string) ([]CouponConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("PAYIT_COUPONS_FILE could not be read: %w", err)
+	}
+
+	var coupons []CouponConfig
+	if err := json.Unmarshal(data, &coupons); err != nil {
+		return nil, fmt.Errorf("PAYIT_COUPONS_FILE must contain a JSON array of coupons: %w", err)
+	}
+
+	seen := make(map[string]bool, len(coupons))
+	for i, c := range coupons {
+		code := strings.ToUpper(strings.TrimSpace(c.Code))
+		switch {
+		case code == "":
+			return nil, fmt.Errorf("coupon %d: code is required", i)
+		case seen[code]:
+			return nil, fmt.Errorf("coupon %s: duplicate code", code)
+		case (c.PercentOff > 0) == (c.AmountOffCents > 0):
+			return nil, fmt.Errorf("coupon %s: exactly one of percent_off or amount_off_cents must be set", code)
+		case c.PercentOff < 0 || c.PercentOff > 100:
+			return nil, fmt.Errorf("coupon %s: percent_off must be between 1 and 100", code)
+		case c.AmountOffCents < 0 || c.MaxRedemptions < 0 || c.MinimumAmountCents < 0:
+			return nil, fmt.Errorf("coupon %s: amounts and limits must not be negative", code)
+		}
+		seen[code] = true
+		coupons[i].Code = code
+	}
+
+	return coupons, nil
+}
+
 func loadDotEnv() error {
 	filename := ".env.local"
 	relPaths := []string{
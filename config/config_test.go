@@ -1,8 +1,11 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadSuccess(t *testing.T) {
@@ -59,6 +62,58 @@ func TestLoadInvalidPrice(t *testing.T) {
 	}
 }
 
+func TestLoadPromotionSettings(t *testing.T) {
+	setRequiredEnv(t)
+	path := filepath.Join(t.TempDir(), "coupons.json")
+	coupons := `[{"code":" launch ","percent_off":20,"expires_at":"2030-01-01T00:00:00Z","skus":["demo"]}]`
+	if err := os.WriteFile(path, []byte(coupons), 0o600); err != nil {
+		t.Fatalf("failed to write coupons: %v", err)
+	}
+	t.Setenv("PAYIT_COUPONS_FILE", path)
+	t.Setenv("PAYIT_ALLOW_PROMOTION_CODES", "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.AllowPromotionCodes {
+		t.Fatal("expected promotion codes to be allowed")
+	}
+	if len(cfg.Coupons) != 1 || cfg.Coupons[0].Code != "LAUNCH" || cfg.Coupons[0].PercentOff != 20 {
+		t.Fatalf("unexpected coupons: %#v", cfg.Coupons)
+	}
+	if cfg.Product.SKU != "demo" {
+		t.Fatalf("expected default SKU, got %q", cfg.Product.SKU)
+	}
+}
+
+func TestLoadRejectsAmbiguousCoupon(t *testing.T) {
+	setRequiredEnv(t)
+	path := filepath.Join(t.TempDir(), "coupons.json")
+	if err := os.WriteFile(path, []byte(`[{"code":"BOTH","percent_off":10,"amount_off_cents":100}]`), 0o600); err != nil {
+		t.Fatalf("failed to write coupons: %v", err)
+	}
+	t.Setenv("PAYIT_COUPONS_FILE", path)
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "BOTH") {
+		t.Fatalf("expected coupon validation error, got %v", err)
+	}
+}
+
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("PAYIT_STRIPE_SECRET_KEY", "sk_test")
+	t.Setenv("PAYIT_STRIPE_PUBLISHABLE_KEY", "pk_test")
+	t.Setenv("PAYIT_PRODUCT_NAME", "Demo product")
+	t.Setenv("PAYIT_PRODUCT_DESCRIPTION", "Great product")
+	t.Setenv("PAYIT_PRODUCT_PRICE_CENTS", "2500")
+	t.Setenv("PAYIT_PRODUCT_CURRENCY", "usd")
+	t.Setenv("PAYIT_PRODUCT_SUCCESS_URL", "https://example.com/success")
+	t.Setenv("PAYIT_PRODUCT_CANCEL_URL", "https://example.com/cancel")
+}
+
 func clearAllEnv(t *testing.T) {
 	t.Helper()
 	envs := []string{
@@ -75,3 +130,448 @@ func clearAllEnv(t *testing.T) {
 		t.Setenv(env, "")
 	}
 }
+
+func TestLoadLocalTaxRequiresOrigin(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("PAYIT_TAX_MODE", "local")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "PAYIT_TAX_ORIGIN_COUNTRY") {
+		t.Fatalf("expected origin country error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_TAX_ORIGIN_COUNTRY", "fr")
+	t.Setenv("PAYIT_TAX_PRICES_INCLUDE_TAX", "true")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Tax.DefaultCountry != "FR" || !cfg.Tax.PricesIncludeTax || len(cfg.Tax.Rates) == 0 {
+		t.Fatalf("unexpected tax config: %#v", cfg.Tax)
+	}
+}
+
+func TestLoadPhysicalProductRequiresShipping(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("PAYIT_PRODUCT_PHYSICAL", "true")
+	t.Setenv("PAYIT_PRODUCT_WEIGHT_GRAMS", "450")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "PAYIT_SHIPPING_COUNTRIES") {
+		t.Fatalf("expected shipping countries error, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`[{"name":"Standard","amount_cents":500,"free_over_cents":5000}]`), 0o600); err != nil {
+		t.Fatalf("failed to write rates: %v", err)
+	}
+	t.Setenv("PAYIT_SHIPPING_COUNTRIES", "fr, de")
+	t.Setenv("PAYIT_SHIPPING_RATES_FILE", path)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Product.Physical || cfg.Product.WeightGrams != 450 {
+		t.Fatalf("unexpected product: %#v", cfg.Product)
+	}
+	if len(cfg.Shipping.Countries) != 2 || cfg.Shipping.Countries[1] != "DE" || len(cfg.Shipping.Rates) != 1 {
+		t.Fatalf("unexpected shipping config: %#v", cfg.Shipping)
+	}
+}
+
+func TestLoadCheckoutSessionTTL(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("PAYIT_CHECKOUT_SESSION_TTL", "10m")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_CHECKOUT_SESSION_TTL") {
+		t.Fatalf("expected TTL range error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_CHECKOUT_SESSION_TTL", "2h")
+	t.Setenv("PAYIT_PUBLIC_URL", "https://shop.example/")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CheckoutSessionTTL != 2*time.Hour || cfg.PublicURL != "https://shop.example" {
+		t.Fatalf("unexpected config: %v %q", cfg.CheckoutSessionTTL, cfg.PublicURL)
+	}
+}
+
+func TestLoadMailSettings(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("PAYIT_MAIL_TRANSPORT", "smtp")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_SMTP_HOST") {
+		t.Fatalf("expected missing SMTP host error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_SMTP_HOST", "smtp.example.com")
+	t.Setenv("PAYIT_SMTP_PORT", "2525")
+	t.Setenv("PAYIT_MAIL_STAFF", "ops@example.com, finance@example.com")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Mail.SMTPPort != 2525 || len(cfg.Mail.StaffRecipients) != 2 || cfg.Mail.StaffRecipients[1] != "finance@example.com" {
+		t.Fatalf("unexpected mail config: %#v", cfg.Mail)
+	}
+}
+
+func TestLoadEventWebhookRequiresSecret(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("PAYIT_EVENT_WEBHOOK_URL", "https://orders.internal/payit")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_EVENT_WEBHOOK_SECRET") {
+		t.Fatalf("expected missing secret error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_EVENT_WEBHOOK_SECRET", "whsec_local")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.EventWebhook.URL != "https://orders.internal/payit" {
+		t.Fatalf("unexpected event webhook config: %#v", cfg.EventWebhook)
+	}
+}
+
+func TestLoadCaptureMethod(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("PAYIT_CAPTURE_METHOD", "later")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_CAPTURE_METHOD") {
+		t.Fatalf("expected capture method error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_CAPTURE_METHOD", "manual")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.ManualCapture {
+		t.Fatal("expected manual capture to be enabled")
+	}
+}
+
+func TestLoadCheckoutUI(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CheckoutUI != CheckoutUIHosted {
+		t.Fatalf("expected hosted checkout by default, got %q", cfg.CheckoutUI)
+	}
+
+	t.Setenv("PAYIT_CHECKOUT_UI", "popup")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_CHECKOUT_UI") {
+		t.Fatalf("expected checkout UI error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_CHECKOUT_UI", "Embedded")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CheckoutUI != CheckoutUIEmbedded {
+		t.Fatalf("expected embedded checkout, got %q", cfg.CheckoutUI)
+	}
+
+	t.Setenv("PAYIT_CHECKOUT_UI", "elements")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CheckoutUI != CheckoutUIElements {
+		t.Fatalf("expected Elements checkout, got %q", cfg.CheckoutUI)
+	}
+}
+
+func TestLoadAdminCredentials(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("PAYIT_ADMIN_PASSWORD_HASH", "plain-text")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "bcrypt") {
+		t.Fatalf("expected bcrypt hash error, got %v", err)
+	}
+
+	dir := t.TempDir()
+	keysPath := filepath.Join(dir, "keys.json")
+	if err := os.WriteFile(keysPath, []byte(`[{"id": "bot", "hash": "sha256:abc", "scopes": ["orders:read"]}]`), 0o600); err != nil {
+		t.Fatalf("write keys: %v", err)
+	}
+	t.Setenv("PAYIT_ADMIN_PASSWORD_HASH", "$2a$10$abcdefghijklmnopqrstuv")
+	t.Setenv("PAYIT_API_KEYS_FILE", keysPath)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Admin.Users) != 1 || cfg.Admin.Users[0].Username != "admin" {
+		t.Fatalf("unexpected users: %#v", cfg.Admin.Users)
+	}
+	if len(cfg.Admin.APIKeys) != 1 || cfg.Admin.APIKeys[0].ID != "bot" || cfg.Admin.SessionTTL != 12*time.Hour {
+		t.Fatalf("unexpected admin config: %#v", cfg.Admin)
+	}
+}
+
+func TestRedactedMasksSecrets(t *testing.T) {
+	cfg := Config{
+		StripeSecretKey: "sk_test_123",
+		Mail:            MailConfig{SMTPPassword: "hunter2"},
+		PayPal:          PayPalConfig{ClientID: "client", ClientSecret: "paypal-secret"},
+		Accounts:        AccountConfig{SigningKey: strings.Repeat("k", 32)},
+		AuditKey:        strings.Repeat("a", 32),
+		Admin: AdminConfig{
+			Users: []AdminUserConfig{{Username: "admin", PasswordHash: "$2a$10$abc"}},
+		},
+	}
+
+	out := cfg.Redacted()
+	if out.StripeSecretKey != redacted || out.Mail.SMTPPassword != redacted || out.PayPal.ClientSecret != redacted || out.Accounts.SigningKey != redacted || out.AuditKey != redacted || out.Admin.Users[0].PasswordHash != redacted {
+		t.Fatalf("expected secrets to be redacted: %#v", out)
+	}
+	if out.StripeWebhookSecret != "" {
+		t.Fatalf("expected unset secrets to stay empty, got %q", out.StripeWebhookSecret)
+	}
+	if cfg.Admin.Users[0].PasswordHash != "$2a$10$abc" {
+		t.Fatal("expected the original configuration to be left untouched")
+	}
+}
+
+func TestLoadResilience(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Resilience.CallTimeout != 2*time.Second || cfg.Resilience.MaxRetries != 2 || cfg.Resilience.BreakerThreshold != 5 {
+		t.Fatalf("unexpected defaults: %#v", cfg.Resilience)
+	}
+
+	t.Setenv("PAYIT_PROVIDER_TIMEOUT", "500ms")
+	t.Setenv("PAYIT_PROVIDER_MAX_RETRIES", "0")
+	t.Setenv("PAYIT_PROVIDER_BREAKER_COOLDOWN", "1m")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Resilience.CallTimeout != 500*time.Millisecond || cfg.Resilience.MaxRetries != 0 || cfg.Resilience.BreakerCooldown != time.Minute {
+		t.Fatalf("unexpected resilience config: %#v", cfg.Resilience)
+	}
+
+	t.Setenv("PAYIT_PROVIDER_BREAKER_THRESHOLD", "0")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_PROVIDER_BREAKER_THRESHOLD") {
+		t.Fatalf("expected threshold error, got %v", err)
+	}
+}
+
+func TestLoadResilienceRejectsCallsOutlastingTheWriteTimeout(t *testing.T) {
+	setRequiredEnv(t)
+	// Three 4s attempts overrun the 9s request timeout.
+	t.Setenv("PAYIT_PROVIDER_TIMEOUT", "4s")
+	t.Setenv("PAYIT_PROVIDER_MAX_RETRIES", "2")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "write timeout") {
+		t.Fatalf("expected the retry budget to be rejected, got %v", err)
+	}
+
+	t.Setenv("PAYIT_PROVIDER_MAX_RETRIES", "1")
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected two 4s attempts to fit, got %v", err)
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	setRequiredEnv(t)
+	path := filepath.Join(t.TempDir(), "routes.json")
+	routes := `[{"provider":" Stripe ","currencies":["EUR"],"countries":["fr"],"weight":1},{"provider":"backup"}]`
+	if err := os.WriteFile(path, []byte(routes), 0o600); err != nil {
+		t.Fatalf("failed to write routes: %v", err)
+	}
+	t.Setenv("PAYIT_ROUTES_FILE", path)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Routes) != 2 || cfg.Routes[0].Provider != "stripe" || cfg.Routes[0].Currencies[0] != "eur" || cfg.Routes[0].Countries[0] != "FR" {
+		t.Fatalf("unexpected routes: %#v", cfg.Routes)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"provider":"stripe","min_amount_cents":500,"max_amount_cents":100}]`), 0o600); err != nil {
+		t.Fatalf("failed to write routes: %v", err)
+	}
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "max_amount_cents") {
+		t.Fatalf("expected amount range error, got %v", err)
+	}
+}
+
+func TestLoadPayPal(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("PAYIT_PAYPAL_CLIENT_ID", "client")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_PAYPAL_CLIENT_SECRET") {
+		t.Fatalf("expected missing secret error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_PAYPAL_CLIENT_SECRET", "secret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.PayPal.Enabled() || cfg.PayPal.APIURL != PayPalSandboxURL {
+		t.Fatalf("expected sandbox PayPal, got %#v", cfg.PayPal)
+	}
+
+	t.Setenv("PAYIT_PAYPAL_ENV", "live")
+	if cfg, err = Load(); err != nil || cfg.PayPal.APIURL != PayPalLiveURL {
+		t.Fatalf("expected live PayPal, got %#v, %v", cfg.PayPal, err)
+	}
+}
+
+func TestLoadLimits(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Product.MinQuantity != 1 || cfg.Product.MaxQuantity != 1000 || cfg.Limits.MaxOrderTotalCents != 99_999_999 {
+		t.Fatalf("unexpected defaults: %#v %#v", cfg.Product, cfg.Limits)
+	}
+
+	t.Setenv("PAYIT_PRODUCT_MAX_QUANTITY", "5")
+	t.Setenv("PAYIT_MAX_ORDER_TOTAL_CENTS", "10000")
+	t.Setenv("PAYIT_ALLOWED_CURRENCIES", " USD , eur")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Product.MaxQuantity != 5 || cfg.Limits.MaxOrderTotalCents != 10000 || len(cfg.Limits.Currencies) != 2 || cfg.Limits.Currencies[0] != "usd" {
+		t.Fatalf("unexpected limits: %#v %#v", cfg.Product, cfg.Limits)
+	}
+
+	t.Setenv("PAYIT_PRODUCT_MIN_QUANTITY", "10")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_PRODUCT_MIN_QUANTITY") {
+		t.Fatalf("expected quantity range error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_PRODUCT_MIN_QUANTITY", "")
+	t.Setenv("PAYIT_ALLOWED_CURRENCIES", "eur")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_ALLOWED_CURRENCIES") {
+		t.Fatalf("expected currency error, got %v", err)
+	}
+}
+
+func TestLoadAccounts(t *testing.T) {
+	setRequiredEnv(t)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Accounts.Enabled || cfg.Accounts.SigningKey != "" || cfg.Accounts.LinkTTL != 15*time.Minute || cfg.Accounts.SessionTTL != 30*24*time.Hour {
+		t.Fatalf("unexpected defaults: %#v", cfg.Accounts)
+	}
+
+	t.Setenv("PAYIT_ACCOUNT_SIGNING_KEY", "short")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_ACCOUNT_SIGNING_KEY") {
+		t.Fatalf("expected signing key error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_ACCOUNT_SIGNING_KEY", strings.Repeat("k", 32))
+	t.Setenv("PAYIT_ACCOUNT_LINK_TTL", "5m")
+	t.Setenv("PAYIT_ACCOUNTS", "true")
+	if cfg, err = Load(); err != nil || !cfg.Accounts.Enabled || cfg.Accounts.LinkTTL != 5*time.Minute {
+		t.Fatalf("unexpected accounts config: %#v, %v", cfg.Accounts, err)
+	}
+
+	t.Setenv("PAYIT_ACCOUNT_SESSION_TTL", "-1h")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_ACCOUNT_SESSION_TTL") {
+		t.Fatalf("expected session TTL error, got %v", err)
+	}
+}
+
+func TestLoadAuditKey(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("PAYIT_AUDIT_KEY", "short")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PAYIT_AUDIT_KEY") {
+		t.Fatalf("expected audit key error, got %v", err)
+	}
+
+	t.Setenv("PAYIT_AUDIT_KEY", strings.Repeat("a", 32))
+	if cfg, err := Load(); err != nil || cfg.AuditKey != strings.Repeat("a", 32) {
+		t.Fatalf("unexpected audit key: %q, %v", cfg.AuditKey, err)
+	}
+}
+
+func TestLoadMetering(t *testing.T) {
+	setRequiredEnv(t)
+	path := filepath.Join(t.TempDir(), "metered.json")
+	prices := `[{"meter":"api_requests","name":"API requests","unit_amount_decimal":"0.05","currency":"USD","stripe_price_id":"price_1","stripe_meter_id":"mtr_1","trial_days":14,"trial_without_card":true}]`
+	if err := os.WriteFile(path, []byte(prices), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PAYIT_METERED_PRICES_FILE", path)
+	t.Setenv("PAYIT_USAGE_FLUSH_INTERVAL", "30s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	price, ok := cfg.Metering.Price("api_requests")
+	if !ok || price.Currency != "usd" || price.Interval != "month" || price.TrialDays != 14 || !price.TrialWithoutCard || cfg.Metering.FlushInterval != 30*time.Second {
+		t.Fatalf("unexpected metering config: %#v", cfg.Metering)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"meter":"api_requests","unit_amount_decimal":"a lot","currency":"usd","stripe_price_id":"price_1","stripe_meter_id":"mtr_1"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "unit_amount_decimal") {
+		t.Fatalf("expected unit amount error, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"meter":"api_requests","unit_amount_decimal":"1","currency":"usd","stripe_price_id":"price_1","stripe_meter_id":"mtr_1","trial_without_card":true}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "trial_without_card") {
+		t.Fatalf("expected a cardless trial without trial days to be rejected, got %v", err)
+	}
+}
+
+func TestLoadDunning(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Dunning.Reminders) != 2 || cfg.Dunning.GracePeriod != 14*24*time.Hour || cfg.Dunning.FinalAction != DunningFinalNone || cfg.Dunning.Enabled || cfg.Dunning.JobsPath != DefaultJobsPath {
+		t.Fatalf("unexpected default dunning config: %#v", cfg.Dunning)
+	}
+
+	t.Setenv("PAYIT_DUNNING_REMINDERS", "48h, 24h")
+	t.Setenv("PAYIT_DUNNING_GRACE_PERIOD", "72h")
+	t.Setenv("PAYIT_DUNNING_FINAL_ACTION", "downgrade")
+	t.Setenv("PAYIT_DUNNING_DOWNGRADE_PRICE", "price_free")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Dunning.Reminders[0] != 24*time.Hour || cfg.Dunning.Reminders[1] != 48*time.Hour || cfg.Dunning.DowngradePriceID != "price_free" {
+		t.Fatalf("unexpected dunning config: %#v", cfg.Dunning)
+	}
+
+	cases := map[string][2]string{
+		"reminder after grace": {"PAYIT_DUNNING_REMINDERS", "96h"},
+		"unknown action":       {"PAYIT_DUNNING_FINAL_ACTION", "pause"},
+		"missing price":        {"PAYIT_DUNNING_DOWNGRADE_PRICE", ""},
+	}
+	for name, env := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(env[0], env[1])
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected %s=%q to be rejected", env[0], env[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Final actions taken on a subscription whose renewal stays unpaid through
+// the dunning grace period.
+const (
+	DunningFinalCancel    = "cancel"
+	DunningFinalDowngrade = "downgrade"
+	// DunningFinalNone only sends reminders and leaves the subscription to
+	// the provider's own retry settings.
+	DunningFinalNone = "none"
+)
+
+// DunningConfig schedules how payit chases a failed subscription renewal.
+type DunningConfig struct {
+	// Enabled turns dunning and its job queue on. It is off unless
+	// PAYIT_DUNNING is set.
+	Enabled bool
+	// Reminders are when reminder emails are sent, counted from the failed
+	// payment. The customer is told about the failure itself right away.
+	Reminders []time.Duration
+	// GracePeriod is how long, from the failed payment, the subscriber keeps
+	// access before FinalAction is taken.
+	GracePeriod time.Duration
+	FinalAction string
+	// DowngradePriceID is the Stripe price subscriptions move to when
+	// FinalAction is DunningFinalDowngrade.
+	DowngradePriceID string
+	// JobsPath is the file holding scheduled dunning steps, so that they
+	// still run after a restart.
+	JobsPath string
+}
+
+// DefaultJobsPath is where scheduled jobs are kept unless PAYIT_JOBS_FILE says otherwise.
+const DefaultJobsPath = "data/jobs.json"
+
+const (
+	defaultDunningReminders   = "72h,168h"
+	defaultDunningGracePeriod = 14 * 24 * time.Hour
+)
+
+func loadDunning() (DunningConfig, error) {
+	cfg := DunningConfig{
+		GracePeriod:      defaultDunningGracePeriod,
+		FinalAction:      strings.ToLower(envOrDefault("PAYIT_DUNNING_FINAL_ACTION", DunningFinalNone)),
+		DowngradePriceID: strings.TrimSpace(os.Getenv("PAYIT_DUNNING_DOWNGRADE_PRICE")),
+		JobsPath:         envOrDefault("PAYIT_JOBS_FILE", DefaultJobsPath),
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_DUNNING")); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return DunningConfig{}, fmt.Errorf("PAYIT_DUNNING must be a boolean: %w", err)
+		}
+		cfg.Enabled = enabled
+	}
+
+	for _, raw := range strings.Split(envOrDefault("PAYIT_DUNNING_REMINDERS", defaultDunningReminders), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		after, err := time.ParseDuration(raw)
+		if err != nil || after <= 0 {
+			return DunningConfig{}, fmt.Errorf("PAYIT_DUNNING_REMINDERS must list positive durations, got %q", raw)
+		}
+		cfg.Reminders = append(cfg.Reminders, after)
+	}
+	slices.Sort(cfg.Reminders)
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_DUNNING_GRACE_PERIOD")); raw != "" {
+		grace, err := time.ParseDuration(raw)
+		if err != nil || grace <= 0 {
+			return DunningConfig{}, fmt.Errorf("PAYIT_DUNNING_GRACE_PERIOD must be a positive duration")
+		}
+		cfg.GracePeriod = grace
+	}
+	if n := len(cfg.Reminders); n > 0 && cfg.Reminders[n-1] >= cfg.GracePeriod {
+		return DunningConfig{}, fmt.Errorf("PAYIT_DUNNING_REMINDERS must all fall within PAYIT_DUNNING_GRACE_PERIOD")
+	}
+
+	switch cfg.FinalAction {
+	case DunningFinalCancel, DunningFinalNone:
+	case DunningFinalDowngrade:
+		if cfg.DowngradePriceID == "" {
+			return DunningConfig{}, fmt.Errorf("PAYIT_DUNNING_DOWNGRADE_PRICE is required when PAYIT_DUNNING_FINAL_ACTION is downgrade")
+		}
+	default:
+		return DunningConfig{}, fmt.Errorf("PAYIT_DUNNING_FINAL_ACTION must be cancel, downgrade or none")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LimitsConfig bounds what a single checkout may ask for, on top of each
+// product's quantity range.
+type LimitsConfig struct {
+	// MaxOrderTotalCents caps the total of one order, tax included.
+	MaxOrderTotalCents int64
+	// Currencies lists the lowercase ISO 4217 codes orders may be charged
+	// in; empty allows any.
+	Currencies []string
+}
+
+const (
+	defaultMinQuantity = 1
+	defaultMaxQuantity = 1000
+	// defaultMaxOrderTotalCents is the largest amount Stripe charges in one
+	// payment for most currencies.
+	defaultMaxOrderTotalCents = 99_999_999
+)
+
+// loadQuantityBounds reads the quantity range a checkout for product may ask for.
+func loadQuantityBounds(product *ProductConfig) error {
+	product.MinQuantity = defaultMinQuantity
+	product.MaxQuantity = defaultMaxQuantity
+	bounds := []struct {
+		name string
+		dst  *int64
+	}{
+		{"PAYIT_PRODUCT_MIN_QUANTITY", &product.MinQuantity},
+		{"PAYIT_PRODUCT_MAX_QUANTITY", &product.MaxQuantity},
+	}
+	for _, b := range bounds {
+		if raw := strings.TrimSpace(os.Getenv(b.name)); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 1 {
+				return fmt.Errorf("%s must be a positive integer", b.name)
+			}
+			*b.dst = n
+		}
+	}
+	if product.MinQuantity > product.MaxQuantity {
+		return fmt.Errorf("PAYIT_PRODUCT_MIN_QUANTITY must not exceed PAYIT_PRODUCT_MAX_QUANTITY")
+	}
+	return nil
+}
+
+// loadLimits reads the per-order caps, which must allow the product's own
+// currency.
+func loadLimits(product ProductConfig) (LimitsConfig, error) {
+	cfg := LimitsConfig{MaxOrderTotalCents: defaultMaxOrderTotalCents}
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_MAX_ORDER_TOTAL_CENTS")); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			return LimitsConfig{}, fmt.Errorf("PAYIT_MAX_ORDER_TOTAL_CENTS must be a positive integer")
+		}
+		cfg.MaxOrderTotalCents = n
+	}
+
+	for _, code := range strings.Split(os.Getenv("PAYIT_ALLOWED_CURRENCIES"), ",") {
+		if code = strings.ToLower(strings.TrimSpace(code)); code != "" {
+			cfg.Currencies = append(cfg.Currencies, code)
+		}
+	}
+	if len(cfg.Currencies) > 0 && !slices.Contains(cfg.Currencies, strings.ToLower(product.Currency)) {
+		return LimitsConfig{}, fmt.Errorf("PAYIT_ALLOWED_CURRENCIES must include the product currency %s", product.Currency)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Mail transports accepted by PAYIT_MAIL_TRANSPORT.
+const (
+	MailTransportLog  = "log"
+	MailTransportFile = "file"
+	MailTransportSMTP = "smtp"
+)
+
+// MailConfig controls outgoing customer emails and staff alerts.
+type MailConfig struct {
+	Transport       string
+	From            string
+	BrandName       string
+	StaffRecipients []string
+	// Dir is where the file transport writes messages.
+	Dir          string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+func loadMail() (MailConfig, error) {
+	cfg := MailConfig{
+		Transport:    strings.ToLower(envOrDefault("PAYIT_MAIL_TRANSPORT", MailTransportLog)),
+		From:         envOrDefault("PAYIT_MAIL_FROM", "PayIt <no-reply@localhost>"),
+		BrandName:    envOrDefault("PAYIT_BRAND_NAME", "PayIt"),
+		Dir:          envOrDefault("PAYIT_MAIL_DIR", "tmp/mail"),
+		SMTPHost:     os.Getenv("PAYIT_SMTP_HOST"),
+		SMTPPort:     587,
+		SMTPUsername: os.Getenv("PAYIT_SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("PAYIT_SMTP_PASSWORD"),
+	}
+
+	for _, addr := range strings.Split(os.Getenv("PAYIT_MAIL_STAFF"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.StaffRecipients = append(cfg.StaffRecipients, addr)
+		}
+	}
+
+	switch cfg.Transport {
+	case MailTransportLog, MailTransportFile:
+	case MailTransportSMTP:
+		if cfg.SMTPHost == "" {
+			return MailConfig{}, fmt.Errorf("PAYIT_SMTP_HOST is required when PAYIT_MAIL_TRANSPORT is %s", MailTransportSMTP)
+		}
+		if raw := strings.TrimSpace(os.Getenv("PAYIT_SMTP_PORT")); raw != "" {
+			port, err := strconv.Atoi(raw)
+			if err != nil || port <= 0 || port > 65535 {
+				return MailConfig{}, fmt.Errorf("PAYIT_SMTP_PORT must be a valid port number")
+			}
+			cfg.SMTPPort = port
+		}
+	default:
+		return MailConfig{}, fmt.Errorf("PAYIT_MAIL_TRANSPORT must be one of %s, %s or %s", MailTransportLog, MailTransportFile, MailTransportSMTP)
+	}
+
+	return cfg, nil
+}
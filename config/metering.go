@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MeteredPriceConfig is a usage-based subscription price: customers are
+// billed per unit of a meter they use during each interval.
+type MeteredPriceConfig struct {
+	// Meter names what is counted, such as "api_requests". It is the event
+	// name of the Stripe meter and what usage records refer to.
+	Meter string `json:"meter"`
+	Name  string `json:"name"`
+	// UnitAmountDecimal is the price of one unit in cents and may be
+	// fractional, such as "0.05".
+	UnitAmountDecimal string `json:"unit_amount_decimal"`
+	Currency          string `json:"currency"`
+	// Interval is how often usage is billed: day, week, month or year.
+	Interval      string `json:"interval,omitempty"`
+	StripePriceID string `json:"stripe_price_id"`
+	// StripeMeterID is read back from to reconcile reported usage.
+	StripeMeterID string `json:"stripe_meter_id"`
+	// TrialDays gives new subscribers that many free days before billing
+	// starts.
+	TrialDays int64 `json:"trial_days,omitempty"`
+	// TrialWithoutCard lets buyers start the trial without a payment method;
+	// trials that end with none on file are canceled.
+	TrialWithoutCard bool `json:"trial_without_card,omitempty"`
+}
+
+// MeteringConfig lists the metered prices and how often recorded usage is
+// reported to the provider.
+type MeteringConfig struct {
+	Prices        []MeteredPriceConfig
+	FlushInterval time.Duration
+}
+
+// Price returns the metered price for meter.
+func (c MeteringConfig) Price(meter string) (MeteredPriceConfig, bool) {
+	i := slices.IndexFunc(c.Prices, func(p MeteredPriceConfig) bool { return p.Meter == meter })
+	if i < 0 {
+		return MeteredPriceConfig{}, false
+	}
+	return c.Prices[i], true
+}
+
+const defaultUsageFlushInterval = time.Minute
+
+// maxTrialDays is the longest trial Stripe accepts.
+const maxTrialDays = 730
+
+var billingIntervals = []string{"day", "week", "month", "year"}
+
+func loadMetering() (MeteringConfig, error) {
+	cfg := MeteringConfig{FlushInterval: defaultUsageFlushInterval}
+
+	if path := strings.TrimSpace(os.Getenv("PAYIT_METERED_PRICES_FILE")); path != "" {
+		if err := readJSONFile("PAYIT_METERED_PRICES_FILE", path, &cfg.Prices); err != nil {
+			return MeteringConfig{}, err
+		}
+	}
+	seen := make(map[string]bool, len(cfg.Prices))
+	for i := range cfg.Prices {
+		p := &cfg.Prices[i]
+		p.Currency = strings.ToLower(p.Currency)
+		if p.Interval == "" {
+			p.Interval = "month"
+		}
+		amount, err := strconv.ParseFloat(p.UnitAmountDecimal, 64)
+		switch {
+		case p.Meter == "":
+			return MeteringConfig{}, fmt.Errorf("metered price %d: meter is required", i)
+		case seen[p.Meter]:
+			return MeteringConfig{}, fmt.Errorf("metered price %s: duplicate meter", p.Meter)
+		case err != nil || amount < 0:
+			return MeteringConfig{}, fmt.Errorf("metered price %s: unit_amount_decimal must be a non-negative number of cents", p.Meter)
+		case p.Currency == "":
+			return MeteringConfig{}, fmt.Errorf("metered price %s: currency is required", p.Meter)
+		case !slices.Contains(billingIntervals, p.Interval):
+			return MeteringConfig{}, fmt.Errorf("metered price %s: interval must be one of %s", p.Meter, strings.Join(billingIntervals, ", "))
+		case p.StripePriceID == "" || p.StripeMeterID == "":
+			return MeteringConfig{}, fmt.Errorf("metered price %s: stripe_price_id and stripe_meter_id are required", p.Meter)
+		case p.TrialDays < 0 || p.TrialDays > maxTrialDays:
+			return MeteringConfig{}, fmt.Errorf("metered price %s: trial_days must be between 0 and %d", p.Meter, maxTrialDays)
+		case p.TrialWithoutCard && p.TrialDays == 0:
+			return MeteringConfig{}, fmt.Errorf("metered price %s: trial_without_card needs trial_days", p.Meter)
+		}
+		seen[p.Meter] = true
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_USAGE_FLUSH_INTERVAL")); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			return MeteringConfig{}, fmt.Errorf("PAYIT_USAGE_FLUSH_INTERVAL must be a positive duration")
+		}
+		cfg.FlushInterval = interval
+	}
+	return cfg, nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PayPal REST API endpoints selected by PAYIT_PAYPAL_ENV.
+const (
+	PayPalSandboxURL = "https://api-m.sandbox.paypal.com"
+	PayPalLiveURL    = "https://api-m.paypal.com"
+)
+
+// PayPalConfig enables PayPal as a second payment provider. It is disabled
+// when ClientID is empty.
+type PayPalConfig struct {
+	ClientID     string
+	ClientSecret string
+	// WebhookID is the ID PayPal assigned to payit's webhook; the webhook
+	// endpoint is only served when it is set.
+	WebhookID string
+	// APIURL is PayPal's REST endpoint, the sandbox unless PAYIT_PAYPAL_ENV
+	// is "live".
+	APIURL string
+}
+
+// Enabled reports whether PayPal credentials are configured.
+func (c PayPalConfig) Enabled() bool {
+	return c.ClientID != ""
+}
+
+func loadPayPal() (PayPalConfig, error) {
+	cfg := PayPalConfig{
+		ClientID:     strings.TrimSpace(os.Getenv("PAYIT_PAYPAL_CLIENT_ID")),
+		ClientSecret: os.Getenv("PAYIT_PAYPAL_CLIENT_SECRET"),
+		WebhookID:    strings.TrimSpace(os.Getenv("PAYIT_PAYPAL_WEBHOOK_ID")),
+	}
+	switch env := strings.ToLower(strings.TrimSpace(envOrDefault("PAYIT_PAYPAL_ENV", "sandbox"))); env {
+	case "sandbox":
+		cfg.APIURL = PayPalSandboxURL
+	case "live":
+		cfg.APIURL = PayPalLiveURL
+	default:
+		return PayPalConfig{}, fmt.Errorf("PAYIT_PAYPAL_ENV must be sandbox or live, got %q", env)
+	}
+	if cfg.ClientID != "" && cfg.ClientSecret == "" {
+		return PayPalConfig{}, fmt.Errorf("PAYIT_PAYPAL_CLIENT_SECRET is required when PAYIT_PAYPAL_CLIENT_ID is set")
+	}
+	return cfg, nil
+}
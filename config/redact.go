@@ -0,0 +1,35 @@
+package config
+
+import "slices"
+
+// redacted replaces secret values in printed configuration.
+const redacted = "[redacted]"
+
+// Redacted returns a copy of c that is safe to print: keys, passwords and
+// signing secrets are masked, leaving only whether they are set.
+func (c Config) Redacted() Config {
+	c.StripeSecretKey = redact(c.StripeSecretKey)
+	c.StripeWebhookSecret = redact(c.StripeWebhookSecret)
+	c.Mail.SMTPPassword = redact(c.Mail.SMTPPassword)
+	c.EventWebhook.Secret = redact(c.EventWebhook.Secret)
+	c.PayPal.ClientSecret = redact(c.PayPal.ClientSecret)
+	c.Accounts.SigningKey = redact(c.Accounts.SigningKey)
+	c.AuditKey = redact(c.AuditKey)
+
+	c.Admin.Users = slices.Clone(c.Admin.Users)
+	for i := range c.Admin.Users {
+		c.Admin.Users[i].PasswordHash = redact(c.Admin.Users[i].PasswordHash)
+	}
+	c.Admin.APIKeys = slices.Clone(c.Admin.APIKeys)
+	for i := range c.Admin.APIKeys {
+		c.Admin.APIKeys[i].Hash = redact(c.Admin.APIKeys[i].Hash)
+	}
+	return c
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
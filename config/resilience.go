@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerWriteTimeout bounds how long payit's HTTP server takes to answer a
+// request, provider calls included.
+const ServerWriteTimeout = 10 * time.Second
+
+// RequestTimeout is the deadline put on the work behind checkout and API
+// requests. It ends before ServerWriteTimeout so that a handler whose
+// provider calls ran out of time can still write its answer.
+const RequestTimeout = ServerWriteTimeout - time.Second
+
+// Retries of provider calls wait ProviderBackoff before the first retry,
+// doubling on every further one up to MaxProviderBackoff.
+const (
+	ProviderBackoff    = 100 * time.Millisecond
+	MaxProviderBackoff = 2 * time.Second
+)
+
+// ResilienceConfig bounds how payit calls payment providers. A retried call
+// must fit inside RequestTimeout.
+type ResilienceConfig struct {
+	// CallTimeout caps a single provider API call.
+	CallTimeout time.Duration
+	// MaxRetries is how often a call failing with a network error, 429 or
+	// 5xx is retried.
+	MaxRetries int
+	// BreakerThreshold consecutive failures open the circuit breaker, which
+	// then fails calls fast for BreakerCooldown before letting one through.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+const (
+	defaultCallTimeout      = 2 * time.Second
+	defaultMaxRetries       = 2
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+func loadResilience() (ResilienceConfig, error) {
+	cfg := ResilienceConfig{
+		CallTimeout:      defaultCallTimeout,
+		MaxRetries:       defaultMaxRetries,
+		BreakerThreshold: defaultBreakerThreshold,
+		BreakerCooldown:  defaultBreakerCooldown,
+	}
+
+	durations := []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"PAYIT_PROVIDER_TIMEOUT", &cfg.CallTimeout},
+		{"PAYIT_PROVIDER_BREAKER_COOLDOWN", &cfg.BreakerCooldown},
+	}
+	for _, d := range durations {
+		if raw := strings.TrimSpace(os.Getenv(d.name)); raw != "" {
+			v, err := time.ParseDuration(raw)
+			if err != nil || v <= 0 {
+				return ResilienceConfig{}, fmt.Errorf("%s must be a positive duration", d.name)
+			}
+			*d.dst = v
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_PROVIDER_MAX_RETRIES")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > 10 {
+			return ResilienceConfig{}, fmt.Errorf("PAYIT_PROVIDER_MAX_RETRIES must be between 0 and 10")
+		}
+		cfg.MaxRetries = n
+	}
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_PROVIDER_BREAKER_THRESHOLD")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return ResilienceConfig{}, fmt.Errorf("PAYIT_PROVIDER_BREAKER_THRESHOLD must be a positive integer")
+		}
+		cfg.BreakerThreshold = n
+	}
+
+	if worst := cfg.MaxCallDuration(); worst > RequestTimeout {
+		return ResilienceConfig{}, fmt.Errorf("PAYIT_PROVIDER_TIMEOUT of %s with %d retries and their backoff can take %s, more than the %s a request may run before the server's write timeout",
+			cfg.CallTimeout, cfg.MaxRetries, worst, RequestTimeout)
+	}
+	return cfg, nil
+}
+
+// MaxCallDuration is how long a provider call can take when every attempt
+// times out: CallTimeout per attempt plus the backoff between them.
+func (c ResilienceConfig) MaxCallDuration() time.Duration {
+	total := c.CallTimeout * time.Duration(c.MaxRetries+1)
+	for attempt := range c.MaxRetries {
+		total += min(ProviderBackoff<<attempt, MaxProviderBackoff)
+	}
+	return total
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RouteConfig sends checkouts matching every set rule to a payment provider.
+// Routes with a weight share traffic in proportion to it; routes without one
+// only serve as backups when the weighted routes are unavailable.
+type RouteConfig struct {
+	Provider string `json:"provider"`
+	// Currencies and Countries, when set, restrict the route to these ISO
+	// codes. A country rule never matches a buyer who gave no country.
+	Currencies []string `json:"currencies,omitempty"`
+	Countries  []string `json:"countries,omitempty"`
+	// MinAmountCents and MaxAmountCents bound the order total; zero leaves a
+	// side open.
+	MinAmountCents int64 `json:"min_amount_cents,omitempty"`
+	MaxAmountCents int64 `json:"max_amount_cents,omitempty"`
+	Weight         int   `json:"weight,omitempty"`
+}
+
+func loadRoutes() ([]RouteConfig, error) {
+	path := strings.TrimSpace(os.Getenv("PAYIT_ROUTES_FILE"))
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("PAYIT_ROUTES_FILE could not be read: %w", err)
+	}
+
+	var routes []RouteConfig
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("PAYIT_ROUTES_FILE must contain a JSON array of routes: %w", err)
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("PAYIT_ROUTES_FILE must list at least one route")
+	}
+
+	for i, r := range routes {
+		provider := strings.ToLower(strings.TrimSpace(r.Provider))
+		switch {
+		case provider == "":
+			return nil, fmt.Errorf("route %d: provider is required", i)
+		case r.Weight < 0:
+			return nil, fmt.Errorf("route %d: weight must not be negative", i)
+		case r.MinAmountCents < 0 || r.MaxAmountCents < 0:
+			return nil, fmt.Errorf("route %d: amounts must not be negative", i)
+		case r.MaxAmountCents > 0 && r.MaxAmountCents < r.MinAmountCents:
+			return nil, fmt.Errorf("route %d: max_amount_cents is below min_amount_cents", i)
+		}
+		routes[i].Provider = provider
+		for j, c := range r.Currencies {
+			routes[i].Currencies[j] = strings.ToLower(strings.TrimSpace(c))
+		}
+		for j, c := range r.Countries {
+			routes[i].Countries[j] = strings.ToUpper(strings.TrimSpace(c))
+		}
+	}
+	return routes, nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ShippingRateConfig is one delivery option from the shipping rate table.
+// A rate costs AmountCents plus PerKgCents for every started kilogram, and is
+// free once the order subtotal reaches FreeOverCents.
+type ShippingRateConfig struct {
+	Name          string `json:"name"`
+	AmountCents   int64  `json:"amount_cents"`
+	PerKgCents    int64  `json:"per_kg_cents,omitempty"`
+	FreeOverCents int64  `json:"free_over_cents,omitempty"`
+	MinDays       int64  `json:"min_days,omitempty"`
+	MaxDays       int64  `json:"max_days,omitempty"`
+}
+
+// ShippingConfig controls address collection and rates for physical products.
+type ShippingConfig struct {
+	Countries []string
+	Rates     []ShippingRateConfig
+}
+
+// maxShippingRates mirrors Stripe Checkout's limit on shipping options.
+const maxShippingRates = 5
+
+func loadShipping(physical bool) (ShippingConfig, error) {
+	var cfg ShippingConfig
+	for _, c := range strings.Split(os.Getenv("PAYIT_SHIPPING_COUNTRIES"), ",") {
+		if c = strings.ToUpper(strings.TrimSpace(c)); c != "" {
+			cfg.Countries = append(cfg.Countries, c)
+		}
+	}
+
+	path := strings.TrimSpace(os.Getenv("PAYIT_SHIPPING_RATES_FILE"))
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return ShippingConfig{}, fmt.Errorf("PAYIT_SHIPPING_RATES_FILE could not be read: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg.Rates); err != nil {
+			return ShippingConfig{}, fmt.Errorf("PAYIT_SHIPPING_RATES_FILE must contain a JSON array of rates: %w", err)
+		}
+		for i, r := range cfg.Rates {
+			if r.Name == "" || r.AmountCents < 0 || r.PerKgCents < 0 || r.FreeOverCents < 0 {
+				return ShippingConfig{}, fmt.Errorf("shipping rate %d: a name and non-negative amounts are required", i)
+			}
+		}
+		if len(cfg.Rates) > maxShippingRates {
+			return ShippingConfig{}, fmt.Errorf("PAYIT_SHIPPING_RATES_FILE may define at most %d rates", maxShippingRates)
+		}
+	}
+
+	if physical {
+		if len(cfg.Countries) == 0 {
+			return ShippingConfig{}, fmt.Errorf("PAYIT_SHIPPING_COUNTRIES is required for physical products")
+		}
+		if len(cfg.Rates) == 0 {
+			return ShippingConfig{}, fmt.Errorf("PAYIT_SHIPPING_RATES_FILE is required for physical products")
+		}
+	}
+
+	return cfg, nil
+}
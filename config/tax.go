@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Tax calculation modes accepted by PAYIT_TAX_MODE.
+const (
+	TaxModeNone   = "none"
+	TaxModeStripe = "stripe"
+	TaxModeLocal  = "local"
+)
+
+// TaxRateConfig is a VAT/GST rate for a country or one of its regions.
+type TaxRateConfig struct {
+	Country         string `json:"country"`
+	Region          string `json:"region,omitempty"`
+	Name            string `json:"name"`
+	RateBasisPoints int64  `json:"rate_basis_points"`
+	// ReverseCharge marks jurisdictions where B2B buyers with a tax ID
+	// self-assess tax on cross-border purchases.
+	ReverseCharge bool `json:"reverse_charge,omitempty"`
+}
+
+// TaxConfig selects and parameterises tax calculation.
+type TaxConfig struct {
+	Mode             string
+	OriginCountry    string
+	DefaultCountry   string
+	PricesIncludeTax bool
+	Rates            []TaxRateConfig
+	// VIESURL, when set, is the VIES service that must confirm a buyer's
+	// VAT number before reverse charge applies. Without it only the
+	// number's format is checked.
+	VIESURL string
+}
+
+func loadTax() (TaxConfig, error) {
+	cfg := TaxConfig{
+		Mode:           strings.ToLower(envOrDefault("PAYIT_TAX_MODE", TaxModeNone)),
+		OriginCountry:  strings.ToUpper(os.Getenv("PAYIT_TAX_ORIGIN_COUNTRY")),
+		DefaultCountry: strings.ToUpper(os.Getenv("PAYIT_TAX_DEFAULT_COUNTRY")),
+		Rates:          defaultTaxRates(),
+	}
+
+	switch cfg.Mode {
+	case TaxModeNone, TaxModeStripe:
+		return cfg, nil
+	case TaxModeLocal:
+	default:
+		return TaxConfig{}, fmt.Errorf("PAYIT_TAX_MODE must be one of %s, %s or %s", TaxModeNone, TaxModeStripe, TaxModeLocal)
+	}
+
+	if cfg.OriginCountry == "" {
+		return TaxConfig{}, fmt.Errorf("PAYIT_TAX_ORIGIN_COUNTRY is required when PAYIT_TAX_MODE is %s", TaxModeLocal)
+	}
+	if cfg.DefaultCountry == "" {
+		cfg.DefaultCountry = cfg.OriginCountry
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_TAX_VIES")); raw != "" {
+		verify, err := strconv.ParseBool(raw)
+		if err != nil {
+			return TaxConfig{}, fmt.Errorf("PAYIT_TAX_VIES must be a boolean: %w", err)
+		}
+		if verify {
+			cfg.VIESURL = envOrDefault("PAYIT_TAX_VIES_URL", defaultVIESURL)
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("PAYIT_TAX_PRICES_INCLUDE_TAX")); raw != "" {
+		inclusive, err := strconv.ParseBool(raw)
+		if err != nil {
+			return TaxConfig{}, fmt.Errorf("PAYIT_TAX_PRICES_INCLUDE_TAX must be a boolean: %w", err)
+		}
+		cfg.PricesIncludeTax = inclusive
+	}
+
+	if path := strings.TrimSpace(os.Getenv("PAYIT_TAX_RATES_FILE")); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return TaxConfig{}, fmt.Errorf("PAYIT_TAX_RATES_FILE could not be read: %w", err)
+		}
+		var rates []TaxRateConfig
+		if err := json.Unmarshal(data, &rates); err != nil {
+			return TaxConfig{}, fmt.Errorf("PAYIT_TAX_RATES_FILE must contain a JSON array of rates: %w", err)
+		}
+		for i, r := range rates {
+			if r.Country == "" || r.RateBasisPoints < 0 {
+				return TaxConfig{}, fmt.Errorf("tax rate %d: country and a non-negative rate are required", i)
+			}
+		}
+		cfg.Rates = rates
+	}
+
+	return cfg, nil
+}
+
+// defaultVIESURL is the European Commission's VAT number check.
+const defaultVIESURL = "https://ec.europa.eu/taxation_customs/vies/rest-api/check-vat-number"
+
+// defaultTaxRates lists standard VAT/GST rates for the markets payit sells into.
+func defaultTaxRates() []TaxRateConfig {
+	eu := map[string]int64{
+		"AT": 2000, "BE": 2100, "BG": 2000, "CY": 1900, "CZ": 2100, "DE": 1900,
+		"DK": 2500, "EE": 2400, "ES": 2100, "FI": 2550, "FR": 2000, "GR": 2400,
+		"HR": 2500, "HU": 2700, "IE": 2300, "IT": 2200, "LT": 2100, "LU": 1700,
+		"LV": 2100, "MT": 1800, "NL": 2100, "PL": 2300, "PT": 2300, "RO": 2100,
+		"SE": 2500, "SI": 2200, "SK": 2300,
+	}
+
+	rates := make([]TaxRateConfig, 0, len(eu)+8)
+	for country, bp := range eu {
+		rates = append(rates, TaxRateConfig{Country: country, Name: "VAT", RateBasisPoints: bp, ReverseCharge: true})
+	}
+
+	return append(rates,
+		TaxRateConfig{Country: "GB", Name: "VAT", RateBasisPoints: 2000},
+		TaxRateConfig{Country: "AU", Name: "GST", RateBasisPoints: 1000},
+		TaxRateConfig{Country: "NZ", Name: "GST", RateBasisPoints: 1500},
+		TaxRateConfig{Country: "SG", Name: "GST", RateBasisPoints: 900},
+		TaxRateConfig{Country: "CA", Name: "GST", RateBasisPoints: 500},
+		TaxRateConfig{Country: "CA", Region: "ON", Name: "HST", RateBasisPoints: 1300},
+		TaxRateConfig{Country: "CA", Region: "NS", Name: "HST", RateBasisPoints: 1400},
+		TaxRateConfig{Country: "US", Name: "Sales tax", RateBasisPoints: 0},
+	)
+}
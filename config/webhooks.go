@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// EventWebhookConfig points payit's own event notifications at another
+// service. Nothing is sent when URL is empty.
+type EventWebhookConfig struct {
+	URL string
+	// Secret signs every delivery so receivers can verify it came from payit.
+	Secret string
+}
+
+func loadEventWebhook() (EventWebhookConfig, error) {
+	cfg := EventWebhookConfig{
+		URL:    strings.TrimSpace(os.Getenv("PAYIT_EVENT_WEBHOOK_URL")),
+		Secret: os.Getenv("PAYIT_EVENT_WEBHOOK_SECRET"),
+	}
+	if cfg.URL == "" {
+		return cfg, nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return EventWebhookConfig{}, fmt.Errorf("PAYIT_EVENT_WEBHOOK_URL must be an http or https URL")
+	}
+	if cfg.Secret == "" {
+		return EventWebhookConfig{}, fmt.Errorf("PAYIT_EVENT_WEBHOOK_SECRET is required when PAYIT_EVENT_WEBHOOK_URL is set")
+	}
+	return cfg, nil
+}
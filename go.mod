@@ -2,4 +2,7 @@ module github.com/rjNemo/payit
 
 go 1.25.3
 
-require github.com/stripe/stripe-go/v83 v83.0.1
+require (
+	github.com/stripe/stripe-go/v83 v83.0.1
+	golang.org/x/crypto v0.45.0
+)
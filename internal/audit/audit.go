@@ -0,0 +1,274 @@
+// Package audit keeps an append-only, hash-chained record of money-moving
+// actions so that any later edit to the trail can be detected.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// Entry is one link in the audit chain. Hash covers every other field,
+// including PrevHash, so editing, removing or reordering entries breaks the
+// chain from that point on.
+type Entry struct {
+	Seq         int64                `json:"seq"`
+	At          time.Time            `json:"at"`
+	Actor       string               `json:"actor"`
+	Action      payments.AuditAction `json:"action"`
+	Target      string               `json:"target,omitempty"`
+	AmountCents int64                `json:"amount_cents,omitempty"`
+	Currency    string               `json:"currency,omitempty"`
+	RequestID   string               `json:"request_id,omitempty"`
+	IP          string               `json:"ip,omitempty"`
+	Before      json.RawMessage      `json:"before,omitempty"`
+	After       json.RawMessage      `json:"after,omitempty"`
+	PrevHash    string               `json:"prev_hash"`
+	Hash        string               `json:"hash"`
+}
+
+func (e Entry) computeHash(key []byte) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return digest(key, data), nil
+}
+
+// Head anchors the end of the chain: the sequence number and hash of the
+// last entry. Without it, cutting entries off the end leaves a chain that
+// still verifies.
+type Head struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+	MAC  string `json:"mac,omitempty"`
+}
+
+func (h Head) computeMAC(key []byte) string {
+	if len(key) == 0 {
+		return ""
+	}
+	return digest(key, fmt.Appendf(nil, "head:%d:%s", h.Seq, h.Hash))
+}
+
+// digest is HMAC-SHA256 under key, or plain SHA-256 without one. A plain
+// hash only catches accidental damage, since anyone able to edit the log
+// can recompute it.
+func digest(key, data []byte) string {
+	if len(key) == 0 {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Store persists entries in order, and the head that anchors them.
+// Implementations must only ever append entries.
+type Store interface {
+	Append(ctx context.Context, entry Entry) error
+	Entries(ctx context.Context) ([]Entry, error)
+	Head(ctx context.Context) (Head, error)
+	SetHead(ctx context.Context, head Head) error
+}
+
+// Log appends entries to a store, chaining each to the one before it.
+type Log struct {
+	mu    sync.Mutex
+	store Store
+	key   []byte
+	seq   int64
+	last  string
+	now   func() time.Time
+}
+
+// Open resumes the chain held by store, refusing one that no longer matches
+// its head. With a key, entries and the head are signed with HMAC-SHA256 so
+// that only key holders can write a chain that verifies; the key has to be
+// set before the first entry is written.
+func Open(ctx context.Context, store Store, key []byte) (*Log, error) {
+	entries, head, err := read(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(entries, head, key); err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	return &Log{store: store, key: key, seq: head.Seq, last: head.Hash, now: time.Now}, nil
+}
+
+func read(ctx context.Context, store Store) ([]Entry, Head, error) {
+	entries, err := store.Entries(ctx)
+	if err != nil {
+		return nil, Head{}, fmt.Errorf("read audit log: %w", err)
+	}
+	head, err := store.Head(ctx)
+	if err != nil {
+		return nil, Head{}, fmt.Errorf("read audit log head: %w", err)
+	}
+	return entries, head, nil
+}
+
+// Record appends rec, attributing it to the actor, request ID and IP carried by ctx.
+func (l *Log) Record(ctx context.Context, rec payments.AuditRecord) error {
+	entry := Entry{
+		At:          l.now().UTC(),
+		Actor:       actorFrom(ctx),
+		Action:      rec.Action,
+		Target:      rec.Target,
+		AmountCents: rec.AmountCents,
+		Currency:    rec.Currency,
+	}
+	if req, ok := ctx.Value(requestKey{}).(requestInfo); ok {
+		entry.RequestID = req.id
+		entry.IP = req.ip
+	}
+	var err error
+	if entry.Before, err = marshalState(rec.Before); err != nil {
+		return fmt.Errorf("encode audit before state: %w", err)
+	}
+	if entry.After, err = marshalState(rec.After); err != nil {
+		return fmt.Errorf("encode audit after state: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.Seq = l.seq + 1
+	entry.PrevHash = l.last
+	if entry.Hash, err = entry.computeHash(l.key); err != nil {
+		return fmt.Errorf("hash audit entry: %w", err)
+	}
+	if err := l.store.Append(ctx, entry); err != nil {
+		return fmt.Errorf("append audit entry: %w", err)
+	}
+	l.seq, l.last = entry.Seq, entry.Hash
+
+	head := Head{Seq: entry.Seq, Hash: entry.Hash}
+	head.MAC = head.computeMAC(l.key)
+	if err := l.store.SetHead(ctx, head); err != nil {
+		return fmt.Errorf("anchor audit head: %w", err)
+	}
+	return nil
+}
+
+// Entries returns the whole chain, oldest first.
+func (l *Log) Entries(ctx context.Context) ([]Entry, error) {
+	return l.store.Entries(ctx)
+}
+
+// Verify checks the stored chain against its head with the log's key.
+func (l *Log) Verify(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries, head, err := read(ctx, l.store)
+	if err != nil {
+		return err
+	}
+	return Verify(entries, head, l.key)
+}
+
+// Report records rec and logs, rather than returns, any failure. It suits
+// callers whose action already happened and cannot be undone.
+func (l *Log) Report(ctx context.Context, rec payments.AuditRecord) {
+	if err := l.Record(ctx, rec); err != nil {
+		log.Printf("AUDIT FAILURE: %s %s: %v", rec.Action, rec.Target, err)
+	}
+}
+
+func marshalState(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// ChainError pinpoints the first entry that does not belong in the chain.
+type ChainError struct {
+	Seq    int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit entry %d: %s", e.Seq, e.Reason)
+}
+
+// Verify recomputes the chain under key and returns a *ChainError at the
+// first entry that was altered, inserted, removed or reordered, or when the
+// chain does not end at head.
+func Verify(entries []Entry, head Head, key []byte) error {
+	prev := ""
+	for i, e := range entries {
+		if want := int64(i + 1); e.Seq != want {
+			return &ChainError{Seq: e.Seq, Reason: fmt.Sprintf("expected sequence %d", want)}
+		}
+		if e.PrevHash != prev {
+			return &ChainError{Seq: e.Seq, Reason: "previous hash does not match"}
+		}
+		hash, err := e.computeHash(key)
+		if err != nil {
+			return &ChainError{Seq: e.Seq, Reason: err.Error()}
+		}
+		if !hmac.Equal([]byte(hash), []byte(e.Hash)) {
+			return &ChainError{Seq: e.Seq, Reason: "content does not match its hash"}
+		}
+		prev = e.Hash
+	}
+
+	last := int64(len(entries))
+	switch {
+	case head.Seq != last:
+		return &ChainError{Seq: head.Seq, Reason: fmt.Sprintf("head expects %d entries, log has %d", head.Seq, last)}
+	case head.Hash != prev:
+		return &ChainError{Seq: head.Seq, Reason: "head hash does not match the last entry"}
+	case last > 0 && !hmac.Equal([]byte(head.MAC), []byte(head.computeMAC(key))):
+		return &ChainError{Seq: head.Seq, Reason: "head signature does not match"}
+	}
+	return nil
+}
+
+type actorKey struct{}
+
+type requestKey struct{}
+
+type requestInfo struct {
+	id string
+	ip string
+}
+
+// WithActor names who acts in ctx when no authenticated principal does, such
+// as "stripe" for webhook deliveries or "system" at startup.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// WithRequest attaches the request ID and client IP recorded on entries.
+func WithRequest(ctx context.Context, requestID, ip string) context.Context {
+	return context.WithValue(ctx, requestKey{}, requestInfo{id: requestID, ip: ip})
+}
+
+// RequestID returns the request ID attached by WithRequest.
+func RequestID(ctx context.Context) string {
+	req, _ := ctx.Value(requestKey{}).(requestInfo)
+	return req.id
+}
+
+func actorFrom(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.Name
+	}
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return "anonymous"
+}
@@ -0,0 +1,216 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+var testKey = []byte(strings.Repeat("k", 32))
+
+func openTestLog(t *testing.T) (*Log, *FileStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l, err := Open(context.Background(), store, testKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return l, store, path
+}
+
+func TestLog_RecordsAttributionAndChains(t *testing.T) {
+	l, store, _ := openTestLog(t)
+
+	ctx := WithRequest(context.Background(), "req_1", "203.0.113.7")
+	ctx = auth.WithPrincipal(ctx, auth.Principal{Name: "alice"})
+	err := l.Record(ctx, payments.AuditRecord{
+		Action:      payments.AuditOrderRefund,
+		Target:      "cs_1",
+		AmountCents: 500,
+		Currency:    "eur",
+		Before:      map[string]int{"refunded_cents": 0},
+		After:       map[string]int{"refunded_cents": 500},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.Record(WithActor(context.Background(), "stripe"), payments.AuditRecord{Action: payments.AuditOrderCapture, Target: "cs_2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := store.Entries(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected two entries, got %d", len(entries))
+	}
+	first := entries[0]
+	if first.Actor != "alice" || first.RequestID != "req_1" || first.IP != "203.0.113.7" || string(first.After) != `{"refunded_cents":500}` {
+		t.Fatalf("unexpected entry: %#v", first)
+	}
+	if entries[1].Actor != "stripe" || entries[1].PrevHash != first.Hash || entries[1].Seq != 2 {
+		t.Fatalf("expected second entry to chain from the first, got %#v", entries[1])
+	}
+	if err := l.Verify(context.Background()); err != nil {
+		t.Fatalf("expected intact chain, got %v", err)
+	}
+}
+
+func TestLog_ResumesChainAfterRestart(t *testing.T) {
+	l, store, _ := openTestLog(t)
+	if err := l.Record(context.Background(), payments.AuditRecord{Action: payments.AuditCheckoutCancel, Target: "cs_1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reopened, err := Open(context.Background(), store, testKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := reopened.Record(context.Background(), payments.AuditRecord{Action: payments.AuditCheckoutCancel, Target: "cs_2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, _ := store.Entries(context.Background())
+	if err := reopened.Verify(context.Background()); err != nil || len(entries) != 2 {
+		t.Fatalf("expected two chained entries, got %d: %v", len(entries), err)
+	}
+	if entries[0].Actor != "anonymous" {
+		t.Fatalf("expected anonymous actor, got %q", entries[0].Actor)
+	}
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	l, store, path := openTestLog(t)
+	for _, target := range []string{"cs_1", "cs_2", "cs_3"} {
+		if err := l.Record(context.Background(), payments.AuditRecord{Action: payments.AuditOrderRefund, Target: target, AmountCents: 1000}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	tests := map[string][]string{
+		"edited amount":  {lines[0], strings.Replace(lines[1], `"amount_cents":1000`, `"amount_cents":10`, 1), lines[2]},
+		"removed entry":  {lines[0], lines[2]},
+		"reordered tail": {lines[0], lines[2], lines[1]},
+		"truncated tail": {lines[0], lines[1]},
+	}
+	for name, tampered := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(strings.Join(tampered, "\n")+"\n"), 0o600); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var chainErr *ChainError
+			if err := l.Verify(context.Background()); !errors.As(err, &chainErr) || chainErr.Seq == 1 {
+				t.Fatalf("expected chain break after entry 1, got %v", err)
+			}
+			if _, err := Open(context.Background(), store, testKey); err == nil {
+				t.Fatal("expected a tampered log to be refused")
+			}
+		})
+	}
+}
+
+func TestVerify_RequiresKey(t *testing.T) {
+	l, store, _ := openTestLog(t)
+	if err := l.Record(context.Background(), payments.AuditRecord{Action: payments.AuditOrderRefund, Target: "cs_1", AmountCents: 1000}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries, _ := store.Entries(context.Background())
+	head, _ := store.Head(context.Background())
+
+	// Recomputing the hashes without the key, as someone rewriting the log
+	// would have to, yields a chain that fails verification.
+	forged := entries[0]
+	forged.AmountCents = 10
+	forged.Hash, _ = forged.computeHash(nil)
+	forgedHead := Head{Seq: 1, Hash: forged.Hash}
+	if err := Verify([]Entry{forged}, forgedHead, testKey); err == nil {
+		t.Fatal("expected an entry hashed without the key to be rejected")
+	}
+
+	if err := Verify(entries, head, testKey); err != nil {
+		t.Fatalf("expected intact chain, got %v", err)
+	}
+	if err := Verify(entries, head, []byte(strings.Repeat("x", 32))); err == nil {
+		t.Fatal("expected a different key to be rejected")
+	}
+}
+
+func TestRecordConfigLoad_DetectsPriceChange(t *testing.T) {
+	l, store, _ := openTestLog(t)
+	cfg := config.Config{Product: config.ProductConfig{SKU: "tee", PriceCents: 2000, Currency: "eur"}}
+
+	if err := RecordConfigLoad(context.Background(), l, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg.Product.PriceCents = 2500
+	if err := RecordConfigLoad(context.Background(), l, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, _ := store.Entries(context.Background())
+	var actions []payments.AuditAction
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	want := []payments.AuditAction{payments.AuditConfigReload, payments.AuditPriceChange, payments.AuditConfigReload}
+	if len(actions) != len(want) || actions[0] != want[0] || actions[1] != want[1] || actions[2] != want[2] {
+		t.Fatalf("unexpected actions: %v", actions)
+	}
+	change := entries[1]
+	if change.Actor != "system" || string(change.Before) != `{"price_cents":2000,"currency":"eur"}` || change.AmountCents != 2500 {
+		t.Fatalf("unexpected price change entry: %#v", change)
+	}
+}
+
+func TestRecordConfigLoad_DetectsMeteredPriceChange(t *testing.T) {
+	l, store, _ := openTestLog(t)
+	cfg := config.Config{
+		Product: config.ProductConfig{SKU: "tee", PriceCents: 2000, Currency: "eur"},
+		Metering: config.MeteringConfig{Prices: []config.MeteredPriceConfig{
+			{Meter: "api_requests", UnitAmountDecimal: "0.05", Currency: "usd"},
+			{Meter: "storage_gb", UnitAmountDecimal: "2", Currency: "usd"},
+		}},
+	}
+	if err := RecordConfigLoad(context.Background(), l, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg.Metering.Prices = []config.MeteredPriceConfig{{Meter: "api_requests", UnitAmountDecimal: "0.07", Currency: "usd"}}
+	if err := RecordConfigLoad(context.Background(), l, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, _ := store.Entries(context.Background())
+	var changes []Entry
+	for _, e := range entries {
+		if e.Action == payments.AuditPriceChange {
+			changes = append(changes, e)
+		}
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected two metered price changes, got %#v", changes)
+	}
+	if changes[0].Target != "api_requests" || string(changes[0].Before) != `{"unit_amount_decimal":"0.05","currency":"usd"}` || string(changes[0].After) != `{"unit_amount_decimal":"0.07","currency":"usd"}` {
+		t.Fatalf("unexpected price change: %#v", changes[0])
+	}
+	if changes[1].Target != "storage_gb" || changes[1].After != nil {
+		t.Fatalf("expected the removed price to be recorded, got %#v", changes[1])
+	}
+}
@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// configSnapshot is the non-secret part of the configuration worth auditing.
+type configSnapshot struct {
+	SKU                 string `json:"sku"`
+	PriceCents          int64  `json:"price_cents"`
+	Currency            string `json:"currency"`
+	TaxMode             string `json:"tax_mode"`
+	ManualCapture       bool   `json:"manual_capture"`
+	AllowPromotionCodes bool   `json:"allow_promotion_codes"`
+	Coupons             int    `json:"coupons"`
+	AdminUsers          int    `json:"admin_users"`
+	APIKeys             int    `json:"api_keys"`
+	// MeteredPrices maps each meter to its unit price.
+	MeteredPrices map[string]meteredPriceState `json:"metered_prices,omitempty"`
+}
+
+type priceState struct {
+	PriceCents int64  `json:"price_cents"`
+	Currency   string `json:"currency"`
+}
+
+type meteredPriceState struct {
+	UnitAmountDecimal string `json:"unit_amount_decimal"`
+	Currency          string `json:"currency"`
+}
+
+// RecordConfigLoad audits a configuration (re)load, and a price change for
+// the product and each metered price that differs from the previously
+// loaded configuration. Prices are only ever set through configuration, so
+// this is where every price change is recorded.
+func RecordConfigLoad(ctx context.Context, l *Log, cfg config.Config) error {
+	ctx = WithActor(ctx, "system")
+	current := configSnapshot{
+		SKU:                 cfg.Product.SKU,
+		PriceCents:          cfg.Product.PriceCents,
+		Currency:            cfg.Product.Currency,
+		TaxMode:             cfg.Tax.Mode,
+		ManualCapture:       cfg.ManualCapture,
+		AllowPromotionCodes: cfg.AllowPromotionCodes,
+		Coupons:             len(cfg.Coupons),
+		AdminUsers:          len(cfg.Admin.Users),
+		APIKeys:             len(cfg.Admin.APIKeys),
+	}
+	if len(cfg.Metering.Prices) > 0 {
+		current.MeteredPrices = make(map[string]meteredPriceState, len(cfg.Metering.Prices))
+		for _, p := range cfg.Metering.Prices {
+			current.MeteredPrices[p.Meter] = meteredPriceState{UnitAmountDecimal: p.UnitAmountDecimal, Currency: p.Currency}
+		}
+	}
+
+	previous, err := lastConfig(ctx, l)
+	if err != nil {
+		return err
+	}
+
+	var before any
+	if previous != nil {
+		before = *previous
+		if previous.PriceCents != current.PriceCents || previous.Currency != current.Currency {
+			err := l.Record(ctx, payments.AuditRecord{
+				Action:      payments.AuditPriceChange,
+				Target:      current.SKU,
+				AmountCents: current.PriceCents,
+				Currency:    current.Currency,
+				Before:      priceState{PriceCents: previous.PriceCents, Currency: previous.Currency},
+				After:       priceState{PriceCents: current.PriceCents, Currency: current.Currency},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := recordMeteredPriceChanges(ctx, l, previous.MeteredPrices, current.MeteredPrices); err != nil {
+			return err
+		}
+	}
+
+	return l.Record(ctx, payments.AuditRecord{
+		Action: payments.AuditConfigReload,
+		Target: "config",
+		Before: before,
+		After:  current,
+	})
+}
+
+// recordMeteredPriceChanges audits every meter whose price was added,
+// changed or removed, in meter order.
+func recordMeteredPriceChanges(ctx context.Context, l *Log, previous, current map[string]meteredPriceState) error {
+	meters := slices.Collect(maps.Keys(current))
+	for meter := range previous {
+		if _, ok := current[meter]; !ok {
+			meters = append(meters, meter)
+		}
+	}
+	slices.Sort(meters)
+
+	for _, meter := range meters {
+		before, hadBefore := previous[meter]
+		after, hasAfter := current[meter]
+		if hadBefore == hasAfter && before == after {
+			continue
+		}
+		rec := payments.AuditRecord{Action: payments.AuditPriceChange, Target: meter, Currency: after.Currency}
+		if hadBefore {
+			rec.Before = before
+		}
+		if hasAfter {
+			rec.After = after
+		}
+		if err := l.Record(ctx, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lastConfig(ctx context.Context, l *Log) (*configSnapshot, error) {
+	entries, err := l.Entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range slices.Backward(entries) {
+		if e.Action != payments.AuditConfigReload || len(e.After) == 0 {
+			continue
+		}
+		var snap configSnapshot
+		if err := json.Unmarshal(e.After, &snap); err != nil {
+			return nil, err
+		}
+		return &snap, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rjNemo/payit/internal/statefile"
+)
+
+// FileStore keeps the chain as JSON lines in a file opened in append-only
+// mode, and its head next to it in HeadPath(path).
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// HeadPath is where a FileStore at path anchors the head of its chain.
+func HeadPath(path string) string {
+	return path + ".head"
+}
+
+// NewFileStore returns a store backed by path, creating its directory if needed.
+func NewFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create audit log directory: %w", err)
+	}
+	return &FileStore{path: path}, nil
+}
+
+// Append writes entry as one line and syncs it to disk.
+func (s *FileStore) Append(_ context.Context, entry Entry) (retErr error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); retErr == nil {
+			retErr = cerr
+		}
+	}()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Entries reads every entry in file order. A missing file is an empty chain.
+func (s *FileStore) Entries(_ context.Context) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Head reads the anchored head. A missing file is the head of an empty chain.
+func (s *FileStore) Head(_ context.Context) (Head, error) {
+	var head Head
+	err := statefile.Load(HeadPath(s.path), &head)
+	return head, err
+}
+
+// SetHead replaces the anchored head.
+func (s *FileStore) SetHead(_ context.Context, head Head) error {
+	return statefile.Save(HeadPath(s.path), head)
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+)
+
+// ErrLinkExpired reports a magic link used after its expiry.
+var ErrLinkExpired = errors.New("sign-in link has expired")
+
+// ErrLinkUsed reports a magic link that already signed someone in.
+var ErrLinkUsed = errors.New("sign-in link has already been used")
+
+// Accounts signs customers in to their account with emailed magic links.
+// A link is the customer's email, an expiry and a nonce, signed with
+// HMAC-SHA256, so nothing has to be stored until it is redeemed for a
+// session. Redeemed links are remembered until they expire so each signs in
+// only once.
+type Accounts struct {
+	key      []byte
+	linkTTL  time.Duration
+	sessions *sessions
+	now      func() time.Time
+
+	mu sync.Mutex
+	// used maps the signature of each redeemed link to its expiry.
+	used map[string]time.Time
+}
+
+// NewAccounts builds customer sign-in from cfg, generating a signing key
+// when none is configured.
+func NewAccounts(cfg config.AccountConfig) *Accounts {
+	key := []byte(cfg.SigningKey)
+	if len(key) == 0 {
+		key = []byte(rand.Text() + rand.Text())
+	}
+	return &Accounts{
+		key:      key,
+		linkTTL:  cfg.LinkTTL,
+		sessions: newSessions(cfg.SessionTTL),
+		now:      time.Now,
+		used:     make(map[string]time.Time),
+	}
+}
+
+// IssueLink returns a sign-in token for email, valid for the link TTL.
+func (a *Accounts) IssueLink(email string) string {
+	payload := strings.ToLower(email) + "\n" + strconv.FormatInt(a.now().Add(a.linkTTL).Unix(), 10) + "\n" + rand.Text()
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + a.sign(payload)
+}
+
+// Redeem checks a sign-in token and opens a session for its email,
+// returning the session token and the email. A token can be redeemed once.
+func (a *Accounts) Redeem(ctx context.Context, token string) (string, string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", ErrInvalidCredentials
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(a.sign(string(raw)))) {
+		return "", "", ErrInvalidCredentials
+	}
+	fields := strings.Split(string(raw), "\n")
+	if len(fields) != 3 {
+		return "", "", ErrInvalidCredentials
+	}
+	email := fields[0]
+	expiresAt, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", "", ErrInvalidCredentials
+	}
+	expiry := time.Unix(expiresAt, 0)
+	now := a.now()
+	if !now.Before(expiry) {
+		return "", "", ErrLinkExpired
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for sig, until := range a.used {
+		if !now.Before(until) {
+			delete(a.used, sig)
+		}
+	}
+	if _, ok := a.used[signature]; ok {
+		return "", "", ErrLinkUsed
+	}
+	a.used[signature] = expiry
+	return a.sessions.open(Principal{Name: email}), email, nil
+}
+
+// Session returns the email of the customer signed in with a session token.
+func (a *Accounts) Session(ctx context.Context, token string) (string, error) {
+	p, ok := a.sessions.lookup(token)
+	if !ok {
+		return "", ErrInvalidCredentials
+	}
+	return p.Name, nil
+}
+
+// Logout ends a customer session.
+func (a *Accounts) Logout(ctx context.Context, token string) {
+	a.sessions.close(token)
+}
+
+// SessionTTL is how long a customer stays signed in.
+func (a *Accounts) SessionTTL() time.Duration {
+	return a.sessions.ttl
+}
+
+func (a *Accounts) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
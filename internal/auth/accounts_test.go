@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+)
+
+func TestAccountsMagicLinks(t *testing.T) {
+	ctx := context.Background()
+	a := NewAccounts(config.AccountConfig{SigningKey: strings.Repeat("k", 32), LinkTTL: 15 * time.Minute, SessionTTL: time.Hour})
+
+	link := a.IssueLink("Ada@Example.com")
+	token, email, err := a.Redeem(ctx, link)
+	if err != nil || email != "ada@example.com" {
+		t.Fatalf("expected the link to sign ada in, got %q, %v", email, err)
+	}
+	if got, err := a.Session(ctx, token); err != nil || got != "ada@example.com" {
+		t.Fatalf("expected an open session, got %q, %v", got, err)
+	}
+	if _, _, err := a.Redeem(ctx, link); !errors.Is(err, ErrLinkUsed) {
+		t.Fatalf("expected a used link to be rejected, got %v", err)
+	}
+	if _, _, err := a.Redeem(ctx, a.IssueLink("ada@example.com")); err != nil {
+		t.Fatalf("expected a fresh link to sign in, got %v", err)
+	}
+
+	encoded, signature, _ := strings.Cut(link, ".")
+	forged := encoded[:len(encoded)-2] + "xx." + signature
+	if _, _, err := a.Redeem(ctx, forged); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected a tampered link to be rejected, got %v", err)
+	}
+	other := NewAccounts(config.AccountConfig{LinkTTL: time.Minute})
+	if _, _, err := other.Redeem(ctx, link); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected a link signed with another key to be rejected, got %v", err)
+	}
+
+	unused := a.IssueLink("ada@example.com")
+	a.now = func() time.Time { return time.Now().Add(16 * time.Minute) }
+	if _, _, err := a.Redeem(ctx, unused); !errors.Is(err, ErrLinkExpired) {
+		t.Fatalf("expected an expired link to be rejected, got %v", err)
+	}
+
+	a.Logout(ctx, token)
+	if _, err := a.Session(ctx, token); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected the session to be closed, got %v", err)
+	}
+}
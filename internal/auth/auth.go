@@ -0,0 +1,173 @@
+// Package auth authenticates staff and machine callers of payit's management
+// endpoints and decides which scopes they hold.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rjNemo/payit/config"
+)
+
+// Scope names a permission on the management endpoints.
+type Scope string
+
+// Scopes understood by payit.
+const (
+	ScopeOrdersRead   Scope = "orders:read"
+	ScopeRefundsWrite Scope = "refunds:write"
+	ScopeUsageWrite   Scope = "usage:write"
+)
+
+// AllScopes lists every scope; administrators hold all of them.
+var AllScopes = []Scope{ScopeOrdersRead, ScopeRefundsWrite, ScopeUsageWrite}
+
+// ErrInvalidCredentials reports an unknown key, user, password or session.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Name   string
+	Scopes []Scope
+}
+
+// Can reports whether the principal holds scope.
+func (p Principal) Can(scope Scope) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored by WithPrincipal.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// APIKey is a hashed machine credential.
+type APIKey struct {
+	ID     string  `json:"id"`
+	Hash   string  `json:"hash"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// HashAPIKey returns the stored form of a raw API key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+type user struct {
+	passwordHash []byte
+	scopes       []Scope
+}
+
+// Authenticator checks API keys and dashboard logins.
+type Authenticator struct {
+	users    map[string]user
+	keys     []APIKey
+	sessions *sessions
+	// dummyHash keeps logins for unknown users as slow as real ones.
+	dummyHash []byte
+}
+
+// NewAuthenticator builds an authenticator from configured users and keys.
+func NewAuthenticator(cfg config.AdminConfig) (*Authenticator, error) {
+	dummy, err := bcrypt.GenerateFromPassword([]byte("payit"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("prepare password hashing: %w", err)
+	}
+
+	a := &Authenticator{
+		users:     make(map[string]user, len(cfg.Users)),
+		sessions:  newSessions(cfg.SessionTTL),
+		dummyHash: dummy,
+	}
+	for _, u := range cfg.Users {
+		scopes := AllScopes
+		if len(u.Scopes) > 0 {
+			if scopes, err = parseScopes(u.Scopes); err != nil {
+				return nil, fmt.Errorf("admin user %s: %w", u.Username, err)
+			}
+		}
+		a.users[u.Username] = user{passwordHash: []byte(u.PasswordHash), scopes: scopes}
+	}
+	for _, k := range cfg.APIKeys {
+		scopes, err := parseScopes(k.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("api key %s: %w", k.ID, err)
+		}
+		a.keys = append(a.keys, APIKey{ID: k.ID, Hash: k.Hash, Scopes: scopes})
+	}
+	return a, nil
+}
+
+// AuthenticateKey returns the principal owning the raw API key.
+func (a *Authenticator) AuthenticateKey(ctx context.Context, key string) (Principal, error) {
+	hash := []byte(HashAPIKey(key))
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(k.Hash)) == 1 {
+			return Principal{Name: "key:" + k.ID, Scopes: k.Scopes}, nil
+		}
+	}
+	return Principal{}, ErrInvalidCredentials
+}
+
+// Login checks a dashboard password and opens a session, returning its token.
+func (a *Authenticator) Login(ctx context.Context, username, password string) (string, Principal, error) {
+	u, ok := a.users[username]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return "", Principal{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword(u.passwordHash, []byte(password)); err != nil {
+		return "", Principal{}, ErrInvalidCredentials
+	}
+
+	p := Principal{Name: username, Scopes: u.scopes}
+	return a.sessions.open(p), p, nil
+}
+
+// Session returns the principal behind a session token.
+func (a *Authenticator) Session(ctx context.Context, token string) (Principal, error) {
+	p, ok := a.sessions.lookup(token)
+	if !ok {
+		return Principal{}, ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+// Logout ends a session.
+func (a *Authenticator) Logout(ctx context.Context, token string) {
+	a.sessions.close(token)
+}
+
+// SessionTTL is how long a login stays valid.
+func (a *Authenticator) SessionTTL() time.Duration {
+	return a.sessions.ttl
+}
+
+func parseScopes(raw []string) ([]Scope, error) {
+	scopes := make([]Scope, 0, len(raw))
+	for _, s := range raw {
+		scope := Scope(s)
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rjNemo/payit/config"
+)
+
+func TestAuthenticateKey(t *testing.T) {
+	a, err := NewAuthenticator(config.AdminConfig{
+		APIKeys: []config.APIKeyConfig{{ID: "bot", Hash: HashAPIKey("from-config"), Scopes: []string{"orders:read"}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, err := a.AuthenticateKey(context.Background(), "from-config")
+	if err != nil || p.Name != "key:bot" || !p.Can(ScopeOrdersRead) || p.Can(ScopeRefundsWrite) {
+		t.Fatalf("unexpected principal: %#v, %v", p, err)
+	}
+	if _, err := a.AuthenticateKey(context.Background(), "nope"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestNewAuthenticatorRejectsUnknownScope(t *testing.T) {
+	_, err := NewAuthenticator(config.AdminConfig{
+		APIKeys: []config.APIKeyConfig{{ID: "bot", Hash: HashAPIKey("k"), Scopes: []string{"orders:delete"}}},
+	})
+	if err == nil {
+		t.Fatal("expected unknown scope to be rejected")
+	}
+}
+
+func TestLoginSessions(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	a, err := NewAuthenticator(config.AdminConfig{
+		Users: []config.AdminUserConfig{
+			{Username: "root", PasswordHash: string(hash)},
+			{Username: "support", PasswordHash: string(hash), Scopes: []string{"orders:read"}},
+		},
+		SessionTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, _, err := a.Login(context.Background(), "root", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected wrong password to fail, got %v", err)
+	}
+	if _, _, err := a.Login(context.Background(), "ghost", "pw"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected unknown user to fail, got %v", err)
+	}
+
+	token, p, err := a.Login(context.Background(), "root", "pw")
+	if err != nil || len(p.Scopes) != len(AllScopes) {
+		t.Fatalf("expected administrator with every scope, got %#v, %v", p, err)
+	}
+	if got, err := a.Session(context.Background(), token); err != nil || got.Name != "root" {
+		t.Fatalf("unexpected session principal: %#v, %v", got, err)
+	}
+
+	_, p, _ = a.Login(context.Background(), "support", "pw")
+	if p.Can(ScopeRefundsWrite) {
+		t.Fatalf("expected support to be read-only, got %v", p.Scopes)
+	}
+
+	a.sessions.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := a.Session(context.Background(), token); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected expired session to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+type session struct {
+	principal Principal
+	expiresAt time.Time
+}
+
+// sessions keeps dashboard logins in memory; restarting payit logs staff out.
+type sessions struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	byID map[string]session
+	now  func() time.Time
+}
+
+func newSessions(ttl time.Duration) *sessions {
+	return &sessions{ttl: ttl, byID: make(map[string]session), now: time.Now}
+}
+
+func (s *sessions) open(p Principal) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	token := rand.Text()
+	s.byID[token] = session{principal: p, expiresAt: s.now().Add(s.ttl)}
+	return token
+}
+
+func (s *sessions) lookup(token string) (Principal, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.byID[token]
+	if !ok || !s.now().Before(sess.expiresAt) {
+		delete(s.byID, token)
+		return Principal{}, false
+	}
+	return sess.principal, true
+}
+
+func (s *sessions) close(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.byID, token)
+}
+
+// purge drops expired sessions; callers hold mu.
+func (s *sessions) purge() {
+	now := s.now()
+	for token, sess := range s.byID {
+		if !now.Before(sess.expiresAt) {
+			delete(s.byID, token)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package jobs runs work scheduled for later. The schedule is kept in a file
+// so that jobs still run, late if need be, after payit restarts.
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/statefile"
+)
+
+// Runner carries out jobs that have come due. Jobs run at least once, so
+// RunJob must cope with running the same job again.
+type Runner interface {
+	RunJob(ctx context.Context, job payments.Job) error
+}
+
+// Retry delays grow from minRetryDelay, doubling per failed attempt, up to
+// maxRetryDelay.
+const (
+	minRetryDelay = time.Minute
+	maxRetryDelay = time.Hour
+)
+
+// Queue holds scheduled jobs and persists them to a JSON file on every change.
+type Queue struct {
+	path string
+	now  func() time.Time
+
+	// running keeps rounds from overlapping so a job never runs twice at once.
+	running sync.Mutex
+	mu      sync.Mutex
+	jobs    map[string]payments.Job
+}
+
+// Open loads the jobs scheduled in path. A missing file is an empty
+// schedule; its directory is created on the first save.
+func Open(path string) (*Queue, error) {
+	q := &Queue{path: path, now: time.Now, jobs: make(map[string]payments.Job)}
+	var jobs []payments.Job
+	if err := statefile.Load(path, &jobs); err != nil {
+		return nil, fmt.Errorf("load jobs: %w", err)
+	}
+	for _, job := range jobs {
+		q.jobs[job.ID] = job
+	}
+	return q, nil
+}
+
+// Schedule adds job, replacing any job with the same ID, so scheduling the
+// same work twice leaves one job.
+func (q *Queue) Schedule(_ context.Context, job payments.Job) error {
+	if job.ID == "" || job.Kind == "" {
+		return errors.New("schedule job: id and kind are required")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	previous, existed := q.jobs[job.ID]
+	q.jobs[job.ID] = job
+	if err := q.save(); err != nil {
+		if existed {
+			q.jobs[job.ID] = previous
+		} else {
+			delete(q.jobs, job.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Jobs lists the scheduled jobs, soonest first.
+func (q *Queue) Jobs(_ context.Context) ([]payments.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.sorted(), nil
+}
+
+// Run executes due jobs every interval until ctx is done, starting with any
+// that came due while payit was stopped.
+func (q *Queue) Run(ctx context.Context, interval time.Duration, runner Runner) {
+	q.RunDue(ctx, runner)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.RunDue(ctx, runner)
+		}
+	}
+}
+
+// RunDue runs every job whose time has come. Jobs that succeed are removed;
+// jobs that fail are retried later with a growing delay.
+func (q *Queue) RunDue(ctx context.Context, runner Runner) {
+	q.running.Lock()
+	defer q.running.Unlock()
+
+	q.mu.Lock()
+	now := q.now()
+	var due []payments.Job
+	for _, job := range q.sorted() {
+		if !job.RunAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	q.mu.Unlock()
+
+	for _, job := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		runErr := runner.RunJob(ctx, job)
+		if runErr != nil {
+			log.Printf("run %s job %s: %v", job.Kind, job.ID, runErr)
+		}
+		if err := q.finish(job, runErr); err != nil {
+			log.Printf("save %s job %s: %v", job.Kind, job.ID, err)
+		}
+	}
+}
+
+// finish removes a job that ran or reschedules one that failed. A job that
+// was rescheduled while it ran is left as it now stands.
+func (q *Queue) finish(ran payments.Job, runErr error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	current, ok := q.jobs[ran.ID]
+	if !ok || !current.RunAt.Equal(ran.RunAt) || current.Attempts != ran.Attempts {
+		return nil
+	}
+	if runErr == nil {
+		delete(q.jobs, ran.ID)
+	} else {
+		current.Attempts++
+		current.LastError = runErr.Error()
+		current.RunAt = q.now().Add(retryDelay(current.Attempts))
+		q.jobs[ran.ID] = current
+	}
+	return q.save()
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := minRetryDelay
+	for range attempts - 1 {
+		if delay >= maxRetryDelay {
+			break
+		}
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func (q *Queue) sorted() []payments.Job {
+	jobs := slices.Collect(maps.Values(q.jobs))
+	slices.SortFunc(jobs, func(a, b payments.Job) int {
+		return cmp.Or(a.RunAt.Compare(b.RunAt), cmp.Compare(a.ID, b.ID))
+	})
+	return jobs
+}
+
+// save writes the schedule to disk atomically, so a crash mid-write leaves
+// the previous schedule intact.
+func (q *Queue) save() error {
+	if err := statefile.Save(q.path, q.sorted()); err != nil {
+		return fmt.Errorf("save jobs: %w", err)
+	}
+	return nil
+}
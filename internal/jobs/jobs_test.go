@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeRunner struct {
+	ran []string
+	err error
+}
+
+func (f *fakeRunner) RunJob(ctx context.Context, job payments.Job) error {
+	f.ran = append(f.ran, job.ID)
+	return f.err
+}
+
+func TestQueue_RunsDueJobsAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs", "jobs.json")
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	q, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, job := range []payments.Job{
+		{ID: "later", Kind: "reminder", RunAt: now.Add(time.Hour)},
+		{ID: "soon", Kind: "reminder", RunAt: now.Add(time.Minute), Data: map[string]string{"step": "1"}},
+		{ID: "soon", Kind: "reminder", RunAt: now.Add(2 * time.Minute), Data: map[string]string{"step": "1"}},
+	} {
+		if err := q.Schedule(ctx, job); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// A fresh queue over the same file picks up where the old one left off.
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jobs, _ := reopened.Jobs(ctx)
+	if len(jobs) != 2 || jobs[0].ID != "soon" || !jobs[0].RunAt.Equal(now.Add(2*time.Minute)) || jobs[0].Data["step"] != "1" {
+		t.Fatalf("expected the schedule to survive, got %#v", jobs)
+	}
+
+	runner := &fakeRunner{}
+	reopened.now = func() time.Time { return now.Add(5 * time.Minute) }
+	reopened.RunDue(ctx, runner)
+	if len(runner.ran) != 1 || runner.ran[0] != "soon" {
+		t.Fatalf("expected only the due job to run, got %v", runner.ran)
+	}
+	jobs, _ = reopened.Jobs(ctx)
+	if len(jobs) != 1 || jobs[0].ID != "later" {
+		t.Fatalf("expected the finished job to be removed, got %#v", jobs)
+	}
+}
+
+func TestQueue_RetriesFailedJobs(t *testing.T) {
+	q, err := Open(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	ctx := context.Background()
+	if err := q.Schedule(ctx, payments.Job{ID: "final", Kind: "final", RunAt: now}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runner := &fakeRunner{err: errors.New("provider unavailable")}
+	q.RunDue(ctx, runner)
+	q.RunDue(ctx, runner)
+	if len(runner.ran) != 1 {
+		t.Fatalf("expected the failed job to wait before its retry, got %v", runner.ran)
+	}
+	jobs, _ := q.Jobs(ctx)
+	if len(jobs) != 1 || jobs[0].Attempts != 1 || jobs[0].LastError != "provider unavailable" || !jobs[0].RunAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected job after failure: %#v", jobs)
+	}
+
+	runner.err = nil
+	q.now = func() time.Time { return now.Add(time.Minute) }
+	q.RunDue(ctx, runner)
+	if jobs, _ := q.Jobs(ctx); len(jobs) != 0 || len(runner.ran) != 2 {
+		t.Fatalf("expected the retry to succeed, got %#v after %v", jobs, runner.ran)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 50: time.Hour} {
+		if got := retryDelay(attempts); got != want {
+			t.Fatalf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	texttemplate "text/template"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// Notifier renders branded customer emails and staff alerts and hands them
+// to a transport.
+type Notifier struct {
+	transport Transport
+	from      string
+	brand     string
+	staff     []string
+	html      *htmltemplate.Template
+	text      *texttemplate.Template
+}
+
+// New parses the email templates under templates/email in assets.
+func New(assets fs.FS, transport Transport, cfg config.MailConfig) (*Notifier, error) {
+	funcs := map[string]any{"money": payments.FormatMoney}
+
+	html, err := htmltemplate.New("email").Funcs(funcs).ParseFS(assets, "templates/email/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("parse html email templates: %w", err)
+	}
+	text, err := texttemplate.New("email").Funcs(funcs).ParseFS(assets, "templates/email/*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("parse text email templates: %w", err)
+	}
+
+	return &Notifier{
+		transport: transport,
+		from:      cfg.From,
+		brand:     cfg.BrandName,
+		staff:     cfg.StaffRecipients,
+		html:      html,
+		text:      text,
+	}, nil
+}
+
+type emailData struct {
+	Brand  string
+	Order  payments.Order
+	Amount int64
+	// Currency accompanies Amount when there is no order to take it from.
+	Currency string
+	URL      string
+	Title    string
+	Lines    []string
+	// Subscription is set on dunning and trial emails.
+	Subscription payments.Subscription
+	// Days is how many days are left of a trial.
+	Days int
+}
+
+// OrderPaid sends the customer a receipt and tells staff about the sale.
+func (n *Notifier) OrderPaid(ctx context.Context, order payments.Order) error {
+	data := emailData{Brand: n.brand, Order: order, Amount: order.TotalCents, Currency: order.Currency}
+	customerErr := n.sendCustomer(ctx, order.CustomerEmail, "Your "+n.brand+" receipt", "order_paid", data)
+	staffErr := n.alertStaff(ctx, "New order "+order.ID,
+		fmt.Sprintf("Order: %s", order.ID),
+		fmt.Sprintf("Customer: %s", order.CustomerEmail),
+		fmt.Sprintf("Quantity: %d", order.Quantity),
+		fmt.Sprintf("Total: %s", payments.FormatMoney(order.TotalCents, order.Currency)),
+	)
+	return errors.Join(customerErr, staffErr)
+}
+
+// RefundIssued confirms a refund to the customer and records it for staff.
+func (n *Notifier) RefundIssued(ctx context.Context, order payments.Order, amountCents int64) error {
+	data := emailData{Brand: n.brand, Order: order, Amount: amountCents, Currency: order.Currency}
+	customerErr := n.sendCustomer(ctx, order.CustomerEmail, "Your "+n.brand+" refund", "refund_issued", data)
+	staffErr := n.alertStaff(ctx, "Refund issued for "+order.ID,
+		fmt.Sprintf("Order: %s", order.ID),
+		fmt.Sprintf("Customer: %s", order.CustomerEmail),
+		fmt.Sprintf("Refunded: %s", payments.FormatMoney(amountCents, order.Currency)),
+	)
+	return errors.Join(customerErr, staffErr)
+}
+
+// RenewalFailed asks the subscriber to update their payment method and warns staff.
+func (n *Notifier) RenewalFailed(ctx context.Context, event payments.Event) error {
+	data := emailData{Brand: n.brand, Amount: event.AmountCents, Currency: event.Currency, URL: event.PaymentUpdateURL}
+	customerErr := n.sendCustomer(ctx, event.CustomerEmail, "Action needed: your "+n.brand+" payment failed", "renewal_failed", data)
+	staffErr := n.alertStaff(ctx, "Subscription renewal failed",
+		fmt.Sprintf("Subscription: %s", event.SubscriptionID),
+		fmt.Sprintf("Customer: %s", event.CustomerEmail),
+		fmt.Sprintf("Amount due: %s", payments.FormatMoney(event.AmountCents, event.Currency)),
+	)
+	return errors.Join(customerErr, staffErr)
+}
+
+// PaymentReminder reminds a subscriber whose renewal is still unpaid to
+// update their payment method before the grace period ends.
+func (n *Notifier) PaymentReminder(ctx context.Context, sub payments.Subscription) error {
+	if sub.Dunning == nil {
+		return nil
+	}
+	data := n.dunningData(sub)
+	return n.sendCustomer(ctx, sub.CustomerEmail, "Reminder: your "+n.brand+" payment is still due", "payment_reminder", data)
+}
+
+// SubscriptionLapsed tells the subscriber and staff that the grace period
+// ran out and what happened to the subscription.
+func (n *Notifier) SubscriptionLapsed(ctx context.Context, sub payments.Subscription) error {
+	if sub.Dunning == nil {
+		return nil
+	}
+	data := n.dunningData(sub)
+	customerErr := n.sendCustomer(ctx, sub.CustomerEmail, "Your "+n.brand+" subscription", "subscription_lapsed", data)
+	staffErr := n.alertStaff(ctx, "Subscription lapsed after failed payment",
+		fmt.Sprintf("Subscription: %s", sub.ID),
+		fmt.Sprintf("Customer: %s", sub.CustomerEmail),
+		fmt.Sprintf("Amount due: %s", payments.FormatMoney(sub.Dunning.AmountCents, sub.Dunning.Currency)),
+		fmt.Sprintf("Outcome: %s", sub.Dunning.Outcome),
+	)
+	return errors.Join(customerErr, staffErr)
+}
+
+// TrialEnding tells a subscriber how many days are left before their free
+// trial ends and billing starts.
+func (n *Notifier) TrialEnding(ctx context.Context, sub payments.Subscription, daysLeft int) error {
+	data := emailData{Brand: n.brand, Subscription: sub, Days: daysLeft}
+	subject := fmt.Sprintf("Your %s trial ends in %d days", n.brand, daysLeft)
+	if daysLeft == 1 {
+		subject = "Your " + n.brand + " trial ends tomorrow"
+	}
+	return n.sendCustomer(ctx, sub.CustomerEmail, subject, "trial_ending", data)
+}
+
+// TrialEnded tells staff whether a trial converted. Subscribers whose trial
+// expired are told their access has ended.
+func (n *Notifier) TrialEnded(ctx context.Context, sub payments.Subscription, converted bool) error {
+	title := "Trial converted"
+	var customerErr error
+	if !converted {
+		title = "Trial expired"
+		data := emailData{Brand: n.brand, Subscription: sub}
+		customerErr = n.sendCustomer(ctx, sub.CustomerEmail, "Your "+n.brand+" trial has ended", "trial_expired", data)
+	}
+	staffErr := n.alertStaff(ctx, title,
+		fmt.Sprintf("Subscription: %s", sub.ID),
+		fmt.Sprintf("Customer: %s", sub.CustomerEmail),
+		fmt.Sprintf("Status: %s", sub.Status),
+	)
+	return errors.Join(customerErr, staffErr)
+}
+
+func (n *Notifier) dunningData(sub payments.Subscription) emailData {
+	return emailData{
+		Brand:        n.brand,
+		Amount:       sub.Dunning.AmountCents,
+		Currency:     sub.Dunning.Currency,
+		URL:          sub.Dunning.PaymentUpdateURL,
+		Subscription: sub,
+	}
+}
+
+// CheckoutRecovery sends an abandoned-checkout reminder with a fresh checkout link.
+func (n *Notifier) CheckoutRecovery(ctx context.Context, notice payments.RecoveryNotice) error {
+	data := emailData{Brand: n.brand, URL: notice.URL}
+	return n.sendCustomer(ctx, notice.Email, "You left something at "+n.brand, "checkout_recovery", data)
+}
+
+// SignInLink emails a customer the magic link that signs them in to their account.
+func (n *Notifier) SignInLink(ctx context.Context, email, url string) error {
+	data := emailData{Brand: n.brand, URL: url}
+	return n.sendCustomer(ctx, email, "Sign in to "+n.brand, "sign_in", data)
+}
+
+func (n *Notifier) sendCustomer(ctx context.Context, to, subject, template string, data emailData) error {
+	if to == "" {
+		return nil
+	}
+	msg, err := n.render([]string{to}, subject, template, data)
+	if err != nil {
+		return err
+	}
+	return n.transport.Send(ctx, msg)
+}
+
+func (n *Notifier) alertStaff(ctx context.Context, title string, lines ...string) error {
+	if len(n.staff) == 0 {
+		return nil
+	}
+	data := emailData{Brand: n.brand, Title: title, Lines: lines}
+	msg, err := n.render(n.staff, "["+n.brand+"] "+title, "staff_alert", data)
+	if err != nil {
+		return err
+	}
+	return n.transport.Send(ctx, msg)
+}
+
+func (n *Notifier) render(to []string, subject, template string, data emailData) (Message, error) {
+	var html, text bytes.Buffer
+	if err := n.html.ExecuteTemplate(&html, template+".html", data); err != nil {
+		return Message{}, fmt.Errorf("render %s.html: %w", template, err)
+	}
+	if err := n.text.ExecuteTemplate(&text, template+".txt", data); err != nil {
+		return Message{}, fmt.Errorf("render %s.txt: %w", template, err)
+	}
+
+	return Message{From: n.from, To: to, Subject: subject, Text: text.String(), HTML: html.String()}, nil
+}
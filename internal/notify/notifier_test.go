@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	webassets "github.com/rjNemo/payit/web"
+)
+
+type captureTransport struct {
+	sent []Message
+}
+
+func (c *captureTransport) Send(ctx context.Context, msg Message) error {
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func newTestNotifier(t *testing.T, staff ...string) (*Notifier, *captureTransport) {
+	t.Helper()
+	transport := &captureTransport{}
+	n, err := New(webassets.Assets, transport, config.MailConfig{From: "shop@example.com", BrandName: "Acme", StaffRecipients: staff})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return n, transport
+}
+
+func TestNotifier_OrderPaidSendsReceiptAndStaffAlert(t *testing.T) {
+	n, transport := newTestNotifier(t, "ops@example.com")
+
+	order := payments.Order{
+		ID:            "cs_1",
+		Quantity:      2,
+		Currency:      "eur",
+		SubtotalCents: 4000,
+		TotalCents:    4760,
+		CustomerEmail: "buyer@example.com",
+		Tax:           &payments.TaxBreakdown{Name: "VAT", TaxCents: 760},
+	}
+	if err := n.OrderPaid(context.Background(), order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(transport.sent) != 2 {
+		t.Fatalf("expected receipt and staff alert, got %d messages", len(transport.sent))
+	}
+	receipt := transport.sent[0]
+	if receipt.To[0] != "buyer@example.com" || receipt.Subject != "Your Acme receipt" {
+		t.Fatalf("unexpected receipt envelope: %#v", receipt)
+	}
+	if !strings.Contains(receipt.Text, "47.60 EUR") || !strings.Contains(receipt.HTML, "VAT") || !strings.Contains(receipt.HTML, "Acme") {
+		t.Fatalf("unexpected receipt body:\n%s\n%s", receipt.Text, receipt.HTML)
+	}
+	alert := transport.sent[1]
+	if alert.To[0] != "ops@example.com" || !strings.Contains(alert.Text, "buyer@example.com") {
+		t.Fatalf("unexpected staff alert: %#v", alert)
+	}
+}
+
+func TestNotifier_SkipsCustomerWithoutEmail(t *testing.T) {
+	n, transport := newTestNotifier(t)
+
+	if err := n.RefundIssued(context.Background(), payments.Order{ID: "cs_1", Currency: "usd"}, 500); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(transport.sent) != 0 {
+		t.Fatalf("expected no messages, got %d", len(transport.sent))
+	}
+}
+
+func TestNotifier_RenewalFailedIncludesUpdateLink(t *testing.T) {
+	n, transport := newTestNotifier(t)
+
+	err := n.RenewalFailed(context.Background(), payments.Event{
+		CustomerEmail:    "sub@example.com",
+		AmountCents:      999,
+		Currency:         "usd",
+		PaymentUpdateURL: "https://invoice.stripe.test/i/1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(transport.sent) != 1 || !strings.Contains(transport.sent[0].HTML, "https://invoice.stripe.test/i/1") {
+		t.Fatalf("expected update link in email, got %#v", transport.sent)
+	}
+}
+
+func TestNotifier_DunningEmails(t *testing.T) {
+	n, transport := newTestNotifier(t, "ops@example.com")
+	sub := payments.Subscription{
+		ID:            "sub_1",
+		CustomerEmail: "sub@example.com",
+		Dunning: &payments.Dunning{
+			GraceUntil:       time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC),
+			AmountCents:      999,
+			Currency:         "usd",
+			PaymentUpdateURL: "https://invoice.stripe.test/i/1",
+		},
+	}
+
+	if err := n.PaymentReminder(context.Background(), sub); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reminder := transport.sent[0]
+	if !strings.Contains(reminder.Text, "15 March 2026") || !strings.Contains(reminder.HTML, "https://invoice.stripe.test/i/1") {
+		t.Fatalf("expected the deadline and update link, got %#v", reminder)
+	}
+
+	sub.Dunning.Outcome = payments.DunningCanceled
+	if err := n.SubscriptionLapsed(context.Background(), sub); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(transport.sent) != 3 || !strings.Contains(transport.sent[1].Text, "has been canceled") || !strings.Contains(transport.sent[2].Text, "Outcome: canceled") {
+		t.Fatalf("expected a cancellation notice and a staff alert, got %#v", transport.sent[1:])
+	}
+}
+
+func TestNotifier_TrialEmails(t *testing.T) {
+	n, transport := newTestNotifier(t, "ops@example.com")
+	sub := payments.Subscription{ID: "sub_1", Status: "trialing", CustomerEmail: "sub@example.com", TrialEnd: time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)}
+
+	if err := n.TrialEnding(context.Background(), sub, 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ending := transport.sent[0]
+	if !strings.Contains(ending.Subject, "ends in 3 days") || !strings.Contains(ending.Text, "15 March 2026") {
+		t.Fatalf("expected the days left and end date, got %#v", ending)
+	}
+
+	sub.Status = "active"
+	if err := n.TrialEnded(context.Background(), sub, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(transport.sent) != 2 || !strings.Contains(transport.sent[1].Text, "Trial converted") {
+		t.Fatalf("expected only a staff alert for a conversion, got %#v", transport.sent[1:])
+	}
+
+	sub.Status = "canceled"
+	if err := n.TrialEnded(context.Background(), sub, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(transport.sent) != 4 || !strings.Contains(transport.sent[2].Text, "trial has ended") {
+		t.Fatalf("expected the subscriber told their trial ended, got %#v", transport.sent[2:])
+	}
+}
+
+type fakeOutbox struct {
+	queued []payments.RecoveryNotice
+}
+
+func (f *fakeOutbox) EnqueueRecovery(ctx context.Context, notice payments.RecoveryNotice) error {
+	f.queued = append(f.queued, notice)
+	return nil
+}
+
+func (f *fakeOutbox) DrainRecoveries(ctx context.Context) ([]payments.RecoveryNotice, error) {
+	notices := f.queued
+	f.queued = nil
+	return notices, nil
+}
+
+func TestNotifier_SignInLink(t *testing.T) {
+	n, transport := newTestNotifier(t, "ops@example.com")
+
+	if err := n.SignInLink(context.Background(), "ada@example.com", "https://shop.example/account/verify?token=abc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(transport.sent) != 1 || transport.sent[0].To[0] != "ada@example.com" {
+		t.Fatalf("expected only the customer to be emailed, got %#v", transport.sent)
+	}
+	if msg := transport.sent[0]; !strings.Contains(msg.Text, "token=abc") || !strings.Contains(msg.HTML, "token=abc") {
+		t.Fatalf("expected the link in both parts, got %q", msg.Text)
+	}
+}
+
+func TestNotifier_DeliversQueuedRecoveries(t *testing.T) {
+	n, transport := newTestNotifier(t)
+	outbox := &fakeOutbox{queued: []payments.RecoveryNotice{{OrderID: "cs_1", Email: "lost@example.com", URL: "https://shop.example/checkout/recover/cs_1"}}}
+
+	n.deliverRecoveries(context.Background(), outbox)
+
+	if len(transport.sent) != 1 || !strings.Contains(transport.sent[0].Text, "https://shop.example/checkout/recover/cs_1") {
+		t.Fatalf("expected recovery email, got %#v", transport.sent)
+	}
+	if len(outbox.queued) != 0 {
+		t.Fatalf("expected outbox to be empty, got %d", len(outbox.queued))
+	}
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// RecoveryOutbox holds recovery notices queued by the checkout service.
+type RecoveryOutbox interface {
+	EnqueueRecovery(ctx context.Context, notice payments.RecoveryNotice) error
+	DrainRecoveries(ctx context.Context) ([]payments.RecoveryNotice, error)
+}
+
+// RunRecoveries delivers queued recovery notices every interval until ctx is
+// done. Notices that fail to send are put back for the next round.
+func (n *Notifier) RunRecoveries(ctx context.Context, outbox RecoveryOutbox, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.deliverRecoveries(ctx, outbox)
+		}
+	}
+}
+
+func (n *Notifier) deliverRecoveries(ctx context.Context, outbox RecoveryOutbox) {
+	notices, err := outbox.DrainRecoveries(ctx)
+	if err != nil {
+		log.Printf("drain recovery outbox: %v", err)
+		return
+	}
+
+	for _, notice := range notices {
+		if err := n.CheckoutRecovery(ctx, notice); err != nil {
+			log.Printf("send recovery for order %s: %v", notice.OrderID, err)
+			if err := outbox.EnqueueRecovery(context.WithoutCancel(ctx), notice); err != nil {
+				log.Printf("requeue recovery for order %s: %v", notice.OrderID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a minimal in-process SMTP server that records one message.
+type smtpStandIn struct {
+	addr       string
+	from       string
+	recipients []string
+	data       string
+	done       chan struct{}
+}
+
+func startSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &smtpStandIn{addr: ln.Addr().String(), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s
+}
+
+func (s *smtpStandIn) serve(c *textproto.Conn) {
+	_ = c.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			_ = c.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			_ = c.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.recipients = append(s.recipients, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			_ = c.PrintfLine("250 OK")
+		case cmd == "DATA":
+			_ = c.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			_ = c.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			_ = c.PrintfLine("221 Bye")
+			return
+		default:
+			_ = c.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPTransport_Send(t *testing.T) {
+	server := startSMTPStandIn(t)
+	host, portRaw, _ := net.SplitHostPort(server.addr)
+	port, _ := net.LookupPort("tcp", portRaw)
+
+	transport := SMTPTransport{Host: host, Port: port}
+	err := transport.Send(context.Background(), Message{
+		From:    "shop@example.com",
+		To:      []string{"buyer@example.com"},
+		Subject: "Your receipt",
+		Text:    "Thanks!",
+		HTML:    "<p>Thanks!</p>",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-server.done
+
+	if server.from != "shop@example.com" {
+		t.Fatalf("unexpected sender: %q", server.from)
+	}
+	if len(server.recipients) != 1 || server.recipients[0] != "buyer@example.com" {
+		t.Fatalf("unexpected recipients: %v", server.recipients)
+	}
+	if !strings.Contains(server.data, "Subject: Your receipt") || !strings.Contains(server.data, "text/html") {
+		t.Fatalf("unexpected message:\n%s", server.data)
+	}
+}
+
+func TestSMTPTransport_SendStopsWhenContextIsCanceled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		// Accept the connection but never greet, like a stuck relay.
+		conn, err := ln.Accept()
+		if err == nil {
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+	host, portRaw, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := net.LookupPort("tcp", portRaw)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- SMTPTransport{Host: host, Port: port}.Send(ctx, Message{
+			From: "shop@example.com", To: []string{"buyer@example.com"}, Subject: "Hi", Text: "Hi",
+		})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Send to return once its context was canceled")
+	}
+}
+
+func TestFileTransport_WritesMaildir(t *testing.T) {
+	dir := t.TempDir()
+	transport := FileTransport{Dir: dir}
+
+	if err := transport.Send(context.Background(), Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "Hi", Text: "Hello"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one message in maildir, got %v (%v)", entries, err)
+	}
+	f, err := os.Open(filepath.Join(dir, "new", entries[0].Name()))
+	if err != nil {
+		t.Fatalf("open message: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	header, err := textproto.NewReader(bufio.NewReader(f)).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	if header.Get("Subject") != "Hi" || header.Get("To") != "b@example.com" {
+		t.Fatalf("unexpected headers: %v", header)
+	}
+}
+
+func TestMessageBytes_EncodesNonASCIISubject(t *testing.T) {
+	raw, err := Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "Reçu", Text: "ok"}.Bytes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(raw), "Subject: =?utf-8?q?") {
+		t.Fatalf("expected encoded subject, got:\n%s", raw)
+	}
+}
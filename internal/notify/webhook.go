@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+// webhookTimeout bounds a single delivery so a slow receiver cannot hold up
+// the provider webhook that triggered it.
+const webhookTimeout = 5 * time.Second
+
+// WebhookNotifier announces payments, refunds and failed renewals to another
+// service with signed JSON POSTs. Receivers verify them with pkg/client.
+type WebhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewWebhookNotifier delivers events to cfg.URL, signed with cfg.Secret.
+func NewWebhookNotifier(cfg config.EventWebhookConfig) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    cfg.URL,
+		secret: cfg.Secret,
+		client: &http.Client{Timeout: webhookTimeout},
+		now:    time.Now,
+	}
+}
+
+// OrderPaid announces order.paid.
+func (n *WebhookNotifier) OrderPaid(ctx context.Context, order payments.Order) error {
+	return n.deliver(ctx, payit.WebhookEvent{
+		Type:          payit.WebhookOrderPaid,
+		Order:         &order,
+		AmountCents:   order.TotalCents,
+		Currency:      order.Currency,
+		CustomerEmail: order.CustomerEmail,
+	})
+}
+
+// RefundIssued announces order.refunded with the newly refunded amount.
+func (n *WebhookNotifier) RefundIssued(ctx context.Context, order payments.Order, amountCents int64) error {
+	return n.deliver(ctx, payit.WebhookEvent{
+		Type:          payit.WebhookOrderRefunded,
+		Order:         &order,
+		AmountCents:   amountCents,
+		Currency:      order.Currency,
+		CustomerEmail: order.CustomerEmail,
+	})
+}
+
+// RenewalFailed announces subscription.renewal_failed.
+func (n *WebhookNotifier) RenewalFailed(ctx context.Context, event payments.Event) error {
+	return n.deliver(ctx, payit.WebhookEvent{
+		Type:           payit.WebhookRenewalFailed,
+		AmountCents:    event.AmountCents,
+		Currency:       event.Currency,
+		SubscriptionID: event.SubscriptionID,
+		CustomerEmail:  event.CustomerEmail,
+	})
+}
+
+// TrialEnding announces subscription.trial_ending.
+func (n *WebhookNotifier) TrialEnding(ctx context.Context, sub payments.Subscription, daysLeft int) error {
+	return n.deliver(ctx, payit.WebhookEvent{
+		Type:           payit.WebhookTrialEnding,
+		SubscriptionID: sub.ID,
+		CustomerEmail:  sub.CustomerEmail,
+		TrialEnd:       sub.TrialEnd,
+		TrialDaysLeft:  daysLeft,
+	})
+}
+
+// TrialEnded announces subscription.trial_converted or subscription.trial_expired.
+func (n *WebhookNotifier) TrialEnded(ctx context.Context, sub payments.Subscription, converted bool) error {
+	event := payit.WebhookEvent{Type: payit.WebhookTrialExpired, SubscriptionID: sub.ID, CustomerEmail: sub.CustomerEmail}
+	if converted {
+		event.Type = payit.WebhookTrialConverted
+	}
+	return n.deliver(ctx, event)
+}
+
+func (n *WebhookNotifier) deliver(ctx context.Context, event payit.WebhookEvent) error {
+	now := n.now()
+	event.ID = "evt_" + rand.Text()
+	event.CreatedAt = now.UTC()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode %s webhook: %w", event.Type, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("build %s webhook: %w", event.Type, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(payit.SignatureHeader, payit.SignWebhook(payload, n.secret, now))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("deliver %s webhook: %w", event.Type, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("deliver %s webhook: receiver answered %s", event.Type, resp.Status)
+	}
+	return nil
+}
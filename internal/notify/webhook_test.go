@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/client"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+func TestWebhookNotifierSignsDeliveries(t *testing.T) {
+	var event payit.WebhookEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		var err error
+		if event, err = client.ParseWebhook(payload, r.Header.Get(payit.SignatureHeader), "whsec_1"); err != nil {
+			t.Errorf("delivery did not verify: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	n := NewWebhookNotifier(config.EventWebhookConfig{URL: srv.URL, Secret: "whsec_1"})
+	order := payments.Order{ID: "cs_1", TotalCents: 5000, Currency: "eur", CustomerEmail: "ana@example.com"}
+	if err := n.RefundIssued(context.Background(), order, 1250); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if event.Type != payit.WebhookOrderRefunded || event.AmountCents != 1250 || event.Order == nil || event.Order.ID != "cs_1" || event.ID == "" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+func TestWebhookNotifierReportsRejections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	n := NewWebhookNotifier(config.EventWebhookConfig{URL: srv.URL, Secret: "whsec_1"})
+	if err := n.OrderPaid(context.Background(), payments.Order{ID: "cs_1"}); err == nil {
+		t.Fatal("expected rejected delivery to be reported")
+	}
+}
@@ -0,0 +1,31 @@
+package payments
+
+// AuditAction names a money-moving or configuration action recorded in the audit log.
+type AuditAction string
+
+// Audited actions.
+const (
+	AuditOrderRefund    AuditAction = "order.refund"
+	AuditOrderCapture   AuditAction = "order.capture"
+	AuditCheckoutCancel AuditAction = "checkout.cancel"
+	// AuditSubscriptionCancel covers subscriptions set to end at period end.
+	AuditSubscriptionCancel AuditAction = "subscription.cancel"
+	// AuditSubscriptionDunning covers subscriptions ended or downgraded for
+	// non-payment.
+	AuditSubscriptionDunning AuditAction = "subscription.dunning"
+	AuditPriceChange         AuditAction = "product.price_change"
+	AuditConfigReload        AuditAction = "config.reload"
+)
+
+// AuditRecord describes one action for the audit log. Who performed it, and
+// from where, is taken from the request context by the audit log itself.
+type AuditRecord struct {
+	Action      AuditAction
+	Target      string
+	AmountCents int64
+	Currency    string
+	// Before and After capture the target's state around the action; either
+	// may be nil.
+	Before any
+	After  any
+}
@@ -0,0 +1,201 @@
+package coupon
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/statefile"
+)
+
+// hold is a redemption set aside for an open checkout.
+type hold struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// state is what the engine keeps across restarts.
+type state struct {
+	// Redeemed counts the paid redemptions per code.
+	Redeemed map[string]int64 `json:"redeemed"`
+	Holds    map[string]hold  `json:"holds"`
+}
+
+// Engine validates promotion codes against the locally configured coupons and
+// tracks how many times each one has been redeemed. A redemption is held for
+// the checkout that applied the code and only counts once it is paid.
+type Engine struct {
+	product config.ProductConfig
+	ttl     time.Duration
+	now     func() time.Time
+	// path is the file the redemption counts are kept in; empty keeps them
+	// in memory.
+	path string
+
+	mu      sync.Mutex
+	coupons map[string]config.CouponConfig
+	state   state
+}
+
+// NewEngine builds a coupon engine for the given product and coupon table,
+// keeping redemptions in memory. Holds lapse after ttl even if the checkout
+// is never closed, so an abandoned checkout cannot use up a code.
+func NewEngine(product config.ProductConfig, coupons []config.CouponConfig, ttl time.Duration) *Engine {
+	byCode := make(map[string]config.CouponConfig, len(coupons))
+	for _, c := range coupons {
+		byCode[normalize(c.Code)] = c
+	}
+
+	return &Engine{
+		product: product,
+		ttl:     ttl,
+		now:     time.Now,
+		coupons: byCode,
+		state:   state{Redeemed: make(map[string]int64), Holds: make(map[string]hold)},
+	}
+}
+
+// Open builds a coupon engine like NewEngine whose redemptions are kept in
+// the file at path, resuming those recorded there.
+func Open(path string, product config.ProductConfig, coupons []config.CouponConfig, ttl time.Duration) (*Engine, error) {
+	e := NewEngine(product, coupons, ttl)
+	e.path = path
+	if err := statefile.Load(path, &e.state); err != nil {
+		return nil, fmt.Errorf("load coupon redemptions: %w", err)
+	}
+	if e.state.Redeemed == nil {
+		e.state.Redeemed = make(map[string]int64)
+	}
+	if e.state.Holds == nil {
+		e.state.Holds = make(map[string]hold)
+	}
+	return e, nil
+}
+
+// Redeem validates code for a purchase of quantity units and, when it applies,
+// holds a redemption for the checkout and returns the resulting discount and
+// the hold's ID.
+func (e *Engine) Redeem(_ context.Context, code string, quantity int64) (payments.Discount, string, error) {
+	code = normalize(code)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c, ok := e.coupons[code]
+	if !ok {
+		return payments.Discount{}, "", fmt.Errorf("%w: %s is not recognised", payments.ErrInvalidPromoCode, code)
+	}
+	if !c.ExpiresAt.IsZero() && !e.now().Before(c.ExpiresAt) {
+		return payments.Discount{}, "", fmt.Errorf("%w: %s has expired", payments.ErrInvalidPromoCode, code)
+	}
+	if c.MaxRedemptions > 0 && e.used(code) >= c.MaxRedemptions {
+		return payments.Discount{}, "", fmt.Errorf("%w: %s has reached its redemption limit", payments.ErrInvalidPromoCode, code)
+	}
+	if len(c.SKUs) > 0 && !slices.Contains(c.SKUs, e.product.SKU) {
+		return payments.Discount{}, "", fmt.Errorf("%w: %s does not apply to this product", payments.ErrInvalidPromoCode, code)
+	}
+
+	subtotal := e.product.PriceCents * quantity
+	if subtotal < c.MinimumAmountCents {
+		return payments.Discount{}, "", fmt.Errorf("%w: %s requires a minimum order of %d cents", payments.ErrInvalidPromoCode, code, c.MinimumAmountCents)
+	}
+
+	discount := payments.Discount{Code: code, StripeCouponID: c.StripeCouponID}
+	if c.PercentOff > 0 {
+		discount.UnitAmountOffCents = e.product.PriceCents * c.PercentOff / 100
+	} else {
+		// Fixed amounts apply to the whole order; spread them per unit and round
+		// down so the customer never receives more than the advertised amount.
+		discount.UnitAmountOffCents = min(c.AmountOffCents/quantity, e.product.PriceCents)
+	}
+	if discount.UnitAmountOffCents <= 0 && discount.StripeCouponID == "" {
+		return payments.Discount{}, "", fmt.Errorf("%w: %s does not reduce this order", payments.ErrInvalidPromoCode, code)
+	}
+
+	id := "red_" + rand.Text()
+	e.state.Holds[id] = hold{Code: code, ExpiresAt: e.now().Add(e.ttl)}
+	if err := e.save(); err != nil {
+		delete(e.state.Holds, id)
+		return payments.Discount{}, "", err
+	}
+	return discount, id, nil
+}
+
+// Commit counts the redemption held under id as used. A checkout paid after
+// its hold lapsed still used the code, so code is counted directly then.
+func (e *Engine) Commit(_ context.Context, id, code string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	h, held := e.state.Holds[id]
+	if held {
+		code = h.Code
+		delete(e.state.Holds, id)
+	}
+	code = normalize(code)
+	e.state.Redeemed[code]++
+	if err := e.save(); err != nil {
+		e.state.Redeemed[code]--
+		if held {
+			e.state.Holds[id] = h
+		}
+		return err
+	}
+	return nil
+}
+
+// Release gives back the redemption held under id, so the code can be used
+// by another checkout.
+func (e *Engine) Release(_ context.Context, id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	h, ok := e.state.Holds[id]
+	if !ok {
+		return fmt.Errorf("redemption %s: %w", id, payments.ErrNotFound)
+	}
+	delete(e.state.Holds, id)
+	if err := e.save(); err != nil {
+		e.state.Holds[id] = h
+		return err
+	}
+	return nil
+}
+
+// used must be called with mu held. It counts code's paid redemptions and
+// those held by open checkouts, forgetting holds that have lapsed.
+func (e *Engine) used(code string) int64 {
+	now := e.now()
+	n := e.state.Redeemed[code]
+	for id, h := range e.state.Holds {
+		if !now.Before(h.ExpiresAt) {
+			delete(e.state.Holds, id)
+			continue
+		}
+		if h.Code == code {
+			n++
+		}
+	}
+	return n
+}
+
+// save must be called with mu held.
+func (e *Engine) save() error {
+	if e.path == "" {
+		return nil
+	}
+	if err := statefile.Save(e.path, e.state); err != nil {
+		return fmt.Errorf("save coupon redemptions: %w", err)
+	}
+	return nil
+}
+
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,133 @@
+package coupon
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+func TestEngine_RedeemPercentOff(t *testing.T) {
+	engine := NewEngine(testProduct(), []config.CouponConfig{{Code: "LAUNCH", PercentOff: 25}}, time.Hour)
+
+	discount, _, err := engine.Redeem(context.Background(), " launch ", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if discount.Code != "LAUNCH" {
+		t.Fatalf("expected normalized code, got %q", discount.Code)
+	}
+	if discount.UnitAmountOffCents != 500 {
+		t.Fatalf("expected 500 off per unit, got %d", discount.UnitAmountOffCents)
+	}
+}
+
+func TestEngine_RedeemAmountOffSpreadsAcrossUnits(t *testing.T) {
+	engine := NewEngine(testProduct(), []config.CouponConfig{{Code: "TENOFF", AmountOffCents: 1000}}, time.Hour)
+
+	discount, _, err := engine.Redeem(context.Background(), "TENOFF", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if discount.UnitAmountOffCents != 333 {
+		t.Fatalf("expected 333 off per unit, got %d", discount.UnitAmountOffCents)
+	}
+}
+
+func TestEngine_RedeemRejections(t *testing.T) {
+	past := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		coupon   config.CouponConfig
+		code     string
+		quantity int64
+	}{
+		{name: "unknown", coupon: config.CouponConfig{Code: "A", PercentOff: 10}, code: "B", quantity: 1},
+		{name: "expired", coupon: config.CouponConfig{Code: "A", PercentOff: 10, ExpiresAt: past}, code: "A", quantity: 1},
+		{name: "other product", coupon: config.CouponConfig{Code: "A", PercentOff: 10, SKUs: []string{"hoodie"}}, code: "A", quantity: 1},
+		{name: "below minimum", coupon: config.CouponConfig{Code: "A", PercentOff: 10, MinimumAmountCents: 5000}, code: "A", quantity: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(testProduct(), []config.CouponConfig{tt.coupon}, time.Hour)
+
+			_, _, err := engine.Redeem(context.Background(), tt.code, tt.quantity)
+			if !errors.Is(err, payments.ErrInvalidPromoCode) {
+				t.Fatalf("expected ErrInvalidPromoCode, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEngine_RedeemEnforcesMaxRedemptions(t *testing.T) {
+	engine := NewEngine(testProduct(), []config.CouponConfig{{Code: "ONCE", PercentOff: 10, MaxRedemptions: 1}}, time.Hour)
+
+	if _, _, err := engine.Redeem(context.Background(), "ONCE", 1); err != nil {
+		t.Fatalf("unexpected error on first redemption: %v", err)
+	}
+	if _, _, err := engine.Redeem(context.Background(), "ONCE", 1); !errors.Is(err, payments.ErrInvalidPromoCode) {
+		t.Fatalf("expected limit error on second redemption, got %v", err)
+	}
+}
+
+func TestEngine_HoldsRedemptionsUntilPaid(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "coupons.json")
+	coupons := []config.CouponConfig{{Code: "ONCE", PercentOff: 10, MaxRedemptions: 1}}
+	engine, err := Open(path, testProduct(), coupons, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return now }
+
+	_, abandoned, err := engine.Redeem(ctx, "ONCE", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := engine.Release(ctx, abandoned); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, lapsed, err := engine.Redeem(ctx, "ONCE", 1)
+	if err != nil {
+		t.Fatalf("expected a released redemption to be free again, got %v", err)
+	}
+
+	// A hold that lapsed frees the code, but paying for it late still counts.
+	now = now.Add(2 * time.Hour)
+	_, paid, err := engine.Redeem(ctx, "ONCE", 1)
+	if err != nil {
+		t.Fatalf("expected a lapsed hold to free the code, got %v", err)
+	}
+	if err := engine.Commit(ctx, paid, "ONCE"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := engine.Commit(ctx, lapsed, "ONCE"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	restarted, err := Open(path, testProduct(), coupons, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := restarted.state.Redeemed["ONCE"]; got != 2 {
+		t.Fatalf("expected both paid redemptions kept across a restart, got %d", got)
+	}
+	if _, _, err := restarted.Redeem(ctx, "ONCE", 1); !errors.Is(err, payments.ErrInvalidPromoCode) {
+		t.Fatalf("expected the limit to hold after a restart, got %v", err)
+	}
+}
+
+func testProduct() config.ProductConfig {
+	return config.ProductConfig{
+		SKU:        "widget",
+		Name:       "Demo Widget",
+		PriceCents: 2000,
+		Currency:   "usd",
+	}
+}
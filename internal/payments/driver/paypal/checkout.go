@@ -0,0 +1,312 @@
+// Package paypal implements the checkout driver for PayPal's Orders v2
+// redirect flow: payit creates an order, the buyer approves it on PayPal, and
+// payit captures it when PayPal sends the buyer back.
+package paypal
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/resilience"
+)
+
+// Name identifies PayPal in provider routes and on orders.
+const Name = "paypal"
+
+// ReturnPath is where PayPal sends buyers after they approve an order; payit
+// captures the payment there.
+const ReturnPath = "/checkout/paypal/return"
+
+// Driver implements the CheckoutDriver interface on PayPal's REST API.
+type Driver struct {
+	api       *client
+	product   config.ProductConfig
+	returnURL string
+	webhookID string
+	policy    *resilience.Policy
+}
+
+// Option customises a Driver.
+type Option func(*Driver)
+
+// WithHTTPClient sends API requests through hc.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(d *Driver) {
+		d.api.http = hc
+	}
+}
+
+// WithPolicy guards every PayPal call with p's timeout, retries and circuit
+// breaker.
+func WithPolicy(p *resilience.Policy) Option {
+	return func(d *Driver) {
+		d.policy = p
+	}
+}
+
+// NewDriver creates a PayPal checkout driver. publicURL is payit's external
+// base URL, used to build the return URL PayPal redirects buyers to.
+func NewDriver(cfg config.PayPalConfig, product config.ProductConfig, publicURL string, opts ...Option) *Driver {
+	d := &Driver{
+		api: &client{
+			baseURL:  cfg.APIURL,
+			clientID: cfg.ClientID,
+			secret:   cfg.ClientSecret,
+			http:     &http.Client{},
+			now:      time.Now,
+		},
+		product:   product,
+		returnURL: publicURL + ReturnPath,
+		webhookID: cfg.WebhookID,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// CreateSession creates a PayPal order and returns the approval link the
+// buyer must visit. The order ID doubles as the session ID.
+func (d *Driver) CreateSession(ctx context.Context, req payments.CheckoutSessionRequest) (payments.CheckoutSessionResult, error) {
+	unit, err := d.purchaseUnit(req)
+	if err != nil {
+		return payments.CheckoutSessionResult{}, err
+	}
+	preference := "NO_SHIPPING"
+	if unit.Shipping != nil {
+		preference = "GET_FROM_FILE"
+	}
+	body := orderRequest{
+		Intent:        "CAPTURE",
+		PurchaseUnits: []purchaseUnit{unit},
+		PaymentSource: paymentSource{PayPal: paypalSource{ExperienceContext: &experienceContext{
+			BrandName:          d.product.Name,
+			UserAction:         "PAY_NOW",
+			ShippingPreference: preference,
+			ReturnURL:          d.returnURL,
+			CancelURL:          d.product.CancelURL,
+		}}},
+	}
+
+	var created order
+	requestID := rand.Text()
+	err = d.call(ctx, func(ctx context.Context) error {
+		return d.api.do(ctx, http.MethodPost, "/v2/checkout/orders", requestID, body, &created)
+	})
+	if err != nil {
+		return payments.CheckoutSessionResult{}, err
+	}
+	approve := findLink(created.Links, "payer-action")
+	if approve == "" {
+		approve = findLink(created.Links, "approve")
+	}
+	if created.ID == "" || approve == "" {
+		return payments.CheckoutSessionResult{}, errors.New("paypal returned an order without an approval link")
+	}
+	return payments.CheckoutSessionResult{ID: created.ID, URL: approve, Provider: Name}, nil
+}
+
+// CheckSupport reports why PayPal cannot serve req, or nil when it can. PayPal
+// has no equivalent of Stripe coupons or Stripe Tax, and only charges whole
+// units of some currencies.
+func (d *Driver) CheckSupport(req payments.CheckoutSessionRequest) error {
+	if req.Discount != nil && req.Discount.UnitAmountOffCents <= 0 {
+		return fmt.Errorf("%w: %s only applies to Stripe checkouts", payments.ErrUnsupportedCheckout, req.Discount.Code)
+	}
+	if req.Tax != nil && req.Tax.Automatic {
+		return fmt.Errorf("%w: paypal cannot calculate tax; use local tax rates with PayPal", payments.ErrUnsupportedCheckout)
+	}
+	amounts := []int64{d.product.PriceCents}
+	if req.Discount != nil {
+		amounts = append(amounts, req.Discount.UnitAmountOffCents)
+	}
+	if req.Tax != nil {
+		amounts = append(amounts, req.Tax.TaxCents)
+	}
+	if req.Shipping != nil && len(req.Shipping.Options) > 0 {
+		amounts = append(amounts, req.Shipping.Options[0].AmountCents)
+	}
+	return checkAmounts(d.product.Currency, amounts...)
+}
+
+// purchaseUnit prices the checkout the way the checkout service did, so the
+// total PayPal charges matches the order.
+func (d *Driver) purchaseUnit(req payments.CheckoutSessionRequest) (purchaseUnit, error) {
+	if err := d.CheckSupport(req); err != nil {
+		return purchaseUnit{}, err
+	}
+	currency := d.product.Currency
+	quantity := max(req.Quantity, 1)
+	itemTotal := d.product.PriceCents * quantity
+	total := itemTotal
+
+	category := "DIGITAL_GOODS"
+	if d.product.Physical {
+		category = "PHYSICAL_GOODS"
+	}
+	unit := purchaseUnit{
+		ReferenceID: d.product.SKU,
+		Items: []item{{
+			Name:        d.product.Name,
+			Description: d.product.Description,
+			SKU:         d.product.SKU,
+			Quantity:    strconv.FormatInt(quantity, 10),
+			UnitAmount:  toMoney(d.product.PriceCents, currency),
+			Category:    category,
+		}},
+	}
+	parts := &breakdown{ItemTotal: toMoneyRef(itemTotal, currency)}
+
+	if req.Discount != nil {
+		off := min(req.Discount.UnitAmountOffCents*quantity, itemTotal)
+		parts.Discount = toMoneyRef(off, currency)
+		total -= off
+	}
+	if req.Tax != nil {
+		if !req.Tax.Inclusive && req.Tax.TaxCents > 0 {
+			parts.TaxTotal = toMoneyRef(req.Tax.TaxCents, currency)
+			total += req.Tax.TaxCents
+		}
+	}
+	if req.Shipping != nil && len(req.Shipping.Options) > 0 {
+		// PayPal only charges the selected option unless a shipping callback
+		// is registered, so the first quoted rate is the one offered.
+		rate := req.Shipping.Options[0]
+		unit.Shipping = &shipping{Options: []shippingOption{{
+			ID:       "rate-0",
+			Label:    rate.Name,
+			Type:     "SHIPPING",
+			Selected: true,
+			Amount:   toMoneyRef(rate.AmountCents, currency),
+		}}}
+		parts.Shipping = toMoneyRef(rate.AmountCents, currency)
+		total += rate.AmountCents
+	}
+
+	unit.Amount = amount{money: toMoney(total, currency), Breakdown: parts}
+	return unit, nil
+}
+
+// CompleteSession captures an order the buyer approved and reports it as a
+// completed checkout. The capture is keyed on the order ID, so capturing twice
+// replays the first result instead of failing.
+func (d *Driver) CompleteSession(ctx context.Context, id string) (payments.Event, error) {
+	var captured order
+	path := "/v2/checkout/orders/" + url.PathEscape(id)
+	err := d.call(ctx, func(ctx context.Context) error {
+		return d.api.do(ctx, http.MethodPost, path+"/capture", "capture-"+id, struct{}{}, &captured)
+	})
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.hasIssue("ORDER_ALREADY_CAPTURED") {
+		err = d.call(ctx, func(ctx context.Context) error {
+			return d.api.do(ctx, http.MethodGet, path, "", nil, &captured)
+		})
+	}
+	switch {
+	case errors.As(err, &apiErr) && apiErr.hasIssue("ORDER_NOT_APPROVED"):
+		return payments.Event{}, fmt.Errorf("%w: paypal order %s was not approved", payments.ErrOrderNotOpen, id)
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		return payments.Event{}, fmt.Errorf("%w: paypal order %s", payments.ErrNotFound, id)
+	case err != nil:
+		return payments.Event{}, err
+	}
+	return orderEvent(captured)
+}
+
+// orderEvent translates a captured order into a completed checkout.
+func orderEvent(o order) (payments.Event, error) {
+	event := payments.Event{Type: payments.EventCheckoutCompleted, SessionID: o.ID}
+	if o.Payer != nil {
+		event.CustomerEmail = o.Payer.EmailAddress
+	}
+	if event.CustomerEmail == "" && o.PaymentSource != nil {
+		event.CustomerEmail = o.PaymentSource.PayPal.EmailAddress
+	}
+	if len(o.PurchaseUnits) == 0 {
+		return event, nil
+	}
+
+	unit := o.PurchaseUnits[0]
+	if unit.Payments != nil && len(unit.Payments.Captures) > 0 {
+		c := unit.Payments.Captures[0]
+		event.PaymentIntentID = c.ID
+		// Pending captures, such as eChecks, complete later by webhook.
+		event.Paid = c.Status == "COMPLETED"
+	}
+	if s := unit.Shipping; s != nil {
+		if s.Address != nil {
+			event.ShippingAddress = &payments.Address{
+				Line1:      s.Address.AddressLine1,
+				Line2:      s.Address.AddressLine2,
+				City:       s.Address.AdminArea2,
+				PostalCode: s.Address.PostalCode,
+				State:      s.Address.AdminArea1,
+				Country:    s.Address.CountryCode,
+			}
+			if s.Name != nil {
+				event.ShippingAddress.Name = s.Name.FullName
+			}
+		}
+		for _, opt := range s.Options {
+			if opt.Selected {
+				event.ShippingRate = opt.Label
+			}
+		}
+	}
+	if b := unit.Amount.Breakdown; b != nil && b.Shipping != nil && event.ShippingRate != "" {
+		cents, err := b.Shipping.cents()
+		if err != nil {
+			return payments.Event{}, err
+		}
+		event.ShippingCents = cents
+	}
+	return event, nil
+}
+
+// ExpireSession is a no-op: PayPal cannot cancel an order, and unapproved
+// orders lapse on their own. Capture on return refuses orders payit closed.
+func (d *Driver) ExpireSession(ctx context.Context, id string) error {
+	return nil
+}
+
+// RefundPayment refunds amountCents of the given capture.
+func (d *Driver) RefundPayment(ctx context.Context, captureID string, amountCents int64) error {
+	if err := checkAmounts(d.product.Currency, amountCents); err != nil {
+		return err
+	}
+	body := refundRequest{Amount: toMoney(amountCents, d.product.Currency)}
+	requestID := rand.Text()
+	return d.call(ctx, func(ctx context.Context) error {
+		return d.api.do(ctx, http.MethodPost, "/v2/payments/captures/"+url.PathEscape(captureID)+"/refund", requestID, body, nil)
+	})
+}
+
+// CapturePayment always fails: PayPal orders are captured when the buyer
+// returns, so there is never a held payment to capture.
+func (d *Driver) CapturePayment(ctx context.Context, paymentID string) error {
+	return fmt.Errorf("%w: paypal payments are captured at checkout", payments.ErrNotCapturable)
+}
+
+func (d *Driver) call(ctx context.Context, fn func(context.Context) error) error {
+	return d.policy.Do(ctx, isTransient, fn)
+}
+
+// isTransient reports whether a PayPal call may succeed if repeated: network
+// failures, rate limiting and server errors.
+func isTransient(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,204 @@
+package paypal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/resilience"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+func TestDriver_CreateSession(t *testing.T) {
+	d, fake := newTestDriver(t)
+
+	res, err := d.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		CheckoutSessionRequest: payit.CheckoutSessionRequest{
+			Quantity: 2,
+		},
+		Discount: &payments.Discount{Code: "LAUNCH", UnitAmountOffCents: 500},
+		Tax:      &payments.TaxBreakdown{Name: "VAT", TaxCents: 800},
+		Shipping: &payments.Shipping{Options: []payments.ShippingOption{{Name: "Colissimo", AmountCents: 450}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ID != "5O190127TN364715T" || res.URL != "https://www.paypal.com/checkoutnow?token=5O190127TN364715T" || res.Provider != Name {
+		t.Fatalf("unexpected session: %#v", res)
+	}
+
+	sent := fake.orders[res.ID]
+	unit := sent.PurchaseUnits[0]
+	// 2 × 25.00 − 10.00 discount + 8.00 tax + 4.50 shipping.
+	if unit.Amount.Value != "52.50" || unit.Amount.CurrencyCode != "EUR" {
+		t.Fatalf("unexpected total: %#v", unit.Amount.money)
+	}
+	b := unit.Amount.Breakdown
+	if b.ItemTotal.Value != "50.00" || b.Discount.Value != "10.00" || b.TaxTotal.Value != "8.00" || b.Shipping.Value != "4.50" {
+		t.Fatalf("unexpected breakdown: %+v", b)
+	}
+	if unit.Items[0].Quantity != "2" || unit.Items[0].UnitAmount.Value != "25.00" {
+		t.Fatalf("unexpected items: %#v", unit.Items)
+	}
+	ctx := sent.PaymentSource.PayPal.ExperienceContext
+	if ctx.ReturnURL != "https://pay.example"+ReturnPath || ctx.CancelURL != "https://shop.example/cancel" || ctx.ShippingPreference != "GET_FROM_FILE" {
+		t.Fatalf("unexpected experience context: %#v", ctx)
+	}
+}
+
+func TestDriver_CreateSessionRejectsStripeOnlyCoupons(t *testing.T) {
+	d, _ := newTestDriver(t)
+	_, err := d.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		Discount: &payments.Discount{Code: "STRIPEONLY", StripeCouponID: "co_1"},
+	})
+	if !errors.Is(err, payments.ErrUnsupportedCheckout) {
+		t.Fatalf("expected the Stripe coupon to be unsupported, got %v", err)
+	}
+	err = d.CheckSupport(payments.CheckoutSessionRequest{Tax: &payments.TaxBreakdown{Automatic: true}})
+	if !errors.Is(err, payments.ErrUnsupportedCheckout) {
+		t.Fatalf("expected automatic tax to be unsupported, got %v", err)
+	}
+}
+
+func TestCheckAmountsRequiresWholeForints(t *testing.T) {
+	if err := checkAmounts("huf", 150000, 250); !errors.Is(err, payments.ErrUnsupportedCheckout) {
+		t.Fatalf("expected fillér to be unsupported, got %v", err)
+	}
+	if err := checkAmounts("eur", 250); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := (money{CurrencyCode: "HUF", Value: "1500.50"}).cents(); err == nil {
+		t.Fatal("expected a forint amount with decimals to be rejected")
+	}
+}
+
+func TestDriver_CachesAccessToken(t *testing.T) {
+	d, fake := newTestDriver(t)
+	now := time.Unix(1_700_000_000, 0)
+	d.api.now = func() time.Time { return now }
+
+	for range 2 {
+		if _, err := d.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fake.tokens != 1 {
+		t.Fatalf("expected one token for both calls, got %d", fake.tokens)
+	}
+
+	now = now.Add(9 * time.Hour)
+	if _, err := d.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.tokens != 2 {
+		t.Fatalf("expected a new token once the old one nears expiry, got %d", fake.tokens)
+	}
+
+	// A token PayPal revoked early is replaced and the call repeated.
+	fake.rejectToken = "token-2"
+	if _, err := d.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.tokens != 3 {
+		t.Fatalf("expected a rejected token to be renewed, got %d", fake.tokens)
+	}
+}
+
+func TestDriver_RetriesWithSameRequestID(t *testing.T) {
+	policy := resilience.New(config.ResilienceConfig{CallTimeout: time.Second, MaxRetries: 2, BreakerThreshold: 10}, resilience.WithBackoff(0))
+	d, fake := newTestDriver(t, WithPolicy(policy))
+	fake.failures = 2
+
+	if _, err := d.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil {
+		t.Fatalf("expected success after two 503s, got %v", err)
+	}
+	if len(fake.requestIDs) != 3 || fake.requestIDs[0] != fake.requestIDs[2] {
+		t.Fatalf("expected one PayPal-Request-Id across retries, got %q", fake.requestIDs)
+	}
+
+	fake.failures = 3
+	_, err := d.CreateSession(context.Background(), payments.CheckoutSessionRequest{})
+	if !errors.Is(err, payments.ErrProviderUnavailable) {
+		t.Fatalf("expected provider unavailable, got %v", err)
+	}
+}
+
+func TestDriver_CompleteSessionCaptures(t *testing.T) {
+	d, _ := newTestDriver(t)
+	res, err := d.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		Shipping: &payments.Shipping{Options: []payments.ShippingOption{{Name: "Colissimo", AmountCents: 450}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	event, err := d.CompleteSession(context.Background(), res.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payments.EventCheckoutCompleted || event.SessionID != res.ID || !event.Paid ||
+		event.PaymentIntentID != "3C679366HH908993F" || event.CustomerEmail != "ada@example.com" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+	if event.ShippingRate != "Colissimo" || event.ShippingCents != 450 || event.ShippingAddress == nil || event.ShippingAddress.City != "Paris" {
+		t.Fatalf("unexpected shipping: %#v %#v", event, event.ShippingAddress)
+	}
+}
+
+func TestDriver_CompleteSessionAlreadyCaptured(t *testing.T) {
+	d, fake := newTestDriver(t)
+	res, err := d.CreateSession(context.Background(), payments.CheckoutSessionRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fake.alreadyCaptured = true
+
+	event, err := d.CompleteSession(context.Background(), res.ID)
+	if err != nil || !event.Paid || event.PaymentIntentID == "" {
+		t.Fatalf("expected the captured order to be read back, got %#v, %v", event, err)
+	}
+
+	if _, err := d.CompleteSession(context.Background(), "UNKNOWN"); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected unknown order to be not found, got %v", err)
+	}
+}
+
+func TestDriver_RefundPayment(t *testing.T) {
+	d, fake := newTestDriver(t)
+
+	if err := d.RefundPayment(context.Background(), "3C679366HH908993F", 1250); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.refundedCapture != "3C679366HH908993F" || len(fake.refunds) != 1 || fake.refunds[0].Amount != (money{CurrencyCode: "EUR", Value: "12.50"}) {
+		t.Fatalf("unexpected refund: %s %#v", fake.refundedCapture, fake.refunds)
+	}
+	if err := d.CapturePayment(context.Background(), "3C679366HH908993F"); !errors.Is(err, payments.ErrNotCapturable) {
+		t.Fatalf("expected manual capture to be unsupported, got %v", err)
+	}
+}
+
+func TestMoneyRoundTrip(t *testing.T) {
+	tests := []struct {
+		cents    int64
+		currency string
+		value    string
+	}{
+		{2500, "eur", "25.00"},
+		{5, "usd", "0.05"},
+		{1200, "jpy", "1200"},
+		{150000, "huf", "1500"},
+		{-3000, "twd", "-30"},
+	}
+	for _, tt := range tests {
+		m := toMoney(tt.cents, tt.currency)
+		if m.Value != tt.value {
+			t.Fatalf("expected %s, got %s", tt.value, m.Value)
+		}
+		if got, err := m.cents(); err != nil || got != tt.cents {
+			t.Fatalf("expected %d back from %s, got %d, %v", tt.cents, tt.value, got, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package paypal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenMargin renews an access token this long before PayPal expires it.
+const tokenMargin = time.Minute
+
+// APIError is a failure response from the PayPal REST API.
+type APIError struct {
+	StatusCode int           `json:"-"`
+	Name       string        `json:"name"`
+	Message    string        `json:"message"`
+	DebugID    string        `json:"debug_id"`
+	Details    []ErrorDetail `json:"details"`
+}
+
+// ErrorDetail names one problem PayPal found with a request.
+type ErrorDetail struct {
+	Issue       string `json:"issue"`
+	Description string `json:"description"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("paypal: %d %s: %s", e.StatusCode, e.Name, e.Message)
+	if len(e.Details) > 0 {
+		msg += " (" + e.Details[0].Issue + ")"
+	}
+	if e.DebugID != "" {
+		msg += " debug_id=" + e.DebugID
+	}
+	return msg
+}
+
+// hasIssue reports whether PayPal flagged the request with issue.
+func (e *APIError) hasIssue(issue string) bool {
+	for _, d := range e.Details {
+		if d.Issue == issue {
+			return true
+		}
+	}
+	return false
+}
+
+// client calls the PayPal REST API with a cached OAuth access token.
+type client struct {
+	baseURL  string
+	clientID string
+	secret   string
+	http     *http.Client
+	now      func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// accessToken returns the cached token, fetching a new one once it is about
+// to expire. Holding the lock while fetching keeps concurrent callers from
+// each requesting their own.
+func (c *client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && c.now().Before(c.expiresAt) {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("paypal: build token request: %w", err)
+	}
+	req.SetBasicAuth(c.clientID, c.secret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("paypal: fetch access token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", decodeError(resp)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.AccessToken == "" {
+		return "", fmt.Errorf("paypal: decode access token: %v", err)
+	}
+	c.token = body.AccessToken
+	c.expiresAt = c.now().Add(time.Duration(body.ExpiresIn)*time.Second - tokenMargin)
+	return c.token, nil
+}
+
+// forget drops token if it is still the cached one, so the next call fetches
+// a fresh token.
+func (c *client) forget(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+// do sends a JSON request and decodes the response into out. requestID, when
+// set, is sent as PayPal-Request-Id so PayPal treats repeats as one request.
+// A rejected token is renewed once.
+func (c *client) do(ctx context.Context, method, path, requestID string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("paypal: encode request: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := c.accessToken(ctx)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("paypal: build request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Prefer", "return=representation")
+		if requestID != "" {
+			req.Header.Set("PayPal-Request-Id", requestID)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return fmt.Errorf("paypal: %s %s: %w", method, path, err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			_ = resp.Body.Close()
+			c.forget(token)
+			continue
+		}
+		return decodeResponse(resp, out)
+	}
+}
+
+func decodeResponse(resp *http.Response, out any) error {
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return decodeError(resp)
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("paypal: decode response: %w", err)
+	}
+	return nil
+}
+
+func decodeError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var body struct {
+		APIError
+		// The token endpoint reports failures in OAuth's format instead.
+		OAuthError       string `json:"error"`
+		OAuthDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body); err == nil {
+		apiErr.Name, apiErr.Message, apiErr.DebugID, apiErr.Details = body.Name, body.Message, body.DebugID, body.Details
+		if apiErr.Name == "" {
+			apiErr.Name, apiErr.Message = body.OAuthError, body.OAuthDescription
+		}
+	}
+	if apiErr.Name == "" {
+		apiErr.Name = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
@@ -0,0 +1,82 @@
+package paypal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// zeroDecimal lists currencies without minor units, which payit, like
+// Stripe, counts in whole units.
+var zeroDecimal = map[string]bool{"JPY": true}
+
+// wholeUnitsOnly lists currencies payit counts in hundredths, like Stripe,
+// but PayPal only accepts in whole units.
+var wholeUnitsOnly = map[string]bool{"HUF": true, "TWD": true}
+
+// checkAmounts reports amounts PayPal cannot charge in currency, such as
+// forint amounts with fillér.
+func checkAmounts(currency string, amounts ...int64) error {
+	if !wholeUnitsOnly[strings.ToUpper(currency)] {
+		return nil
+	}
+	for _, cents := range amounts {
+		if cents%100 != 0 {
+			return fmt.Errorf("%w: paypal only accepts whole %s amounts", payments.ErrUnsupportedCheckout, strings.ToUpper(currency))
+		}
+	}
+	return nil
+}
+
+// toMoney renders minor units as PayPal's decimal string. Amounts in
+// wholeUnitsOnly currencies must have passed checkAmounts.
+func toMoney(cents int64, currency string) money {
+	currency = strings.ToUpper(currency)
+	if zeroDecimal[currency] {
+		return money{CurrencyCode: currency, Value: strconv.FormatInt(cents, 10)}
+	}
+	if wholeUnitsOnly[currency] {
+		return money{CurrencyCode: currency, Value: strconv.FormatInt(cents/100, 10)}
+	}
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return money{CurrencyCode: currency, Value: fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)}
+}
+
+// cents parses a PayPal amount back into minor units.
+func (m money) cents() (int64, error) {
+	whole, frac, _ := strings.Cut(m.Value, ".")
+	if zeroDecimal[strings.ToUpper(m.CurrencyCode)] {
+		if strings.Trim(frac, "0") != "" {
+			return 0, fmt.Errorf("paypal: %s amount %q has decimals", m.CurrencyCode, m.Value)
+		}
+		return strconv.ParseInt(whole, 10, 64)
+	}
+	if wholeUnitsOnly[strings.ToUpper(m.CurrencyCode)] && strings.Trim(frac, "0") != "" {
+		return 0, fmt.Errorf("paypal: %s amount %q has decimals", m.CurrencyCode, m.Value)
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("paypal: amount %q has more than two decimals", m.Value)
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("paypal: amount %q: %w", m.Value, err)
+	}
+	minor, err := strconv.ParseInt(frac+strings.Repeat("0", 2-len(frac)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("paypal: amount %q: %w", m.Value, err)
+	}
+	if strings.HasPrefix(whole, "-") {
+		return units*100 - minor, nil
+	}
+	return units*100 + minor, nil
+}
+
+func toMoneyRef(cents int64, currency string) *money {
+	m := toMoney(cents, currency)
+	return &m
+}
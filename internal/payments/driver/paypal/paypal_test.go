@@ -0,0 +1,181 @@
+package paypal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+)
+
+// fakePayPal is a local stand-in for the PayPal REST API.
+type fakePayPal struct {
+	mu sync.Mutex
+	// tokens counts access tokens issued; every token is "token-<n>".
+	tokens int
+	// rejectToken makes the API refuse this token with 401.
+	rejectToken string
+	// failures answers that many API calls with 503 first.
+	failures int
+	// alreadyCaptured makes captures fail as if done before.
+	alreadyCaptured bool
+	orders          map[string]orderRequest
+	requestIDs      []string
+	refunds         []refundRequest
+	refundedCapture string
+}
+
+func newFakePayPal(t *testing.T) (*fakePayPal, *httptest.Server) {
+	t.Helper()
+	f := &fakePayPal{orders: make(map[string]orderRequest)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/oauth2/token", f.token)
+	mux.HandleFunc("POST /v2/checkout/orders", f.api(f.createOrder))
+	mux.HandleFunc("POST /v2/checkout/orders/{id}/capture", f.api(f.capture))
+	mux.HandleFunc("GET /v2/checkout/orders/{id}", f.api(f.getOrder))
+	mux.HandleFunc("POST /v2/payments/captures/{id}/refund", f.api(f.refund))
+	mux.HandleFunc("POST /v1/notifications/verify-webhook-signature", f.api(f.verify))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakePayPal) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"Client Authentication failed"}`))
+		return
+	}
+	f.mu.Lock()
+	f.tokens++
+	n := f.tokens
+	f.mu.Unlock()
+	writeFakeJSON(w, http.StatusOK, map[string]any{"access_token": fmt.Sprintf("token-%d", n), "expires_in": 32400})
+}
+
+// api checks the bearer token and injected faults before calling next.
+func (f *fakePayPal) api(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		auth := r.Header.Get("Authorization")
+		if auth == "" || auth == "Bearer "+f.rejectToken {
+			writeFakeJSON(w, http.StatusUnauthorized, map[string]any{"name": "AUTHENTICATION_FAILURE", "message": "token expired"})
+			return
+		}
+		if id := r.Header.Get("PayPal-Request-Id"); id != "" {
+			f.requestIDs = append(f.requestIDs, id)
+		}
+		if f.failures > 0 {
+			f.failures--
+			writeFakeJSON(w, http.StatusServiceUnavailable, map[string]any{"name": "SERVICE_UNAVAILABLE", "debug_id": "dbg1"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (f *fakePayPal) createOrder(w http.ResponseWriter, r *http.Request) {
+	var req orderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.orders["5O190127TN364715T"] = req
+	writeFakeJSON(w, http.StatusOK, order{
+		ID:     "5O190127TN364715T",
+		Status: "PAYER_ACTION_REQUIRED",
+		Links: []link{
+			{Rel: "self", Href: "https://api-m.paypal.com/v2/checkout/orders/5O190127TN364715T"},
+			{Rel: "payer-action", Href: "https://www.paypal.com/checkoutnow?token=5O190127TN364715T"},
+		},
+	})
+}
+
+func (f *fakePayPal) capture(w http.ResponseWriter, r *http.Request) {
+	if f.alreadyCaptured {
+		writeFakeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"name":    "UNPROCESSABLE_ENTITY",
+			"details": []ErrorDetail{{Issue: "ORDER_ALREADY_CAPTURED"}},
+		})
+		return
+	}
+	f.getOrder(w, r)
+}
+
+func (f *fakePayPal) getOrder(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	req, ok := f.orders[id]
+	if !ok {
+		writeFakeJSON(w, http.StatusNotFound, map[string]any{"name": "RESOURCE_NOT_FOUND"})
+		return
+	}
+	unit := req.PurchaseUnits[0]
+	unit.Payments = &unitPayments{Captures: []capture{{ID: "3C679366HH908993F", Status: "COMPLETED", Amount: &unit.Amount.money}}}
+	if unit.Shipping != nil {
+		unit.Shipping.Name = &shippingName{FullName: "Ada Lovelace"}
+		unit.Shipping.Address = &address{AddressLine1: "1 Rue de Rivoli", AdminArea2: "Paris", PostalCode: "75001", CountryCode: "FR"}
+	}
+	writeFakeJSON(w, http.StatusCreated, order{
+		ID:            id,
+		Status:        "COMPLETED",
+		Payer:         &payer{EmailAddress: "ada@example.com"},
+		PurchaseUnits: []purchaseUnit{unit},
+	})
+}
+
+func (f *fakePayPal) refund(w http.ResponseWriter, r *http.Request) {
+	var req refundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.refunds = append(f.refunds, req)
+	f.refundedCapture = r.PathValue("id")
+	writeFakeJSON(w, http.StatusCreated, refund{ID: "1JU08902781691411", Status: "COMPLETED", Amount: &req.Amount})
+}
+
+func (f *fakePayPal) verify(w http.ResponseWriter, r *http.Request) {
+	var req verifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	status := "FAILURE"
+	if req.WebhookID == "WH-1" && req.TransmissionSig == "valid-signature" && json.Valid(req.WebhookEvent) {
+		status = "SUCCESS"
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]string{"verification_status": status})
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func testProduct() config.ProductConfig {
+	return config.ProductConfig{
+		SKU:         "demo",
+		Name:        "Demo",
+		Description: "A demo product",
+		PriceCents:  2500,
+		Currency:    "eur",
+		SuccessURL:  "https://shop.example/thanks",
+		CancelURL:   "https://shop.example/cancel",
+	}
+}
+
+func newTestDriver(t *testing.T, opts ...Option) (*Driver, *fakePayPal) {
+	t.Helper()
+	fake, srv := newFakePayPal(t)
+	cfg := config.PayPalConfig{ClientID: "client", ClientSecret: "secret", WebhookID: "WH-1", APIURL: srv.URL}
+	d := NewDriver(cfg, testProduct(), "https://pay.example", append([]Option{WithHTTPClient(srv.Client())}, opts...)...)
+	d.api.now = func() time.Time { return time.Unix(1_700_000_000, 0) }
+	return d, fake
+}
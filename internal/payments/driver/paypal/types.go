@@ -0,0 +1,145 @@
+package paypal
+
+// The subset of PayPal Orders v2 and Payments v2 resources payit uses.
+
+type money struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+type amount struct {
+	money
+	Breakdown *breakdown `json:"breakdown,omitempty"`
+}
+
+type breakdown struct {
+	ItemTotal *money `json:"item_total,omitempty"`
+	Shipping  *money `json:"shipping,omitempty"`
+	TaxTotal  *money `json:"tax_total,omitempty"`
+	Discount  *money `json:"discount,omitempty"`
+}
+
+type item struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	SKU         string `json:"sku,omitempty"`
+	Quantity    string `json:"quantity"`
+	UnitAmount  money  `json:"unit_amount"`
+	Category    string `json:"category,omitempty"`
+}
+
+type purchaseUnit struct {
+	ReferenceID string        `json:"reference_id,omitempty"`
+	Amount      amount        `json:"amount"`
+	Items       []item        `json:"items,omitempty"`
+	Shipping    *shipping     `json:"shipping,omitempty"`
+	Payments    *unitPayments `json:"payments,omitempty"`
+}
+
+type unitPayments struct {
+	Captures []capture `json:"captures,omitempty"`
+}
+
+type shipping struct {
+	Name    *shippingName    `json:"name,omitempty"`
+	Address *address         `json:"address,omitempty"`
+	Options []shippingOption `json:"options,omitempty"`
+}
+
+type shippingName struct {
+	FullName string `json:"full_name"`
+}
+
+type shippingOption struct {
+	ID       string `json:"id"`
+	Label    string `json:"label"`
+	Type     string `json:"type"`
+	Selected bool   `json:"selected"`
+	Amount   *money `json:"amount,omitempty"`
+}
+
+type address struct {
+	AddressLine1 string `json:"address_line_1,omitempty"`
+	AddressLine2 string `json:"address_line_2,omitempty"`
+	AdminArea2   string `json:"admin_area_2,omitempty"`
+	AdminArea1   string `json:"admin_area_1,omitempty"`
+	PostalCode   string `json:"postal_code,omitempty"`
+	CountryCode  string `json:"country_code"`
+}
+
+type orderRequest struct {
+	Intent        string         `json:"intent"`
+	PurchaseUnits []purchaseUnit `json:"purchase_units"`
+	PaymentSource paymentSource  `json:"payment_source"`
+}
+
+type paymentSource struct {
+	PayPal paypalSource `json:"paypal"`
+}
+
+type paypalSource struct {
+	EmailAddress      string             `json:"email_address,omitempty"`
+	ExperienceContext *experienceContext `json:"experience_context,omitempty"`
+}
+
+type experienceContext struct {
+	BrandName          string `json:"brand_name,omitempty"`
+	UserAction         string `json:"user_action"`
+	ShippingPreference string `json:"shipping_preference"`
+	ReturnURL          string `json:"return_url"`
+	CancelURL          string `json:"cancel_url"`
+}
+
+type order struct {
+	ID            string         `json:"id"`
+	Status        string         `json:"status"`
+	Links         []link         `json:"links"`
+	Payer         *payer         `json:"payer,omitempty"`
+	PaymentSource *paymentSource `json:"payment_source,omitempty"`
+	PurchaseUnits []purchaseUnit `json:"purchase_units"`
+}
+
+type payer struct {
+	EmailAddress string `json:"email_address"`
+}
+
+type link struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel"`
+}
+
+type capture struct {
+	ID                string             `json:"id"`
+	Status            string             `json:"status"`
+	Amount            *money             `json:"amount,omitempty"`
+	SupplementaryData *supplementaryData `json:"supplementary_data,omitempty"`
+}
+
+type supplementaryData struct {
+	RelatedIDs struct {
+		OrderID string `json:"order_id"`
+	} `json:"related_ids"`
+}
+
+type refund struct {
+	ID                     string `json:"id"`
+	Status                 string `json:"status"`
+	Amount                 *money `json:"amount,omitempty"`
+	SellerPayableBreakdown *struct {
+		TotalRefundedAmount *money `json:"total_refunded_amount,omitempty"`
+	} `json:"seller_payable_breakdown,omitempty"`
+	Links []link `json:"links"`
+}
+
+type refundRequest struct {
+	Amount money `json:"amount"`
+}
+
+func findLink(links []link, rel string) string {
+	for _, l := range links {
+		if l.Rel == rel {
+			return l.Href
+		}
+	}
+	return ""
+}
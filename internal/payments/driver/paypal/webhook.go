@@ -0,0 +1,129 @@
+package paypal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// signatureHeaders are the transmission headers PayPal signs a webhook with.
+var signatureHeaders = []string{
+	"PAYPAL-AUTH-ALGO",
+	"PAYPAL-CERT-URL",
+	"PAYPAL-TRANSMISSION-ID",
+	"PAYPAL-TRANSMISSION-SIG",
+	"PAYPAL-TRANSMISSION-TIME",
+}
+
+type verifyRequest struct {
+	AuthAlgo         string          `json:"auth_algo"`
+	CertURL          string          `json:"cert_url"`
+	TransmissionID   string          `json:"transmission_id"`
+	TransmissionSig  string          `json:"transmission_sig"`
+	TransmissionTime string          `json:"transmission_time"`
+	WebhookID        string          `json:"webhook_id"`
+	WebhookEvent     json.RawMessage `json:"webhook_event"`
+}
+
+type webhookEvent struct {
+	ID        string          `json:"id"`
+	EventType string          `json:"event_type"`
+	Resource  json.RawMessage `json:"resource"`
+}
+
+// ParseWebhook asks PayPal to verify a delivery's signature and translates
+// the events payit cares about. Unhandled event types come back with an empty
+// Type.
+func (d *Driver) ParseWebhook(ctx context.Context, header http.Header, payload []byte) (payments.Event, error) {
+	if d.webhookID == "" {
+		return payments.Event{}, fmt.Errorf("%w: no paypal webhook id configured", payments.ErrInvalidWebhook)
+	}
+	values := make([]string, len(signatureHeaders))
+	for i, name := range signatureHeaders {
+		if values[i] = header.Get(name); values[i] == "" {
+			return payments.Event{}, fmt.Errorf("%w: missing %s header", payments.ErrInvalidWebhook, name)
+		}
+	}
+	if !json.Valid(payload) {
+		return payments.Event{}, fmt.Errorf("%w: payload is not JSON", payments.ErrInvalidWebhook)
+	}
+
+	body := verifyRequest{
+		AuthAlgo:         values[0],
+		CertURL:          values[1],
+		TransmissionID:   values[2],
+		TransmissionSig:  values[3],
+		TransmissionTime: values[4],
+		WebhookID:        d.webhookID,
+		WebhookEvent:     payload,
+	}
+	var verdict struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	err := d.call(ctx, func(ctx context.Context) error {
+		return d.api.do(ctx, http.MethodPost, "/v1/notifications/verify-webhook-signature", "", body, &verdict)
+	})
+	if err != nil {
+		return payments.Event{}, fmt.Errorf("paypal: verify webhook: %w", err)
+	}
+	if verdict.VerificationStatus != "SUCCESS" {
+		return payments.Event{}, fmt.Errorf("%w: paypal verification %s", payments.ErrInvalidWebhook, verdict.VerificationStatus)
+	}
+
+	var event webhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return payments.Event{}, fmt.Errorf("%w: decode event: %v", payments.ErrInvalidWebhook, err)
+	}
+	return translateEvent(event)
+}
+
+func translateEvent(event webhookEvent) (payments.Event, error) {
+	out := payments.Event{ID: event.ID}
+	switch event.EventType {
+	case "PAYMENT.CAPTURE.COMPLETED", "PAYMENT.CAPTURE.DENIED", "PAYMENT.CAPTURE.DECLINED":
+		var c capture
+		if err := json.Unmarshal(event.Resource, &c); err != nil {
+			return payments.Event{}, fmt.Errorf("%w: decode capture: %v", payments.ErrInvalidWebhook, err)
+		}
+		if c.SupplementaryData == nil || c.SupplementaryData.RelatedIDs.OrderID == "" {
+			return out, nil
+		}
+		out.SessionID = c.SupplementaryData.RelatedIDs.OrderID
+		out.PaymentIntentID = c.ID
+		if event.EventType == "PAYMENT.CAPTURE.COMPLETED" {
+			out.Type = payments.EventCheckoutCompleted
+			out.Paid = true
+		} else {
+			out.Type = payments.EventCheckoutFailed
+		}
+	case "PAYMENT.CAPTURE.REFUNDED":
+		var r refund
+		if err := json.Unmarshal(event.Resource, &r); err != nil {
+			return payments.Event{}, fmt.Errorf("%w: decode refund: %v", payments.ErrInvalidWebhook, err)
+		}
+		// The "up" link points at the refunded capture.
+		if up := findLink(r.Links, "up"); strings.Contains(up, "/captures/") {
+			out.PaymentIntentID = path.Base(up)
+		}
+		total := r.Amount
+		if r.SellerPayableBreakdown != nil && r.SellerPayableBreakdown.TotalRefundedAmount != nil {
+			total = r.SellerPayableBreakdown.TotalRefundedAmount
+		}
+		if total == nil {
+			return payments.Event{}, fmt.Errorf("%w: refund %s has no amount", payments.ErrInvalidWebhook, r.ID)
+		}
+		cents, err := total.cents()
+		if err != nil {
+			return payments.Event{}, fmt.Errorf("%w: %v", payments.ErrInvalidWebhook, err)
+		}
+		out.Type = payments.EventRefundIssued
+		out.AmountCents = cents
+		out.Currency = strings.ToLower(total.CurrencyCode)
+	}
+	return out, nil
+}
@@ -0,0 +1,76 @@
+package paypal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+func signedHeader(signature string) http.Header {
+	h := http.Header{}
+	h.Set("PAYPAL-AUTH-ALGO", "SHA256withRSA")
+	h.Set("PAYPAL-CERT-URL", "https://api-m.paypal.com/v1/notifications/certs/CERT-1")
+	h.Set("PAYPAL-TRANSMISSION-ID", "69cd13f0-d67a-11e5-baa3-778b53f4ae55")
+	h.Set("PAYPAL-TRANSMISSION-SIG", signature)
+	h.Set("PAYPAL-TRANSMISSION-TIME", "2026-10-19T12:00:00Z")
+	return h
+}
+
+func TestParseWebhookCaptureCompleted(t *testing.T) {
+	d, _ := newTestDriver(t)
+	payload := []byte(`{"id":"WH-EVT-1","event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{
+		"id":"3C679366HH908993F","status":"COMPLETED","amount":{"currency_code":"EUR","value":"25.00"},
+		"supplementary_data":{"related_ids":{"order_id":"5O190127TN364715T"}}}}`)
+
+	event, err := d.ParseWebhook(context.Background(), signedHeader("valid-signature"), payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.ID != "WH-EVT-1" || event.Type != payments.EventCheckoutCompleted || !event.Paid ||
+		event.SessionID != "5O190127TN364715T" || event.PaymentIntentID != "3C679366HH908993F" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+func TestParseWebhookRefund(t *testing.T) {
+	d, _ := newTestDriver(t)
+	payload := []byte(`{"id":"WH-EVT-2","event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{
+		"id":"1JU08902781691411","status":"COMPLETED","amount":{"currency_code":"EUR","value":"5.00"},
+		"seller_payable_breakdown":{"total_refunded_amount":{"currency_code":"EUR","value":"15.00"}},
+		"links":[{"rel":"self","href":"https://api-m.paypal.com/v2/payments/refunds/1JU08902781691411"},
+		{"rel":"up","href":"https://api-m.paypal.com/v2/payments/captures/3C679366HH908993F"}]}}`)
+
+	event, err := d.ParseWebhook(context.Background(), signedHeader("valid-signature"), payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Refund events carry the cumulative amount, like Stripe's.
+	if event.Type != payments.EventRefundIssued || event.PaymentIntentID != "3C679366HH908993F" || event.AmountCents != 1500 || event.Currency != "eur" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+func TestParseWebhookRejectsBadSignatures(t *testing.T) {
+	d, _ := newTestDriver(t)
+	payload := []byte(`{"id":"WH-EVT-3","event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{}}`)
+
+	if _, err := d.ParseWebhook(context.Background(), signedHeader("forged"), payload); !errors.Is(err, payments.ErrInvalidWebhook) {
+		t.Fatalf("expected forged signature to be rejected, got %v", err)
+	}
+	if _, err := d.ParseWebhook(context.Background(), http.Header{}, payload); !errors.Is(err, payments.ErrInvalidWebhook) {
+		t.Fatalf("expected unsigned delivery to be rejected, got %v", err)
+	}
+}
+
+func TestParseWebhookIgnoresOtherEvents(t *testing.T) {
+	d, _ := newTestDriver(t)
+	payload := []byte(`{"id":"WH-EVT-4","event_type":"CUSTOMER.DISPUTE.CREATED","resource":{}}`)
+
+	event, err := d.ParseWebhook(context.Background(), signedHeader("valid-signature"), payload)
+	if err != nil || event.Type != "" || event.ID != "WH-EVT-4" {
+		t.Fatalf("expected an acknowledged but ignored event, got %#v, %v", event, err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package router spreads checkouts across several payment drivers by
+// currency, amount, country and weight, failing over to the next eligible
+// provider when one is unavailable.
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/service"
+)
+
+// supportChecker is implemented by drivers that cannot serve every checkout.
+// CheckSupport reports why req is out of reach, or nil.
+type supportChecker interface {
+	CheckSupport(req payments.CheckoutSessionRequest) error
+}
+
+// Router implements service.CheckoutDriver on top of named drivers.
+type Router struct {
+	drivers map[string]service.CheckoutDriver
+	routes  []config.RouteConfig
+	// primary serves follow-up calls for orders that recorded no provider.
+	primary string
+	intn    func(n int) int
+}
+
+// New returns a router over drivers, keyed by provider name. Every route must
+// name one of them.
+func New(drivers map[string]service.CheckoutDriver, routes []config.RouteConfig) (*Router, error) {
+	if len(routes) == 0 {
+		return nil, errors.New("router: at least one route is required")
+	}
+	for i, route := range routes {
+		if _, ok := drivers[route.Provider]; !ok {
+			return nil, fmt.Errorf("router: route %d names unknown provider %q", i, route.Provider)
+		}
+	}
+	return &Router{drivers: drivers, routes: routes, primary: routes[0].Provider, intn: rand.IntN}, nil
+}
+
+// CreateSession opens a session with the first eligible provider, trying the
+// next one whenever a provider reports payments.ErrProviderUnavailable. The
+// result names the provider that served it.
+func (r *Router) CreateSession(ctx context.Context, req payments.CheckoutSessionRequest) (payments.CheckoutSessionResult, error) {
+	providers := r.candidates(req)
+	if len(providers) == 0 {
+		return payments.CheckoutSessionResult{}, fmt.Errorf("%w: %d %s to %q",
+			payments.ErrNoRoute, req.AmountCents, req.Currency, req.Country)
+	}
+
+	var err error
+	for i, provider := range providers {
+		var result payments.CheckoutSessionResult
+		result, err = r.drivers[provider].CreateSession(ctx, req)
+		if err == nil {
+			result.Provider = provider
+			return result, nil
+		}
+		if !errors.Is(err, payments.ErrProviderUnavailable) {
+			return payments.CheckoutSessionResult{}, err
+		}
+		if i < len(providers)-1 {
+			log.Printf("router: %s unavailable, failing over to %s: %v", provider, providers[i+1], err)
+		}
+	}
+	return payments.CheckoutSessionResult{}, err
+}
+
+// Provider returns the driver registered under name.
+func (r *Router) Provider(name string) (service.CheckoutDriver, bool) {
+	d, ok := r.drivers[name]
+	return d, ok
+}
+
+// EnsureCustomer links customer with every provider that keeps customer
+// records, since any of them may end up serving the checkout. A provider that
+// is unavailable is skipped so that failover still works; the customer is
+// linked with it on a later checkout.
+func (r *Router) EnsureCustomer(ctx context.Context, customer payments.Customer) (payments.Customer, error) {
+	for _, provider := range slices.Sorted(maps.Keys(r.drivers)) {
+		d, ok := r.drivers[provider].(service.CustomerDriver)
+		if !ok {
+			continue
+		}
+		linked, err := d.EnsureCustomer(ctx, customer)
+		switch {
+		case errors.Is(err, payments.ErrProviderUnavailable):
+			log.Printf("router: %s unavailable, not linking customer %s: %v", provider, customer.ID, err)
+		case err != nil:
+			return payments.Customer{}, fmt.Errorf("%s: %w", provider, err)
+		default:
+			customer = linked
+		}
+	}
+	return customer, nil
+}
+
+// ExpireSession expires a session with the primary provider. The checkout
+// service sends calls for orders that recorded a provider to that provider
+// through Provider instead.
+func (r *Router) ExpireSession(ctx context.Context, id string) error {
+	return r.drivers[r.primary].ExpireSession(ctx, id)
+}
+
+// RefundPayment refunds through the primary provider.
+func (r *Router) RefundPayment(ctx context.Context, paymentID string, amountCents int64) error {
+	return r.drivers[r.primary].RefundPayment(ctx, paymentID, amountCents)
+}
+
+// CapturePayment captures through the primary provider.
+func (r *Router) CapturePayment(ctx context.Context, paymentID string) error {
+	return r.drivers[r.primary].CapturePayment(ctx, paymentID)
+}
+
+// candidates lists the providers to try for req: eligible weighted routes in
+// a weighted random order, then eligible backups in configured order. Each
+// provider appears once. Subscription checkouts only go to providers that
+// manage subscriptions, and no checkout goes to a provider that reports it
+// cannot serve it.
+func (r *Router) candidates(req payments.CheckoutSessionRequest) []string {
+	var weighted, backups []config.RouteConfig
+	total := 0
+	for _, route := range r.routes {
+		if !matches(route, req) {
+			continue
+		}
+		if _, ok := r.drivers[route.Provider].(service.SubscriptionDriver); req.Subscription != nil && !ok {
+			continue
+		}
+		if c, ok := r.drivers[route.Provider].(supportChecker); ok && c.CheckSupport(req) != nil {
+			continue
+		}
+		if route.Weight > 0 {
+			weighted = append(weighted, route)
+			total += route.Weight
+		} else {
+			backups = append(backups, route)
+		}
+	}
+
+	var providers []string
+	add := func(provider string) {
+		if !slices.Contains(providers, provider) {
+			providers = append(providers, provider)
+		}
+	}
+	for len(weighted) > 0 {
+		pick := r.intn(total)
+		for i, route := range weighted {
+			if pick < route.Weight {
+				add(route.Provider)
+				total -= route.Weight
+				weighted = slices.Delete(weighted, i, i+1)
+				break
+			}
+			pick -= route.Weight
+		}
+	}
+	for _, route := range backups {
+		add(route.Provider)
+	}
+	return providers
+}
+
+func matches(route config.RouteConfig, req payments.CheckoutSessionRequest) bool {
+	if len(route.Currencies) > 0 && !slices.Contains(route.Currencies, strings.ToLower(req.Currency)) {
+		return false
+	}
+	if len(route.Countries) > 0 && !slices.Contains(route.Countries, strings.ToUpper(req.Country)) {
+		return false
+	}
+	if req.AmountCents < route.MinAmountCents {
+		return false
+	}
+	return route.MaxAmountCents == 0 || req.AmountCents <= route.MaxAmountCents
+}
@@ -0,0 +1,235 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/service"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+type fakeDriver struct {
+	name     string
+	err      error
+	sessions int
+	refunds  []string
+}
+
+func (f *fakeDriver) CreateSession(ctx context.Context, req payments.CheckoutSessionRequest) (payments.CheckoutSessionResult, error) {
+	f.sessions++
+	if f.err != nil {
+		return payments.CheckoutSessionResult{}, f.err
+	}
+	return payments.CheckoutSessionResult{ID: f.name + "_session"}, nil
+}
+
+func (f *fakeDriver) ExpireSession(ctx context.Context, id string) error { return f.err }
+
+func (f *fakeDriver) RefundPayment(ctx context.Context, paymentID string, amountCents int64) error {
+	f.refunds = append(f.refunds, fmt.Sprintf("%s:%d", paymentID, amountCents))
+	return f.err
+}
+
+func (f *fakeDriver) CapturePayment(ctx context.Context, paymentID string) error { return f.err }
+
+func newTestRouter(t *testing.T, routes ...config.RouteConfig) (*Router, *fakeDriver, *fakeDriver) {
+	t.Helper()
+	primary, backup := &fakeDriver{name: "primary"}, &fakeDriver{name: "backup"}
+	r, err := New(map[string]service.CheckoutDriver{"primary": primary, "backup": backup}, routes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return r, primary, backup
+}
+
+func TestRouterRecordsProvider(t *testing.T) {
+	r, _, _ := newTestRouter(t, config.RouteConfig{Provider: "primary", Weight: 1})
+
+	res, err := r.CreateSession(context.Background(), payments.CheckoutSessionRequest{Currency: "eur", AmountCents: 2500})
+	if err != nil || res.ID != "primary_session" || res.Provider != "primary" {
+		t.Fatalf("expected primary to serve, got %#v, %v", res, err)
+	}
+}
+
+func TestRouterMatchesRules(t *testing.T) {
+	r, _, _ := newTestRouter(t,
+		config.RouteConfig{Provider: "primary", Currencies: []string{"eur"}, Countries: []string{"FR", "DE"}, MaxAmountCents: 10000, Weight: 1},
+		config.RouteConfig{Provider: "backup", Weight: 1, MinAmountCents: 100},
+	)
+
+	tests := []struct {
+		name string
+		req  payments.CheckoutSessionRequest
+		want string
+	}{
+		{"all rules match", payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Country: "fr"}, Currency: "EUR", AmountCents: 5000}, "primary"},
+		{"other currency", payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Country: "FR"}, Currency: "usd", AmountCents: 5000}, "backup"},
+		{"no country given", payments.CheckoutSessionRequest{Currency: "eur", AmountCents: 5000}, "backup"},
+		{"above max amount", payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Country: "DE"}, Currency: "eur", AmountCents: 10001}, "backup"},
+	}
+	for _, tt := range tests {
+		// Always pick the first weighted route so only eligibility decides.
+		r.intn = func(int) int { return 0 }
+		res, err := r.CreateSession(context.Background(), tt.req)
+		if err != nil || res.Provider != tt.want {
+			t.Fatalf("%s: expected %s, got %#v, %v", tt.name, tt.want, res, err)
+		}
+	}
+
+	_, err := r.CreateSession(context.Background(), payments.CheckoutSessionRequest{Currency: "usd", AmountCents: 50})
+	if !errors.Is(err, payments.ErrNoRoute) || errors.Is(err, payments.ErrProviderUnavailable) {
+		t.Fatalf("expected no route, got %v", err)
+	}
+}
+
+func TestRouterSplitsTrafficByWeight(t *testing.T) {
+	r, primary, backup := newTestRouter(t,
+		config.RouteConfig{Provider: "primary", Weight: 3},
+		config.RouteConfig{Provider: "backup", Weight: 1},
+	)
+	// Walk the first pick of each checkout across the whole weight range.
+	pick := 0
+	r.intn = func(n int) int {
+		if n < 4 {
+			return 0
+		}
+		defer func() { pick++ }()
+		return pick
+	}
+
+	for range 4 {
+		if _, err := r.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if primary.sessions != 3 || backup.sessions != 1 {
+		t.Fatalf("expected a 3:1 split, got %d:%d", primary.sessions, backup.sessions)
+	}
+}
+
+func TestRouterFailsOverWhenUnavailable(t *testing.T) {
+	r, primary, backup := newTestRouter(t,
+		config.RouteConfig{Provider: "primary", Weight: 1},
+		config.RouteConfig{Provider: "backup"},
+	)
+	primary.err = fmt.Errorf("%w: circuit breaker open", payments.ErrProviderUnavailable)
+
+	res, err := r.CreateSession(context.Background(), payments.CheckoutSessionRequest{})
+	if err != nil || res.Provider != "backup" || primary.sessions != 1 {
+		t.Fatalf("expected failover to backup, got %#v, %v", res, err)
+	}
+
+	backup.err = primary.err
+	if _, err := r.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); !errors.Is(err, payments.ErrProviderUnavailable) {
+		t.Fatalf("expected unavailable when every provider is down, got %v", err)
+	}
+}
+
+func TestRouterDoesNotFailOverRejections(t *testing.T) {
+	r, primary, backup := newTestRouter(t,
+		config.RouteConfig{Provider: "primary", Weight: 1},
+		config.RouteConfig{Provider: "backup"},
+	)
+	primary.err = errors.New("invalid currency")
+
+	if _, err := r.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); !errors.Is(err, primary.err) || backup.sessions != 0 {
+		t.Fatalf("expected the rejection without failover, got %v", err)
+	}
+}
+
+type fakeCustomerDriver struct {
+	fakeDriver
+}
+
+func (f *fakeCustomerDriver) EnsureCustomer(ctx context.Context, customer payments.Customer) (payments.Customer, error) {
+	if f.err != nil {
+		return payments.Customer{}, f.err
+	}
+	customer.ProviderIDs = map[string]string{f.name: "cus_" + customer.ID}
+	return customer, nil
+}
+
+func TestRouterEnsuresCustomerWithProvidersThatKeepThem(t *testing.T) {
+	stripe := &fakeCustomerDriver{fakeDriver{name: "stripe"}}
+	r, err := New(map[string]service.CheckoutDriver{"stripe": stripe, "paypal": &fakeDriver{name: "paypal"}},
+		[]config.RouteConfig{{Provider: "stripe", Weight: 1}, {Provider: "paypal"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	customer, err := r.EnsureCustomer(context.Background(), payments.Customer{ID: "cust_1"})
+	if err != nil || customer.ProviderIDs["stripe"] != "cus_cust_1" {
+		t.Fatalf("expected a Stripe customer, got %#v, %v", customer, err)
+	}
+
+	stripe.err = fmt.Errorf("%w: circuit breaker open", payments.ErrProviderUnavailable)
+	if customer, err = r.EnsureCustomer(context.Background(), payments.Customer{ID: "cust_2"}); err != nil || len(customer.ProviderIDs) != 0 {
+		t.Fatalf("expected an unavailable provider to be skipped, got %#v, %v", customer, err)
+	}
+
+	stripe.err = errors.New("invalid email")
+	if _, err := r.EnsureCustomer(context.Background(), payments.Customer{ID: "cust_3"}); !errors.Is(err, stripe.err) {
+		t.Fatalf("expected the rejection, got %v", err)
+	}
+}
+
+type fakeSubscriptionDriver struct {
+	fakeDriver
+}
+
+func (f *fakeSubscriptionDriver) CancelSubscription(ctx context.Context, id string) (payments.Subscription, error) {
+	return payments.Subscription{ID: id}, nil
+}
+
+func TestRouterSendsSubscriptionsToProvidersThatManageThem(t *testing.T) {
+	r, err := New(map[string]service.CheckoutDriver{"stripe": &fakeSubscriptionDriver{fakeDriver{name: "stripe"}}, "paypal": &fakeDriver{name: "paypal"}},
+		[]config.RouteConfig{{Provider: "paypal", Weight: 1}, {Provider: "stripe"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := r.CreateSession(context.Background(), payments.CheckoutSessionRequest{Currency: "eur", Subscription: &payments.SubscriptionPlan{Meter: "api_requests"}})
+	if err != nil || res.Provider != "stripe" {
+		t.Fatalf("expected the subscription to skip paypal, got %#v, %v", res, err)
+	}
+}
+
+// fakeLimitedDriver cannot serve checkouts with automatic tax.
+type fakeLimitedDriver struct {
+	fakeDriver
+}
+
+func (f *fakeLimitedDriver) CheckSupport(req payments.CheckoutSessionRequest) error {
+	if req.Tax != nil && req.Tax.Automatic {
+		return payments.ErrUnsupportedCheckout
+	}
+	return nil
+}
+
+func TestRouterSkipsProvidersThatCannotServeTheCheckout(t *testing.T) {
+	paypal := &fakeLimitedDriver{fakeDriver{name: "paypal"}}
+	r, err := New(map[string]service.CheckoutDriver{"stripe": &fakeDriver{name: "stripe"}, "paypal": paypal},
+		[]config.RouteConfig{{Provider: "paypal", Weight: 1}, {Provider: "stripe"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := r.CreateSession(context.Background(), payments.CheckoutSessionRequest{Tax: &payments.TaxBreakdown{Automatic: true}})
+	if err != nil || res.Provider != "stripe" || paypal.sessions != 0 {
+		t.Fatalf("expected automatic tax to skip paypal, got %#v, %v", res, err)
+	}
+	if res, err := r.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil || res.Provider != "paypal" {
+		t.Fatalf("expected other checkouts to reach paypal, got %#v, %v", res, err)
+	}
+}
+
+func TestNewRejectsUnknownProvider(t *testing.T) {
+	_, err := New(map[string]service.CheckoutDriver{"stripe": &fakeDriver{}}, []config.RouteConfig{{Provider: "paypal"}})
+	if err == nil {
+		t.Fatal("expected unknown provider to be rejected")
+	}
+}
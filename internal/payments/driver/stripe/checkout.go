@@ -3,31 +3,124 @@ package stripe
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/stripe/stripe-go/v83"
 
 	"github.com/rjNemo/payit/config"
 	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/resilience"
 )
 
 type sessionCreator interface {
 	Create(ctx context.Context, params *stripe.CheckoutSessionCreateParams) (*stripe.CheckoutSession, error)
 }
 
+type sessionRetriever interface {
+	Retrieve(ctx context.Context, id string, params *stripe.CheckoutSessionRetrieveParams) (*stripe.CheckoutSession, error)
+}
+
+type sessionExpirer interface {
+	Expire(ctx context.Context, id string, params *stripe.CheckoutSessionExpireParams) (*stripe.CheckoutSession, error)
+}
+
+// Name identifies Stripe in provider routes and on orders.
+const Name = "stripe"
+
+// ReturnPath is where Stripe sends buyers after an embedded checkout, with
+// the session ID in the session_id query parameter.
+const ReturnPath = "/checkout/return"
+
 // Driver implements the CheckoutDriver interface using the Stripe SDK.
 type Driver struct {
-	product  config.ProductConfig
-	sessions sessionCreator
+	product             config.ProductConfig
+	sessions            sessionCreator
+	retriever           sessionRetriever
+	expirer             sessionExpirer
+	refunds             refundCreator
+	captures            paymentCapturer
+	intents             paymentIntentClient
+	customers           customerClient
+	subscriptions       subscriptionClient
+	meterEvents         meterEventCreator
+	meterSummaries      meterEventSummaryLister
+	allowPromotionCodes bool
+	manualCapture       bool
+	sessionTTL          time.Duration
+	// returnURL is set for embedded checkouts, which return to payit
+	// instead of the product's success and cancel URLs.
+	returnURL string
+	policy    *resilience.Policy
+}
+
+// Option customises a Driver.
+type Option func(*Driver)
+
+// WithPromotionCodes lets customers enter Stripe promotion codes on the hosted
+// page for sessions that carry no locally applied discount.
+func WithPromotionCodes(allow bool) Option {
+	return func(d *Driver) {
+		d.allowPromotionCodes = allow
+	}
+}
+
+// WithSessionTTL sets how long each session stays payable before Stripe expires it.
+func WithSessionTTL(ttl time.Duration) Option {
+	return func(d *Driver) {
+		d.sessionTTL = ttl
+	}
+}
+
+// WithManualCapture only authorizes card payments at checkout so they can be
+// captured later.
+func WithManualCapture(manual bool) Option {
+	return func(d *Driver) {
+		d.manualCapture = manual
+	}
+}
+
+// WithEmbeddedUI creates sessions for Stripe's embedded form, mounted on
+// payit's checkout page, which sends buyers back to publicURL's ReturnPath.
+func WithEmbeddedUI(publicURL string) Option {
+	return func(d *Driver) {
+		d.returnURL = publicURL + ReturnPath + "?session_id={CHECKOUT_SESSION_ID}"
+	}
+}
+
+// WithPolicy guards every Stripe call with p's timeout, retries and circuit
+// breaker. Without it calls are made once, unguarded.
+func WithPolicy(p *resilience.Policy) Option {
+	return func(d *Driver) {
+		d.policy = p
+	}
 }
 
 // NewDriver creates a Stripe-backed checkout driver with the provided credentials.
-func NewDriver(apiKey string, product config.ProductConfig) *Driver {
-	stripeClient := stripe.NewClient(apiKey, nil)
+func NewDriver(apiKey string, product config.ProductConfig, opts ...Option) *Driver {
+	// Retries are left to the policy so they share its breaker and budget.
+	backends := stripe.NewBackendsWithConfig(&stripe.BackendConfig{MaxNetworkRetries: stripe.Int64(0)})
+	stripeClient := stripe.NewClient(apiKey, stripe.WithBackends(backends))
 
-	return &Driver{
-		product:  product,
-		sessions: stripeClient.V1CheckoutSessions,
+	d := &Driver{
+		product:        product,
+		sessions:       stripeClient.V1CheckoutSessions,
+		retriever:      stripeClient.V1CheckoutSessions,
+		expirer:        stripeClient.V1CheckoutSessions,
+		refunds:        stripeClient.V1Refunds,
+		captures:       stripeClient.V1PaymentIntents,
+		intents:        stripeClient.V1PaymentIntents,
+		customers:      stripeClient.V1Customers,
+		subscriptions:  stripeClient.V1Subscriptions,
+		meterEvents:    stripeClient.V1BillingMeterEvents,
+		meterSummaries: stripeClient.V1BillingMeterEventSummaries,
+	}
+	for _, opt := range opts {
+		opt(d)
 	}
+	return d
 }
 
 // CreateSession delegates session creation to Stripe, translating domain values to SDK params.
@@ -39,16 +132,66 @@ func (d *Driver) CreateSession(ctx context.Context, req payments.CheckoutSession
 
 	params := &stripe.CheckoutSessionCreateParams{}
 	params.Context = ctx
-	params.SuccessURL = stripe.String(d.product.SuccessURL)
-	params.CancelURL = stripe.String(d.product.CancelURL)
+	if d.returnURL != "" {
+		params.UIMode = stripe.String(string(stripe.CheckoutSessionUIModeEmbedded))
+		params.ReturnURL = stripe.String(d.returnURL)
+	} else {
+		params.SuccessURL = stripe.String(d.product.SuccessURL)
+		params.CancelURL = stripe.String(d.product.CancelURL)
+	}
 	params.Mode = stripe.String(string(stripe.CheckoutSessionModePayment))
 	params.PaymentMethodTypes = stripe.StringSlice([]string{"card"})
+	if d.sessionTTL > 0 {
+		params.ExpiresAt = stripe.Int64(time.Now().Add(d.sessionTTL).Unix())
+	}
+
+	// Stripe takes either a customer, whose email it already knows, or a
+	// bare email.
+	if id := customerID(req.Customer); id != "" {
+		params.Customer = stripe.String(id)
+	} else if req.CustomerEmail != "" {
+		params.CustomerEmail = stripe.String(req.CustomerEmail)
+	}
+	// Caller metadata goes first so payit's own keys win on collision.
+	for key, value := range req.Metadata {
+		params.AddMetadata(key, value)
+	}
+	if req.Subscription != nil {
+		applySubscription(params, req.Subscription)
+		return d.createSession(ctx, params)
+	}
+
+	unitAmount := d.product.PriceCents
+	switch {
+	case req.Discount == nil:
+		if d.allowPromotionCodes {
+			params.AllowPromotionCodes = stripe.Bool(true)
+		}
+	case req.Discount.StripeCouponID != "":
+		params.Discounts = []*stripe.CheckoutSessionCreateDiscountParams{
+			{Coupon: stripe.String(req.Discount.StripeCouponID)},
+		}
+	default:
+		unitAmount = max(unitAmount-req.Discount.UnitAmountOffCents, 0)
+	}
+	if req.Discount != nil {
+		params.AddMetadata("promo_code", req.Discount.Code)
+	}
+	if d.manualCapture || saveCard(req) {
+		params.PaymentIntentData = &stripe.CheckoutSessionCreatePaymentIntentDataParams{}
+	}
+	if d.manualCapture {
+		params.PaymentIntentData.CaptureMethod = stripe.String(string(stripe.PaymentIntentCaptureMethodManual))
+	}
+	if saveCard(req) {
+		params.PaymentIntentData.SetupFutureUsage = stripe.String(string(stripe.PaymentIntentSetupFutureUsageOffSession))
+	}
 
 	params.LineItems = append(params.LineItems, &stripe.CheckoutSessionCreateLineItemParams{
 		Quantity: stripe.Int64(quantity),
 		PriceData: &stripe.CheckoutSessionCreateLineItemPriceDataParams{
 			Currency:   stripe.String(d.product.Currency),
-			UnitAmount: stripe.Int64(d.product.PriceCents),
+			UnitAmount: stripe.Int64(unitAmount),
 			ProductData: &stripe.CheckoutSessionCreateLineItemPriceDataProductDataParams{
 				Name:        stripe.String(d.product.Name),
 				Description: stripe.String(d.product.Description),
@@ -56,7 +199,25 @@ func (d *Driver) CreateSession(ctx context.Context, req payments.CheckoutSession
 		},
 	})
 
-	session, err := d.sessions.Create(ctx, params)
+	if req.Tax != nil {
+		applyTax(params, req.Tax, d.product.Currency)
+	}
+	if req.Shipping != nil {
+		applyShipping(params, req.Shipping, d.product.Currency)
+	}
+
+	return d.createSession(ctx, params)
+}
+
+func (d *Driver) createSession(ctx context.Context, params *stripe.CheckoutSessionCreateParams) (payments.CheckoutSessionResult, error) {
+	params.SetIdempotencyKey(stripe.NewIdempotencyKey())
+	var session *stripe.CheckoutSession
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		session, err = d.sessions.Create(ctx, params)
+		return err
+	})
 	if err != nil {
 		return payments.CheckoutSessionResult{}, err
 	}
@@ -64,5 +225,160 @@ func (d *Driver) CreateSession(ctx context.Context, req payments.CheckoutSession
 		return payments.CheckoutSessionResult{}, errors.New("stripe returned nil session")
 	}
 
-	return payments.CheckoutSessionResult{ID: session.ID, URL: session.URL}, nil
+	result := payments.CheckoutSessionResult{ID: session.ID, URL: session.URL, ClientSecret: session.ClientSecret, Provider: Name}
+	if session.ExpiresAt > 0 {
+		result.ExpiresAt = time.Unix(session.ExpiresAt, 0).UTC()
+	}
+	return result, nil
+}
+
+// CompleteSession reads back an embedded checkout the buyer returned from.
+// Sessions still open were not paid, so the buyer can try again.
+func (d *Driver) CompleteSession(ctx context.Context, id string) (payments.Event, error) {
+	params := &stripe.CheckoutSessionRetrieveParams{}
+	var session *stripe.CheckoutSession
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		session, err = d.retriever.Retrieve(ctx, id, params)
+		return err
+	})
+	var stripeErr *stripe.Error
+	switch {
+	case errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusNotFound:
+		return payments.Event{}, fmt.Errorf("%w: checkout session %s", payments.ErrNotFound, id)
+	case err != nil:
+		return payments.Event{}, err
+	case session == nil:
+		return payments.Event{}, errors.New("stripe returned nil session")
+	}
+
+	switch session.Status {
+	case stripe.CheckoutSessionStatusComplete:
+	case stripe.CheckoutSessionStatusExpired:
+		return payments.Event{}, fmt.Errorf("%w: checkout session %s expired", payments.ErrOrderNotOpen, id)
+	default:
+		return payments.Event{}, fmt.Errorf("%w: checkout session %s is %s", payments.ErrCheckoutIncomplete, id, session.Status)
+	}
+	event := payments.Event{Type: payments.EventCheckoutCompleted}
+	fillSessionEvent(&event, session)
+	return event, nil
+}
+
+// ExpireSession closes an open Checkout Session so it can no longer be paid.
+func (d *Driver) ExpireSession(ctx context.Context, id string) error {
+	params := &stripe.CheckoutSessionExpireParams{}
+	params.SetIdempotencyKey(stripe.NewIdempotencyKey())
+	return d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		_, err := d.expirer.Expire(ctx, id, params)
+		return err
+	})
+}
+
+// applySubscription turns params into a subscription signup for plan's
+// Stripe price. Metered prices bill for usage later, so the line carries no
+// quantity.
+func applySubscription(params *stripe.CheckoutSessionCreateParams, plan *payments.SubscriptionPlan) {
+	params.Mode = stripe.String(string(stripe.CheckoutSessionModeSubscription))
+	params.LineItems = []*stripe.CheckoutSessionCreateLineItemParams{{Price: stripe.String(plan.StripePriceID)}}
+	params.SubscriptionData = &stripe.CheckoutSessionCreateSubscriptionDataParams{}
+	params.SubscriptionData.AddMetadata("plan", plan.Meter)
+	if plan.TrialDays > 0 {
+		params.SubscriptionData.TrialPeriodDays = stripe.Int64(plan.TrialDays)
+	}
+	if plan.TrialWithoutCard {
+		params.PaymentMethodCollection = stripe.String(string(stripe.CheckoutSessionPaymentMethodCollectionIfRequired))
+		// Without a card there is nothing to bill when the trial ends.
+		params.SubscriptionData.TrialSettings = &stripe.CheckoutSessionCreateSubscriptionDataTrialSettingsParams{
+			EndBehavior: &stripe.CheckoutSessionCreateSubscriptionDataTrialSettingsEndBehaviorParams{
+				MissingPaymentMethod: stripe.String("cancel"),
+			},
+		}
+	} else {
+		params.PaymentMethodCollection = stripe.String(string(stripe.CheckoutSessionPaymentMethodCollectionAlways))
+	}
+}
+
+// applyTax enables Stripe Tax for automatic breakdowns and otherwise charges
+// locally computed tax as its own line item. Stripe rejects automatic tax and
+// tax ID collection for an existing customer unless Checkout may save the
+// address and name it collects onto that customer.
+func applyTax(params *stripe.CheckoutSessionCreateParams, tax *payments.TaxBreakdown, currency string) {
+	if tax.Automatic {
+		params.AutomaticTax = &stripe.CheckoutSessionCreateAutomaticTaxParams{Enabled: stripe.Bool(true)}
+		params.TaxIDCollection = &stripe.CheckoutSessionCreateTaxIDCollectionParams{Enabled: stripe.Bool(true)}
+		if params.Customer != nil {
+			params.CustomerUpdate = &stripe.CheckoutSessionCreateCustomerUpdateParams{
+				Address: stripe.String("auto"),
+				Name:    stripe.String("auto"),
+			}
+		}
+		return
+	}
+
+	params.AddMetadata("tax_country", tax.Country)
+	params.AddMetadata("tax_cents", strconv.FormatInt(tax.TaxCents, 10))
+	if tax.ReverseCharge {
+		params.AddMetadata("tax_reverse_charge", tax.TaxID)
+	}
+
+	// Inclusive prices already contain the tax, so only exclusive pricing adds a line.
+	if tax.Inclusive || tax.TaxCents <= 0 {
+		return
+	}
+
+	params.LineItems = append(params.LineItems, &stripe.CheckoutSessionCreateLineItemParams{
+		Quantity: stripe.Int64(1),
+		PriceData: &stripe.CheckoutSessionCreateLineItemPriceDataParams{
+			Currency:   stripe.String(currency),
+			UnitAmount: stripe.Int64(tax.TaxCents),
+			ProductData: &stripe.CheckoutSessionCreateLineItemPriceDataProductDataParams{
+				Name: stripe.String(fmt.Sprintf("%s (%s%%)", tax.Name, formatBasisPoints(tax.RateBasisPoints))),
+			},
+		},
+	})
+}
+
+func formatBasisPoints(bp int64) string {
+	return strconv.FormatFloat(float64(bp)/100, 'f', -1, 64)
+}
+
+// applyShipping asks Stripe to collect a shipping address and offers each
+// quoted rate as an inline fixed-amount shipping option.
+func applyShipping(params *stripe.CheckoutSessionCreateParams, shipping *payments.Shipping, currency string) {
+	params.ShippingAddressCollection = &stripe.CheckoutSessionCreateShippingAddressCollectionParams{
+		AllowedCountries: stripe.StringSlice(shipping.AllowedCountries),
+	}
+	// Automatic tax reads the shipping address, which for an existing
+	// customer Stripe also wants saved.
+	if params.CustomerUpdate != nil {
+		params.CustomerUpdate.Shipping = stripe.String("auto")
+	}
+
+	for _, opt := range shipping.Options {
+		rate := &stripe.CheckoutSessionCreateShippingOptionShippingRateDataParams{
+			Type:        stripe.String("fixed_amount"),
+			DisplayName: stripe.String(opt.Name),
+			FixedAmount: &stripe.CheckoutSessionCreateShippingOptionShippingRateDataFixedAmountParams{
+				Amount:   stripe.Int64(opt.AmountCents),
+				Currency: stripe.String(currency),
+			},
+		}
+		if opt.MinDays > 0 && opt.MaxDays >= opt.MinDays {
+			rate.DeliveryEstimate = &stripe.CheckoutSessionCreateShippingOptionShippingRateDataDeliveryEstimateParams{
+				Minimum: &stripe.CheckoutSessionCreateShippingOptionShippingRateDataDeliveryEstimateMinimumParams{
+					Unit:  stripe.String("business_day"),
+					Value: stripe.Int64(opt.MinDays),
+				},
+				Maximum: &stripe.CheckoutSessionCreateShippingOptionShippingRateDataDeliveryEstimateMaximumParams{
+					Unit:  stripe.String("business_day"),
+					Value: stripe.Int64(opt.MaxDays),
+				},
+			}
+		}
+		params.ShippingOptions = append(params.ShippingOptions, &stripe.CheckoutSessionCreateShippingOptionParams{
+			ShippingRateData: rate,
+		})
+	}
 }
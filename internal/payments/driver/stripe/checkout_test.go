@@ -3,12 +3,16 @@ package stripe
 import (
 	"context"
 	"errors"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/form"
 
 	"github.com/rjNemo/payit/config"
 	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
 )
 
 type fakeSessionCreator struct {
@@ -92,7 +96,7 @@ func TestDriver_CreateSessionWithCustomQuantity(t *testing.T) {
 
 	driver := &Driver{product: product, sessions: fake}
 
-	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{Quantity: 3})
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 3}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -142,3 +146,335 @@ func testProductConfig() config.ProductConfig {
 		CancelURL:   "https://example.com/cancel",
 	}
 }
+
+func TestDriver_CreateSessionAdjustsPriceForDiscount(t *testing.T) {
+	product := testProductConfig()
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{}}
+
+	driver := &Driver{product: product, sessions: fake, allowPromotionCodes: true}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		Discount: &payments.Discount{Code: "LAUNCH", UnitAmountOffCents: 499},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params := fake.lastParams
+	if amount := params.LineItems[0].PriceData.UnitAmount; amount == nil || *amount != 1500 {
+		t.Fatalf("unexpected unit amount: %v", amount)
+	}
+	if params.AllowPromotionCodes != nil {
+		t.Fatal("expected promotion codes to be disabled when a discount is applied")
+	}
+	if params.Metadata["promo_code"] != "LAUNCH" {
+		t.Fatalf("expected promo code metadata, got %#v", params.Metadata)
+	}
+}
+
+func TestDriver_CreateSessionUsesStripeCoupon(t *testing.T) {
+	product := testProductConfig()
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{}}
+
+	driver := &Driver{product: product, sessions: fake}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		Discount: &payments.Discount{Code: "LAUNCH", UnitAmountOffCents: 499, StripeCouponID: "co_123"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params := fake.lastParams
+	if len(params.Discounts) != 1 || params.Discounts[0].Coupon == nil || *params.Discounts[0].Coupon != "co_123" {
+		t.Fatalf("unexpected discounts: %#v", params.Discounts)
+	}
+	if amount := params.LineItems[0].PriceData.UnitAmount; amount == nil || *amount != product.PriceCents {
+		t.Fatalf("expected list price when Stripe applies the coupon, got %v", amount)
+	}
+}
+
+func TestDriver_CreateSessionStartsTrialSubscription(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{ID: "cs_sub"}}
+	driver := &Driver{product: testProductConfig(), sessions: fake}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		CheckoutSessionRequest: payit.CheckoutSessionRequest{
+			Quantity: 1,
+		},
+		Subscription: &payments.SubscriptionPlan{Meter: "api_requests", StripePriceID: "price_metered", TrialDays: 14, TrialWithoutCard: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params := fake.lastParams
+	if *params.Mode != "subscription" || len(params.LineItems) != 1 || *params.LineItems[0].Price != "price_metered" || params.LineItems[0].Quantity != nil {
+		t.Fatalf("expected a subscription to the metered price, got %#v", params)
+	}
+	data := params.SubscriptionData
+	if data == nil || *data.TrialPeriodDays != 14 || data.Metadata["plan"] != "api_requests" {
+		t.Fatalf("expected a 14-day trial, got %#v", data)
+	}
+	if *params.PaymentMethodCollection != "if_required" || *data.TrialSettings.EndBehavior.MissingPaymentMethod != "cancel" {
+		t.Fatalf("expected a cardless trial that cancels without a card, got %v", *params.PaymentMethodCollection)
+	}
+	if params.PaymentIntentData != nil {
+		t.Fatal("subscription checkouts must not set payment intent data")
+	}
+}
+
+func TestDriver_CreateSessionAllowsPromotionCodes(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{}}
+
+	driver := &Driver{product: testProductConfig(), sessions: fake, allowPromotionCodes: true}
+
+	if _, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if allow := fake.lastParams.AllowPromotionCodes; allow == nil || !*allow {
+		t.Fatalf("expected allow_promotion_codes, got %v", allow)
+	}
+}
+
+func TestDriver_CreateSessionAddsExclusiveTaxLine(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{}}
+	driver := &Driver{product: testProductConfig(), sessions: fake}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		Tax: &payments.TaxBreakdown{Country: "DE", Name: "VAT", RateBasisPoints: 1900, TaxCents: 380},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params := fake.lastParams
+	if len(params.LineItems) != 2 {
+		t.Fatalf("expected product and tax line items, got %d", len(params.LineItems))
+	}
+	taxLine := params.LineItems[1]
+	if taxLine.PriceData.UnitAmount == nil || *taxLine.PriceData.UnitAmount != 380 {
+		t.Fatalf("unexpected tax amount: %v", taxLine.PriceData.UnitAmount)
+	}
+	if name := taxLine.PriceData.ProductData.Name; name == nil || *name != "VAT (19%)" {
+		t.Fatalf("unexpected tax line name: %v", name)
+	}
+}
+
+func TestDriver_CreateSessionEnablesAutomaticTax(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{}}
+	driver := &Driver{product: testProductConfig(), sessions: fake}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		Tax: &payments.TaxBreakdown{Automatic: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params := fake.lastParams
+	if params.AutomaticTax == nil || params.AutomaticTax.Enabled == nil || !*params.AutomaticTax.Enabled {
+		t.Fatalf("expected automatic tax, got %#v", params.AutomaticTax)
+	}
+	if len(params.LineItems) != 1 {
+		t.Fatalf("expected no extra tax line, got %d items", len(params.LineItems))
+	}
+}
+
+func TestDriver_CreateSessionLetsCheckoutUpdateTaxedCustomer(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{}}
+	driver := &Driver{product: testProductConfig(), sessions: fake}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		Customer: &payments.Customer{ID: "cust_1", ProviderIDs: map[string]string{Name: "cus_1"}},
+		Tax:      &payments.TaxBreakdown{Automatic: true},
+		Shipping: &payments.Shipping{AllowedCountries: []string{"FR"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	values := &form.Values{}
+	form.AppendTo(values, fake.lastParams)
+	for key, want := range map[string]string{
+		"customer":                   "cus_1",
+		"automatic_tax[enabled]":     "true",
+		"tax_id_collection[enabled]": "true",
+		"customer_update[address]":   "auto",
+		"customer_update[name]":      "auto",
+		"customer_update[shipping]":  "auto",
+	} {
+		if got := values.Get(key); len(got) != 1 || got[0] != want {
+			t.Fatalf("expected %s=%s, got %v in %s", key, want, got, values.Encode())
+		}
+	}
+
+	// Without a customer, Stripe creates one from what Checkout collects.
+	if _, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{Tax: &payments.TaxBreakdown{Automatic: true}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.lastParams.CustomerUpdate != nil {
+		t.Fatalf("expected no customer update without a customer, got %#v", fake.lastParams.CustomerUpdate)
+	}
+}
+
+func TestDriver_CreateSessionCollectsShipping(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{}}
+	driver := &Driver{product: testProductConfig(), sessions: fake}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		Shipping: &payments.Shipping{
+			AllowedCountries: []string{"FR", "DE"},
+			Options: []payments.ShippingOption{
+				{Name: "Standard", AmountCents: 500, MinDays: 3, MaxDays: 5},
+				{Name: "Free", AmountCents: 0},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params := fake.lastParams
+	if params.ShippingAddressCollection == nil || len(params.ShippingAddressCollection.AllowedCountries) != 2 {
+		t.Fatalf("expected address collection, got %#v", params.ShippingAddressCollection)
+	}
+	if len(params.ShippingOptions) != 2 {
+		t.Fatalf("expected two shipping options, got %d", len(params.ShippingOptions))
+	}
+	standard := params.ShippingOptions[0].ShippingRateData
+	if standard.FixedAmount == nil || *standard.FixedAmount.Amount != 500 || standard.DeliveryEstimate == nil {
+		t.Fatalf("unexpected standard rate: %#v", standard)
+	}
+	if free := params.ShippingOptions[1].ShippingRateData; free.DeliveryEstimate != nil {
+		t.Fatalf("expected no delivery estimate without days, got %#v", free.DeliveryEstimate)
+	}
+}
+
+type fakeSessionExpirer struct {
+	id string
+}
+
+func (f *fakeSessionExpirer) Expire(ctx context.Context, id string, params *stripe.CheckoutSessionExpireParams) (*stripe.CheckoutSession, error) {
+	f.id = id
+	return &stripe.CheckoutSession{ID: id}, nil
+}
+
+func TestDriver_CreateSessionForCustomer(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{ID: "cs_test_123"}}
+	driver := &Driver{product: testProductConfig(), sessions: fake}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{
+		CheckoutSessionRequest: payit.CheckoutSessionRequest{
+			CustomerEmail: "ada@example.com",
+		},
+		Customer: &payments.Customer{ID: "cust_1", ProviderIDs: map[string]string{Name: "cus_1"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params := fake.lastParams; params.Customer == nil || *params.Customer != "cus_1" || params.CustomerEmail != nil {
+		t.Fatalf("expected the Stripe customer instead of the email, got %v %v", params.Customer, params.CustomerEmail)
+	}
+}
+
+func TestDriver_ExpireSession(t *testing.T) {
+	expirer := &fakeSessionExpirer{}
+	driver := &Driver{product: testProductConfig(), expirer: expirer}
+
+	if err := driver.ExpireSession(context.Background(), "cs_test_1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expirer.id != "cs_test_1" {
+		t.Fatalf("expected cs_test_1 to be expired, got %q", expirer.id)
+	}
+}
+
+func TestDriver_CreateSessionSetsExpiry(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{ID: "cs_1", ExpiresAt: expiresAt}}
+	driver := &Driver{product: testProductConfig(), sessions: fake, sessionTTL: time.Hour}
+
+	res, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := fake.lastParams.ExpiresAt
+	if got == nil || *got < time.Now().Add(59*time.Minute).Unix() || *got > time.Now().Add(time.Hour).Unix() {
+		t.Fatalf("unexpected expires_at: %v", got)
+	}
+	if res.ExpiresAt.Unix() != expiresAt {
+		t.Fatalf("expected expiry in result, got %v", res.ExpiresAt)
+	}
+}
+
+func TestDriver_CreateSessionEmbedded(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{ID: "cs_1", ClientSecret: "cs_1_secret"}}
+	driver := &Driver{product: testProductConfig(), sessions: fake}
+	WithEmbeddedUI("https://pay.example")(driver)
+
+	res, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ClientSecret != "cs_1_secret" || res.URL != "" {
+		t.Fatalf("expected a client secret instead of a URL, got %#v", res)
+	}
+
+	params := fake.lastParams
+	if params.UIMode == nil || *params.UIMode != string(stripe.CheckoutSessionUIModeEmbedded) {
+		t.Fatalf("unexpected ui mode: %v", params.UIMode)
+	}
+	if params.ReturnURL == nil || *params.ReturnURL != "https://pay.example/checkout/return?session_id={CHECKOUT_SESSION_ID}" {
+		t.Fatalf("unexpected return URL: %v", params.ReturnURL)
+	}
+	if params.SuccessURL != nil || params.CancelURL != nil {
+		t.Fatal("expected no success or cancel URL for embedded sessions")
+	}
+}
+
+type fakeSessionRetriever struct {
+	session *stripe.CheckoutSession
+	err     error
+}
+
+func (f *fakeSessionRetriever) Retrieve(ctx context.Context, id string, params *stripe.CheckoutSessionRetrieveParams) (*stripe.CheckoutSession, error) {
+	return f.session, f.err
+}
+
+func TestDriver_CompleteSession(t *testing.T) {
+	retriever := &fakeSessionRetriever{session: &stripe.CheckoutSession{
+		ID:              "cs_1",
+		Status:          stripe.CheckoutSessionStatusComplete,
+		PaymentStatus:   stripe.CheckoutSessionPaymentStatusPaid,
+		PaymentIntent:   &stripe.PaymentIntent{ID: "pi_1"},
+		CustomerDetails: &stripe.CheckoutSessionCustomerDetails{Email: "ada@example.com"},
+	}}
+	driver := &Driver{product: testProductConfig(), retriever: retriever}
+
+	event, err := driver.CompleteSession(context.Background(), "cs_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payments.EventCheckoutCompleted || event.SessionID != "cs_1" || !event.Paid ||
+		event.PaymentIntentID != "pi_1" || event.CustomerEmail != "ada@example.com" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+
+	retriever.session.Status = stripe.CheckoutSessionStatusOpen
+	if _, err := driver.CompleteSession(context.Background(), "cs_1"); !errors.Is(err, payments.ErrCheckoutIncomplete) {
+		t.Fatalf("expected ErrCheckoutIncomplete for an open session, got %v", err)
+	}
+
+	retriever.session.Status = stripe.CheckoutSessionStatusExpired
+	if _, err := driver.CompleteSession(context.Background(), "cs_1"); !errors.Is(err, payments.ErrOrderNotOpen) {
+		t.Fatalf("expected ErrOrderNotOpen for an expired session, got %v", err)
+	}
+
+	retriever.err = &stripe.Error{HTTPStatusCode: http.StatusNotFound}
+	if _, err := driver.CompleteSession(context.Background(), "cs_missing"); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
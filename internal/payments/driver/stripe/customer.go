@@ -0,0 +1,64 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"maps"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type customerClient interface {
+	Create(ctx context.Context, params *stripe.CustomerCreateParams) (*stripe.Customer, error)
+	ListPaymentMethods(ctx context.Context, params *stripe.CustomerListPaymentMethodsParams) stripe.Seq2[*stripe.PaymentMethod, error]
+}
+
+// EnsureCustomer creates a Stripe customer for customer unless one is already
+// recorded under Name, so every checkout by the same buyer lands on it.
+func (d *Driver) EnsureCustomer(ctx context.Context, customer payments.Customer) (payments.Customer, error) {
+	if customer.ProviderIDs[Name] != "" {
+		return customer, nil
+	}
+
+	params := &stripe.CustomerCreateParams{Email: stripe.String(customer.Email)}
+	if customer.Name != "" {
+		params.Name = stripe.String(customer.Name)
+	}
+	if customer.Locale != "" {
+		params.PreferredLocales = stripe.StringSlice([]string{customer.Locale})
+	}
+	params.AddMetadata("payit_customer_id", customer.ID)
+
+	// Keyed by payit's ID so a retried call cannot create a second customer.
+	params.SetIdempotencyKey("customer-" + customer.ID)
+	var created *stripe.Customer
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		created, err = d.customers.Create(ctx, params)
+		return err
+	})
+	if err != nil {
+		return payments.Customer{}, err
+	}
+	if created == nil {
+		return payments.Customer{}, errors.New("stripe returned nil customer")
+	}
+
+	customer.ProviderIDs = maps.Clone(customer.ProviderIDs)
+	if customer.ProviderIDs == nil {
+		customer.ProviderIDs = make(map[string]string)
+	}
+	customer.ProviderIDs[Name] = created.ID
+	return customer, nil
+}
+
+// customerID returns the Stripe customer recorded for customer, if any.
+func customerID(customer *payments.Customer) string {
+	if customer == nil {
+		return ""
+	}
+	return customer.ProviderIDs[Name]
+}
@@ -0,0 +1,56 @@
+package stripe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeCustomers struct {
+	created []*stripe.CustomerCreateParams
+	methods []*stripe.PaymentMethod
+	listed  *stripe.CustomerListPaymentMethodsParams
+}
+
+func (f *fakeCustomers) Create(ctx context.Context, params *stripe.CustomerCreateParams) (*stripe.Customer, error) {
+	f.created = append(f.created, params)
+	return &stripe.Customer{ID: "cus_1"}, nil
+}
+
+func (f *fakeCustomers) ListPaymentMethods(ctx context.Context, params *stripe.CustomerListPaymentMethodsParams) stripe.Seq2[*stripe.PaymentMethod, error] {
+	f.listed = params
+	return func(yield func(*stripe.PaymentMethod, error) bool) {
+		for _, pm := range f.methods {
+			if !yield(pm, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestDriver_EnsureCustomer(t *testing.T) {
+	fake := &fakeCustomers{}
+	driver := &Driver{customers: fake}
+
+	customer, err := driver.EnsureCustomer(context.Background(), payments.Customer{ID: "cust_1", Email: "ada@example.com", Name: "Ada", Locale: "en-GB"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if customer.ProviderIDs[Name] != "cus_1" {
+		t.Fatalf("expected the Stripe customer ID to be recorded, got %#v", customer.ProviderIDs)
+	}
+	params := fake.created[0]
+	if *params.Email != "ada@example.com" || *params.Name != "Ada" || *params.PreferredLocales[0] != "en-GB" || params.Metadata["payit_customer_id"] != "cust_1" {
+		t.Fatalf("unexpected params: %#v", params)
+	}
+	if params.IdempotencyKey == nil || *params.IdempotencyKey != "customer-cust_1" {
+		t.Fatalf("expected an idempotency key derived from the customer, got %v", params.IdempotencyKey)
+	}
+
+	if _, err := driver.EnsureCustomer(context.Background(), customer); err != nil || len(fake.created) != 1 {
+		t.Fatalf("expected a linked customer to be left alone, got %d creates, %v", len(fake.created), err)
+	}
+}
@@ -0,0 +1,126 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type paymentIntentClient interface {
+	Create(ctx context.Context, params *stripe.PaymentIntentCreateParams) (*stripe.PaymentIntent, error)
+	Retrieve(ctx context.Context, id string, params *stripe.PaymentIntentRetrieveParams) (*stripe.PaymentIntent, error)
+	Cancel(ctx context.Context, id string, params *stripe.PaymentIntentCancelParams) (*stripe.PaymentIntent, error)
+}
+
+// CreatePaymentIntent opens a card payment for the order total that the buyer
+// confirms with Stripe Elements. The total already includes any discount and
+// tax the checkout service resolved.
+func (d *Driver) CreatePaymentIntent(ctx context.Context, req payments.CheckoutSessionRequest) (payments.PaymentIntent, error) {
+	params := &stripe.PaymentIntentCreateParams{
+		Amount:             stripe.Int64(req.AmountCents),
+		Currency:           stripe.String(req.Currency),
+		Description:        stripe.String(d.product.Name),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+	}
+	if d.manualCapture {
+		params.CaptureMethod = stripe.String(string(stripe.PaymentIntentCaptureMethodManual))
+	}
+	if req.CustomerEmail != "" {
+		params.ReceiptEmail = stripe.String(req.CustomerEmail)
+	}
+	if id := customerID(req.Customer); id != "" {
+		params.Customer = stripe.String(id)
+	}
+	if saveCard(req) {
+		params.SetupFutureUsage = stripe.String(string(stripe.PaymentIntentSetupFutureUsageOffSession))
+	}
+	for key, value := range req.Metadata {
+		params.AddMetadata(key, value)
+	}
+	params.AddMetadata("quantity", strconv.FormatInt(req.Quantity, 10))
+	if req.Discount != nil {
+		params.AddMetadata("promo_code", req.Discount.Code)
+	}
+	if req.Tax != nil {
+		params.AddMetadata("tax_country", req.Tax.Country)
+		params.AddMetadata("tax_cents", strconv.FormatInt(req.Tax.TaxCents, 10))
+		if req.Tax.ReverseCharge {
+			params.AddMetadata("tax_reverse_charge", req.Tax.TaxID)
+		}
+	}
+
+	params.SetIdempotencyKey(stripe.NewIdempotencyKey())
+	var intent *stripe.PaymentIntent
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		intent, err = d.intents.Create(ctx, params)
+		return err
+	})
+	if err != nil {
+		return payments.PaymentIntent{}, err
+	}
+	if intent == nil {
+		return payments.PaymentIntent{}, errors.New("stripe returned nil payment intent")
+	}
+
+	result := paymentIntent(intent)
+	result.ClientSecret = intent.ClientSecret
+	return result, nil
+}
+
+// PaymentIntent reads back the current state of a payment intent.
+func (d *Driver) PaymentIntent(ctx context.Context, id string) (payments.PaymentIntent, error) {
+	params := &stripe.PaymentIntentRetrieveParams{}
+	var intent *stripe.PaymentIntent
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		intent, err = d.intents.Retrieve(ctx, id, params)
+		return err
+	})
+	var stripeErr *stripe.Error
+	switch {
+	case errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusNotFound:
+		return payments.PaymentIntent{}, fmt.Errorf("%w: payment intent %s", payments.ErrNotFound, id)
+	case err != nil:
+		return payments.PaymentIntent{}, err
+	case intent == nil:
+		return payments.PaymentIntent{}, errors.New("stripe returned nil payment intent")
+	}
+	return paymentIntent(intent), nil
+}
+
+// CancelPaymentIntent abandons a payment intent so it can no longer be confirmed.
+func (d *Driver) CancelPaymentIntent(ctx context.Context, id string) error {
+	params := &stripe.PaymentIntentCancelParams{}
+	params.SetIdempotencyKey(stripe.NewIdempotencyKey())
+	return d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		_, err := d.intents.Cancel(ctx, id, params)
+		return err
+	})
+}
+
+// paymentIntent translates a Stripe PaymentIntent, leaving out the client
+// secret so status lookups never hand it out.
+func paymentIntent(intent *stripe.PaymentIntent) payments.PaymentIntent {
+	result := payments.PaymentIntent{
+		ID:            intent.ID,
+		Status:        payments.PaymentIntentStatus(intent.Status),
+		AmountCents:   intent.Amount,
+		Currency:      string(intent.Currency),
+		CustomerEmail: intent.ReceiptEmail,
+		Provider:      Name,
+	}
+	if next := intent.NextAction; next != nil && next.RedirectToURL != nil {
+		result.NextActionURL = next.RedirectToURL.URL
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+type fakePaymentIntents struct {
+	lastParams *stripe.PaymentIntentCreateParams
+	intent     *stripe.PaymentIntent
+	err        error
+	canceled   string
+}
+
+func (f *fakePaymentIntents) Create(ctx context.Context, params *stripe.PaymentIntentCreateParams) (*stripe.PaymentIntent, error) {
+	f.lastParams = params
+	return f.intent, f.err
+}
+
+func (f *fakePaymentIntents) Retrieve(ctx context.Context, id string, params *stripe.PaymentIntentRetrieveParams) (*stripe.PaymentIntent, error) {
+	return f.intent, f.err
+}
+
+func (f *fakePaymentIntents) Cancel(ctx context.Context, id string, params *stripe.PaymentIntentCancelParams) (*stripe.PaymentIntent, error) {
+	f.canceled = id
+	return f.intent, f.err
+}
+
+func TestDriver_CreatePaymentIntent(t *testing.T) {
+	fake := &fakePaymentIntents{intent: &stripe.PaymentIntent{
+		ID:           "pi_1",
+		ClientSecret: "pi_1_secret",
+		Status:       stripe.PaymentIntentStatusRequiresPaymentMethod,
+		Amount:       3600,
+		Currency:     "eur",
+	}}
+	driver := &Driver{product: testProductConfig(), intents: fake, manualCapture: true}
+
+	intent, err := driver.CreatePaymentIntent(context.Background(), payments.CheckoutSessionRequest{
+		CheckoutSessionRequest: payit.CheckoutSessionRequest{
+			Quantity: 2,
+		},
+		Discount:    &payments.Discount{Code: "TEN"},
+		Currency:    "eur",
+		AmountCents: 3600,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if intent.ID != "pi_1" || intent.ClientSecret != "pi_1_secret" || intent.Provider != Name ||
+		intent.Status != payments.PaymentIntentRequiresPaymentMethod {
+		t.Fatalf("unexpected intent: %#v", intent)
+	}
+
+	params := fake.lastParams
+	if params.Amount == nil || *params.Amount != 3600 || params.Currency == nil || *params.Currency != "eur" {
+		t.Fatalf("unexpected amount: %v %v", params.Amount, params.Currency)
+	}
+	if params.CaptureMethod == nil || *params.CaptureMethod != string(stripe.PaymentIntentCaptureMethodManual) {
+		t.Fatalf("expected manual capture, got %v", params.CaptureMethod)
+	}
+	if params.Metadata["promo_code"] != "TEN" || params.IdempotencyKey == nil {
+		t.Fatalf("expected promo metadata and an idempotency key, got %#v", params.Params)
+	}
+}
+
+func TestDriver_PaymentIntentReportsNextAction(t *testing.T) {
+	fake := &fakePaymentIntents{intent: &stripe.PaymentIntent{
+		ID:           "pi_1",
+		ClientSecret: "pi_1_secret",
+		Status:       stripe.PaymentIntentStatusRequiresAction,
+		NextAction: &stripe.PaymentIntentNextAction{
+			RedirectToURL: &stripe.PaymentIntentNextActionRedirectToURL{URL: "https://hooks.stripe.com/3ds"},
+		},
+	}}
+	driver := &Driver{product: testProductConfig(), intents: fake}
+
+	intent, err := driver.PaymentIntent(context.Background(), "pi_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if intent.Status != payments.PaymentIntentRequiresAction || intent.NextActionURL != "https://hooks.stripe.com/3ds" {
+		t.Fatalf("unexpected intent: %#v", intent)
+	}
+	if intent.ClientSecret != "" {
+		t.Fatal("expected status lookups to leave out the client secret")
+	}
+
+	fake.err = &stripe.Error{HTTPStatusCode: http.StatusNotFound}
+	if _, err := driver.PaymentIntent(context.Background(), "pi_missing"); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// saveCard reports whether the card used for req should stay on the buyer's
+// Stripe customer for later off-session charges.
+func saveCard(req payments.CheckoutSessionRequest) bool {
+	return req.SavePaymentMethod && customerID(req.Customer) != ""
+}
+
+// PaymentMethods lists the cards saved on customer's Stripe customer.
+func (d *Driver) PaymentMethods(ctx context.Context, customer payments.Customer) ([]payments.PaymentMethod, error) {
+	id := customerID(&customer)
+	if id == "" {
+		return nil, nil
+	}
+	params := &stripe.CustomerListPaymentMethodsParams{
+		Customer: stripe.String(id),
+		Type:     stripe.String(string(stripe.PaymentMethodTypeCard)),
+	}
+	var methods []payments.PaymentMethod
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		methods = methods[:0]
+		for pm, err := range d.customers.ListPaymentMethods(ctx, params) {
+			if err != nil {
+				return err
+			}
+			if pm.Card == nil {
+				continue
+			}
+			methods = append(methods, payments.PaymentMethod{
+				ID:       pm.ID,
+				Brand:    string(pm.Card.Brand),
+				Last4:    pm.Card.Last4,
+				ExpMonth: pm.Card.ExpMonth,
+				ExpYear:  pm.Card.ExpYear,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return methods, nil
+}
+
+// ChargeOffSession confirms a payment on a saved card right away, without the
+// customer on a payment page. Banks that insist on authenticating the payment
+// are reported as payments.ErrAuthenticationRequired, and other card
+// failures as payments.ErrCardDeclined, so the customer can be sent to
+// Checkout instead.
+func (d *Driver) ChargeOffSession(ctx context.Context, charge payments.OffSessionCharge) (payments.PaymentIntent, error) {
+	params := &stripe.PaymentIntentCreateParams{
+		Amount:        stripe.Int64(charge.AmountCents),
+		Currency:      stripe.String(charge.Currency),
+		Customer:      stripe.String(customerID(&charge.Customer)),
+		PaymentMethod: stripe.String(charge.PaymentMethodID),
+		Description:   stripe.String(d.product.Name),
+		ReceiptEmail:  stripe.String(charge.Customer.Email),
+		Confirm:       stripe.Bool(true),
+		OffSession:    stripe.Bool(true),
+	}
+	if d.manualCapture {
+		params.CaptureMethod = stripe.String(string(stripe.PaymentIntentCaptureMethodManual))
+	}
+	if addr := charge.ShippingAddress; addr != nil {
+		params.Shipping = &stripe.ShippingDetailsParams{
+			Name: stripe.String(addr.Name),
+			Address: &stripe.AddressParams{
+				Line1:      stripe.String(addr.Line1),
+				Line2:      stripe.String(addr.Line2),
+				City:       stripe.String(addr.City),
+				PostalCode: stripe.String(addr.PostalCode),
+				State:      stripe.String(addr.State),
+				Country:    stripe.String(addr.Country),
+			},
+		}
+	}
+	for key, value := range charge.Metadata {
+		params.AddMetadata(key, value)
+	}
+	params.AddMetadata("quantity", strconv.FormatInt(charge.Quantity, 10))
+
+	key := charge.IdempotencyKey
+	if key == "" {
+		key = stripe.NewIdempotencyKey()
+	}
+	params.SetIdempotencyKey("offsession-" + key)
+	var intent *stripe.PaymentIntent
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		intent, err = d.intents.Create(ctx, params)
+		return err
+	})
+	var stripeErr *stripe.Error
+	switch {
+	case errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodeAuthenticationRequired:
+		return payments.PaymentIntent{}, fmt.Errorf("%w: %s", payments.ErrAuthenticationRequired, stripeErr.Msg)
+	case errors.As(err, &stripeErr) && stripeErr.Type == stripe.ErrorTypeCard:
+		return payments.PaymentIntent{}, fmt.Errorf("%w: %s", payments.ErrCardDeclined, stripeErr.Msg)
+	case err != nil:
+		return payments.PaymentIntent{}, err
+	case intent == nil:
+		return payments.PaymentIntent{}, errors.New("stripe returned nil payment intent")
+	}
+	return paymentIntent(intent), nil
+}
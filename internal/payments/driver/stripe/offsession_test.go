@@ -0,0 +1,116 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+var linkedCustomer = payments.Customer{
+	ID:          "cust_1",
+	Email:       "ada@example.com",
+	ProviderIDs: map[string]string{Name: "cus_1"},
+}
+
+func TestDriver_PaymentMethods(t *testing.T) {
+	fake := &fakeCustomers{methods: []*stripe.PaymentMethod{
+		{ID: "pm_1", Card: &stripe.PaymentMethodCard{Brand: stripe.PaymentMethodCardBrandVisa, Last4: "4242", ExpMonth: 12, ExpYear: 2030}},
+	}}
+	driver := &Driver{customers: fake}
+
+	methods, err := driver.PaymentMethods(context.Background(), linkedCustomer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(methods) != 1 || methods[0].ID != "pm_1" || methods[0].Brand != "visa" || methods[0].Last4 != "4242" {
+		t.Fatalf("unexpected payment methods: %#v", methods)
+	}
+	if *fake.listed.Customer != "cus_1" || *fake.listed.Type != "card" {
+		t.Fatalf("unexpected list params: %#v", fake.listed)
+	}
+
+	methods, err = driver.PaymentMethods(context.Background(), payments.Customer{ID: "cust_2"})
+	if err != nil || methods != nil {
+		t.Fatalf("expected no cards for a customer without a Stripe customer, got %v %v", methods, err)
+	}
+}
+
+func TestDriver_ChargeOffSession(t *testing.T) {
+	fake := &fakePaymentIntents{intent: &stripe.PaymentIntent{ID: "pi_1", Status: stripe.PaymentIntentStatusSucceeded, Amount: 2500, Currency: "eur"}}
+	driver := &Driver{product: testProductConfig(), intents: fake}
+
+	intent, err := driver.ChargeOffSession(context.Background(), payments.OffSessionCharge{
+		Customer:        linkedCustomer,
+		PaymentMethodID: "pm_1",
+		Quantity:        2,
+		AmountCents:     2500,
+		Currency:        "eur",
+		ShippingAddress: &payments.Address{Name: "Ada", Line1: "1 Rue", City: "Paris", PostalCode: "75001", Country: "FR"},
+		IdempotencyKey:  "click-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if intent.ID != "pi_1" || intent.Status != payments.PaymentIntentSucceeded {
+		t.Fatalf("unexpected intent: %#v", intent)
+	}
+
+	params := fake.lastParams
+	if *params.Customer != "cus_1" || *params.PaymentMethod != "pm_1" || !*params.OffSession || !*params.Confirm {
+		t.Fatalf("expected a confirmed off-session charge on the saved card, got %#v", params)
+	}
+	if *params.Amount != 2500 || *params.Shipping.Address.Country != "FR" || params.Metadata["quantity"] != "2" {
+		t.Fatalf("unexpected charge: %#v", params)
+	}
+	if *params.IdempotencyKey != "offsession-click-1" {
+		t.Fatalf("expected the caller's idempotency key, got %q", *params.IdempotencyKey)
+	}
+}
+
+func TestDriver_ChargeOffSessionNeedsCustomer(t *testing.T) {
+	cases := []struct {
+		name string
+		err  *stripe.Error
+		want error
+	}{
+		{"authentication", &stripe.Error{HTTPStatusCode: http.StatusPaymentRequired, Type: stripe.ErrorTypeCard, Code: stripe.ErrorCodeAuthenticationRequired}, payments.ErrAuthenticationRequired},
+		{"declined", &stripe.Error{HTTPStatusCode: http.StatusPaymentRequired, Type: stripe.ErrorTypeCard, Code: stripe.ErrorCodeCardDeclined}, payments.ErrCardDeclined},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &Driver{product: testProductConfig(), intents: &fakePaymentIntents{err: tc.err}}
+			_, err := driver.ChargeOffSession(context.Background(), payments.OffSessionCharge{Customer: linkedCustomer, PaymentMethodID: "pm_1"})
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestDriver_CreateSessionSavesCardForSignedInCustomer(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{ID: "cs_1"}}
+	driver := &Driver{product: testProductConfig(), sessions: fake}
+
+	customer := linkedCustomer
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{Customer: &customer, SavePaymentMethod: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := fake.lastParams.PaymentIntentData
+	if data == nil || data.SetupFutureUsage == nil || *data.SetupFutureUsage != "off_session" || *fake.lastParams.Customer != "cus_1" {
+		t.Fatalf("expected the card to be saved on the customer, got %#v", fake.lastParams)
+	}
+
+	if _, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{CustomerEmail: "ada@example.com"}, SavePaymentMethod: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.lastParams.PaymentIntentData != nil {
+		t.Fatalf("expected no card to be saved without a Stripe customer, got %#v", fake.lastParams.PaymentIntentData)
+	}
+}
@@ -0,0 +1,40 @@
+package stripe
+
+import (
+	"context"
+
+	"github.com/stripe/stripe-go/v83"
+)
+
+type refundCreator interface {
+	Create(ctx context.Context, params *stripe.RefundCreateParams) (*stripe.Refund, error)
+}
+
+type paymentCapturer interface {
+	Capture(ctx context.Context, id string, params *stripe.PaymentIntentCaptureParams) (*stripe.PaymentIntent, error)
+}
+
+// RefundPayment refunds amountCents of the given PaymentIntent.
+func (d *Driver) RefundPayment(ctx context.Context, paymentIntentID string, amountCents int64) error {
+	params := &stripe.RefundCreateParams{
+		PaymentIntent: stripe.String(paymentIntentID),
+		Amount:        stripe.Int64(amountCents),
+	}
+	params.SetIdempotencyKey(stripe.NewIdempotencyKey())
+	return d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		_, err := d.refunds.Create(ctx, params)
+		return err
+	})
+}
+
+// CapturePayment captures the full authorized amount of the given PaymentIntent.
+func (d *Driver) CapturePayment(ctx context.Context, paymentIntentID string) error {
+	params := &stripe.PaymentIntentCaptureParams{}
+	params.SetIdempotencyKey(stripe.NewIdempotencyKey())
+	return d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		_, err := d.captures.Capture(ctx, paymentIntentID, params)
+		return err
+	})
+}
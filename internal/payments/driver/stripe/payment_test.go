@@ -0,0 +1,64 @@
+package stripe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeRefunds struct {
+	lastParams *stripe.RefundCreateParams
+}
+
+func (f *fakeRefunds) Create(ctx context.Context, params *stripe.RefundCreateParams) (*stripe.Refund, error) {
+	f.lastParams = params
+	return &stripe.Refund{}, nil
+}
+
+type fakeCaptures struct {
+	captured string
+}
+
+func (f *fakeCaptures) Capture(ctx context.Context, id string, params *stripe.PaymentIntentCaptureParams) (*stripe.PaymentIntent, error) {
+	f.captured = id
+	return &stripe.PaymentIntent{}, nil
+}
+
+func TestDriver_RefundPayment(t *testing.T) {
+	refunds := &fakeRefunds{}
+	driver := &Driver{refunds: refunds}
+
+	if err := driver.RefundPayment(context.Background(), "pi_1", 1250); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p := refunds.lastParams; p == nil || *p.PaymentIntent != "pi_1" || *p.Amount != 1250 {
+		t.Fatalf("unexpected refund params: %#v", p)
+	}
+}
+
+func TestDriver_CapturePayment(t *testing.T) {
+	captures := &fakeCaptures{}
+	driver := &Driver{captures: captures}
+
+	if err := driver.CapturePayment(context.Background(), "pi_1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if captures.captured != "pi_1" {
+		t.Fatalf("expected pi_1 to be captured, got %q", captures.captured)
+	}
+}
+
+func TestDriver_CreateSessionWithManualCapture(t *testing.T) {
+	fake := &fakeSessionCreator{result: &stripe.CheckoutSession{}}
+	driver := &Driver{product: testProductConfig(), sessions: fake, manualCapture: true}
+
+	if _, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data := fake.lastParams.PaymentIntentData; data == nil || *data.CaptureMethod != "manual" {
+		t.Fatalf("expected manual capture, got %#v", data)
+	}
+}
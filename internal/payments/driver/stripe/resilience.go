@@ -0,0 +1,29 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/stripe/stripe-go/v83"
+)
+
+// call runs one Stripe request under the driver's policy. Callers set an
+// idempotency key on params before calling so every retry is the same request
+// to Stripe.
+func (d *Driver) call(ctx context.Context, fn func(context.Context) error) error {
+	return d.policy.Do(ctx, isTransient, fn)
+}
+
+// isTransient reports whether a Stripe call may succeed if repeated: network
+// failures, rate limiting and server errors.
+func isTransient(err error) bool {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) {
+		return stripeErr.HTTPStatusCode == http.StatusTooManyRequests ||
+			stripeErr.HTTPStatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
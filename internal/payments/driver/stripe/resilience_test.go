@@ -0,0 +1,110 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/resilience"
+)
+
+// faultySessionCreator fails with each of faults in turn before succeeding,
+// recording the idempotency key of every attempt.
+type faultySessionCreator struct {
+	faults []error
+	delay  time.Duration
+	keys   []string
+}
+
+func (f *faultySessionCreator) Create(ctx context.Context, params *stripe.CheckoutSessionCreateParams) (*stripe.CheckoutSession, error) {
+	f.keys = append(f.keys, stripe.StringValue(params.IdempotencyKey))
+	if f.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(f.delay):
+		}
+	}
+	if len(f.faults) > 0 {
+		err := f.faults[0]
+		f.faults = f.faults[1:]
+		return nil, err
+	}
+	return &stripe.CheckoutSession{ID: "cs_test_1", URL: "https://stripe.test/cs_test_1"}, nil
+}
+
+func testPolicy(retries, threshold int) *resilience.Policy {
+	return resilience.New(config.ResilienceConfig{
+		CallTimeout:      time.Second,
+		MaxRetries:       retries,
+		BreakerThreshold: threshold,
+		BreakerCooldown:  time.Minute,
+	}, resilience.WithBackoff(0))
+}
+
+func TestDriver_CreateSessionRetriesWithSameIdempotencyKey(t *testing.T) {
+	fake := &faultySessionCreator{faults: []error{
+		&net.OpError{Op: "dial", Err: errors.New("connection refused")},
+		&stripe.Error{HTTPStatusCode: http.StatusTooManyRequests},
+		&stripe.Error{HTTPStatusCode: http.StatusBadGateway},
+	}}
+	driver := &Driver{product: testProductConfig(), sessions: fake, policy: testPolicy(3, 10)}
+
+	res, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{})
+	if err != nil || res.ID != "cs_test_1" {
+		t.Fatalf("expected success after faults, got %#v, %v", res, err)
+	}
+	if len(fake.keys) != 4 || fake.keys[0] == "" {
+		t.Fatalf("expected 4 keyed attempts, got %q", fake.keys)
+	}
+	for _, key := range fake.keys {
+		if key != fake.keys[0] {
+			t.Fatalf("expected one idempotency key across retries, got %q", fake.keys)
+		}
+	}
+}
+
+func TestDriver_CreateSessionDoesNotRetryCardErrors(t *testing.T) {
+	declined := &stripe.Error{HTTPStatusCode: http.StatusPaymentRequired, Type: stripe.ErrorTypeCard}
+	fake := &faultySessionCreator{faults: []error{declined}}
+	driver := &Driver{product: testProductConfig(), sessions: fake, policy: testPolicy(3, 10)}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{})
+	if !errors.Is(err, declined) || errors.Is(err, payments.ErrProviderUnavailable) || len(fake.keys) != 1 {
+		t.Fatalf("expected the card error once, got %v after %d calls", err, len(fake.keys))
+	}
+}
+
+func TestDriver_CreateSessionTimesOut(t *testing.T) {
+	fake := &faultySessionCreator{delay: time.Second}
+	policy := resilience.New(config.ResilienceConfig{CallTimeout: 10 * time.Millisecond, MaxRetries: 1, BreakerThreshold: 10})
+	driver := &Driver{product: testProductConfig(), sessions: fake, policy: policy}
+
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{})
+	if !errors.Is(err, payments.ErrProviderUnavailable) || len(fake.keys) != 2 {
+		t.Fatalf("expected two timed-out attempts, got %v after %d calls", err, len(fake.keys))
+	}
+}
+
+func TestDriver_CreateSessionFailsFastWhenBreakerOpens(t *testing.T) {
+	outage := &stripe.Error{HTTPStatusCode: http.StatusServiceUnavailable}
+	fake := &faultySessionCreator{faults: []error{outage, outage, outage, outage}}
+	driver := &Driver{product: testProductConfig(), sessions: fake, policy: testPolicy(0, 2)}
+
+	for range 2 {
+		if _, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); !errors.Is(err, payments.ErrProviderUnavailable) {
+			t.Fatalf("expected provider unavailable, got %v", err)
+		}
+	}
+	_, err := driver.CreateSession(context.Background(), payments.CheckoutSessionRequest{})
+	if !errors.Is(err, payments.ErrProviderUnavailable) || len(fake.keys) != 2 {
+		t.Fatalf("expected a fast failure without calling Stripe, got %v after %d calls", err, len(fake.keys))
+	}
+}
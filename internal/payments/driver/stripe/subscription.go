@@ -0,0 +1,117 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type subscriptionClient interface {
+	Retrieve(ctx context.Context, id string, params *stripe.SubscriptionRetrieveParams) (*stripe.Subscription, error)
+	Update(ctx context.Context, id string, params *stripe.SubscriptionUpdateParams) (*stripe.Subscription, error)
+	Cancel(ctx context.Context, id string, params *stripe.SubscriptionCancelParams) (*stripe.Subscription, error)
+}
+
+// CancelSubscription sets a subscription to end at the close of its current
+// period, so the customer keeps what they already paid for.
+func (d *Driver) CancelSubscription(ctx context.Context, id string) (payments.Subscription, error) {
+	params := &stripe.SubscriptionUpdateParams{CancelAtPeriodEnd: stripe.Bool(true)}
+	params.SetIdempotencyKey(stripe.NewIdempotencyKey())
+	var sub *stripe.Subscription
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		sub, err = d.subscriptions.Update(ctx, id, params)
+		return err
+	})
+	return subscriptionResult(id, sub, err)
+}
+
+// Subscription fetches the current state of a subscription from Stripe.
+func (d *Driver) Subscription(ctx context.Context, id string) (payments.Subscription, error) {
+	sub, err := d.retrieveSubscription(ctx, id)
+	return subscriptionResult(id, sub, err)
+}
+
+// EndSubscription cancels a subscription right away, without waiting for the
+// end of the period the customer did not pay for.
+func (d *Driver) EndSubscription(ctx context.Context, id string) (payments.Subscription, error) {
+	params := &stripe.SubscriptionCancelParams{}
+	// Keyed by subscription so a retried job does not cancel twice.
+	params.SetIdempotencyKey("end-subscription-" + id)
+	var sub *stripe.Subscription
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		sub, err = d.subscriptions.Cancel(ctx, id, params)
+		return err
+	})
+	return subscriptionResult(id, sub, err)
+}
+
+// DowngradeSubscription moves a subscription onto priceID from its next
+// period, dropping any other items, without prorating the change.
+func (d *Driver) DowngradeSubscription(ctx context.Context, id, priceID string) (payments.Subscription, error) {
+	current, err := d.retrieveSubscription(ctx, id)
+	if err != nil {
+		return subscriptionResult(id, nil, err)
+	}
+	params := &stripe.SubscriptionUpdateParams{ProrationBehavior: stripe.String("none")}
+	if current.Items != nil {
+		for i, item := range current.Items.Data {
+			if i == 0 {
+				params.Items = append(params.Items, &stripe.SubscriptionUpdateItemParams{ID: stripe.String(item.ID), Price: stripe.String(priceID)})
+				continue
+			}
+			params.Items = append(params.Items, &stripe.SubscriptionUpdateItemParams{ID: stripe.String(item.ID), Deleted: stripe.Bool(true)})
+		}
+	}
+	if len(params.Items) == 0 {
+		params.Items = []*stripe.SubscriptionUpdateItemParams{{Price: stripe.String(priceID)}}
+	}
+	params.SetIdempotencyKey("downgrade-subscription-" + id + "-" + priceID)
+	var sub *stripe.Subscription
+	err = d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		sub, err = d.subscriptions.Update(ctx, id, params)
+		return err
+	})
+	return subscriptionResult(id, sub, err)
+}
+
+func (d *Driver) retrieveSubscription(ctx context.Context, id string) (*stripe.Subscription, error) {
+	params := &stripe.SubscriptionRetrieveParams{}
+	params.AddExpand("customer")
+	var sub *stripe.Subscription
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		var err error
+		sub, err = d.subscriptions.Retrieve(ctx, id, params)
+		return err
+	})
+	if err == nil && sub == nil {
+		err = errors.New("stripe returned nil subscription")
+	}
+	return sub, err
+}
+
+// subscriptionResult translates the outcome of a subscription call, mapping
+// unknown subscriptions to payments.ErrNotFound.
+func subscriptionResult(id string, sub *stripe.Subscription, err error) (payments.Subscription, error) {
+	var stripeErr *stripe.Error
+	switch {
+	case errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusNotFound:
+		return payments.Subscription{}, fmt.Errorf("%w: subscription %s", payments.ErrNotFound, id)
+	case err != nil:
+		return payments.Subscription{}, err
+	case sub == nil:
+		return payments.Subscription{}, errors.New("stripe returned nil subscription")
+	}
+	return subscription(sub), nil
+}
@@ -0,0 +1,86 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeSubscriptions struct {
+	current  *stripe.Subscription
+	err      error
+	params   *stripe.SubscriptionUpdateParams
+	canceled *stripe.SubscriptionCancelParams
+}
+
+func (f *fakeSubscriptions) Retrieve(ctx context.Context, id string, params *stripe.SubscriptionRetrieveParams) (*stripe.Subscription, error) {
+	return f.current, f.err
+}
+
+func (f *fakeSubscriptions) Update(ctx context.Context, id string, params *stripe.SubscriptionUpdateParams) (*stripe.Subscription, error) {
+	f.params = params
+	return &stripe.Subscription{ID: id, Status: stripe.SubscriptionStatusActive, CancelAtPeriodEnd: params.CancelAtPeriodEnd != nil && *params.CancelAtPeriodEnd}, nil
+}
+
+func (f *fakeSubscriptions) Cancel(ctx context.Context, id string, params *stripe.SubscriptionCancelParams) (*stripe.Subscription, error) {
+	f.canceled = params
+	return &stripe.Subscription{ID: id, Status: stripe.SubscriptionStatusCanceled}, nil
+}
+
+func TestDriver_CancelSubscription(t *testing.T) {
+	fake := &fakeSubscriptions{}
+	driver := &Driver{subscriptions: fake}
+
+	sub, err := driver.CancelSubscription(context.Background(), "sub_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.params.CancelAtPeriodEnd == nil || !*fake.params.CancelAtPeriodEnd {
+		t.Fatal("expected the subscription to be canceled at period end")
+	}
+	if sub.ID != "sub_1" || sub.Status != "active" || !sub.CancelAtPeriodEnd {
+		t.Fatalf("unexpected subscription: %#v", sub)
+	}
+}
+
+func TestDriver_EndSubscription(t *testing.T) {
+	fake := &fakeSubscriptions{}
+	driver := &Driver{subscriptions: fake}
+
+	sub, err := driver.EndSubscription(context.Background(), "sub_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sub.Status != "canceled" || *fake.canceled.IdempotencyKey != "end-subscription-sub_1" {
+		t.Fatalf("expected an immediate, keyed cancellation, got %#v %#v", sub, fake.canceled)
+	}
+}
+
+func TestDriver_DowngradeSubscription(t *testing.T) {
+	fake := &fakeSubscriptions{current: &stripe.Subscription{ID: "sub_1", Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{{ID: "si_1"}, {ID: "si_2"}}}}}
+	driver := &Driver{subscriptions: fake}
+
+	if _, err := driver.DowngradeSubscription(context.Background(), "sub_1", "price_free"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	items := fake.params.Items
+	if len(items) != 2 || *items[0].ID != "si_1" || *items[0].Price != "price_free" || *items[1].ID != "si_2" || !*items[1].Deleted {
+		t.Fatalf("expected the first item moved to the new price and the rest dropped, got %#v", items)
+	}
+	if *fake.params.ProrationBehavior != "none" {
+		t.Fatalf("expected no proration, got %q", *fake.params.ProrationBehavior)
+	}
+}
+
+func TestDriver_SubscriptionNotFound(t *testing.T) {
+	driver := &Driver{subscriptions: &fakeSubscriptions{err: &stripe.Error{HTTPStatusCode: http.StatusNotFound}}}
+
+	if _, err := driver.Subscription(context.Background(), "sub_9"); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
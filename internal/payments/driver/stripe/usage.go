@@ -0,0 +1,78 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type meterEventCreator interface {
+	Create(ctx context.Context, params *stripe.BillingMeterEventCreateParams) (*stripe.BillingMeterEvent, error)
+}
+
+type meterEventSummaryLister interface {
+	List(ctx context.Context, params *stripe.BillingMeterEventSummaryListParams) stripe.Seq2[*stripe.BillingMeterEventSummary, error]
+}
+
+// ReportUsage sends batch to Stripe as one meter event, timestamped at the
+// start of the batch's hour. The batch ID is the event identifier, so Stripe
+// drops a batch reported twice.
+func (d *Driver) ReportUsage(ctx context.Context, price config.MeteredPriceConfig, customer payments.Customer, batch payments.UsageBatch) error {
+	id := customerID(&customer)
+	if id == "" {
+		return fmt.Errorf("customer %s has no Stripe customer", customer.ID)
+	}
+	params := &stripe.BillingMeterEventCreateParams{
+		EventName:  stripe.String(price.Meter),
+		Identifier: stripe.String(batch.ID),
+		Payload: map[string]string{
+			"stripe_customer_id": id,
+			"value":              strconv.FormatInt(batch.Quantity, 10),
+		},
+		Timestamp: stripe.Int64(batch.Hour.Unix()),
+	}
+	params.SetIdempotencyKey("meter-event-" + batch.ID)
+	return d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		_, err := d.meterEvents.Create(ctx, params)
+		return err
+	})
+}
+
+// UsageTotal sums the usage Stripe's meter for price has recorded for
+// customer between from and to.
+func (d *Driver) UsageTotal(ctx context.Context, price config.MeteredPriceConfig, customer payments.Customer, from, to time.Time) (int64, error) {
+	id := customerID(&customer)
+	if id == "" {
+		return 0, nil
+	}
+	params := &stripe.BillingMeterEventSummaryListParams{
+		ID:        stripe.String(price.StripeMeterID),
+		Customer:  stripe.String(id),
+		StartTime: stripe.Int64(from.Truncate(time.Minute).Unix()),
+		EndTime:   stripe.Int64(to.Truncate(time.Minute).Unix()),
+	}
+	var total float64
+	err := d.call(ctx, func(ctx context.Context) error {
+		params.Context = ctx
+		total = 0
+		for summary, err := range d.meterSummaries.List(ctx, params) {
+			if err != nil {
+				return err
+			}
+			total += summary.AggregatedValue
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(total)), nil
+}
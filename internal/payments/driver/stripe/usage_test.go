@@ -0,0 +1,82 @@
+package stripe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeMeterEvents struct {
+	created []*stripe.BillingMeterEventCreateParams
+}
+
+func (f *fakeMeterEvents) Create(ctx context.Context, params *stripe.BillingMeterEventCreateParams) (*stripe.BillingMeterEvent, error) {
+	f.created = append(f.created, params)
+	return &stripe.BillingMeterEvent{Identifier: *params.Identifier}, nil
+}
+
+type fakeMeterSummaries struct {
+	summaries []*stripe.BillingMeterEventSummary
+	listed    *stripe.BillingMeterEventSummaryListParams
+}
+
+func (f *fakeMeterSummaries) List(ctx context.Context, params *stripe.BillingMeterEventSummaryListParams) stripe.Seq2[*stripe.BillingMeterEventSummary, error] {
+	f.listed = params
+	return func(yield func(*stripe.BillingMeterEventSummary, error) bool) {
+		for _, s := range f.summaries {
+			if !yield(s, nil) {
+				return
+			}
+		}
+	}
+}
+
+var apiRequests = config.MeteredPriceConfig{Meter: "api_requests", StripePriceID: "price_1", StripeMeterID: "mtr_1"}
+
+func TestDriver_ReportUsage(t *testing.T) {
+	fake := &fakeMeterEvents{}
+	driver := &Driver{meterEvents: fake}
+	hour := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	err := driver.ReportUsage(context.Background(), apiRequests, linkedCustomer, payments.UsageBatch{ID: "usage_1", Quantity: 42, Hour: hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	params := fake.created[0]
+	if *params.EventName != "api_requests" || *params.Identifier != "usage_1" || *params.Timestamp != hour.Unix() {
+		t.Fatalf("unexpected meter event: %#v", params)
+	}
+	if params.Payload["stripe_customer_id"] != "cus_1" || params.Payload["value"] != "42" {
+		t.Fatalf("unexpected payload: %#v", params.Payload)
+	}
+	if *params.IdempotencyKey != "meter-event-usage_1" {
+		t.Fatalf("expected the batch to key the request, got %q", *params.IdempotencyKey)
+	}
+
+	if err := driver.ReportUsage(context.Background(), apiRequests, payments.Customer{ID: "cust_2"}, payments.UsageBatch{ID: "usage_2"}); err == nil {
+		t.Fatalf("expected usage without a Stripe customer to fail")
+	}
+}
+
+func TestDriver_UsageTotal(t *testing.T) {
+	fake := &fakeMeterSummaries{summaries: []*stripe.BillingMeterEventSummary{{AggregatedValue: 40}, {AggregatedValue: 2}}}
+	driver := &Driver{meterSummaries: fake}
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	total, err := driver.UsageTotal(context.Background(), apiRequests, linkedCustomer, from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 42 {
+		t.Fatalf("expected 42, got %d", total)
+	}
+	if *fake.listed.ID != "mtr_1" || *fake.listed.Customer != "cus_1" || *fake.listed.StartTime != from.Unix() || *fake.listed.EndTime != to.Unix() {
+		t.Fatalf("unexpected list params: %#v", fake.listed)
+	}
+}
@@ -0,0 +1,218 @@
+package stripe
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/webhook"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// WebhookParser verifies Stripe webhook signatures and translates the events
+// payit cares about into provider-agnostic events.
+type WebhookParser struct {
+	secret string
+}
+
+// NewWebhookParser creates a parser that checks signatures against secret.
+func NewWebhookParser(secret string) *WebhookParser {
+	return &WebhookParser{secret: secret}
+}
+
+// SignPayload returns a Stripe-Signature header for payload as Stripe would
+// send it at t, so saved events can be replayed against the webhook endpoint.
+func SignPayload(payload []byte, secret string, t time.Time) string {
+	return webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: secret, Timestamp: t}).Header
+}
+
+// ParseEvent verifies payload against the Stripe-Signature header value.
+// Unhandled event types come back with an empty Type.
+func (p *WebhookParser) ParseEvent(payload []byte, signature string) (payments.Event, error) {
+	event, err := webhook.ConstructEventWithOptions(payload, signature, p.secret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+	if err != nil {
+		return payments.Event{}, fmt.Errorf("%w: %v", payments.ErrInvalidWebhook, err)
+	}
+
+	out := payments.Event{ID: event.ID}
+	switch event.Type {
+	case stripe.EventTypeCheckoutSessionCompleted, stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded:
+		out.Type = payments.EventCheckoutCompleted
+	case stripe.EventTypeCheckoutSessionExpired:
+		out.Type = payments.EventCheckoutExpired
+	case stripe.EventTypeCheckoutSessionAsyncPaymentFailed:
+		out.Type = payments.EventCheckoutFailed
+	case stripe.EventTypePaymentIntentSucceeded, stripe.EventTypePaymentIntentAmountCapturableUpdated:
+		var intent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+			return payments.Event{}, fmt.Errorf("%w: decode payment intent: %v", payments.ErrInvalidWebhook, err)
+		}
+		// Intents behind a Checkout Session complete through the session's
+		// own event; keying by intent only matches orders paid on a custom form.
+		out.Type = payments.EventCheckoutCompleted
+		out.SessionID = intent.ID
+		out.PaymentIntentID = intent.ID
+		out.Paid = intent.Status == stripe.PaymentIntentStatusSucceeded
+		out.CustomerEmail = intent.ReceiptEmail
+		return out, nil
+	case stripe.EventTypeChargeRefunded:
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return payments.Event{}, fmt.Errorf("%w: decode charge: %v", payments.ErrInvalidWebhook, err)
+		}
+		out.Type = payments.EventRefundIssued
+		fillChargeEvent(&out, &charge)
+		return out, nil
+	case stripe.EventTypeInvoicePaymentFailed, stripe.EventTypeInvoicePaid:
+		var invoice stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+			return payments.Event{}, fmt.Errorf("%w: decode invoice: %v", payments.ErrInvalidWebhook, err)
+		}
+		if invoice.Parent == nil || invoice.Parent.SubscriptionDetails == nil || invoice.Parent.SubscriptionDetails.Subscription == nil {
+			return out, nil
+		}
+		out.Type = payments.EventRenewalFailed
+		if event.Type == stripe.EventTypeInvoicePaid {
+			out.Type = payments.EventRenewalPaid
+		}
+		fillInvoiceEvent(&out, &invoice)
+		return out, nil
+	case stripe.EventTypeCustomerSubscriptionCreated, stripe.EventTypeCustomerSubscriptionUpdated, stripe.EventTypeCustomerSubscriptionDeleted:
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return payments.Event{}, fmt.Errorf("%w: decode subscription: %v", payments.ErrInvalidWebhook, err)
+		}
+		out.Type = payments.EventSubscriptionUpdated
+		fillSubscriptionEvent(&out, &sub)
+		if status, ok := event.Data.PreviousAttributes["status"].(string); ok {
+			out.PreviousStatus = status
+		}
+		return out, nil
+	case stripe.EventTypeCustomerSubscriptionTrialWillEnd:
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return payments.Event{}, fmt.Errorf("%w: decode subscription: %v", payments.ErrInvalidWebhook, err)
+		}
+		out.Type = payments.EventTrialEnding
+		fillSubscriptionEvent(&out, &sub)
+		return out, nil
+	default:
+		return out, nil
+	}
+
+	var session stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+		return payments.Event{}, fmt.Errorf("%w: decode checkout session: %v", payments.ErrInvalidWebhook, err)
+	}
+	fillSessionEvent(&out, &session)
+
+	return out, nil
+}
+
+func fillSessionEvent(out *payments.Event, session *stripe.CheckoutSession) {
+	out.SessionID = session.ID
+	if session.PaymentIntent != nil {
+		out.PaymentIntentID = session.PaymentIntent.ID
+	}
+	if session.Subscription != nil {
+		out.SubscriptionID = session.Subscription.ID
+	}
+	out.Paid = session.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid ||
+		session.PaymentStatus == stripe.CheckoutSessionPaymentStatusNoPaymentRequired
+
+	out.CustomerEmail = session.CustomerEmail
+	if session.CustomerDetails != nil && session.CustomerDetails.Email != "" {
+		out.CustomerEmail = session.CustomerDetails.Email
+	}
+
+	if info := session.CollectedInformation; info != nil && info.ShippingDetails != nil && info.ShippingDetails.Address != nil {
+		addr := info.ShippingDetails.Address
+		out.ShippingAddress = &payments.Address{
+			Name:       info.ShippingDetails.Name,
+			Line1:      addr.Line1,
+			Line2:      addr.Line2,
+			City:       addr.City,
+			PostalCode: addr.PostalCode,
+			State:      addr.State,
+			Country:    addr.Country,
+		}
+	}
+
+	out.Totals = &payments.Totals{AmountCents: session.AmountTotal}
+	if details := session.TotalDetails; details != nil {
+		out.Totals.DiscountCents = details.AmountDiscount
+		out.Totals.TaxCents = details.AmountTax
+	}
+
+	if cost := session.ShippingCost; cost != nil {
+		out.ShippingCents = cost.AmountTotal
+		if cost.ShippingRate != nil {
+			out.ShippingRate = cost.ShippingRate.ID
+			if cost.ShippingRate.DisplayName != "" {
+				out.ShippingRate = cost.ShippingRate.DisplayName
+			}
+		}
+	}
+}
+
+func fillChargeEvent(out *payments.Event, charge *stripe.Charge) {
+	if charge.PaymentIntent != nil {
+		out.PaymentIntentID = charge.PaymentIntent.ID
+	}
+	out.AmountCents = charge.AmountRefunded
+	out.Currency = string(charge.Currency)
+	out.CustomerEmail = charge.ReceiptEmail
+	if out.CustomerEmail == "" && charge.BillingDetails != nil {
+		out.CustomerEmail = charge.BillingDetails.Email
+	}
+}
+
+func fillInvoiceEvent(out *payments.Event, invoice *stripe.Invoice) {
+	out.SubscriptionID = invoice.Parent.SubscriptionDetails.Subscription.ID
+	out.CustomerEmail = invoice.CustomerEmail
+	out.AmountCents = invoice.AmountDue
+	out.Currency = string(invoice.Currency)
+	out.PaymentUpdateURL = invoice.HostedInvoiceURL
+}
+
+func fillSubscriptionEvent(out *payments.Event, sub *stripe.Subscription) {
+	mirror := subscription(sub)
+	out.SubscriptionID = sub.ID
+	out.CustomerEmail = mirror.CustomerEmail
+	out.Subscription = &mirror
+}
+
+// subscription translates a Stripe subscription into payit's mirror of it.
+func subscription(sub *stripe.Subscription) payments.Subscription {
+	mirror := payments.Subscription{
+		ID:                sub.ID,
+		Status:            string(sub.Status),
+		CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+	}
+	if sub.TrialEnd > 0 {
+		mirror.TrialEnd = time.Unix(sub.TrialEnd, 0).UTC()
+	}
+	if sub.Customer != nil {
+		mirror.CustomerID = sub.Customer.ID
+		mirror.CustomerEmail = sub.Customer.Email
+	}
+	if sub.Items != nil {
+		for _, item := range sub.Items.Data {
+			if item.Price != nil {
+				mirror.AmountCents += item.Price.UnitAmount * max(item.Quantity, 1)
+				mirror.Currency = string(item.Price.Currency)
+				if item.Price.Recurring != nil {
+					mirror.Interval = string(item.Price.Recurring.Interval)
+				}
+			}
+			if item.CurrentPeriodEnd > 0 {
+				mirror.CurrentPeriodEnd = time.Unix(item.CurrentPeriodEnd, 0).UTC()
+			}
+		}
+	}
+	return mirror
+}
@@ -0,0 +1,185 @@
+package stripe
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func TestWebhookParser_CheckoutCompleted(t *testing.T) {
+	payload := []byte(`{
+		"id": "evt_1",
+		"object": "event",
+		"type": "checkout.session.completed",
+		"data": {"object": {
+			"id": "cs_test_1",
+			"object": "checkout.session",
+			"payment_status": "paid",
+			"amount_total": 2880,
+			"total_details": {"amount_discount": 200, "amount_shipping": 500, "amount_tax": 380},
+			"customer_details": {"email": "buyer@example.com"},
+			"collected_information": {"shipping_details": {
+				"name": "Ada Lovelace",
+				"address": {"line1": "1 Rue de Rivoli", "city": "Paris", "postal_code": "75001", "country": "FR"}
+			}},
+			"shipping_cost": {"amount_total": 500, "shipping_rate": {"id": "shr_1", "object": "shipping_rate", "display_name": "Standard"}}
+		}}
+	}`)
+
+	event, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if event.Type != payments.EventCheckoutCompleted || event.SessionID != "cs_test_1" || !event.Paid {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+	if event.CustomerEmail != "buyer@example.com" {
+		t.Fatalf("unexpected email: %q", event.CustomerEmail)
+	}
+	if event.ShippingAddress == nil || event.ShippingAddress.Name != "Ada Lovelace" || event.ShippingAddress.Country != "FR" {
+		t.Fatalf("unexpected address: %#v", event.ShippingAddress)
+	}
+	if event.ShippingRate != "Standard" || event.ShippingCents != 500 {
+		t.Fatalf("unexpected shipping: %q %d", event.ShippingRate, event.ShippingCents)
+	}
+	if event.Totals == nil || *event.Totals != (payments.Totals{AmountCents: 2880, DiscountCents: 200, TaxCents: 380}) {
+		t.Fatalf("unexpected totals: %#v", event.Totals)
+	}
+}
+
+func TestWebhookParser_PaymentIntentSucceeded(t *testing.T) {
+	payload := []byte(`{
+		"id": "evt_4",
+		"object": "event",
+		"type": "payment_intent.succeeded",
+		"data": {"object": {"id": "pi_1", "object": "payment_intent", "status": "succeeded", "receipt_email": "buyer@example.com"}}
+	}`)
+
+	event, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payments.EventCheckoutCompleted || event.SessionID != "pi_1" || event.PaymentIntentID != "pi_1" || !event.Paid {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+	if event.CustomerEmail != "buyer@example.com" {
+		t.Fatalf("unexpected email: %q", event.CustomerEmail)
+	}
+}
+
+func TestWebhookParser_IgnoresUnhandledTypes(t *testing.T) {
+	payload := []byte(`{"id": "evt_2", "object": "event", "type": "customer.created", "data": {"object": {}}}`)
+
+	event, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != "" {
+		t.Fatalf("expected empty type, got %q", event.Type)
+	}
+}
+
+func TestWebhookParser_RejectsBadSignature(t *testing.T) {
+	payload := []byte(`{"id": "evt_3", "object": "event", "type": "checkout.session.completed"}`)
+
+	_, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, "t=1,v1=deadbeef")
+	if !errors.Is(err, payments.ErrInvalidWebhook) {
+		t.Fatalf("expected ErrInvalidWebhook, got %v", err)
+	}
+}
+
+func sign(payload []byte) string {
+	return SignPayload(payload, testWebhookSecret, time.Now())
+}
+
+func TestWebhookParser_CheckoutExpired(t *testing.T) {
+	payload := []byte(`{"id": "evt_4", "object": "event", "type": "checkout.session.expired", "data": {"object": {"id": "cs_test_2", "object": "checkout.session", "customer_details": {"email": "lost@example.com"}}}}`)
+
+	event, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payments.EventCheckoutExpired || event.SessionID != "cs_test_2" || event.Paid {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+func TestWebhookParser_ChargeRefunded(t *testing.T) {
+	payload := []byte(`{"id": "evt_5", "object": "event", "type": "charge.refunded", "data": {"object": {"id": "ch_1", "object": "charge", "payment_intent": "pi_1", "amount_refunded": 1500, "currency": "eur", "receipt_email": "buyer@example.com"}}}`)
+
+	event, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payments.EventRefundIssued || event.PaymentIntentID != "pi_1" || event.AmountCents != 1500 || event.Currency != "eur" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+func TestWebhookParser_SubscriptionInvoiceFailed(t *testing.T) {
+	payload := []byte(`{"id": "evt_6", "object": "event", "type": "invoice.payment_failed", "data": {"object": {"id": "in_1", "object": "invoice", "customer_email": "sub@example.com", "amount_due": 999, "currency": "usd", "hosted_invoice_url": "https://invoice.stripe.test/i/1", "parent": {"type": "subscription_details", "subscription_details": {"subscription": "sub_1"}}}}}`)
+
+	event, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payments.EventRenewalFailed || event.SubscriptionID != "sub_1" || event.PaymentUpdateURL != "https://invoice.stripe.test/i/1" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+func TestWebhookParser_SubscriptionInvoicePaid(t *testing.T) {
+	payload := []byte(`{"id": "evt_8", "object": "event", "type": "invoice.paid", "data": {"object": {"id": "in_1", "object": "invoice", "customer_email": "sub@example.com", "amount_paid": 999, "currency": "usd", "parent": {"type": "subscription_details", "subscription_details": {"subscription": "sub_1"}}}}}`)
+
+	event, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payments.EventRenewalPaid || event.SubscriptionID != "sub_1" || event.CustomerEmail != "sub@example.com" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+func TestWebhookParser_SubscriptionUpdated(t *testing.T) {
+	payload := []byte(`{"id": "evt_7", "object": "event", "type": "customer.subscription.updated", "data": {"object": {"id": "sub_1", "object": "subscription", "status": "past_due", "customer": "cus_1", "cancel_at_period_end": true, "items": {"object": "list", "data": [{"id": "si_1", "quantity": 2, "current_period_end": 1780000000, "price": {"id": "price_1", "unit_amount": 900, "currency": "usd", "recurring": {"interval": "month"}}}]}}}}`)
+
+	event, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sub := event.Subscription
+	if event.Type != payments.EventSubscriptionUpdated || sub == nil {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+	if sub.ID != "sub_1" || sub.Status != "past_due" || sub.CustomerID != "cus_1" || !sub.CancelAtPeriodEnd {
+		t.Fatalf("unexpected subscription: %#v", sub)
+	}
+	if sub.AmountCents != 1800 || sub.Interval != "month" || sub.CurrentPeriodEnd.Unix() != 1780000000 {
+		t.Fatalf("unexpected billing details: %#v", sub)
+	}
+}
+
+func TestWebhookParser_TrialEvents(t *testing.T) {
+	payload := []byte(`{"id": "evt_9", "object": "event", "type": "customer.subscription.trial_will_end", "data": {"object": {"id": "sub_1", "object": "subscription", "status": "trialing", "trial_end": 1780000000, "customer": {"id": "cus_1", "object": "customer", "email": "ada@example.com"}}}}`)
+	event, err := NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payments.EventTrialEnding || event.CustomerEmail != "ada@example.com" || event.Subscription.TrialEnd.Unix() != 1780000000 {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+
+	payload = []byte(`{"id": "evt_10", "object": "event", "type": "customer.subscription.updated", "data": {"object": {"id": "sub_1", "object": "subscription", "status": "active", "trial_end": 1780000000}, "previous_attributes": {"status": "trialing"}}}`)
+	event, err = NewWebhookParser(testWebhookSecret).ParseEvent(payload, sign(payload))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payments.EventSubscriptionUpdated || event.PreviousStatus != "trialing" || event.Subscription.Status != "active" {
+		t.Fatalf("expected a converted trial, got %#v", event)
+	}
+}
@@ -0,0 +1,60 @@
+package payments
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNotFound reports that a requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidPromoCode reports that a promotion code cannot be applied to the requested checkout.
+	ErrInvalidPromoCode = errors.New("invalid promotion code")
+	// ErrUnsupportedTaxLocation reports that tax cannot be determined for the buyer's location.
+	ErrUnsupportedTaxLocation = errors.New("unsupported tax location")
+	// ErrOutOfStock reports that not enough units are available to reserve.
+	ErrOutOfStock = errors.New("out of stock")
+	// ErrOrderNotOpen reports an action that requires an open, unpaid order.
+	ErrOrderNotOpen = errors.New("order is not open")
+	// ErrCheckoutIncomplete reports a buyer returning from checkout before paying.
+	ErrCheckoutIncomplete = errors.New("checkout is not complete")
+	// ErrUnsupportedCheckout reports a checkout the chosen payment flow cannot
+	// price, such as shipping on a custom payment form.
+	ErrUnsupportedCheckout = errors.New("checkout not supported by this payment flow")
+	// ErrNoRoute reports a checkout that no configured payment route accepts,
+	// such as one in a currency or country no provider is set up for.
+	ErrNoRoute = errors.New("no payment provider accepts this checkout")
+	// ErrNotRecoverable reports a recovery attempt for an order that did not expire.
+	ErrNotRecoverable = errors.New("order cannot be recovered")
+	// ErrNotRefundable reports a refund the order cannot cover.
+	ErrNotRefundable = errors.New("order cannot be refunded")
+	// ErrNotCapturable reports a capture for an order without an authorized payment.
+	ErrNotCapturable = errors.New("order has no payment to capture")
+	// ErrProviderUnavailable reports a payment provider that is down or
+	// failing fast behind an open circuit breaker.
+	ErrProviderUnavailable = errors.New("payment provider unavailable")
+	// ErrProviderRejected reports a request the payment provider answered
+	// with an error of its own, such as invalid parameters or a declined card.
+	ErrProviderRejected = errors.New("payment provider rejected the request")
+	// ErrAuthenticationRequired reports an off-session charge the customer's
+	// bank will only approve once they authenticate it themselves.
+	ErrAuthenticationRequired = errors.New("payment requires customer authentication")
+	// ErrCardDeclined reports a saved card the bank declined.
+	ErrCardDeclined = errors.New("card declined")
+	// ErrInvalidWebhook reports a webhook whose signature or payload cannot be trusted.
+	ErrInvalidWebhook = errors.New("invalid webhook")
+)
+
+// ValidationError reports every field of a request that breaks payit's
+// limits, so callers can fix them all at once.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		problems[i] = f.Field + ": " + f.Message
+	}
+	return "invalid request: " + strings.Join(problems, "; ")
+}
@@ -0,0 +1,60 @@
+package payments
+
+// EventType identifies a provider notification that payit reacts to.
+type EventType string
+
+// Provider-agnostic event types. Drivers translate their own notifications
+// into these; anything else is acknowledged and ignored.
+const (
+	EventCheckoutCompleted EventType = "checkout.completed"
+	// EventCheckoutExpired covers sessions that lapsed unpaid.
+	EventCheckoutExpired EventType = "checkout.expired"
+	// EventCheckoutFailed covers delayed payment methods that ultimately failed.
+	EventCheckoutFailed EventType = "checkout.failed"
+	// EventRefundIssued reports money returned to the customer; AmountCents is
+	// the cumulative amount refunded for the payment.
+	EventRefundIssued EventType = "refund.issued"
+	// EventRenewalFailed reports a subscription invoice that could not be collected.
+	EventRenewalFailed EventType = "subscription.renewal_failed"
+	// EventRenewalPaid reports a subscription invoice that was paid.
+	EventRenewalPaid EventType = "subscription.renewal_paid"
+	// EventSubscriptionUpdated carries the current state of a subscription.
+	EventSubscriptionUpdated EventType = "subscription.updated"
+	// EventTrialEnding warns that a subscription's free trial ends soon.
+	EventTrialEnding EventType = "subscription.trial_ending"
+)
+
+// Totals break down the amount a provider charged at checkout. AmountCents
+// is the final total, after the provider's own discounts and tax and with
+// shipping included.
+type Totals struct {
+	AmountCents   int64
+	DiscountCents int64
+	TaxCents      int64
+}
+
+// Event is a verified provider notification translated into payit's terms.
+type Event struct {
+	ID              string
+	Type            EventType
+	SessionID       string
+	PaymentIntentID string
+	Paid            bool
+	CustomerEmail   string
+	ShippingAddress *Address
+	ShippingRate    string
+	ShippingCents   int64
+	// Totals are what the provider charged for a completed checkout, when
+	// it reports them.
+	Totals         *Totals
+	AmountCents    int64
+	Currency       string
+	SubscriptionID string
+	// PaymentUpdateURL lets a customer fix a failed payment themselves.
+	PaymentUpdateURL string
+	// Subscription is set on EventSubscriptionUpdated and EventTrialEnding.
+	Subscription *Subscription
+	// PreviousStatus is the subscription's status before an
+	// EventSubscriptionUpdated, when the provider reports it.
+	PreviousStatus string
+}
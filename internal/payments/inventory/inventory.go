@@ -0,0 +1,205 @@
+package inventory
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/statefile"
+)
+
+type reservation struct {
+	SKU       string    `json:"sku"`
+	Quantity  int64     `json:"quantity"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// state is what the tracker keeps across restarts.
+type state struct {
+	OnHand map[string]int64 `json:"on_hand"`
+	// Seeded is the configured stock level each SKU was last given, so that
+	// raising it in the configuration restocks the difference.
+	Seeded       map[string]int64       `json:"seeded"`
+	Reservations map[string]reservation `json:"reservations"`
+}
+
+// Memory tracks stock per SKU and holds reservations for open checkouts.
+// SKUs without a stock level are treated as unlimited.
+type Memory struct {
+	ttl time.Duration
+	now func() time.Time
+	// path is the file stock is kept in; empty keeps it in memory.
+	path string
+
+	mu    sync.Mutex
+	state state
+}
+
+// NewMemory creates a tracker seeded with stock levels. Reservations lapse
+// after ttl even if no expiry notification arrives, so stock cannot leak.
+func NewMemory(stock map[string]int64, ttl time.Duration) *Memory {
+	m := &Memory{
+		ttl: ttl,
+		now: time.Now,
+		state: state{
+			OnHand:       make(map[string]int64, len(stock)),
+			Seeded:       make(map[string]int64, len(stock)),
+			Reservations: make(map[string]reservation),
+		},
+	}
+	for sku, qty := range stock {
+		m.state.OnHand[sku] = qty
+		m.state.Seeded[sku] = qty
+	}
+	return m
+}
+
+// Open creates a tracker like NewMemory whose stock and reservations are
+// kept in the file at path. Units sold and reserved before a restart stay
+// sold and reserved; a stock level changed in the configuration since the
+// last start adds or removes the difference.
+func Open(path string, stock map[string]int64, ttl time.Duration) (*Memory, error) {
+	m := NewMemory(nil, ttl)
+	m.path = path
+	if err := statefile.Load(path, &m.state); err != nil {
+		return nil, fmt.Errorf("load stock: %w", err)
+	}
+	if m.state.OnHand == nil {
+		m.state.OnHand = make(map[string]int64, len(stock))
+	}
+	if m.state.Seeded == nil {
+		m.state.Seeded = make(map[string]int64, len(stock))
+	}
+	if m.state.Reservations == nil {
+		m.state.Reservations = make(map[string]reservation)
+	}
+
+	for sku := range m.state.OnHand {
+		if _, ok := stock[sku]; !ok {
+			delete(m.state.OnHand, sku)
+			delete(m.state.Seeded, sku)
+		}
+	}
+	for sku, qty := range stock {
+		if seeded, ok := m.state.Seeded[sku]; ok {
+			m.state.OnHand[sku] += qty - seeded
+		} else {
+			m.state.OnHand[sku] = qty
+		}
+		m.state.Seeded[sku] = qty
+	}
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reserve holds quantity units of sku and returns the reservation ID.
+func (m *Memory) Reserve(_ context.Context, sku string, quantity int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, tracked := m.state.OnHand[sku]; tracked {
+		if available := m.available(sku); available < quantity {
+			return "", fmt.Errorf("%w: %d of %s requested, %d available", payments.ErrOutOfStock, quantity, sku, available)
+		}
+	}
+
+	id := "res_" + rand.Text()
+	m.state.Reservations[id] = reservation{SKU: sku, Quantity: quantity, ExpiresAt: m.now().Add(m.ttl)}
+	if err := m.save(); err != nil {
+		delete(m.state.Reservations, id)
+		return "", err
+	}
+	return id, nil
+}
+
+// Commit turns a reservation into a sale, permanently removing the units. A
+// checkout paid after its reservation lapsed still sold quantity units of
+// sku, so those are taken directly then.
+func (m *Memory) Commit(_ context.Context, id, sku string, quantity int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, reserved := m.state.Reservations[id]
+	if reserved {
+		sku, quantity = r.SKU, r.Quantity
+		delete(m.state.Reservations, id)
+	}
+	_, tracked := m.state.OnHand[sku]
+	if tracked {
+		// Units of a lapsed reservation may have been resold; stock can then
+		// go negative, which surfaces the oversell.
+		m.state.OnHand[sku] -= quantity
+	}
+	if err := m.save(); err != nil {
+		if tracked {
+			m.state.OnHand[sku] += quantity
+		}
+		if reserved {
+			m.state.Reservations[id] = r
+		}
+		return err
+	}
+	return nil
+}
+
+// Release returns a reservation's units to the available pool.
+func (m *Memory) Release(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.state.Reservations[id]
+	if !ok {
+		return fmt.Errorf("reservation %s: %w", id, payments.ErrNotFound)
+	}
+	delete(m.state.Reservations, id)
+	if err := m.save(); err != nil {
+		m.state.Reservations[id] = r
+		return err
+	}
+	return nil
+}
+
+// Available reports the units of sku that can still be reserved, and whether
+// the SKU is tracked at all.
+func (m *Memory) Available(_ context.Context, sku string) (int64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, tracked := m.state.OnHand[sku]; !tracked {
+		return 0, false
+	}
+	return m.available(sku), true
+}
+
+// available must be called with mu held. Lapsed reservations stop holding
+// stock and are forgotten; a late payment for one is committed by SKU.
+func (m *Memory) available(sku string) int64 {
+	now := m.now()
+	units := m.state.OnHand[sku]
+	for id, r := range m.state.Reservations {
+		if !now.Before(r.ExpiresAt) {
+			delete(m.state.Reservations, id)
+			continue
+		}
+		if r.SKU == sku {
+			units -= r.Quantity
+		}
+	}
+	return units
+}
+
+// save must be called with mu held.
+func (m *Memory) save() error {
+	if m.path == "" {
+		return nil
+	}
+	if err := statefile.Save(m.path, m.state); err != nil {
+		return fmt.Errorf("save stock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+func TestMemory_ReserveRejectsShortStock(t *testing.T) {
+	ctx := context.Background()
+	inv := NewMemory(map[string]int64{"drop": 3}, time.Hour)
+
+	if _, err := inv.Reserve(ctx, "drop", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := inv.Reserve(ctx, "drop", 2); !errors.Is(err, payments.ErrOutOfStock) {
+		t.Fatalf("expected ErrOutOfStock, got %v", err)
+	}
+	if available, _ := inv.Available(ctx, "drop"); available != 1 {
+		t.Fatalf("expected 1 unit available, got %d", available)
+	}
+}
+
+func TestMemory_CommitAndRelease(t *testing.T) {
+	ctx := context.Background()
+	inv := NewMemory(map[string]int64{"drop": 3}, time.Hour)
+
+	sold, _ := inv.Reserve(ctx, "drop", 2)
+	abandoned, _ := inv.Reserve(ctx, "drop", 1)
+
+	if err := inv.Commit(ctx, sold, "drop", 2); err != nil {
+		t.Fatalf("unexpected commit error: %v", err)
+	}
+	if err := inv.Release(ctx, abandoned); err != nil {
+		t.Fatalf("unexpected release error: %v", err)
+	}
+
+	if available, _ := inv.Available(ctx, "drop"); available != 1 {
+		t.Fatalf("expected 1 unit left after sale, got %d", available)
+	}
+	if err := inv.Release(ctx, abandoned); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound on double release, got %v", err)
+	}
+}
+
+func TestMemory_LapsedReservationsFreeStock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	inv := NewMemory(map[string]int64{"drop": 1}, time.Hour)
+	inv.now = func() time.Time { return now }
+
+	id, _ := inv.Reserve(ctx, "drop", 1)
+	now = now.Add(61 * time.Minute)
+
+	if available, _ := inv.Available(ctx, "drop"); available != 1 {
+		t.Fatalf("expected lapsed reservation to free stock, got %d", available)
+	}
+	// Much later the payment goes through after all.
+	now = now.Add(24 * time.Hour)
+	if err := inv.Commit(ctx, id, "drop", 1); err != nil {
+		t.Fatalf("expected late payment to commit, got %v", err)
+	}
+	if available, _ := inv.Available(ctx, "drop"); available != 0 {
+		t.Fatalf("expected stock to be consumed, got %d", available)
+	}
+}
+
+func TestOpen_KeepsStockAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	inv, err := Open(path, map[string]int64{"drop": 5, "retired": 2}, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sold, _ := inv.Reserve(ctx, "drop", 2)
+	if err := inv.Commit(ctx, sold, "drop", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	held, _ := inv.Reserve(ctx, "drop", 1)
+
+	restarted, err := Open(path, map[string]int64{"drop": 5}, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if available, _ := restarted.Available(ctx, "drop"); available != 2 {
+		t.Fatalf("expected sold and reserved units kept across a restart, got %d", available)
+	}
+	if err := restarted.Release(ctx, held); err != nil {
+		t.Fatalf("expected the reservation to survive the restart, got %v", err)
+	}
+	if _, tracked := restarted.Available(ctx, "retired"); tracked {
+		t.Fatal("expected a SKU dropped from the configuration to be untracked")
+	}
+
+	restocked, err := Open(path, map[string]int64{"drop": 15}, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if available, _ := restocked.Available(ctx, "drop"); available != 13 {
+		t.Fatalf("expected a raised stock level to add ten units, got %d", available)
+	}
+}
+
+func TestMemory_UntrackedSKUIsUnlimited(t *testing.T) {
+	inv := NewMemory(nil, time.Hour)
+
+	if _, err := inv.Reserve(context.Background(), "digital", 1000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, tracked := inv.Available(context.Background(), "digital"); tracked {
+		t.Fatal("expected untracked SKU")
+	}
+}
@@ -0,0 +1,334 @@
+// Package metering records usage of metered prices, aggregates it per
+// customer, meter and hour, and reports it to the payment provider on a
+// schedule.
+package metering
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/validate"
+	"github.com/rjNemo/payit/internal/statefile"
+)
+
+// CustomerStore looks up the customers usage is recorded for.
+type CustomerStore interface {
+	Customer(ctx context.Context, id string) (payments.Customer, error)
+}
+
+// Reporter sends usage to the payment provider and reads back what it has
+// on record.
+type Reporter interface {
+	// ReportUsage records batch against customer under price's meter.
+	// Reporting a batch ID again must not count its usage twice.
+	ReportUsage(ctx context.Context, price config.MeteredPriceConfig, customer payments.Customer, batch payments.UsageBatch) error
+	// UsageTotal returns the usage of price's meter by customer between
+	// from and to, which fall on hour boundaries.
+	UsageTotal(ctx context.Context, price config.MeteredPriceConfig, customer payments.Customer, from, to time.Time) (int64, error)
+}
+
+// MaxRecords caps the usage records accepted in one call.
+const MaxRecords = 1000
+
+// retention is how long reported batches are kept for reconciliation; it
+// matches how far back providers accept usage.
+const retention = 35 * 24 * time.Hour
+
+type usageKey struct {
+	customerID string
+	meter      string
+	hour       time.Time
+}
+
+// state is what the meter keeps across restarts.
+type state struct {
+	// Unsent holds batches closed for reporting; each keeps its ID across
+	// retries so the provider can drop duplicates.
+	Unsent []payments.UsageBatch `json:"unsent"`
+	// Reported is the ledger of batches the provider accepted, kept for
+	// reconciliation.
+	Reported []payments.UsageBatch `json:"reported"`
+}
+
+// Meter buffers usage until it is flushed to the provider. Usage still
+// coming in is aggregated in memory, so usage recorded since the last flush
+// is lost if payit stops abruptly; Run flushes once more on shutdown.
+type Meter struct {
+	cfg       config.MeteringConfig
+	customers CustomerStore
+	reporter  Reporter
+	now       func() time.Time
+	// path is the file unsent and reported batches are kept in; empty keeps
+	// them in memory.
+	path string
+
+	// flushing serializes flushes so a batch is never in flight twice.
+	flushing sync.Mutex
+	mu       sync.Mutex
+	// open aggregates usage still coming in.
+	open  map[usageKey]*payments.UsageBatch
+	state state
+}
+
+// New creates a meter for the metered prices in cfg, reporting through reporter.
+func New(cfg config.MeteringConfig, customers CustomerStore, reporter Reporter) *Meter {
+	return &Meter{
+		cfg:       cfg,
+		customers: customers,
+		reporter:  reporter,
+		now:       time.Now,
+		open:      make(map[usageKey]*payments.UsageBatch),
+	}
+}
+
+// Open creates a meter like New whose unsent and reported batches are kept
+// in the file at path, resuming those recorded there.
+func Open(path string, cfg config.MeteringConfig, customers CustomerStore, reporter Reporter) (*Meter, error) {
+	m := New(cfg, customers, reporter)
+	m.path = path
+	if err := statefile.Load(path, &m.state); err != nil {
+		return nil, fmt.Errorf("load usage batches: %w", err)
+	}
+	return m, nil
+}
+
+// Batches returns how many unsent and reported batches the meter holds.
+func (m *Meter) Batches() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.state.Unsent) + len(m.state.Reported)
+}
+
+// Record validates records and adds them to the buffer. Either every record
+// is recorded or, when any is invalid, none is. Usage can only be recorded
+// for customers with a Stripe customer to bill it to.
+func (m *Meter) Record(ctx context.Context, records []payments.UsageRecord) error {
+	now := m.now().UTC()
+	var v validate.Validator
+	v.Check(len(records) > 0, "records", validate.CodeTooSmall, "must not be empty")
+	v.Check(len(records) <= MaxRecords, "records", validate.CodeTooLarge, fmt.Sprintf("must have at most %d records", MaxRecords))
+	for i, rec := range records {
+		field := fmt.Sprintf("records.%d", i)
+		validate.UsageRecord(&v, field, rec, m.cfg, now)
+		if rec.CustomerID == "" {
+			continue
+		}
+		customer, err := m.customers.Customer(ctx, rec.CustomerID)
+		switch {
+		case errors.Is(err, payments.ErrNotFound):
+			v.Add(field+".customer_id", validate.CodeInvalid, "is not a known customer")
+		case err != nil:
+			return fmt.Errorf("load customer %s: %w", rec.CustomerID, err)
+		case customer.ProviderIDs["stripe"] == "":
+			v.Add(field+".customer_id", validate.CodeInvalid, "has no Stripe customer to bill")
+		}
+	}
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rec := range records {
+		at := rec.Timestamp
+		if at.IsZero() {
+			at = now
+		}
+		key := usageKey{customerID: rec.CustomerID, meter: rec.Meter, hour: at.UTC().Truncate(time.Hour)}
+		batch, ok := m.open[key]
+		if !ok {
+			batch = &payments.UsageBatch{ID: "usage_" + rand.Text(), CustomerID: key.customerID, Meter: key.meter, Hour: key.hour}
+			m.open[key] = batch
+		}
+		batch.Quantity += rec.Quantity
+		batch.Records++
+	}
+	return nil
+}
+
+// Flush reports all buffered usage to the provider. Batches that fail stay
+// buffered, under the same ID, for the next flush, until they are too old
+// for the provider to accept; those are dropped and reported in the error.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.flushing.Lock()
+	defer m.flushing.Unlock()
+
+	var errs []error
+	stale := m.now().Add(-validate.MaxUsageAge)
+	m.mu.Lock()
+	closed := make([]payments.UsageBatch, 0, len(m.open))
+	for key, batch := range m.open {
+		closed = append(closed, *batch)
+		delete(m.open, key)
+	}
+	slices.SortFunc(closed, compareBatches)
+	m.state.Unsent = append(m.state.Unsent, closed...)
+	m.state.Unsent = slices.DeleteFunc(m.state.Unsent, func(b payments.UsageBatch) bool {
+		if !b.Hour.Before(stale) {
+			return false
+		}
+		errs = append(errs, fmt.Errorf("drop usage batch %s: %d %s by %s at %s is too old to report",
+			b.ID, b.Quantity, b.Meter, b.CustomerID, b.Hour.Format(time.RFC3339)))
+		return true
+	})
+	pending := slices.Clone(m.state.Unsent)
+	err := m.save()
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, batch := range pending {
+		if err := m.report(ctx, batch); err != nil {
+			errs = append(errs, fmt.Errorf("report usage batch %s: %w", batch.ID, err))
+			continue
+		}
+		batch.ReportedAt = m.now().UTC()
+		m.mu.Lock()
+		m.state.Unsent = slices.DeleteFunc(m.state.Unsent, func(b payments.UsageBatch) bool { return b.ID == batch.ID })
+		m.state.Reported = append(m.state.Reported, batch)
+		err := m.save()
+		m.mu.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	cutoff := m.now().Add(-retention)
+	m.mu.Lock()
+	m.state.Reported = slices.DeleteFunc(m.state.Reported, func(b payments.UsageBatch) bool { return b.Hour.Before(cutoff) })
+	err = m.save()
+	m.mu.Unlock()
+	return errors.Join(append(errs, err)...)
+}
+
+// save writes the unsent and reported batches to disk. m.mu must be held.
+func (m *Meter) save() error {
+	if m.path == "" {
+		return nil
+	}
+	if err := statefile.Save(m.path, m.state); err != nil {
+		return fmt.Errorf("save usage batches: %w", err)
+	}
+	return nil
+}
+
+func (m *Meter) report(ctx context.Context, batch payments.UsageBatch) error {
+	price, ok := m.cfg.Price(batch.Meter)
+	if !ok {
+		return fmt.Errorf("meter %s is no longer configured", batch.Meter)
+	}
+	customer, err := m.customers.Customer(ctx, batch.CustomerID)
+	if err != nil {
+		return fmt.Errorf("load customer %s: %w", batch.CustomerID, err)
+	}
+	return m.reporter.ReportUsage(ctx, price, customer, batch)
+}
+
+// Run flushes buffered usage every interval until ctx is done, then flushes
+// one last time so usage recorded before shutdown is not lost.
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.WithoutCancel(ctx), finalFlushTimeout)
+			defer cancel()
+			if err := m.Flush(final); err != nil {
+				log.Printf("flush usage on shutdown: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := m.Flush(ctx); err != nil {
+				log.Printf("flush usage: %v", err)
+			}
+		}
+	}
+}
+
+// finalFlushTimeout bounds the flush made while payit shuts down.
+const finalFlushTimeout = 10 * time.Second
+
+// Reconcile compares, per customer and meter, the usage recorded between
+// from and to with what the provider has on record. Both bounds are rounded
+// down to the hour, the granularity usage is aggregated at.
+func (m *Meter) Reconcile(ctx context.Context, from, to time.Time) (payments.UsageReconciliation, error) {
+	from, to = from.UTC().Truncate(time.Hour), to.UTC().Truncate(time.Hour)
+	type lineKey struct{ customerID, meter string }
+	lines := make(map[lineKey]*payments.UsageReconciliationLine)
+	add := func(batch payments.UsageBatch, reported bool) {
+		if batch.Hour.Before(from) || !batch.Hour.Before(to) {
+			return
+		}
+		key := lineKey{batch.CustomerID, batch.Meter}
+		line, ok := lines[key]
+		if !ok {
+			line = &payments.UsageReconciliationLine{CustomerID: batch.CustomerID, Meter: batch.Meter}
+			lines[key] = line
+		}
+		line.Recorded += batch.Quantity
+		if reported {
+			line.Reported += batch.Quantity
+		} else {
+			line.Pending += batch.Quantity
+		}
+	}
+
+	m.mu.Lock()
+	for _, batch := range m.open {
+		add(*batch, false)
+	}
+	for _, batch := range m.state.Unsent {
+		add(batch, false)
+	}
+	for _, batch := range m.state.Reported {
+		add(batch, true)
+	}
+	m.mu.Unlock()
+
+	report := payments.UsageReconciliation{From: from, To: to, Lines: []payments.UsageReconciliationLine{}}
+	for _, line := range lines {
+		if err := m.providerUsage(ctx, line, from, to); err != nil {
+			line.Error = err.Error()
+		}
+		report.Lines = append(report.Lines, *line)
+	}
+	slices.SortFunc(report.Lines, func(a, b payments.UsageReconciliationLine) int {
+		return cmp.Or(cmp.Compare(a.CustomerID, b.CustomerID), cmp.Compare(a.Meter, b.Meter))
+	})
+	return report, nil
+}
+
+// providerUsage fills in what the provider has on record for line.
+func (m *Meter) providerUsage(ctx context.Context, line *payments.UsageReconciliationLine, from, to time.Time) error {
+	price, ok := m.cfg.Price(line.Meter)
+	if !ok {
+		return fmt.Errorf("meter %s is no longer configured", line.Meter)
+	}
+	customer, err := m.customers.Customer(ctx, line.CustomerID)
+	if err != nil {
+		return fmt.Errorf("load customer %s: %w", line.CustomerID, err)
+	}
+	total, err := m.reporter.UsageTotal(ctx, price, customer, from, to)
+	if err != nil {
+		return err
+	}
+	line.Provider = total
+	line.Difference = total - line.Reported
+	return nil
+}
+
+func compareBatches(a, b payments.UsageBatch) int {
+	return cmp.Or(a.Hour.Compare(b.Hour), cmp.Compare(a.CustomerID, b.CustomerID), cmp.Compare(a.Meter, b.Meter))
+}
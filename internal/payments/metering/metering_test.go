@@ -0,0 +1,228 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeCustomers map[string]payments.Customer
+
+func (f fakeCustomers) Customer(ctx context.Context, id string) (payments.Customer, error) {
+	c, ok := f[id]
+	if !ok {
+		return payments.Customer{}, payments.ErrNotFound
+	}
+	return c, nil
+}
+
+type fakeReporter struct {
+	err      error
+	reported []payments.UsageBatch
+	totals   map[string]int64
+}
+
+func (f *fakeReporter) ReportUsage(ctx context.Context, price config.MeteredPriceConfig, customer payments.Customer, batch payments.UsageBatch) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.reported = append(f.reported, batch)
+	return nil
+}
+
+func (f *fakeReporter) UsageTotal(ctx context.Context, price config.MeteredPriceConfig, customer payments.Customer, from, to time.Time) (int64, error) {
+	return f.totals[customer.ID+"/"+price.Meter], nil
+}
+
+var testNow = time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC)
+
+func newTestMeter(reporter *fakeReporter) *Meter {
+	cfg := config.MeteringConfig{Prices: []config.MeteredPriceConfig{{Meter: "api_requests", StripePriceID: "price_1", StripeMeterID: "mtr_1"}}}
+	m := New(cfg, fakeCustomers{"cust_1": {ID: "cust_1", ProviderIDs: map[string]string{"stripe": "cus_1"}}}, reporter)
+	m.now = func() time.Time { return testNow }
+	return m
+}
+
+func TestMeter_RecordAggregatesPerHour(t *testing.T) {
+	reporter := &fakeReporter{}
+	m := newTestMeter(reporter)
+	ctx := context.Background()
+
+	err := m.Record(ctx, []payments.UsageRecord{
+		{CustomerID: "cust_1", Meter: "api_requests", Quantity: 3},
+		{CustomerID: "cust_1", Meter: "api_requests", Quantity: 2, Timestamp: testNow.Add(-10 * time.Minute)},
+		{CustomerID: "cust_1", Meter: "api_requests", Quantity: 5, Timestamp: testNow.Add(-time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reporter.reported) != 2 {
+		t.Fatalf("expected one batch per hour, got %#v", reporter.reported)
+	}
+	first, second := reporter.reported[0], reporter.reported[1]
+	if first.Quantity != 5 || first.Hour != testNow.Truncate(time.Hour).Add(-time.Hour) || second.Quantity != 5 || second.Records != 2 {
+		t.Fatalf("unexpected batches: %#v", reporter.reported)
+	}
+	if first.ID == "" || first.ID == second.ID {
+		t.Fatalf("expected distinct batch identifiers, got %q and %q", first.ID, second.ID)
+	}
+}
+
+func TestMeter_RecordRejectsInvalidBatch(t *testing.T) {
+	m := newTestMeter(&fakeReporter{})
+
+	err := m.Record(context.Background(), []payments.UsageRecord{
+		{CustomerID: "cust_1", Meter: "api_requests", Quantity: 1},
+		{CustomerID: "cust_9", Meter: "storage", Quantity: 0},
+	})
+	var verr *payments.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, f := range verr.Fields {
+		fields[f.Field] = true
+	}
+	if !fields["records.1.customer_id"] || !fields["records.1.meter"] || !fields["records.1.quantity"] || fields["records.0.quantity"] {
+		t.Fatalf("unexpected field errors: %#v", verr.Fields)
+	}
+	if len(m.open) != 0 {
+		t.Fatalf("expected nothing recorded, got %#v", m.open)
+	}
+}
+
+func TestMeter_RecordRejectsCustomersWithoutStripeCustomer(t *testing.T) {
+	m := newTestMeter(&fakeReporter{})
+	m.customers = fakeCustomers{"cust_2": {ID: "cust_2"}}
+
+	err := m.Record(context.Background(), []payments.UsageRecord{{CustomerID: "cust_2", Meter: "api_requests", Quantity: 1}})
+	var verr *payments.ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Field != "records.0.customer_id" {
+		t.Fatalf("expected the customer to be rejected, got %v", err)
+	}
+}
+
+func TestMeter_FlushDropsStaleBatches(t *testing.T) {
+	reporter := &fakeReporter{err: errors.New("provider unavailable")}
+	m := newTestMeter(reporter)
+	ctx := context.Background()
+
+	if err := m.Record(ctx, []payments.UsageRecord{{CustomerID: "cust_1", Meter: "api_requests", Quantity: 4}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Flush(ctx); err == nil {
+		t.Fatal("expected the failed report to be returned")
+	}
+
+	m.now = func() time.Time { return testNow.Add(31 * 24 * time.Hour) }
+	err := m.Flush(ctx)
+	if err == nil || !strings.Contains(err.Error(), "too old to report") {
+		t.Fatalf("expected the stale batch to be reported as dropped, got %v", err)
+	}
+	if len(m.state.Unsent) != 0 {
+		t.Fatalf("expected the stale batch to be dropped, got %#v", m.state.Unsent)
+	}
+}
+
+func TestOpen_ResumesUnsentAndReportedBatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metering.json")
+	cfg := config.MeteringConfig{Prices: []config.MeteredPriceConfig{{Meter: "api_requests", StripePriceID: "price_1"}}}
+	customers := fakeCustomers{"cust_1": {ID: "cust_1", ProviderIDs: map[string]string{"stripe": "cus_1"}}}
+	reporter := &fakeReporter{}
+	m, err := Open(path, cfg, customers, reporter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.now = func() time.Time { return testNow }
+	ctx := context.Background()
+
+	for _, fail := range []bool{false, true} {
+		if fail {
+			reporter.err = errors.New("provider unavailable")
+		}
+		if err := m.Record(ctx, []payments.UsageRecord{{CustomerID: "cust_1", Meter: "api_requests", Quantity: 2}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = m.Flush(ctx)
+	}
+
+	resumed, err := Open(path, cfg, customers, reporter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resumed.state.Unsent) != 1 || len(resumed.state.Reported) != 1 || resumed.state.Unsent[0].ID != m.state.Unsent[0].ID {
+		t.Fatalf("expected the batches to survive a restart, got %#v", resumed.state)
+	}
+}
+
+func TestMeter_FlushRetriesWithSameIdentifier(t *testing.T) {
+	reporter := &fakeReporter{err: errors.New("provider unavailable")}
+	m := newTestMeter(reporter)
+	ctx := context.Background()
+
+	if err := m.Record(ctx, []payments.UsageRecord{{CustomerID: "cust_1", Meter: "api_requests", Quantity: 4}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Flush(ctx); err == nil {
+		t.Fatalf("expected the failed report to be returned")
+	}
+	if len(m.state.Unsent) != 1 {
+		t.Fatalf("expected the batch to stay buffered, got %#v", m.state.Unsent)
+	}
+	id := m.state.Unsent[0].ID
+
+	// Usage arriving meanwhile goes into a new batch, not the one in flight.
+	if err := m.Record(ctx, []payments.UsageRecord{{CustomerID: "cust_1", Meter: "api_requests", Quantity: 1}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reporter.err = nil
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reporter.reported) != 2 || reporter.reported[0].ID != id || reporter.reported[0].Quantity != 4 {
+		t.Fatalf("expected the batch retried under its identifier, got %#v", reporter.reported)
+	}
+	if len(m.state.Unsent) != 0 || len(m.state.Reported) != 2 {
+		t.Fatalf("expected both batches reported, got %d unsent, %d reported", len(m.state.Unsent), len(m.state.Reported))
+	}
+}
+
+func TestMeter_Reconcile(t *testing.T) {
+	reporter := &fakeReporter{totals: map[string]int64{"cust_1/api_requests": 9}}
+	m := newTestMeter(reporter)
+	ctx := context.Background()
+
+	if err := m.Record(ctx, []payments.UsageRecord{{CustomerID: "cust_1", Meter: "api_requests", Quantity: 7}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Record(ctx, []payments.UsageRecord{{CustomerID: "cust_1", Meter: "api_requests", Quantity: 2}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report, err := m.Reconcile(ctx, testNow.Add(-24*time.Hour), testNow.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Lines) != 1 {
+		t.Fatalf("expected one line, got %#v", report.Lines)
+	}
+	line := report.Lines[0]
+	if line.Recorded != 9 || line.Reported != 7 || line.Pending != 2 || line.Provider != 9 || line.Difference != 2 {
+		t.Fatalf("unexpected line: %#v", line)
+	}
+	if report.To != testNow.Truncate(time.Hour).Add(time.Hour) {
+		t.Fatalf("expected bounds rounded to the hour, got %v", report.To)
+	}
+}
@@ -0,0 +1,22 @@
+package payments
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatMoney renders an amount in minor units for people, as in "12.34 EUR"
+// or "-5.00 USD".
+func FormatMoney(cents int64, currency string) string {
+	return FormatDecimal(cents) + " " + strings.ToUpper(currency)
+}
+
+// FormatDecimal renders an amount in minor units as a decimal number with
+// two places, as in "12.34" or "-0.50".
+func FormatDecimal(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
@@ -0,0 +1,20 @@
+package payments
+
+import "testing"
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		cents int64
+		want  string
+	}{
+		{1234, "12.34 EUR"},
+		{5, "0.05 EUR"},
+		{-50, "-0.50 EUR"},
+		{-1234, "-12.34 EUR"},
+	}
+	for _, tt := range tests {
+		if got := FormatMoney(tt.cents, "eur"); got != tt.want {
+			t.Fatalf("FormatMoney(%d) = %q, want %q", tt.cents, got, tt.want)
+		}
+	}
+}
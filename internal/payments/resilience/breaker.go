@@ -0,0 +1,80 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker opens after threshold consecutive failures and rejects calls until
+// cooldown has passed. It then lets a single probe through: success closes
+// it, failure opens it for another cooldown.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+// NewBreaker returns a closed breaker. A threshold below one disables it.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// Allow reports whether a call may go ahead. Every allowed call must be
+// followed by Success, Failure or Release.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold < 1 || b.failures < b.threshold {
+		return true
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Success records a call that reached the provider and closes the breaker.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records a call the provider failed. Reaching the threshold, or a
+// failed probe, (re)opens the breaker.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.failures >= b.threshold || b.probing {
+		b.failures = max(b.failures, b.threshold)
+		b.openedAt = b.now()
+	}
+	b.probing = false
+}
+
+// Release gives back an allowed call whose outcome says nothing about the
+// provider, such as one the caller canceled.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// Open reports whether calls are currently being rejected.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.threshold >= 1 && b.failures >= b.threshold && (b.probing || b.now().Sub(b.openedAt) < b.cooldown)
+}
@@ -0,0 +1,144 @@
+// Package resilience guards calls to payment providers with per-call
+// timeouts, retries of transient failures and a circuit breaker.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// Policy runs provider calls under a timeout, retrying transient failures and
+// failing fast with payments.ErrProviderUnavailable while its breaker is open.
+// A nil Policy runs calls unguarded.
+type Policy struct {
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	breaker *Breaker
+}
+
+// Option customises a Policy.
+type Option func(*Policy)
+
+// WithBackoff sets the wait before the first retry; it doubles on every
+// further attempt.
+func WithBackoff(d time.Duration) Option {
+	return func(p *Policy) {
+		p.backoff = d
+	}
+}
+
+// New builds a policy from cfg.
+func New(cfg config.ResilienceConfig, opts ...Option) *Policy {
+	p := &Policy{
+		timeout: cfg.CallTimeout,
+		retries: max(cfg.MaxRetries, 0),
+		backoff: config.ProviderBackoff,
+		breaker: NewBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Do runs call until it succeeds, fails with an error transient rejects, or
+// runs out of retries or of time before ctx's deadline. Each attempt gets its
+// own timeout; an attempt that hits it counts as transient. Exhausted retries and an open breaker both surface
+// as payments.ErrProviderUnavailable wrapping the last failure, and an answer
+// the provider refused surfaces as payments.ErrProviderRejected, so callers
+// can tell an outage from a rejected request and both from a local failure.
+//
+// call must be safe to repeat: requests that move money should carry the same
+// provider idempotency key on every attempt.
+func (p *Policy) Do(ctx context.Context, transient func(error) bool, call func(context.Context) error) error {
+	if p == nil {
+		err := call(ctx)
+		if err != nil && ctx.Err() == nil && (transient == nil || !transient(err)) {
+			return fmt.Errorf("%w: %w", payments.ErrProviderRejected, err)
+		}
+		return err
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if !p.breaker.Allow() {
+			if err != nil {
+				return fmt.Errorf("%w: circuit breaker opened: %w", payments.ErrProviderUnavailable, err)
+			}
+			return fmt.Errorf("%w: circuit breaker open", payments.ErrProviderUnavailable)
+		}
+
+		err = p.attempt(ctx, call)
+		switch {
+		case err == nil:
+			p.breaker.Success()
+			return nil
+		case ctx.Err() != nil:
+			// The caller gave up; that says nothing about the provider.
+			p.breaker.Release()
+			return err
+		case !p.isTransient(err, transient):
+			// The provider answered, it just said no.
+			p.breaker.Success()
+			return fmt.Errorf("%w: %w", payments.ErrProviderRejected, err)
+		}
+
+		p.breaker.Failure()
+		if attempt >= p.retries {
+			return fmt.Errorf("%w: %w", payments.ErrProviderUnavailable, err)
+		}
+		wait := min(p.backoff<<attempt, config.MaxProviderBackoff)
+		if !p.fits(ctx, wait) {
+			return fmt.Errorf("%w: no time left to retry: %w", payments.ErrProviderUnavailable, err)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Policy) attempt(ctx context.Context, call func(context.Context) error) error {
+	if p.timeout <= 0 {
+		return call(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	return call(ctx)
+}
+
+// fits reports whether another attempt, after waiting wait, can run its full
+// timeout before ctx's deadline. Starting one that the deadline would cut
+// short only delays the answer the caller is about to get anyway.
+func (p *Policy) fits(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) >= wait+p.timeout
+}
+
+// isTransient treats a per-attempt timeout as transient on top of what the
+// caller classifies; the parent context is known to be alive here.
+func (p *Policy) isTransient(err error, transient func(error) bool) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	return transient != nil && transient(err)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
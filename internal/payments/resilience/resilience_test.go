@@ -0,0 +1,167 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+var errFlaky = errors.New("connection reset")
+
+func isFlaky(err error) bool { return errors.Is(err, errFlaky) }
+
+func testPolicy(retries, threshold int) *Policy {
+	cfg := config.ResilienceConfig{
+		CallTimeout:      time.Second,
+		MaxRetries:       retries,
+		BreakerThreshold: threshold,
+		BreakerCooldown:  time.Minute,
+	}
+	return New(cfg, WithBackoff(0))
+}
+
+func TestPolicyRetriesTransientFailures(t *testing.T) {
+	p := testPolicy(2, 10)
+	calls := 0
+	err := p.Do(context.Background(), isFlaky, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errFlaky
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success on the third attempt, got %v after %d calls", err, calls)
+	}
+}
+
+func TestPolicyGivesUpAsProviderUnavailable(t *testing.T) {
+	p := testPolicy(1, 10)
+	calls := 0
+	err := p.Do(context.Background(), isFlaky, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+	if !errors.Is(err, payments.ErrProviderUnavailable) || !errors.Is(err, errFlaky) || calls != 2 {
+		t.Fatalf("expected provider unavailable after 2 calls, got %v after %d", err, calls)
+	}
+}
+
+func TestPolicyDoesNotRetryRejections(t *testing.T) {
+	p := testPolicy(3, 1)
+	declined := errors.New("card declined")
+	calls := 0
+	err := p.Do(context.Background(), isFlaky, func(context.Context) error {
+		calls++
+		return declined
+	})
+	if !errors.Is(err, declined) || !errors.Is(err, payments.ErrProviderRejected) || errors.Is(err, payments.ErrProviderUnavailable) || calls != 1 {
+		t.Fatalf("expected the rejection once, got %v after %d calls", err, calls)
+	}
+	if p.breaker.Open() {
+		t.Fatal("a rejection must not open the breaker")
+	}
+}
+
+func TestPolicyTimesOutSlowCalls(t *testing.T) {
+	p := New(config.ResilienceConfig{CallTimeout: 10 * time.Millisecond, BreakerThreshold: 10}, WithBackoff(0))
+	err := p.Do(context.Background(), nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, payments.ErrProviderUnavailable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timed-out call to be unavailable, got %v", err)
+	}
+}
+
+func TestPolicyStopsRetryingNearTheDeadline(t *testing.T) {
+	p := testPolicy(3, 10)
+	// A retry would need the full one-second call timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	calls := 0
+	err := p.Do(ctx, isFlaky, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+	if !errors.Is(err, payments.ErrProviderUnavailable) || !errors.Is(err, errFlaky) || calls != 1 {
+		t.Fatalf("expected to give up after one call, got %v after %d", err, calls)
+	}
+}
+
+func TestPolicyIgnoresCallerCancellation(t *testing.T) {
+	p := testPolicy(3, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.Do(ctx, isFlaky, func(ctx context.Context) error { return ctx.Err() })
+	if !errors.Is(err, context.Canceled) || errors.Is(err, payments.ErrProviderUnavailable) {
+		t.Fatalf("expected the caller's cancellation, got %v", err)
+	}
+	if p.breaker.Open() {
+		t.Fatal("caller cancellation must not open the breaker")
+	}
+}
+
+func TestPolicyFailsFastWhileOpen(t *testing.T) {
+	p := testPolicy(0, 2)
+	calls := 0
+	flaky := func(context.Context) error {
+		calls++
+		return errFlaky
+	}
+	for range 2 {
+		_ = p.Do(context.Background(), isFlaky, flaky)
+	}
+
+	err := p.Do(context.Background(), isFlaky, flaky)
+	if !errors.Is(err, payments.ErrProviderUnavailable) || calls != 2 {
+		t.Fatalf("expected a fast failure without calling, got %v after %d calls", err, calls)
+	}
+}
+
+func TestNilPolicyCallsOnce(t *testing.T) {
+	var p *Policy
+	calls := 0
+	err := p.Do(context.Background(), isFlaky, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+	if !errors.Is(err, errFlaky) || calls != 1 {
+		t.Fatalf("expected one unguarded call, got %v after %d", err, calls)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.Allow()
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("expected an open breaker to reject calls")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatal("expected a probe after the cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("expected only one probe at a time")
+	}
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("expected a failed probe to reopen the breaker")
+	}
+
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Success()
+	if !b.Allow() || !b.Allow() || b.Open() {
+		t.Fatal("expected a successful probe to close the breaker")
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// SubscriptionDriver manages subscriptions held by the payment provider.
+type SubscriptionDriver interface {
+	// CancelSubscription stops a subscription from renewing at the end of the
+	// current period and returns its updated state.
+	CancelSubscription(ctx context.Context, id string) (payments.Subscription, error)
+}
+
+// WithSubscriptionDriver lets customers manage their subscriptions through d.
+func WithSubscriptionDriver(d SubscriptionDriver) Option {
+	return func(s *CheckoutService) {
+		s.subscriptionDriver = d
+	}
+}
+
+// receiptStatuses are the order states a customer has a receipt for.
+var receiptStatuses = []payments.OrderStatus{
+	payments.OrderStatusPaid,
+	payments.OrderStatusAuthorized,
+	payments.OrderStatusRefunded,
+}
+
+// CustomerOrders lists the orders the customer with email has paid for,
+// newest first.
+func (s *CheckoutService) CustomerOrders(ctx context.Context, email string) ([]payments.Order, error) {
+	if s.orders == nil {
+		return nil, nil
+	}
+	customer, err := s.accountCustomer(ctx, email)
+	if errors.Is(err, payments.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.orders.Orders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load orders: %w", err)
+	}
+	var owned []payments.Order
+	for _, order := range all {
+		if ownsOrder(customer, order) {
+			owned = append(owned, order)
+		}
+	}
+	return owned, nil
+}
+
+// CustomerOrder returns an order the customer with email has paid for.
+// Orders belonging to anyone else are reported as not found.
+func (s *CheckoutService) CustomerOrder(ctx context.Context, email, id string) (payments.Order, error) {
+	if s.orders == nil {
+		return payments.Order{}, payments.ErrNotFound
+	}
+	customer, err := s.accountCustomer(ctx, email)
+	if err != nil {
+		return payments.Order{}, err
+	}
+	order, err := s.orders.Order(ctx, id)
+	if err != nil {
+		return payments.Order{}, err
+	}
+	if !ownsOrder(customer, order) {
+		return payments.Order{}, fmt.Errorf("%w: order %s", payments.ErrNotFound, id)
+	}
+	return order, nil
+}
+
+// CustomerSubscriptions lists the subscriptions of the customer with email
+// that have not ended.
+func (s *CheckoutService) CustomerSubscriptions(ctx context.Context, email string) ([]payments.Subscription, error) {
+	if s.subscriptions == nil {
+		return nil, nil
+	}
+	all, err := s.subscriptions.Subscriptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load subscriptions: %w", err)
+	}
+	var owned []payments.Subscription
+	for _, sub := range all {
+		if strings.EqualFold(sub.CustomerEmail, email) && sub.Status != "canceled" && sub.Status != "incomplete_expired" {
+			owned = append(owned, sub)
+		}
+	}
+	return owned, nil
+}
+
+// CancelSubscription stops a subscription of the customer with email from
+// renewing. The customer keeps access until the end of the paid period.
+func (s *CheckoutService) CancelSubscription(ctx context.Context, email, id string) (payments.Subscription, error) {
+	owned, err := s.CustomerSubscriptions(ctx, email)
+	if err != nil {
+		return payments.Subscription{}, err
+	}
+	i := slices.IndexFunc(owned, func(sub payments.Subscription) bool { return sub.ID == id })
+	if i < 0 {
+		return payments.Subscription{}, fmt.Errorf("%w: subscription %s", payments.ErrNotFound, id)
+	}
+	before := owned[i]
+	if before.CancelAtPeriodEnd {
+		return before, nil
+	}
+	if s.subscriptionDriver == nil {
+		return payments.Subscription{}, fmt.Errorf("cancel subscription %s: %w", id, errors.ErrUnsupported)
+	}
+
+	sub, err := s.subscriptionDriver.CancelSubscription(ctx, id)
+	if err != nil {
+		return payments.Subscription{}, err
+	}
+	if sub.CustomerEmail == "" {
+		sub.CustomerEmail = before.CustomerEmail
+	}
+	if err := s.saveSubscription(ctx, payments.Event{Subscription: &sub}); err != nil {
+		return payments.Subscription{}, err
+	}
+	if s.auditor != nil {
+		s.auditor.Report(ctx, payments.AuditRecord{
+			Action:   payments.AuditSubscriptionCancel,
+			Target:   sub.ID,
+			Currency: sub.Currency,
+			Before:   subscriptionStateOf(before),
+			After:    subscriptionStateOf(sub),
+		})
+	}
+	return sub, nil
+}
+
+// subscriptionState is the slice of a subscription recorded around audited actions.
+type subscriptionState struct {
+	Status            string `json:"status"`
+	CancelAtPeriodEnd bool   `json:"cancel_at_period_end"`
+}
+
+func subscriptionStateOf(sub payments.Subscription) subscriptionState {
+	return subscriptionState{Status: sub.Status, CancelAtPeriodEnd: sub.CancelAtPeriodEnd}
+}
+
+// accountCustomer returns the customer record of the signed-in email.
+func (s *CheckoutService) accountCustomer(ctx context.Context, email string) (payments.Customer, error) {
+	if s.customers == nil || email == "" {
+		return payments.Customer{}, payments.ErrNotFound
+	}
+	return s.customers.CustomerByEmail(ctx, email)
+}
+
+// ownsOrder reports whether order is a receipt of customer. Orders are
+// matched by the customer they were linked to, which only happens for an
+// email the buyer signed in with or the provider confirmed, never by the
+// email typed at checkout.
+func ownsOrder(customer payments.Customer, order payments.Order) bool {
+	return order.CustomerID != "" && order.CustomerID == customer.ID && slices.Contains(receiptStatuses, order.Status)
+}
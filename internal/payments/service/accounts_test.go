@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeSubscriptionDriver struct {
+	canceled []string
+}
+
+func (f *fakeSubscriptionDriver) CancelSubscription(ctx context.Context, id string) (payments.Subscription, error) {
+	f.canceled = append(f.canceled, id)
+	return payments.Subscription{ID: id, Status: "active", CancelAtPeriodEnd: true}, nil
+}
+
+func TestCustomerOrders_OnlyListsTheCustomersReceipts(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{
+		{ID: "cs_paid", Status: payments.OrderStatusPaid, CustomerEmail: "Ada@example.com", CustomerID: "cust_ada"},
+		{ID: "cs_open", Status: payments.OrderStatusOpen, CustomerEmail: "ada@example.com", CustomerID: "cust_ada"},
+		{ID: "cs_typed", Status: payments.OrderStatusPaid, CustomerEmail: "ada@example.com"},
+		{ID: "cs_other", Status: payments.OrderStatusPaid, CustomerEmail: "grace@example.com", CustomerID: "cust_grace"},
+	}}
+	customers := &fakeCustomers{}
+	customers.SaveCustomer(context.Background(), payments.Customer{ID: "cust_ada", Email: "ada@example.com"})
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithCustomers(customers))
+	ctx := context.Background()
+
+	owned, err := svc.CustomerOrders(ctx, "ada@example.com")
+	if err != nil || len(owned) != 1 || owned[0].ID != "cs_paid" {
+		t.Fatalf("expected only ada's paid order, got %#v, %v", owned, err)
+	}
+	if _, err := svc.CustomerOrder(ctx, "ada@example.com", "cs_other"); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected someone else's order to be hidden, got %v", err)
+	}
+}
+
+func TestCancelSubscription(t *testing.T) {
+	subs := &fakeSubscriptions{}
+	subs.SaveSubscription(context.Background(), payments.Subscription{ID: "sub_1", Status: "active", CustomerEmail: "ada@example.com"})
+	drv := &fakeSubscriptionDriver{}
+	auditor := &fakeAuditor{}
+	svc := NewCheckoutService(&fakeDriver{}, WithSubscriptions(subs), WithSubscriptionDriver(drv), WithAuditor(auditor))
+	ctx := context.Background()
+
+	if _, err := svc.CancelSubscription(ctx, "grace@example.com", "sub_1"); !errors.Is(err, payments.ErrNotFound) || len(drv.canceled) != 0 {
+		t.Fatalf("expected someone else's subscription to be left alone, got %v", err)
+	}
+
+	sub, err := svc.CancelSubscription(ctx, "ada@example.com", "sub_1")
+	if err != nil || !sub.CancelAtPeriodEnd || sub.CustomerEmail != "ada@example.com" {
+		t.Fatalf("unexpected result: %#v, %v", sub, err)
+	}
+	mirrored, _ := svc.CustomerSubscriptions(ctx, "ada@example.com")
+	if len(mirrored) != 1 || !mirrored[0].CancelAtPeriodEnd {
+		t.Fatalf("expected the mirror to be updated, got %#v", mirrored)
+	}
+	if len(auditor.records) != 1 || auditor.records[0].Action != payments.AuditSubscriptionCancel {
+		t.Fatalf("expected the cancellation to be audited, got %#v", auditor.records)
+	}
+
+	if _, err := svc.CancelSubscription(ctx, "ada@example.com", "sub_1"); err != nil || len(drv.canceled) != 1 {
+		t.Fatalf("expected a repeated cancel to be a no-op, got %d calls, %v", len(drv.canceled), err)
+	}
+}
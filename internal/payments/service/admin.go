@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// SubscriptionStore keeps a local copy of provider subscriptions.
+type SubscriptionStore interface {
+	SaveSubscription(ctx context.Context, sub payments.Subscription) error
+	Subscriptions(ctx context.Context) ([]payments.Subscription, error)
+}
+
+// WithSubscriptions mirrors subscription updates from the provider into store.
+func WithSubscriptions(store SubscriptionStore) Option {
+	return func(s *CheckoutService) {
+		s.subscriptions = store
+	}
+}
+
+// Orders lists recorded orders matching filter, newest first.
+func (s *CheckoutService) Orders(ctx context.Context, filter payments.OrderFilter) ([]payments.Order, error) {
+	if s.orders == nil {
+		return nil, nil
+	}
+	all, err := s.orders.Orders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load orders: %w", err)
+	}
+	var matched []payments.Order
+	for _, order := range all {
+		if filter.Matches(order) {
+			matched = append(matched, order)
+		}
+	}
+	return matched, nil
+}
+
+// Order returns a single recorded order.
+func (s *CheckoutService) Order(ctx context.Context, id string) (payments.Order, error) {
+	if s.orders == nil {
+		return payments.Order{}, payments.ErrNotFound
+	}
+	return s.orders.Order(ctx, id)
+}
+
+// RefundOrder refunds amountCents of a paid order, or whatever remains
+// unrefunded when amountCents is zero.
+func (s *CheckoutService) RefundOrder(ctx context.Context, id string, amountCents int64) (payments.Order, error) {
+	s.refunding.Lock()
+	defer s.refunding.Unlock()
+
+	order, err := s.Order(ctx, id)
+	if err != nil {
+		return payments.Order{}, err
+	}
+	if order.Status != payments.OrderStatusPaid || order.PaymentIntentID == "" {
+		return payments.Order{}, fmt.Errorf("%w: order %s is %s", payments.ErrNotRefundable, id, order.Status)
+	}
+
+	remaining := order.TotalCents - order.RefundedCents
+	if amountCents == 0 {
+		amountCents = remaining
+	}
+	if amountCents < 0 || amountCents > remaining {
+		return payments.Order{}, fmt.Errorf("%w: %s exceeds the %s left on order %s",
+			payments.ErrNotRefundable, payments.FormatMoney(amountCents, order.Currency), payments.FormatMoney(remaining, order.Currency), id)
+	}
+
+	if err := s.driverFor(order).RefundPayment(ctx, order.PaymentIntentID, amountCents); err != nil {
+		return payments.Order{}, fmt.Errorf("refund order %s: %w", id, err)
+	}
+	before := stateOf(order)
+
+	// The provider's refund webhook reports the same cumulative amount, so
+	// recording it now keeps that delivery from being applied twice.
+	order.RefundedCents += amountCents
+	if order.RefundedCents >= order.TotalCents {
+		order.Status = payments.OrderStatusRefunded
+	}
+	s.record(&order, "refunded", payments.FormatMoney(amountCents, order.Currency))
+	if err := s.orders.SaveOrder(ctx, order); err != nil {
+		return payments.Order{}, err
+	}
+	s.audit(ctx, payments.AuditOrderRefund, order, amountCents, before)
+
+	s.notify(ctx, "refund for order "+order.ID, func(n Notifier) error {
+		return n.RefundIssued(ctx, order, amountCents)
+	})
+	return order, nil
+}
+
+// CaptureOrder collects an authorized payment and marks the order paid.
+func (s *CheckoutService) CaptureOrder(ctx context.Context, id string) (payments.Order, error) {
+	order, err := s.Order(ctx, id)
+	if err != nil {
+		return payments.Order{}, err
+	}
+	if order.Status != payments.OrderStatusAuthorized || order.PaymentIntentID == "" {
+		return payments.Order{}, fmt.Errorf("%w: order %s is %s", payments.ErrNotCapturable, id, order.Status)
+	}
+
+	if err := s.driverFor(order).CapturePayment(ctx, order.PaymentIntentID); err != nil {
+		return payments.Order{}, fmt.Errorf("capture order %s: %w", id, err)
+	}
+	before := stateOf(order)
+
+	order.Status = payments.OrderStatusPaid
+	order.PaidAt = s.now().UTC()
+	s.record(&order, "captured", payments.FormatMoney(order.TotalCents, order.Currency))
+	if err := s.orders.SaveOrder(ctx, order); err != nil {
+		return payments.Order{}, err
+	}
+	s.audit(ctx, payments.AuditOrderCapture, order, order.TotalCents, before)
+
+	s.notify(ctx, "receipt for order "+order.ID, func(n Notifier) error {
+		return n.OrderPaid(ctx, order)
+	})
+	return order, nil
+}
+
+// Subscriptions lists the locally mirrored subscriptions.
+func (s *CheckoutService) Subscriptions(ctx context.Context) ([]payments.Subscription, error) {
+	if s.subscriptions == nil {
+		return nil, nil
+	}
+	return s.subscriptions.Subscriptions(ctx)
+}
+
+func (s *CheckoutService) saveSubscription(ctx context.Context, event payments.Event) error {
+	_, err := s.mirrorSubscription(ctx, event)
+	return err
+}
+
+// mirrorSubscription stores the subscription carried by event and returns
+// the stored copy. A subscription leaving its trial is recorded and
+// announced.
+func (s *CheckoutService) mirrorSubscription(ctx context.Context, event payments.Event) (payments.Subscription, error) {
+	if s.subscriptions == nil || event.Subscription == nil {
+		return payments.Subscription{}, nil
+	}
+	sub := *event.Subscription
+	previous := event.PreviousStatus
+	// The provider knows nothing of payit's dunning or timeline, so those
+	// carry over from the local copy.
+	stored, found, err := s.findSubscription(ctx, sub.ID)
+	if err != nil {
+		return payments.Subscription{}, err
+	}
+	if found {
+		if sub.CustomerEmail == "" {
+			sub.CustomerEmail = stored.CustomerEmail
+		}
+		if sub.Dunning == nil {
+			sub.Dunning = stored.Dunning
+		}
+		sub.Timeline = slices.Concat(stored.Timeline, sub.Timeline)
+		if previous == "" {
+			previous = stored.Status
+		}
+	}
+
+	ended, converted := trialOutcome(previous, sub)
+	if ended && converted {
+		s.recordSubscription(&sub, "trial converted", sub.Status)
+	} else if ended {
+		s.recordSubscription(&sub, "trial expired", sub.Status)
+	}
+	if err := s.storeSubscription(ctx, sub); err != nil {
+		return payments.Subscription{}, err
+	}
+	if ended {
+		s.notify(ctx, "end of trial for "+sub.ID, func(n Notifier) error {
+			if tn, ok := n.(TrialNotifier); ok {
+				return tn.TrialEnded(ctx, sub, converted)
+			}
+			return nil
+		})
+	}
+	return sub, nil
+}
+
+// findSubscription looks up the local copy of subscription id.
+func (s *CheckoutService) findSubscription(ctx context.Context, id string) (payments.Subscription, bool, error) {
+	subs, err := s.subscriptions.Subscriptions(ctx)
+	if err != nil {
+		return payments.Subscription{}, false, fmt.Errorf("load subscriptions: %w", err)
+	}
+	i := slices.IndexFunc(subs, func(sub payments.Subscription) bool { return sub.ID == id })
+	if i < 0 {
+		return payments.Subscription{}, false, nil
+	}
+	return subs[i], true, nil
+}
+
+func (s *CheckoutService) storeSubscription(ctx context.Context, sub payments.Subscription) error {
+	sub.UpdatedAt = s.now().UTC()
+	if err := s.subscriptions.SaveSubscription(ctx, sub); err != nil {
+		return fmt.Errorf("save subscription %s: %w", sub.ID, err)
+	}
+	return nil
+}
+
+// orderState is the slice of an order recorded before and after audited actions.
+type orderState struct {
+	Status        payments.OrderStatus `json:"status"`
+	TotalCents    int64                `json:"total_cents"`
+	RefundedCents int64                `json:"refunded_cents"`
+}
+
+func stateOf(order payments.Order) orderState {
+	return orderState{Status: order.Status, TotalCents: order.TotalCents, RefundedCents: order.RefundedCents}
+}
+
+// audit reports an action on order to the configured auditor.
+func (s *CheckoutService) audit(ctx context.Context, action payments.AuditAction, order payments.Order, amountCents int64, before orderState) {
+	if s.auditor == nil {
+		return
+	}
+	s.auditor.Report(ctx, payments.AuditRecord{
+		Action:      action,
+		Target:      order.ID,
+		AmountCents: amountCents,
+		Currency:    order.Currency,
+		Before:      before,
+		After:       stateOf(order),
+	})
+}
+
+// record appends a timeline entry stamped with the service clock.
+func (s *CheckoutService) record(order *payments.Order, action, detail string) {
+	order.Timeline = append(order.Timeline, payments.TimelineEntry{At: s.now().UTC(), Action: action, Detail: detail})
+}
+
+// recordSubscription appends a timeline entry to sub stamped with the service clock.
+func (s *CheckoutService) recordSubscription(sub *payments.Subscription, action, detail string) {
+	sub.Timeline = append(sub.Timeline, payments.TimelineEntry{At: s.now().UTC(), Action: action, Detail: detail})
+}
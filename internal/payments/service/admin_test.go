@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+func TestOrders_AppliesFilter(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	orders := &fakeOrders{saved: []payments.Order{
+		{ID: "cs_1", Status: payments.OrderStatusPaid, CustomerEmail: "Ana@Example.com", CreatedAt: day},
+		{ID: "cs_2", Status: payments.OrderStatusOpen, CustomerEmail: "ana@example.com", CreatedAt: day},
+		{ID: "cs_3", Status: payments.OrderStatusPaid, CustomerEmail: "bob@example.com", CreatedAt: day},
+		{ID: "cs_4", Status: payments.OrderStatusPaid, CustomerEmail: "ana@example.com", CreatedAt: day.AddDate(0, 0, 2)},
+	}}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders))
+
+	got, err := svc.Orders(context.Background(), payments.OrderFilter{
+		Status: payments.OrderStatusPaid,
+		Email:  "ana@",
+		From:   day.Truncate(24 * time.Hour),
+		To:     day.Truncate(24*time.Hour).AddDate(0, 0, 1),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "cs_1" {
+		t.Fatalf("expected only cs_1, got %#v", got)
+	}
+}
+
+func TestRefundOrder(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusPaid, PaymentIntentID: "pi_1", TotalCents: 5000, Currency: "eur"}}}
+	drv := &fakeDriver{}
+	notifier := &fakeNotifier{}
+	svc := NewCheckoutService(drv, WithOrders(orders), WithNotifier(notifier))
+
+	order, err := svc.RefundOrder(context.Background(), "cs_1", 2000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order.RefundedCents != 2000 || order.Status != payments.OrderStatusPaid {
+		t.Fatalf("expected partial refund, got %#v", order)
+	}
+	if len(order.Timeline) != 1 || order.Timeline[0].Action != "refunded" || order.Timeline[0].Detail != "20.00 EUR" {
+		t.Fatalf("expected refund on the timeline, got %#v", order.Timeline)
+	}
+
+	if _, err := svc.RefundOrder(context.Background(), "cs_1", 3001); !errors.Is(err, payments.ErrNotRefundable) {
+		t.Fatalf("expected over-refund to be rejected, got %v", err)
+	}
+
+	// A zero amount refunds whatever is left.
+	order, err = svc.RefundOrder(context.Background(), "cs_1", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order.Status != payments.OrderStatusRefunded || order.RefundedCents != 5000 {
+		t.Fatalf("expected fully refunded order, got %#v", order)
+	}
+	if len(drv.refunds) != 2 || drv.refunds[1] != "pi_1:3000" {
+		t.Fatalf("unexpected provider refunds: %v", drv.refunds)
+	}
+
+	// The webhook for the same refund must not be counted or notified again.
+	if err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventRefundIssued, PaymentIntentID: "pi_1", AmountCents: 5000}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(notifier.refunds) != 2 {
+		t.Fatalf("expected two refund notifications, got %v", notifier.refunds)
+	}
+}
+
+func TestRefundOrder_SerializesConcurrentRefunds(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusPaid, PaymentIntentID: "pi_1", TotalCents: 2000, Currency: "eur"}}}
+	drv := &fakeDriver{}
+	svc := NewCheckoutService(drv, WithOrders(orders))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Go(func() {
+			_, errs[i] = svc.RefundOrder(context.Background(), "cs_1", 1500)
+		})
+	}
+	wg.Wait()
+
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Fatalf("expected exactly one refund to pass the cap, got %v", errs)
+	}
+	if order, _ := orders.Order(context.Background(), "cs_1"); order.RefundedCents != 1500 || len(drv.refunds) != 1 {
+		t.Fatalf("expected one refund recorded, got %d cents and %v", order.RefundedCents, drv.refunds)
+	}
+}
+
+func TestRefundOrder_RequiresPaidOrder(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen, TotalCents: 5000}}}
+	drv := &fakeDriver{}
+	svc := NewCheckoutService(drv, WithOrders(orders))
+
+	if _, err := svc.RefundOrder(context.Background(), "cs_1", 0); !errors.Is(err, payments.ErrNotRefundable) {
+		t.Fatalf("expected ErrNotRefundable, got %v", err)
+	}
+	if len(drv.refunds) != 0 {
+		t.Fatalf("expected no provider call, got %v", drv.refunds)
+	}
+}
+
+func TestManualCapture(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen, ReservationID: "res_1", TotalCents: 2000}}}
+	drv := &fakeDriver{}
+	inv := &fakeInventory{}
+	notifier := &fakeNotifier{}
+	svc := NewCheckoutService(drv, WithOrders(orders), WithInventory(inv), WithNotifier(notifier), WithManualCapture(true))
+
+	err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventCheckoutCompleted, SessionID: "cs_1", PaymentIntentID: "pi_1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	order, _ := orders.Order(context.Background(), "cs_1")
+	if order.Status != payments.OrderStatusAuthorized {
+		t.Fatalf("expected authorized order, got %s", order.Status)
+	}
+	if len(inv.committed) != 1 || len(notifier.paid) != 0 {
+		t.Fatalf("expected stock held and no receipt yet, got %v %v", inv.committed, notifier.paid)
+	}
+
+	order, err = svc.CaptureOrder(context.Background(), "cs_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order.Status != payments.OrderStatusPaid || order.PaidAt.IsZero() {
+		t.Fatalf("expected paid order, got %#v", order)
+	}
+	if len(drv.captured) != 1 || drv.captured[0] != "pi_1" || len(notifier.paid) != 1 {
+		t.Fatalf("expected capture and receipt, got %v %v", drv.captured, notifier.paid)
+	}
+
+	if _, err := svc.CaptureOrder(context.Background(), "cs_1"); !errors.Is(err, payments.ErrNotCapturable) {
+		t.Fatalf("expected second capture to be rejected, got %v", err)
+	}
+}
+
+type fakeSubscriptions struct {
+	saved []payments.Subscription
+}
+
+func (f *fakeSubscriptions) SaveSubscription(ctx context.Context, sub payments.Subscription) error {
+	for i := range f.saved {
+		if f.saved[i].ID == sub.ID {
+			f.saved[i] = sub
+			return nil
+		}
+	}
+	f.saved = append(f.saved, sub)
+	return nil
+}
+
+func (f *fakeSubscriptions) Subscriptions(ctx context.Context) ([]payments.Subscription, error) {
+	return f.saved, nil
+}
+
+func TestHandleEvent_MirrorsSubscriptions(t *testing.T) {
+	subs := &fakeSubscriptions{}
+	svc := NewCheckoutService(&fakeDriver{}, WithSubscriptions(subs))
+
+	err := svc.HandleEvent(context.Background(), payments.Event{
+		Type:         payments.EventSubscriptionUpdated,
+		Subscription: &payments.Subscription{ID: "sub_1", Status: "active"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ := svc.Subscriptions(context.Background())
+	if len(got) != 1 || got[0].ID != "sub_1" || got[0].UpdatedAt.IsZero() {
+		t.Fatalf("unexpected subscriptions: %#v", got)
+	}
+}
+
+type fakeAuditor struct {
+	records []payments.AuditRecord
+}
+
+func (f *fakeAuditor) Report(ctx context.Context, rec payments.AuditRecord) {
+	f.records = append(f.records, rec)
+}
+
+func TestMoneyMovingActionsAreAudited(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{
+		{ID: "cs_paid", Status: payments.OrderStatusPaid, PaymentIntentID: "pi_1", TotalCents: 5000, Currency: "eur"},
+		{ID: "cs_open", Status: payments.OrderStatusOpen, TotalCents: 1000, Currency: "eur"},
+	}}
+	auditor := &fakeAuditor{}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithAuditor(auditor))
+
+	if _, err := svc.RefundOrder(context.Background(), "cs_paid", 1500); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := svc.CancelSession(context.Background(), "cs_open"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A refund made in the provider dashboard arrives as a webhook.
+	if err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventRefundIssued, PaymentIntentID: "pi_1", AmountCents: 2000}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(auditor.records) != 3 {
+		t.Fatalf("expected three audit records, got %#v", auditor.records)
+	}
+	refund := auditor.records[0]
+	before, after := refund.Before.(orderState), refund.After.(orderState)
+	if refund.Action != payments.AuditOrderRefund || refund.Target != "cs_paid" || refund.AmountCents != 1500 || before.RefundedCents != 0 || after.RefundedCents != 1500 {
+		t.Fatalf("unexpected refund record: %#v", refund)
+	}
+	if cancel := auditor.records[1]; cancel.Action != payments.AuditCheckoutCancel || cancel.After.(orderState).Status != payments.OrderStatusCanceled {
+		t.Fatalf("unexpected cancel record: %#v", cancel)
+	}
+	if webhook := auditor.records[2]; webhook.Action != payments.AuditOrderRefund || webhook.AmountCents != 500 {
+		t.Fatalf("unexpected webhook refund record: %#v", webhook)
+	}
+}
+
+type fakeRouter struct {
+	fakeDriver
+	providers map[string]CheckoutDriver
+}
+
+func (f *fakeRouter) Provider(name string) (CheckoutDriver, bool) {
+	d, ok := f.providers[name]
+	return d, ok
+}
+
+func TestRefundOrder_UsesOrderProvider(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusPaid, PaymentIntentID: "pi_1", TotalCents: 5000, Currency: "eur", Provider: "backup"}}}
+	backup := &fakeDriver{}
+	drv := &fakeRouter{providers: map[string]CheckoutDriver{"backup": backup}}
+	svc := NewCheckoutService(drv, WithOrders(orders))
+
+	if _, err := svc.RefundOrder(context.Background(), "cs_1", 1000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(backup.refunds) != 1 || len(drv.refunds) != 0 {
+		t.Fatalf("expected the refund at the order's provider, got %v and %v", backup.refunds, drv.refunds)
+	}
+}
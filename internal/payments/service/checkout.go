@@ -2,30 +2,392 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/rjNemo/payit/config"
 	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/validate"
 )
 
 // CheckoutDriver represents a payment provider capable of creating checkout sessions.
 type CheckoutDriver interface {
 	CreateSession(ctx context.Context, req payments.CheckoutSessionRequest) (payments.CheckoutSessionResult, error)
+	ExpireSession(ctx context.Context, id string) error
+	// RefundPayment returns amountCents of a captured payment to the customer.
+	RefundPayment(ctx context.Context, paymentIntentID string, amountCents int64) error
+	// CapturePayment collects a payment that was only authorized at checkout.
+	CapturePayment(ctx context.Context, paymentIntentID string) error
+}
+
+// ProviderDriver is implemented by drivers that spread checkouts across
+// several payment providers, so that calls for an existing order go back to
+// the provider recorded on it.
+type ProviderDriver interface {
+	Provider(name string) (CheckoutDriver, bool)
+}
+
+// CouponRedeemer validates promotion codes and turns them into discounts.
+// Like stock, a redemption is held for an open checkout until it is paid or
+// abandoned.
+type CouponRedeemer interface {
+	Redeem(ctx context.Context, code string, quantity int64) (discount payments.Discount, redemptionID string, err error)
+	// Commit counts a held redemption as used; code is counted directly if
+	// the hold has lapsed.
+	Commit(ctx context.Context, redemptionID, code string) error
+	Release(ctx context.Context, redemptionID string) error
+}
+
+// TaxCalculator determines the tax owed on a checkout.
+type TaxCalculator interface {
+	Calculate(ctx context.Context, in payments.TaxInput) (payments.TaxBreakdown, error)
+}
+
+// ShippingQuoter offers shipping options for physical orders.
+type ShippingQuoter interface {
+	Quote(ctx context.Context, quantity, subtotalCents int64) (*payments.Shipping, error)
+}
+
+// Inventory holds stock for open checkouts until they are paid or abandoned.
+type Inventory interface {
+	Reserve(ctx context.Context, sku string, quantity int64) (string, error)
+	// Commit turns a reservation into a sale; quantity units of sku are
+	// taken directly if the reservation has lapsed.
+	Commit(ctx context.Context, reservationID, sku string, quantity int64) error
+	Release(ctx context.Context, reservationID string) error
+}
+
+// Notifier tells customers and staff about payment milestones.
+type Notifier interface {
+	OrderPaid(ctx context.Context, order payments.Order) error
+	RefundIssued(ctx context.Context, order payments.Order, amountCents int64) error
+	RenewalFailed(ctx context.Context, event payments.Event) error
+}
+
+// Auditor records money-moving actions in a tamper-evident log.
+type Auditor interface {
+	Report(ctx context.Context, rec payments.AuditRecord)
+}
+
+// OrderStore persists orders created at checkout.
+type OrderStore interface {
+	SaveOrder(ctx context.Context, order payments.Order) error
+	Order(ctx context.Context, id string) (payments.Order, error)
+	Orders(ctx context.Context) ([]payments.Order, error)
 }
 
 // CheckoutService contains provider-agnostic business rules for initiating checkout flows.
 type CheckoutService struct {
-	driver CheckoutDriver
+	driver    CheckoutDriver
+	product   config.ProductConfig
+	limits    config.LimitsConfig
+	coupons   CouponRedeemer
+	tax       TaxCalculator
+	shipping  ShippingQuoter
+	inventory Inventory
+	orders    OrderStore
+	recovery  RecoveryQueue
+	notifiers []Notifier
+	publicURL string
+	// manualCapture means completed checkouts hold funds until staff capture them.
+	manualCapture bool
+	subscriptions SubscriptionStore
+	// subscriptionDriver changes subscriptions with the provider; nil leaves
+	// them read-only.
+	subscriptionDriver SubscriptionDriver
+	customers          CustomerStore
+	auditor            Auditor
+	// intents backs custom payment forms; nil disables them. Their orders
+	// expire after intentTTL.
+	intents   PaymentIntentDriver
+	intentTTL time.Duration
+	// offSession charges saved cards for one-click repurchases; nil sends
+	// every repurchase through checkout.
+	offSession OffSessionDriver
+	// dunning schedules reminders for failed renewals on jobs; nil jobs
+	// leaves chasing them to the provider.
+	dunning config.DunningConfig
+	jobs    JobScheduler
+	// plans are the catalog prices buyers can subscribe to at checkout.
+	plans []config.MeteredPriceConfig
+	now   func() time.Time
+	// completing serializes order completion so a webhook and a buyer
+	// returning from the provider cannot both mark an order paid.
+	completing sync.Mutex
+	// refunding serializes refunds so two partial refunds of an order cannot
+	// both pass the check against what is left, and neither is lost.
+	refunding sync.Mutex
+	// recovering serializes recoveries so one expired order never gets two
+	// checkouts.
+	recovering sync.Mutex
+}
+
+// Option customises a CheckoutService.
+type Option func(*CheckoutService)
+
+// WithProduct sets the product whose price is used to total orders.
+func WithProduct(product config.ProductConfig) Option {
+	return func(s *CheckoutService) {
+		s.product = product
+	}
+}
+
+// WithLimits rejects checkouts whose total or currency breaks limits.
+func WithLimits(limits config.LimitsConfig) Option {
+	return func(s *CheckoutService) {
+		s.limits = limits
+	}
+}
+
+// WithCoupons enables promotion codes validated by the given redeemer.
+func WithCoupons(coupons CouponRedeemer) Option {
+	return func(s *CheckoutService) {
+		s.coupons = coupons
+	}
+}
+
+// WithTax charges tax computed by the given calculator.
+func WithTax(tax TaxCalculator) Option {
+	return func(s *CheckoutService) {
+		s.tax = tax
+	}
+}
+
+// WithShipping collects a shipping address and offers rates for physical products.
+func WithShipping(shipping ShippingQuoter) Option {
+	return func(s *CheckoutService) {
+		s.shipping = shipping
+	}
+}
+
+// WithInventory reserves stock for every session and rejects checkouts that
+// would oversell.
+func WithInventory(inventory Inventory) Option {
+	return func(s *CheckoutService) {
+		s.inventory = inventory
+	}
+}
+
+// WithNotifier sends receipts and alerts through the given notifier. It can be
+// given more than once; every notifier hears about every milestone.
+func WithNotifier(notifier Notifier) Option {
+	return func(s *CheckoutService) {
+		s.notifiers = append(s.notifiers, notifier)
+	}
+}
+
+// WithOrders records an order for every session created.
+func WithOrders(orders OrderStore) Option {
+	return func(s *CheckoutService) {
+		s.orders = orders
+	}
+}
+
+// WithManualCapture treats completed checkouts as authorizations that staff
+// capture later, matching a driver configured to hold funds.
+func WithManualCapture(manual bool) Option {
+	return func(s *CheckoutService) {
+		s.manualCapture = manual
+	}
+}
+
+// WithAuditor records refunds, captures and cancellations with auditor.
+func WithAuditor(auditor Auditor) Option {
+	return func(s *CheckoutService) {
+		s.auditor = auditor
+	}
 }
 
 // NewCheckoutService wires the given driver into a reusable checkout service.
-func NewCheckoutService(driver CheckoutDriver) *CheckoutService {
-	return &CheckoutService{driver: driver}
+func NewCheckoutService(driver CheckoutDriver, opts ...Option) *CheckoutService {
+	s := &CheckoutService{driver: driver, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // CreateSession applies domain defaults before delegating to the configured driver.
 func (s *CheckoutService) CreateSession(ctx context.Context, req payments.CheckoutSessionRequest) (payments.CheckoutSessionResult, error) {
-	if req.Quantity <= 0 {
+	return s.createSession(ctx, req, "")
+}
+
+func (s *CheckoutService) createSession(ctx context.Context, req payments.CheckoutSessionRequest, recoveredFrom string) (_ payments.CheckoutSessionResult, err error) {
+	req, order, err := s.newOrder(ctx, req, recoveredFrom)
+	if err != nil {
+		return payments.CheckoutSessionResult{}, err
+	}
+	defer func() {
+		if err != nil {
+			s.releaseHolds(ctx, order)
+		}
+	}()
+
+	result, err := s.driver.CreateSession(ctx, req)
+	if err != nil {
+		return payments.CheckoutSessionResult{}, err
+	}
+	defer func() {
+		if err != nil {
+			// The buyer must not pay for an order payit kept no record of.
+			_ = s.driverFor(payments.Order{Provider: result.Provider}).ExpireSession(context.WithoutCancel(ctx), result.ID)
+		}
+	}()
+	if err := s.keepCustomer(ctx, req.Customer); err != nil {
+		return payments.CheckoutSessionResult{}, err
+	}
+
+	if s.orders != nil {
+		order.ID = result.ID
+		order.Provider = result.Provider
+		order.ExpiresAt = result.ExpiresAt
+		order.CheckoutURL = result.URL
+		order.CancelToken = rand.Text()
+		if err := s.orders.SaveOrder(ctx, order); err != nil {
+			return payments.CheckoutSessionResult{}, err
+		}
+		result.CancelToken = order.CancelToken
+	}
+
+	return result, nil
+}
+
+// newOrder reserves stock and prices req as an open order, resolving the
+// discount, tax, shipping and, once priced, the customer the driver needs. The stock and
+// promotion code held for it are released if pricing fails; afterwards that
+// is up to the caller.
+func (s *CheckoutService) newOrder(ctx context.Context, req payments.CheckoutSessionRequest, recoveredFrom string) (_ payments.CheckoutSessionRequest, order payments.Order, err error) {
+	if err := validate.CheckoutSession(req, s.product); err != nil {
+		return req, payments.Order{}, err
+	}
+	req.Subscription = nil
+	if req.Plan != "" {
+		return s.newPlanOrder(ctx, req, recoveredFrom)
+	}
+	if req.Quantity == 0 {
 		req.Quantity = 1
 	}
 
-	return s.driver.CreateSession(ctx, req)
+	var reservationID string
+	if s.inventory != nil {
+		reservationID, err = s.inventory.Reserve(ctx, s.product.SKU, req.Quantity)
+		if err != nil {
+			return req, payments.Order{}, err
+		}
+		defer func() {
+			if err != nil {
+				_ = s.inventory.Release(context.WithoutCancel(ctx), reservationID)
+			}
+		}()
+	}
+
+	var redemptionID string
+	req.Discount = nil
+	req.Tax = nil
+	req.Shipping = nil
+	req.PromoCode = strings.TrimSpace(req.PromoCode)
+	if req.PromoCode != "" {
+		if s.coupons == nil {
+			return req, payments.Order{}, payments.ErrInvalidPromoCode
+		}
+		discount, id, err := s.coupons.Redeem(ctx, req.PromoCode, req.Quantity)
+		if err != nil {
+			return req, payments.Order{}, err
+		}
+		redemptionID = id
+		defer func() {
+			if err != nil {
+				_ = s.coupons.Release(context.WithoutCancel(ctx), redemptionID)
+			}
+		}()
+		req.Discount = &discount
+	}
+
+	order = payments.Order{
+		Status:        payments.OrderStatusOpen,
+		SKU:           s.product.SKU,
+		ReservationID: reservationID,
+		RedemptionID:  redemptionID,
+		Quantity:      req.Quantity,
+		Currency:      s.product.Currency,
+		SubtotalCents: s.product.PriceCents * req.Quantity,
+		PromoCode:     req.PromoCode,
+		CustomerEmail: req.CustomerEmail,
+		Metadata:      req.Metadata,
+		RecoveredFrom: recoveredFrom,
+		CreatedAt:     s.now().UTC(),
+	}
+	s.record(&order, "created", "")
+	if req.Discount != nil {
+		order.DiscountCents = min(req.Discount.UnitAmountOffCents*req.Quantity, order.SubtotalCents)
+	}
+	order.TotalCents = order.SubtotalCents - order.DiscountCents
+
+	if s.tax != nil {
+		breakdown, err := s.tax.Calculate(ctx, payments.TaxInput{
+			Country:     req.Country,
+			Region:      req.Region,
+			TaxID:       req.TaxID,
+			AmountCents: order.TotalCents,
+			Currency:    order.Currency,
+		})
+		if err != nil {
+			return req, payments.Order{}, err
+		}
+		req.Tax = &breakdown
+		order.Tax = &breakdown
+		order.TotalCents = breakdown.GrossCents
+	}
+
+	if s.shipping != nil {
+		quote, err := s.shipping.Quote(ctx, req.Quantity, order.SubtotalCents-order.DiscountCents)
+		if err != nil {
+			return req, payments.Order{}, err
+		}
+		req.Shipping = quote
+		order.Physical = quote != nil
+	}
+
+	if err := validate.Order(order, s.limits); err != nil {
+		return req, payments.Order{}, err
+	}
+	if req.Customer, err = s.checkoutCustomer(ctx, req); err != nil {
+		return req, payments.Order{}, err
+	}
+	order.CustomerID = customerID(req.Customer)
+
+	req.Currency = order.Currency
+	req.AmountCents = order.TotalCents
+	return req, order, nil
+}
+
+func customerID(customer *payments.Customer) string {
+	if customer == nil {
+		return ""
+	}
+	return customer.ID
+}
+
+// releaseHolds gives back the stock and promotion code held for an order
+// whose payment could not be started.
+func (s *CheckoutService) releaseHolds(ctx context.Context, order payments.Order) {
+	if s.inventory != nil && order.ReservationID != "" {
+		_ = s.inventory.Release(context.WithoutCancel(ctx), order.ReservationID)
+	}
+	if s.coupons != nil && order.RedemptionID != "" {
+		_ = s.coupons.Release(context.WithoutCancel(ctx), order.RedemptionID)
+	}
+}
+
+// driverFor returns the driver for the provider that served order, falling
+// back to the configured driver for orders that predate routing.
+func (s *CheckoutService) driverFor(order payments.Order) CheckoutDriver {
+	if router, ok := s.driver.(ProviderDriver); ok && order.Provider != "" {
+		if d, ok := router.Provider(order.Provider); ok {
+			return d
+		}
+	}
+	return s.driver
 }
@@ -3,15 +3,22 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/rjNemo/payit/config"
 	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
 )
 
 type fakeDriver struct {
 	lastReq payments.CheckoutSessionRequest
 	result  payments.CheckoutSessionResult
 	err     error
+	expired []string
+	// refunds records "paymentIntentID:amount" per refund.
+	refunds  []string
+	captured []string
 }
 
 func (f *fakeDriver) CreateSession(ctx context.Context, req payments.CheckoutSessionRequest) (payments.CheckoutSessionResult, error) {
@@ -22,6 +29,21 @@ func (f *fakeDriver) CreateSession(ctx context.Context, req payments.CheckoutSes
 	return f.result, nil
 }
 
+func (f *fakeDriver) ExpireSession(ctx context.Context, id string) error {
+	f.expired = append(f.expired, id)
+	return f.err
+}
+
+func (f *fakeDriver) RefundPayment(ctx context.Context, paymentIntentID string, amountCents int64) error {
+	f.refunds = append(f.refunds, fmt.Sprintf("%s:%d", paymentIntentID, amountCents))
+	return f.err
+}
+
+func (f *fakeDriver) CapturePayment(ctx context.Context, paymentIntentID string) error {
+	f.captured = append(f.captured, paymentIntentID)
+	return f.err
+}
+
 func TestCheckoutService_DefaultQuantity(t *testing.T) {
 	drv := &fakeDriver{}
 	svc := NewCheckoutService(drv)
@@ -40,7 +62,7 @@ func TestCheckoutService_PreservesQuantity(t *testing.T) {
 	drv := &fakeDriver{}
 	svc := NewCheckoutService(drv)
 
-	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{Quantity: 5})
+	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 5}})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -50,12 +72,350 @@ func TestCheckoutService_PreservesQuantity(t *testing.T) {
 	}
 }
 
+func TestCheckoutService_RecordsProvider(t *testing.T) {
+	drv := &fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1", Provider: "stripe"}}
+	orders := &fakeOrders{}
+	svc := NewCheckoutService(drv, WithOrders(orders), WithProduct(config.ProductConfig{SKU: "demo", PriceCents: 2500, Currency: "eur"}))
+
+	if _, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 2}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if drv.lastReq.Currency != "eur" || drv.lastReq.AmountCents != 5000 {
+		t.Fatalf("expected routing inputs on the request, got %#v", drv.lastReq)
+	}
+	if len(orders.saved) != 1 || orders.saved[0].Provider != "stripe" {
+		t.Fatalf("expected provider on the order, got %#v", orders.saved)
+	}
+}
+
 func TestCheckoutService_PropagatesError(t *testing.T) {
 	drv := &fakeDriver{err: errors.New("driver failed")}
 	svc := NewCheckoutService(drv)
 
-	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{Quantity: 2})
+	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 2}})
 	if err == nil {
 		t.Fatal("expected error from driver")
 	}
 }
+
+type fakeCoupons struct {
+	discount  payments.Discount
+	err       error
+	code      string
+	committed []string
+	released  []string
+}
+
+func (f *fakeCoupons) Redeem(ctx context.Context, code string, quantity int64) (payments.Discount, string, error) {
+	f.code = code
+	if f.err != nil {
+		return payments.Discount{}, "", f.err
+	}
+	return f.discount, "red_" + code, nil
+}
+
+func (f *fakeCoupons) Commit(ctx context.Context, id, code string) error {
+	f.committed = append(f.committed, id)
+	return nil
+}
+
+func (f *fakeCoupons) Release(ctx context.Context, id string) error {
+	f.released = append(f.released, id)
+	return nil
+}
+
+func TestCheckoutService_AppliesPromoCode(t *testing.T) {
+	drv := &fakeDriver{}
+	coupons := &fakeCoupons{discount: payments.Discount{Code: "LAUNCH", UnitAmountOffCents: 100}}
+	svc := NewCheckoutService(drv, WithCoupons(coupons))
+
+	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{PromoCode: " launch "}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if coupons.code != "launch" {
+		t.Fatalf("expected trimmed code, got %q", coupons.code)
+	}
+	if drv.lastReq.Discount == nil || drv.lastReq.Discount.UnitAmountOffCents != 100 {
+		t.Fatalf("expected discount to reach driver, got %#v", drv.lastReq.Discount)
+	}
+}
+
+func TestCheckoutService_HoldsPromoCodeUntilPaid(t *testing.T) {
+	drv := &fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1"}}
+	coupons := &fakeCoupons{discount: payments.Discount{Code: "LAUNCH", UnitAmountOffCents: 100}}
+	orders := &fakeOrders{}
+	svc := NewCheckoutService(drv, WithProduct(config.ProductConfig{PriceCents: 1000, Currency: "eur"}), WithCoupons(coupons), WithOrders(orders))
+	ctx := context.Background()
+
+	if _, err := svc.CreateSession(ctx, payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{PromoCode: "LAUNCH"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if orders.saved[0].RedemptionID != "red_LAUNCH" || len(coupons.committed) != 0 {
+		t.Fatalf("expected the redemption held on the open order, got %#v and %v", orders.saved[0], coupons.committed)
+	}
+	if err := svc.HandleEvent(ctx, payments.Event{Type: payments.EventCheckoutCompleted, SessionID: "cs_1", Paid: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(coupons.committed) != 1 || len(coupons.released) != 0 {
+		t.Fatalf("expected the redemption counted once paid, got %v and %v", coupons.committed, coupons.released)
+	}
+
+	drv.result.ID = "cs_2"
+	if _, err := svc.CreateSession(ctx, payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{PromoCode: "LAUNCH"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := svc.HandleEvent(ctx, payments.Event{Type: payments.EventCheckoutExpired, SessionID: "cs_2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(coupons.committed) != 1 || len(coupons.released) != 1 {
+		t.Fatalf("expected an abandoned checkout to give its redemption back, got %v and %v", coupons.committed, coupons.released)
+	}
+
+	drv.err = errors.New("stripe down")
+	if _, err := svc.CreateSession(ctx, payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{PromoCode: "LAUNCH"}}); err == nil {
+		t.Fatal("expected error from driver")
+	}
+	if len(coupons.released) != 2 {
+		t.Fatalf("expected a failed checkout to give its redemption back, got %v", coupons.released)
+	}
+}
+
+func TestCheckoutService_RejectsPromoCodeWithoutCoupons(t *testing.T) {
+	drv := &fakeDriver{}
+	svc := NewCheckoutService(drv)
+
+	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{PromoCode: "LAUNCH"}})
+	if !errors.Is(err, payments.ErrInvalidPromoCode) {
+		t.Fatalf("expected ErrInvalidPromoCode, got %v", err)
+	}
+}
+
+type fakeTax struct {
+	in        payments.TaxInput
+	breakdown payments.TaxBreakdown
+}
+
+func (f *fakeTax) Calculate(ctx context.Context, in payments.TaxInput) (payments.TaxBreakdown, error) {
+	f.in = in
+	return f.breakdown, nil
+}
+
+type fakeOrders struct {
+	saved []payments.Order
+	err   error
+}
+
+func (f *fakeOrders) SaveOrder(ctx context.Context, order payments.Order) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.saved = append(f.saved, order)
+	return nil
+}
+
+func (f *fakeOrders) Order(ctx context.Context, id string) (payments.Order, error) {
+	for i := len(f.saved) - 1; i >= 0; i-- {
+		if f.saved[i].ID == id {
+			return f.saved[i], nil
+		}
+	}
+	return payments.Order{}, payments.ErrNotFound
+}
+
+func (f *fakeOrders) Orders(ctx context.Context) ([]payments.Order, error) {
+	latest := make(map[string]int)
+	var orders []payments.Order
+	for _, o := range f.saved {
+		if i, ok := latest[o.ID]; ok {
+			orders[i] = o
+			continue
+		}
+		latest[o.ID] = len(orders)
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
+
+type fakeShipping struct {
+	quote *payments.Shipping
+}
+
+func (f *fakeShipping) Quote(ctx context.Context, quantity, subtotalCents int64) (*payments.Shipping, error) {
+	return f.quote, nil
+}
+
+func TestCheckoutService_PersistsOrderWithTax(t *testing.T) {
+	drv := &fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1"}}
+	taxCalc := &fakeTax{breakdown: payments.TaxBreakdown{Country: "DE", NetCents: 3600, TaxCents: 684, GrossCents: 4284}}
+	orders := &fakeOrders{}
+	svc := NewCheckoutService(drv,
+		WithProduct(config.ProductConfig{PriceCents: 2000, Currency: "eur"}),
+		WithCoupons(&fakeCoupons{discount: payments.Discount{Code: "TEN", UnitAmountOffCents: 200}}),
+		WithTax(taxCalc),
+		WithOrders(orders),
+	)
+
+	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 2, PromoCode: "TEN", Country: "DE"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if taxCalc.in.AmountCents != 3600 || taxCalc.in.Country != "DE" {
+		t.Fatalf("expected tax on discounted amount, got %#v", taxCalc.in)
+	}
+	if drv.lastReq.Tax == nil || drv.lastReq.Tax.TaxCents != 684 {
+		t.Fatalf("expected tax breakdown to reach driver, got %#v", drv.lastReq.Tax)
+	}
+	if len(orders.saved) != 1 {
+		t.Fatalf("expected one order, got %d", len(orders.saved))
+	}
+	order := orders.saved[0]
+	if order.ID != "cs_1" || order.SubtotalCents != 4000 || order.DiscountCents != 400 || order.TotalCents != 4284 {
+		t.Fatalf("unexpected order: %#v", order)
+	}
+	if order.Tax == nil || order.Tax.TaxCents != 684 {
+		t.Fatalf("expected tax breakdown on order, got %#v", order.Tax)
+	}
+}
+
+func TestCheckoutService_OffersShippingForPhysicalProducts(t *testing.T) {
+	drv := &fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1"}}
+	orders := &fakeOrders{}
+	quote := &payments.Shipping{AllowedCountries: []string{"FR"}, Options: []payments.ShippingOption{{Name: "Standard", AmountCents: 500}}}
+	svc := NewCheckoutService(drv, WithShipping(&fakeShipping{quote: quote}), WithOrders(orders))
+
+	if _, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if drv.lastReq.Shipping != quote {
+		t.Fatalf("expected shipping quote to reach driver, got %#v", drv.lastReq.Shipping)
+	}
+	if !orders.saved[0].Physical {
+		t.Fatal("expected order to be marked physical")
+	}
+}
+
+type fakeInventory struct {
+	err       error
+	reserved  map[string]int64
+	committed []string
+	released  []string
+}
+
+func (f *fakeInventory) Reserve(ctx context.Context, sku string, quantity int64) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	if f.reserved == nil {
+		f.reserved = make(map[string]int64)
+	}
+	id := "res_" + sku
+	f.reserved[id] = quantity
+	return id, nil
+}
+
+func (f *fakeInventory) Commit(ctx context.Context, id, sku string, quantity int64) error {
+	f.committed = append(f.committed, id)
+	return nil
+}
+
+func (f *fakeInventory) Release(ctx context.Context, id string) error {
+	f.released = append(f.released, id)
+	return nil
+}
+
+func TestCheckoutService_ReservesStock(t *testing.T) {
+	drv := &fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1"}}
+	inv := &fakeInventory{}
+	orders := &fakeOrders{}
+	svc := NewCheckoutService(drv, WithProduct(config.ProductConfig{SKU: "tee"}), WithInventory(inv), WithOrders(orders))
+
+	if _, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 2}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if inv.reserved["res_tee"] != 2 {
+		t.Fatalf("expected 2 units reserved, got %#v", inv.reserved)
+	}
+	if orders.saved[0].ReservationID != "res_tee" || orders.saved[0].SKU != "tee" {
+		t.Fatalf("expected reservation on order, got %#v", orders.saved[0])
+	}
+}
+
+func TestCheckoutService_RejectsWhenOutOfStock(t *testing.T) {
+	drv := &fakeDriver{}
+	svc := NewCheckoutService(drv, WithInventory(&fakeInventory{err: payments.ErrOutOfStock}))
+
+	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 2}})
+	if !errors.Is(err, payments.ErrOutOfStock) {
+		t.Fatalf("expected ErrOutOfStock, got %v", err)
+	}
+	if drv.lastReq.Quantity != 0 {
+		t.Fatal("expected driver not to be called")
+	}
+}
+
+func TestCheckoutService_ReleasesStockWhenDriverFails(t *testing.T) {
+	inv := &fakeInventory{}
+	svc := NewCheckoutService(&fakeDriver{err: errors.New("stripe down")}, WithProduct(config.ProductConfig{SKU: "tee"}), WithInventory(inv))
+
+	if _, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err == nil {
+		t.Fatal("expected error from driver")
+	}
+	if len(inv.released) != 1 || inv.released[0] != "res_tee" {
+		t.Fatalf("expected reservation to be released, got %v", inv.released)
+	}
+}
+
+func TestCheckoutService_ExpiresSessionWhenOrderIsNotSaved(t *testing.T) {
+	drv := &fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1"}}
+	inv := &fakeInventory{}
+	svc := NewCheckoutService(drv, WithProduct(config.ProductConfig{SKU: "tee"}), WithInventory(inv), WithOrders(&fakeOrders{err: errors.New("disk full")}))
+
+	if _, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err == nil {
+		t.Fatal("expected the save error")
+	}
+	if len(drv.expired) != 1 || drv.expired[0] != "cs_1" {
+		t.Fatalf("expected the session to be expired, got %v", drv.expired)
+	}
+	if len(inv.released) != 1 {
+		t.Fatalf("expected the reservation to be released, got %v", inv.released)
+	}
+}
+
+func TestCheckoutService_RejectsInvalidQuantityBeforeReserving(t *testing.T) {
+	drv := &fakeDriver{}
+	inv := &fakeInventory{}
+	svc := NewCheckoutService(drv, WithProduct(config.ProductConfig{SKU: "tee", MaxQuantity: 10}), WithInventory(inv))
+
+	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 10_000_000}})
+	var invalid *payments.ValidationError
+	if !errors.As(err, &invalid) || invalid.Fields[0].Field != "quantity" {
+		t.Fatalf("expected a quantity validation error, got %v", err)
+	}
+	if inv.reserved != nil || drv.lastReq.Quantity != 0 {
+		t.Fatal("expected nothing to be reserved or sent to the driver")
+	}
+}
+
+func TestCheckoutService_RejectsOrdersOverTheTotalLimit(t *testing.T) {
+	drv := &fakeDriver{}
+	inv := &fakeInventory{}
+	svc := NewCheckoutService(drv,
+		WithProduct(config.ProductConfig{SKU: "tee", PriceCents: 2000, Currency: "eur"}),
+		WithLimits(config.LimitsConfig{MaxOrderTotalCents: 5000}),
+		WithInventory(inv),
+	)
+
+	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 3}})
+	var invalid *payments.ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(inv.released) != 1 || drv.lastReq.Quantity != 0 {
+		t.Fatalf("expected the reservation to be released before reaching the driver, got %v", inv.released)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// CustomerStore keeps payit's own customer records.
+type CustomerStore interface {
+	SaveCustomer(ctx context.Context, customer payments.Customer) error
+	Customer(ctx context.Context, id string) (payments.Customer, error)
+	CustomerByEmail(ctx context.Context, email string) (payments.Customer, error)
+}
+
+// CustomerDriver is implemented by drivers whose providers keep customer
+// records, so repeat buyers are linked on the provider's side as well.
+type CustomerDriver interface {
+	// EnsureCustomer creates the provider customer for customer unless
+	// ProviderIDs already names one, and returns customer with its ID added.
+	EnsureCustomer(ctx context.Context, customer payments.Customer) (payments.Customer, error)
+}
+
+// WithCustomers links paid checkouts to a customer kept in store by the
+// email they were paid with, creating the provider customer for signed-in
+// buyers when the driver supports it.
+func WithCustomers(store CustomerStore) Option {
+	return func(s *CheckoutService) {
+		s.customers = store
+	}
+}
+
+// Customer returns the customer with the given ID.
+func (s *CheckoutService) Customer(ctx context.Context, id string) (payments.Customer, error) {
+	if s.customers == nil {
+		return payments.Customer{}, payments.ErrNotFound
+	}
+	return s.customers.Customer(ctx, id)
+}
+
+// checkoutCustomer resolves the customer buying with req, along with their
+// provider customer, so the provider can save their card. Only a buyer whose
+// email is verified is linked up front; it returns nil for everyone else.
+// A new customer is not saved until keepCustomer is called.
+func (s *CheckoutService) checkoutCustomer(ctx context.Context, req payments.CheckoutSessionRequest) (*payments.Customer, error) {
+	if s.customers == nil || !req.EmailVerified || req.CustomerEmail == "" {
+		return nil, nil
+	}
+	customer, err := s.customers.CustomerByEmail(ctx, req.CustomerEmail)
+	if errors.Is(err, payments.ErrNotFound) {
+		now := s.now().UTC()
+		customer = payments.Customer{ID: "cust_" + rand.Text(), Email: req.CustomerEmail, CreatedAt: now, UpdatedAt: now}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if req.CustomerName != "" {
+		customer.Name = req.CustomerName
+	}
+	if req.Locale != "" {
+		customer.Locale = req.Locale
+	}
+	if d, ok := s.driver.(CustomerDriver); ok {
+		if customer, err = d.EnsureCustomer(ctx, customer); err != nil {
+			return nil, fmt.Errorf("link provider customer for %s: %w", customer.ID, err)
+		}
+	}
+	return &customer, nil
+}
+
+// keepCustomer saves the customer a checkout resolved once its session or
+// payment exists, if it is new or has changed.
+func (s *CheckoutService) keepCustomer(ctx context.Context, customer *payments.Customer) error {
+	if s.customers == nil || customer == nil {
+		return nil
+	}
+	saved, err := s.customers.Customer(ctx, customer.ID)
+	if err != nil && !errors.Is(err, payments.ErrNotFound) {
+		return err
+	}
+	if err == nil && customer.Name == saved.Name && customer.Locale == saved.Locale && maps.Equal(customer.ProviderIDs, saved.ProviderIDs) {
+		return nil
+	}
+	if err == nil {
+		customer.UpdatedAt = s.now().UTC()
+	}
+	return s.customers.SaveCustomer(ctx, *customer)
+}
+
+// linkCustomer attaches order to the customer with email, the address the
+// provider confirmed the buyer paid with.
+func (s *CheckoutService) linkCustomer(ctx context.Context, order *payments.Order, email string) error {
+	if s.customers == nil || order.CustomerID != "" || email == "" {
+		return nil
+	}
+	customer, err := s.findOrCreateCustomer(ctx, email)
+	if err != nil {
+		return err
+	}
+	order.CustomerID = customer.ID
+	return nil
+}
+
+// findOrCreateCustomer returns the customer with email, saving a new one if
+// there is none yet.
+func (s *CheckoutService) findOrCreateCustomer(ctx context.Context, email string) (payments.Customer, error) {
+	customer, err := s.customers.CustomerByEmail(ctx, email)
+	if err == nil || !errors.Is(err, payments.ErrNotFound) {
+		return customer, err
+	}
+	now := s.now().UTC()
+	customer = payments.Customer{
+		ID:        "cust_" + rand.Text(),
+		Email:     email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.customers.SaveCustomer(ctx, customer); err != nil {
+		return payments.Customer{}, err
+	}
+	return customer, nil
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+type fakeCustomers struct {
+	byID  map[string]payments.Customer
+	saves int
+}
+
+func (f *fakeCustomers) SaveCustomer(ctx context.Context, customer payments.Customer) error {
+	if f.byID == nil {
+		f.byID = make(map[string]payments.Customer)
+	}
+	f.byID[customer.ID] = customer
+	f.saves++
+	return nil
+}
+
+func (f *fakeCustomers) Customer(ctx context.Context, id string) (payments.Customer, error) {
+	customer, ok := f.byID[id]
+	if !ok {
+		return payments.Customer{}, payments.ErrNotFound
+	}
+	return customer, nil
+}
+
+func (f *fakeCustomers) CustomerByEmail(ctx context.Context, email string) (payments.Customer, error) {
+	for _, customer := range f.byID {
+		if strings.EqualFold(customer.Email, email) {
+			return customer, nil
+		}
+	}
+	return payments.Customer{}, payments.ErrNotFound
+}
+
+type fakeCustomerDriver struct {
+	fakeDriver
+	created int
+}
+
+func (f *fakeCustomerDriver) EnsureCustomer(ctx context.Context, customer payments.Customer) (payments.Customer, error) {
+	if customer.ProviderIDs["stripe"] != "" {
+		return customer, nil
+	}
+	f.created++
+	customer.ProviderIDs = maps.Clone(customer.ProviderIDs)
+	if customer.ProviderIDs == nil {
+		customer.ProviderIDs = make(map[string]string)
+	}
+	customer.ProviderIDs["stripe"] = "cus_1"
+	return customer, nil
+}
+
+func TestCheckoutService_LinksRepeatBuyersToOneCustomer(t *testing.T) {
+	drv := &fakeCustomerDriver{fakeDriver: fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1"}}}
+	orders := &fakeOrders{}
+	customers := &fakeCustomers{}
+	svc := NewCheckoutService(drv, WithOrders(orders), WithCustomers(customers))
+	ctx := context.Background()
+
+	req := payments.CheckoutSessionRequest{
+		CheckoutSessionRequest: payit.CheckoutSessionRequest{CustomerEmail: "ada@example.com", CustomerName: "Ada", Locale: "en-GB"},
+		EmailVerified:          true,
+	}
+	if _, err := svc.CreateSession(ctx, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first := orders.saved[0]
+	customer, err := svc.Customer(ctx, first.CustomerID)
+	if err != nil {
+		t.Fatalf("expected the order to reference a customer, got %v", err)
+	}
+	if customer.Name != "Ada" || customer.Locale != "en-GB" || customer.ProviderIDs["stripe"] != "cus_1" {
+		t.Fatalf("unexpected customer: %#v", customer)
+	}
+	if drv.lastReq.Customer == nil || drv.lastReq.Customer.ProviderIDs["stripe"] != "cus_1" {
+		t.Fatalf("expected the driver to receive the customer, got %#v", drv.lastReq.Customer)
+	}
+
+	drv.result.ID = "cs_2"
+	saves := customers.saves
+	if _, err := svc.CreateSession(ctx, payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{CustomerEmail: "ADA@example.com"}, EmailVerified: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second := orders.saved[1]; second.CustomerID != first.CustomerID {
+		t.Fatalf("expected the repeat buyer to be linked to %s, got %s", first.CustomerID, second.CustomerID)
+	}
+	if drv.created != 1 || customers.saves != saves {
+		t.Fatalf("expected no new provider customer or update, got %d created and %d saves", drv.created, customers.saves-saves)
+	}
+}
+
+func TestCheckoutService_AnonymousCheckoutHasNoCustomer(t *testing.T) {
+	drv := &fakeCustomerDriver{fakeDriver: fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1"}}}
+	orders := &fakeOrders{}
+	customers := &fakeCustomers{}
+	svc := NewCheckoutService(drv, WithOrders(orders), WithCustomers(customers))
+
+	if _, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if orders.saved[0].CustomerID != "" || drv.lastReq.Customer != nil || drv.created != 0 {
+		t.Fatalf("expected no customer, got %#v", orders.saved[0])
+	}
+}
+
+func TestCheckoutService_UnverifiedEmailLinksNoCustomer(t *testing.T) {
+	drv := &fakeCustomerDriver{fakeDriver: fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1"}}}
+	orders := &fakeOrders{}
+	customers := &fakeCustomers{}
+	customers.SaveCustomer(context.Background(), payments.Customer{ID: "cust_1", Email: "ada@example.com", Name: "Ada"})
+	svc := NewCheckoutService(drv, WithOrders(orders), WithCustomers(customers))
+
+	req := payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{CustomerEmail: "ada@example.com", CustomerName: "Mallory"}}
+	if _, err := svc.CreateSession(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if orders.saved[0].CustomerID != "" || drv.lastReq.Customer != nil || drv.created != 0 {
+		t.Fatalf("expected no customer for an unverified email, got %#v", orders.saved[0])
+	}
+	if customer, _ := svc.Customer(context.Background(), "cust_1"); customer.Name != "Ada" || customers.saves != 1 {
+		t.Fatalf("expected the customer to be left alone, got %#v after %d saves", customer, customers.saves)
+	}
+}
+
+func TestCheckoutService_FailedCheckoutSavesNoCustomer(t *testing.T) {
+	drv := &fakeCustomerDriver{fakeDriver: fakeDriver{err: errors.New("stripe down")}}
+	customers := &fakeCustomers{}
+	svc := NewCheckoutService(drv, WithOrders(&fakeOrders{}), WithCustomers(customers))
+
+	req := payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{CustomerEmail: "ada@example.com"}, EmailVerified: true}
+	if _, err := svc.CreateSession(context.Background(), req); err == nil {
+		t.Fatal("expected the driver error")
+	}
+	if customers.saves != 0 {
+		t.Fatalf("expected no customer saved for a failed checkout, got %d saves", customers.saves)
+	}
+}
+
+func TestHandleEvent_LinksCustomerFromCompletedCheckout(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen}}}
+	customers := &fakeCustomers{}
+	customers.SaveCustomer(context.Background(), payments.Customer{ID: "cust_1", Email: "grace@example.com"})
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithCustomers(customers))
+
+	err := svc.HandleEvent(context.Background(), payments.Event{
+		Type:          payments.EventCheckoutCompleted,
+		SessionID:     "cs_1",
+		Paid:          true,
+		CustomerEmail: "grace@example.com",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order, _ := orders.Order(context.Background(), "cs_1"); order.CustomerID != "cust_1" {
+		t.Fatalf("expected the order to be linked to cust_1, got %q", order.CustomerID)
+	}
+}
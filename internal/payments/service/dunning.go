@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// Job kinds run by RunJob.
+const (
+	JobDunningReminder = "dunning.reminder"
+	JobDunningFinal    = "dunning.final"
+)
+
+// JobScheduler keeps jobs to run later, across restarts.
+type JobScheduler interface {
+	Schedule(ctx context.Context, job payments.Job) error
+}
+
+// DunningDriver is implemented by subscription drivers that can check on and
+// end a subscription whose renewal stayed unpaid.
+type DunningDriver interface {
+	Subscription(ctx context.Context, id string) (payments.Subscription, error)
+	// EndSubscription cancels a subscription right away.
+	EndSubscription(ctx context.Context, id string) (payments.Subscription, error)
+	// DowngradeSubscription moves a subscription onto priceID.
+	DowngradeSubscription(ctx context.Context, id, priceID string) (payments.Subscription, error)
+}
+
+// DunningNotifier is implemented by notifiers that chase failed renewals.
+type DunningNotifier interface {
+	PaymentReminder(ctx context.Context, sub payments.Subscription) error
+	SubscriptionLapsed(ctx context.Context, sub payments.Subscription) error
+}
+
+// WithDunning chases failed renewals on cfg's schedule, with steps kept in
+// jobs. Subscriptions must be mirrored with WithSubscriptions.
+func WithDunning(cfg config.DunningConfig, jobs JobScheduler) Option {
+	return func(s *CheckoutService) {
+		s.dunning = cfg
+		s.jobs = jobs
+	}
+}
+
+// unpaidStatuses are the provider states of a subscription whose renewal is
+// still outstanding.
+var unpaidStatuses = []string{"past_due", "unpaid", "incomplete"}
+
+// startDunning schedules reminders and the final action for a failed
+// renewal. Failed retries of a renewal already being chased are only
+// recorded, so the schedule runs from the first failure.
+func (s *CheckoutService) startDunning(ctx context.Context, event payments.Event) error {
+	if s.jobs == nil || s.subscriptions == nil || event.SubscriptionID == "" {
+		return nil
+	}
+	sub, found, err := s.findSubscription(ctx, event.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		sub = payments.Subscription{ID: event.SubscriptionID, Status: "past_due", AmountCents: event.AmountCents, Currency: event.Currency}
+	}
+	if sub.CustomerEmail == "" {
+		sub.CustomerEmail = event.CustomerEmail
+	}
+	if d := sub.Dunning; d != nil && d.Outcome == "" {
+		if event.PaymentUpdateURL != "" {
+			d.PaymentUpdateURL = event.PaymentUpdateURL
+		}
+		s.recordSubscription(&sub, "payment retry failed", payments.FormatMoney(event.AmountCents, event.Currency))
+		return s.storeSubscription(ctx, sub)
+	}
+
+	now := s.now().UTC()
+	sub.Dunning = &payments.Dunning{
+		StartedAt:        now,
+		GraceUntil:       now.Add(s.dunning.GracePeriod),
+		AmountCents:      event.AmountCents,
+		Currency:         event.Currency,
+		PaymentUpdateURL: event.PaymentUpdateURL,
+	}
+	// Jobs go in before the subscription is saved: if saving fails the
+	// provider redelivers the event, and jobs of an abandoned start find
+	// nothing to do.
+	for i, after := range s.dunning.Reminders {
+		job, err := dunningJob(sub, JobDunningReminder, fmt.Sprintf("reminder-%d", i+1), now.Add(after))
+		if err != nil {
+			return err
+		}
+		if err := s.jobs.Schedule(ctx, job); err != nil {
+			return fmt.Errorf("schedule payment reminder for %s: %w", sub.ID, err)
+		}
+	}
+	job, err := dunningJob(sub, JobDunningFinal, "final", sub.Dunning.GraceUntil)
+	if err != nil {
+		return err
+	}
+	if err := s.jobs.Schedule(ctx, job); err != nil {
+		return fmt.Errorf("schedule end of grace period for %s: %w", sub.ID, err)
+	}
+
+	s.recordSubscription(&sub, "payment failed", payments.FormatMoney(event.AmountCents, event.Currency))
+	s.recordSubscription(&sub, "grace period started", "access until "+sub.Dunning.GraceUntil.Format("2 Jan 2006 15:04 MST"))
+	return s.storeSubscription(ctx, sub)
+}
+
+// dunningJob builds a step of sub's dunning schedule. The job carries the
+// dunning state so it can still run if the subscription mirror was lost.
+func dunningJob(sub payments.Subscription, kind, step string, runAt time.Time) (payments.Job, error) {
+	state, err := json.Marshal(sub.Dunning)
+	if err != nil {
+		return payments.Job{}, fmt.Errorf("encode dunning state: %w", err)
+	}
+	return payments.Job{
+		ID:    fmt.Sprintf("dunning-%s-%d-%s", sub.ID, sub.Dunning.StartedAt.Unix(), step),
+		Kind:  kind,
+		RunAt: runAt,
+		Data: map[string]string{
+			"subscription": sub.ID,
+			"email":        sub.CustomerEmail,
+			"dunning":      string(state),
+		},
+	}, nil
+}
+
+// resolveDunning closes the dunning of a subscription whose renewal was paid.
+func (s *CheckoutService) resolveDunning(ctx context.Context, event payments.Event) error {
+	if s.subscriptions == nil || event.SubscriptionID == "" {
+		return nil
+	}
+	sub, found, err := s.findSubscription(ctx, event.SubscriptionID)
+	if err != nil || !found || sub.Dunning == nil || sub.Dunning.Outcome != "" {
+		return err
+	}
+	s.endDunning(&sub, payments.DunningRecovered)
+	s.recordSubscription(&sub, "payment recovered", payments.FormatMoney(event.AmountCents, event.Currency))
+	return s.storeSubscription(ctx, sub)
+}
+
+// RunJob carries out a scheduled job.
+func (s *CheckoutService) RunJob(ctx context.Context, job payments.Job) error {
+	switch job.Kind {
+	case JobDunningReminder, JobDunningFinal:
+		return s.runDunningStep(ctx, job)
+	default:
+		return fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+}
+
+// runDunningStep sends a reminder or takes the final action, unless the
+// renewal was paid or the subscription ended since the step was scheduled.
+func (s *CheckoutService) runDunningStep(ctx context.Context, job payments.Job) error {
+	if s.subscriptions == nil {
+		return nil
+	}
+	var planned payments.Dunning
+	if err := json.Unmarshal([]byte(job.Data["dunning"]), &planned); err != nil {
+		return fmt.Errorf("decode dunning state of job %s: %w", job.ID, err)
+	}
+	id := job.Data["subscription"]
+	sub, found, err := s.findSubscription(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		sub = payments.Subscription{ID: id, CustomerEmail: job.Data["email"]}
+	}
+	switch {
+	case sub.Dunning == nil:
+		sub.Dunning = &planned
+	case !sub.Dunning.StartedAt.Equal(planned.StartedAt) || sub.Dunning.Outcome != "":
+		return nil
+	}
+
+	if driver, ok := s.subscriptionDriver.(DunningDriver); ok {
+		current, err := driver.Subscription(ctx, id)
+		if errors.Is(err, payments.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("check subscription %s: %w", id, err)
+		}
+		sub.Status = current.Status
+		if !slices.Contains(unpaidStatuses, current.Status) {
+			return s.settleDunning(ctx, sub)
+		}
+	}
+
+	if job.Kind == JobDunningReminder {
+		sub.Dunning.RemindersSent++
+		s.notify(ctx, "payment reminder for "+id, func(n Notifier) error {
+			if dn, ok := n.(DunningNotifier); ok {
+				return dn.PaymentReminder(ctx, sub)
+			}
+			return nil
+		})
+		s.recordSubscription(&sub, "payment reminder sent", fmt.Sprintf("reminder %d of %d", sub.Dunning.RemindersSent, len(s.dunning.Reminders)))
+		return s.storeSubscription(ctx, sub)
+	}
+	return s.finishDunning(ctx, sub)
+}
+
+// settleDunning records that the provider no longer holds the renewal as
+// unpaid: it was paid, or the subscription ended there.
+func (s *CheckoutService) settleDunning(ctx context.Context, sub payments.Subscription) error {
+	if sub.Status == "active" || sub.Status == "trialing" {
+		s.endDunning(&sub, payments.DunningRecovered)
+		s.recordSubscription(&sub, "payment recovered", "")
+	} else {
+		s.endDunning(&sub, payments.DunningCanceled)
+		s.recordSubscription(&sub, "ended by provider", sub.Status)
+	}
+	return s.storeSubscription(ctx, sub)
+}
+
+// finishDunning takes the configured final action once the grace period is
+// over.
+func (s *CheckoutService) finishDunning(ctx context.Context, sub payments.Subscription) error {
+	before := sub
+	driver, _ := s.subscriptionDriver.(DunningDriver)
+	switch s.dunning.FinalAction {
+	case config.DunningFinalCancel, config.DunningFinalDowngrade:
+		if driver == nil {
+			return fmt.Errorf("end subscription %s: %w", sub.ID, errors.ErrUnsupported)
+		}
+	}
+
+	switch s.dunning.FinalAction {
+	case config.DunningFinalCancel:
+		ended, err := driver.EndSubscription(ctx, sub.ID)
+		if err != nil {
+			return fmt.Errorf("cancel subscription %s: %w", sub.ID, err)
+		}
+		sub.Status = ended.Status
+		s.endDunning(&sub, payments.DunningCanceled)
+		s.recordSubscription(&sub, "canceled for non-payment", "")
+	case config.DunningFinalDowngrade:
+		downgraded, err := driver.DowngradeSubscription(ctx, sub.ID, s.dunning.DowngradePriceID)
+		if err != nil {
+			return fmt.Errorf("downgrade subscription %s: %w", sub.ID, err)
+		}
+		sub.Status = downgraded.Status
+		sub.AmountCents, sub.Currency = downgraded.AmountCents, downgraded.Currency
+		s.endDunning(&sub, payments.DunningDowngraded)
+		s.recordSubscription(&sub, "downgraded for non-payment", s.dunning.DowngradePriceID)
+	default:
+		s.endDunning(&sub, payments.DunningLapsed)
+		s.recordSubscription(&sub, "grace period ended", "")
+	}
+	if err := s.storeSubscription(ctx, sub); err != nil {
+		return err
+	}
+
+	if s.auditor != nil && sub.Dunning.Outcome != payments.DunningLapsed {
+		s.auditor.Report(ctx, payments.AuditRecord{
+			Action:   payments.AuditSubscriptionDunning,
+			Target:   sub.ID,
+			Currency: sub.Currency,
+			Before:   subscriptionStateOf(before),
+			After:    subscriptionStateOf(sub),
+		})
+	}
+	s.notify(ctx, "lapsed subscription "+sub.ID, func(n Notifier) error {
+		if dn, ok := n.(DunningNotifier); ok {
+			return dn.SubscriptionLapsed(ctx, sub)
+		}
+		return nil
+	})
+	return nil
+}
+
+func (s *CheckoutService) endDunning(sub *payments.Subscription, outcome payments.DunningOutcome) {
+	d := *sub.Dunning
+	d.Outcome = outcome
+	d.EndedAt = s.now().UTC()
+	sub.Dunning = &d
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeJobs struct {
+	scheduled []payments.Job
+}
+
+func (f *fakeJobs) Schedule(ctx context.Context, job payments.Job) error {
+	f.scheduled = append(f.scheduled, job)
+	return nil
+}
+
+type fakeDunningDriver struct {
+	fakeSubscriptionDriver
+	status     string
+	ended      []string
+	downgraded []string
+}
+
+func (f *fakeDunningDriver) Subscription(ctx context.Context, id string) (payments.Subscription, error) {
+	return payments.Subscription{ID: id, Status: f.status}, nil
+}
+
+func (f *fakeDunningDriver) EndSubscription(ctx context.Context, id string) (payments.Subscription, error) {
+	f.ended = append(f.ended, id)
+	return payments.Subscription{ID: id, Status: "canceled"}, nil
+}
+
+func (f *fakeDunningDriver) DowngradeSubscription(ctx context.Context, id, priceID string) (payments.Subscription, error) {
+	f.downgraded = append(f.downgraded, priceID)
+	return payments.Subscription{ID: id, Status: "active", AmountCents: 0, Currency: "eur"}, nil
+}
+
+type fakeDunningNotifier struct {
+	fakeNotifier
+	reminders []int
+	lapsed    []payments.DunningOutcome
+}
+
+func (f *fakeDunningNotifier) PaymentReminder(ctx context.Context, sub payments.Subscription) error {
+	f.reminders = append(f.reminders, sub.Dunning.RemindersSent)
+	return nil
+}
+
+func (f *fakeDunningNotifier) SubscriptionLapsed(ctx context.Context, sub payments.Subscription) error {
+	f.lapsed = append(f.lapsed, sub.Dunning.Outcome)
+	return nil
+}
+
+var testDunning = config.DunningConfig{
+	Reminders:   []time.Duration{72 * time.Hour, 168 * time.Hour},
+	GracePeriod: 14 * 24 * time.Hour,
+	FinalAction: config.DunningFinalCancel,
+}
+
+func TestDunning_RemindsThenCancels(t *testing.T) {
+	subs := &fakeSubscriptions{}
+	subs.SaveSubscription(context.Background(), payments.Subscription{ID: "sub_1", Status: "active", CustomerEmail: "ada@example.com"})
+	jobs := &fakeJobs{}
+	driver := &fakeDunningDriver{status: "past_due"}
+	notifier := &fakeDunningNotifier{}
+	svc := NewCheckoutService(&fakeDriver{}, WithSubscriptions(subs), WithSubscriptionDriver(driver), WithNotifier(notifier), WithDunning(testDunning, jobs))
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	failed := payments.Event{Type: payments.EventRenewalFailed, SubscriptionID: "sub_1", AmountCents: 900, Currency: "eur", PaymentUpdateURL: "https://pay.example/inv_1"}
+	for range 2 {
+		if err := svc.HandleEvent(ctx, failed); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(jobs.scheduled) != 3 || !jobs.scheduled[0].RunAt.Equal(now.Add(72*time.Hour)) || jobs.scheduled[2].Kind != JobDunningFinal || !jobs.scheduled[2].RunAt.Equal(now.Add(testDunning.GracePeriod)) {
+		t.Fatalf("expected two reminders and a final step scheduled once, got %#v", jobs.scheduled)
+	}
+	sub := subs.saved[0]
+	if sub.Dunning == nil || sub.Dunning.Outcome != "" || !sub.Dunning.GraceUntil.Equal(now.Add(testDunning.GracePeriod)) || sub.Dunning.PaymentUpdateURL != "https://pay.example/inv_1" || len(sub.Timeline) != 3 {
+		t.Fatalf("expected the subscription in its grace period with every step recorded, got %#v", sub)
+	}
+
+	for _, job := range jobs.scheduled {
+		if err := svc.RunJob(ctx, job); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(notifier.reminders) != 2 || notifier.reminders[1] != 2 {
+		t.Fatalf("expected two numbered reminders, got %v", notifier.reminders)
+	}
+	if len(driver.ended) != 1 || len(notifier.lapsed) != 1 || notifier.lapsed[0] != payments.DunningCanceled {
+		t.Fatalf("expected the subscription canceled once, got %v and %v", driver.ended, notifier.lapsed)
+	}
+	sub = subs.saved[0]
+	if sub.Status != "canceled" || sub.Dunning.Outcome != payments.DunningCanceled || sub.Timeline[len(sub.Timeline)-1].Action != "canceled for non-payment" {
+		t.Fatalf("unexpected subscription after dunning: %#v", sub)
+	}
+
+	// A job run again after a crash finds the dunning over.
+	if err := svc.RunJob(ctx, jobs.scheduled[2]); err != nil || len(driver.ended) != 1 {
+		t.Fatalf("expected a repeated final step to do nothing, got %v after %v", err, driver.ended)
+	}
+}
+
+func TestDunning_StopsWhenPaid(t *testing.T) {
+	subs := &fakeSubscriptions{}
+	jobs := &fakeJobs{}
+	driver := &fakeDunningDriver{status: "past_due"}
+	notifier := &fakeDunningNotifier{}
+	svc := NewCheckoutService(&fakeDriver{}, WithSubscriptions(subs), WithSubscriptionDriver(driver), WithNotifier(notifier), WithDunning(testDunning, jobs))
+	ctx := context.Background()
+
+	if err := svc.HandleEvent(ctx, payments.Event{Type: payments.EventRenewalFailed, SubscriptionID: "sub_1", CustomerEmail: "ada@example.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := svc.HandleEvent(ctx, payments.Event{Type: payments.EventRenewalPaid, SubscriptionID: "sub_1", AmountCents: 900, Currency: "eur"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := subs.saved[0].Dunning.Outcome; got != payments.DunningRecovered {
+		t.Fatalf("expected the dunning recovered, got %q", got)
+	}
+	for _, job := range jobs.scheduled {
+		if err := svc.RunJob(ctx, job); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(notifier.reminders) != 0 || len(driver.ended) != 0 {
+		t.Fatalf("expected no chasing after payment, got %v and %v", notifier.reminders, driver.ended)
+	}
+}
+
+func TestDunning_SurvivesLostSubscriptions(t *testing.T) {
+	jobs := &fakeJobs{}
+	driver := &fakeDunningDriver{status: "past_due"}
+	cfg := testDunning
+	cfg.FinalAction, cfg.DowngradePriceID = config.DunningFinalDowngrade, "price_free"
+	first := NewCheckoutService(&fakeDriver{}, WithSubscriptions(&fakeSubscriptions{}), WithDunning(cfg, jobs))
+	if err := first.HandleEvent(context.Background(), payments.Event{Type: payments.EventRenewalFailed, SubscriptionID: "sub_1", CustomerEmail: "ada@example.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// After a restart the in-memory mirror is empty but the jobs remain.
+	subs := &fakeSubscriptions{}
+	restarted := NewCheckoutService(&fakeDriver{}, WithSubscriptions(subs), WithSubscriptionDriver(driver), WithDunning(cfg, jobs))
+	if err := restarted.RunJob(context.Background(), jobs.scheduled[len(jobs.scheduled)-1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(driver.downgraded) != 1 || driver.downgraded[0] != "price_free" {
+		t.Fatalf("expected a downgrade to the configured price, got %v", driver.downgraded)
+	}
+	sub := subs.saved[0]
+	if sub.CustomerEmail != "ada@example.com" || sub.Dunning.Outcome != payments.DunningDowngraded {
+		t.Fatalf("expected the subscription rebuilt from the job, got %#v", sub)
+	}
+}
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// HandleEvent applies a verified provider notification to the local order.
+// Events for sessions payit has no record of are acknowledged and ignored so
+// that the provider stops retrying them.
+func (s *CheckoutService) HandleEvent(ctx context.Context, event payments.Event) error {
+	if event.Type == payments.EventRenewalFailed {
+		s.notify(ctx, "renewal failure for "+event.SubscriptionID, func(n Notifier) error {
+			return n.RenewalFailed(ctx, event)
+		})
+		return s.startDunning(ctx, event)
+	}
+	if event.Type == payments.EventRenewalPaid {
+		return s.resolveDunning(ctx, event)
+	}
+	if event.Type == payments.EventSubscriptionUpdated {
+		return s.saveSubscription(ctx, event)
+	}
+	if event.Type == payments.EventTrialEnding {
+		return s.trialEnding(ctx, event)
+	}
+	if s.orders == nil {
+		return nil
+	}
+
+	switch event.Type {
+	case payments.EventCheckoutCompleted:
+		return s.completeOrder(ctx, event)
+	case payments.EventCheckoutExpired:
+		order, closed, err := s.closeOrder(ctx, event.SessionID, payments.OrderStatusExpired, event.CustomerEmail)
+		if err != nil || !closed {
+			return err
+		}
+		return s.queueRecovery(ctx, order)
+	case payments.EventCheckoutFailed:
+		_, _, err := s.closeOrder(ctx, event.SessionID, payments.OrderStatusFailed, event.CustomerEmail)
+		return err
+	case payments.EventRefundIssued:
+		return s.refundOrder(ctx, event)
+	default:
+		return nil
+	}
+}
+
+// CancelSession expires an open checkout at the provider and releases any
+// stock it was holding.
+func (s *CheckoutService) CancelSession(ctx context.Context, id string) error {
+	if s.orders == nil {
+		return payments.ErrNotFound
+	}
+
+	order, err := s.orders.Order(ctx, id)
+	if err != nil {
+		return err
+	}
+	if order.Status != payments.OrderStatusOpen {
+		return fmt.Errorf("%w: order %s is %s", payments.ErrOrderNotOpen, id, order.Status)
+	}
+
+	if paidByIntent(order) && s.intents != nil {
+		if err := s.intents.CancelPaymentIntent(ctx, id); err != nil {
+			return fmt.Errorf("cancel payment intent %s: %w", id, err)
+		}
+	} else if err := s.driverFor(order).ExpireSession(ctx, id); err != nil {
+		return fmt.Errorf("expire session %s: %w", id, err)
+	}
+
+	canceled, closed, err := s.closeOrder(ctx, id, payments.OrderStatusCanceled, "")
+	if err != nil || !closed {
+		return err
+	}
+	s.audit(ctx, payments.AuditCheckoutCancel, canceled, 0, stateOf(order))
+	return nil
+}
+
+// CancelOwnSession cancels a checkout on behalf of the buyer who started it,
+// who proves it with the cancel token handed out with the session. A wrong
+// token is reported as an unknown session.
+func (s *CheckoutService) CancelOwnSession(ctx context.Context, id, cancelToken string) error {
+	if s.orders == nil {
+		return payments.ErrNotFound
+	}
+	order, err := s.orders.Order(ctx, id)
+	if err != nil {
+		return err
+	}
+	if order.CancelToken == "" || subtle.ConstantTimeCompare([]byte(order.CancelToken), []byte(cancelToken)) != 1 {
+		return fmt.Errorf("%w: checkout %s", payments.ErrNotFound, id)
+	}
+	return s.CancelSession(ctx, id)
+}
+
+// SessionCompleter is implemented by drivers that can finish a checkout when
+// the buyer returns to payit instead of waiting for a webhook, such as
+// PayPal's capture on return or Stripe's embedded checkout.
+type SessionCompleter interface {
+	CompleteSession(ctx context.Context, id string) (payments.Event, error)
+}
+
+// CompleteSession collects the payment for a checkout the buyer approved at
+// the provider and returns the updated order. Orders that were already paid
+// come back unchanged, so reloading the return page is harmless.
+func (s *CheckoutService) CompleteSession(ctx context.Context, id string) (payments.Order, error) {
+	if s.orders == nil {
+		return payments.Order{}, payments.ErrNotFound
+	}
+	order, err := s.orders.Order(ctx, id)
+	if err != nil {
+		return payments.Order{}, err
+	}
+	switch order.Status {
+	case payments.OrderStatusOpen:
+	case payments.OrderStatusPaid, payments.OrderStatusAuthorized, payments.OrderStatusRefunded:
+		return order, nil
+	default:
+		return payments.Order{}, fmt.Errorf("%w: order %s is %s", payments.ErrOrderNotOpen, id, order.Status)
+	}
+
+	completer, ok := s.driverFor(order).(SessionCompleter)
+	if !ok {
+		return payments.Order{}, fmt.Errorf("order %s: provider %q completes checkouts by webhook", id, order.Provider)
+	}
+	event, err := completer.CompleteSession(ctx, id)
+	if err != nil {
+		return payments.Order{}, fmt.Errorf("complete session %s: %w", id, err)
+	}
+	if err := s.completeOrder(ctx, event); err != nil {
+		return payments.Order{}, err
+	}
+	return s.orders.Order(ctx, id)
+}
+
+func (s *CheckoutService) completeOrder(ctx context.Context, event payments.Event) error {
+	s.completing.Lock()
+	defer s.completing.Unlock()
+
+	order, err := s.orders.Order(ctx, event.SessionID)
+	if errors.Is(err, payments.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load order %s: %w", event.SessionID, err)
+	}
+
+	if event.CustomerEmail != "" {
+		order.CustomerEmail = event.CustomerEmail
+	}
+	if err := s.linkCustomer(ctx, &order, event.CustomerEmail); err != nil {
+		return fmt.Errorf("link customer to order %s: %w", order.ID, err)
+	}
+	if event.PaymentIntentID != "" {
+		order.PaymentIntentID = event.PaymentIntentID
+	}
+	if event.ShippingAddress != nil {
+		order.ShippingAddress = event.ShippingAddress
+	}
+	if event.ShippingRate != "" && order.ShippingRate == "" {
+		order.ShippingRate = event.ShippingRate
+		order.ShippingCents = event.ShippingCents
+		order.TotalCents += event.ShippingCents
+	}
+	if event.Totals != nil {
+		applyTotals(&order, *event.Totals)
+	}
+	justPaid := event.Paid && order.Status == payments.OrderStatusOpen
+	// With manual capture the provider reports the checkout complete but
+	// unpaid; the payment is held until staff capture it.
+	authorized := !event.Paid && s.manualCapture && order.PaymentIntentID != "" && order.Status == payments.OrderStatusOpen
+	if justPaid || authorized {
+		if err := s.commitHolds(ctx, order); err != nil {
+			return err
+		}
+	}
+	switch {
+	case justPaid:
+		order.Status = payments.OrderStatusPaid
+		order.PaidAt = s.now().UTC()
+		s.record(&order, "paid", payments.FormatMoney(order.TotalCents, order.Currency))
+	case authorized:
+		order.Status = payments.OrderStatusAuthorized
+		s.record(&order, "authorized", payments.FormatMoney(order.TotalCents, order.Currency))
+	}
+
+	if err := s.orders.SaveOrder(ctx, order); err != nil {
+		return err
+	}
+	if err := s.linkSubscription(ctx, event.SubscriptionID, order.CustomerEmail); err != nil {
+		return err
+	}
+
+	if justPaid {
+		s.notify(ctx, "receipt for order "+order.ID, func(n Notifier) error {
+			return n.OrderPaid(ctx, order)
+		})
+	}
+	return nil
+}
+
+// refundOrder records the cumulative refunded amount on the order that owns
+// the refunded payment and notifies about the newly refunded portion.
+func (s *CheckoutService) refundOrder(ctx context.Context, event payments.Event) error {
+	s.refunding.Lock()
+	defer s.refunding.Unlock()
+
+	orders, err := s.orders.Orders(ctx)
+	if err != nil {
+		return fmt.Errorf("load orders: %w", err)
+	}
+
+	idx := slices.IndexFunc(orders, func(o payments.Order) bool {
+		return event.PaymentIntentID != "" && o.PaymentIntentID == event.PaymentIntentID
+	})
+	if idx < 0 {
+		return nil
+	}
+	order := orders[idx]
+
+	delta := event.AmountCents - order.RefundedCents
+	if delta <= 0 {
+		return nil
+	}
+	before := stateOf(order)
+	order.RefundedCents = event.AmountCents
+	if order.RefundedCents >= order.TotalCents {
+		order.Status = payments.OrderStatusRefunded
+	}
+	s.record(&order, "refunded", payments.FormatMoney(delta, order.Currency))
+	if err := s.orders.SaveOrder(ctx, order); err != nil {
+		return err
+	}
+	// Refunds issued from the provider's dashboard only reach payit here.
+	s.audit(ctx, payments.AuditOrderRefund, order, delta, before)
+
+	s.notify(ctx, "refund for order "+order.ID, func(n Notifier) error {
+		return n.RefundIssued(ctx, order, delta)
+	})
+	return nil
+}
+
+// notify runs send against every configured notifier. Delivery failures are
+// logged rather than returned so a mail outage never makes the provider
+// redeliver an event that was already applied.
+func (s *CheckoutService) notify(ctx context.Context, what string, send func(Notifier) error) {
+	for _, n := range s.notifiers {
+		if err := send(n); err != nil {
+			log.Printf("notify %s: %v", what, err)
+		}
+	}
+}
+
+// closeOrder moves an open order to a terminal unpaid status and releases the
+// stock and promotion code held for it. Orders that already left the open state are left untouched and
+// reported as not closed.
+func (s *CheckoutService) closeOrder(ctx context.Context, id string, status payments.OrderStatus, email string) (payments.Order, bool, error) {
+	order, err := s.orders.Order(ctx, id)
+	if errors.Is(err, payments.ErrNotFound) {
+		return payments.Order{}, false, nil
+	}
+	if err != nil {
+		return payments.Order{}, false, fmt.Errorf("load order %s: %w", id, err)
+	}
+	if order.Status != payments.OrderStatusOpen {
+		return order, false, nil
+	}
+
+	if s.inventory != nil && order.ReservationID != "" {
+		if err := s.inventory.Release(ctx, order.ReservationID); err != nil && !errors.Is(err, payments.ErrNotFound) {
+			return payments.Order{}, false, fmt.Errorf("release stock for order %s: %w", id, err)
+		}
+	}
+	if s.coupons != nil && order.RedemptionID != "" {
+		if err := s.coupons.Release(ctx, order.RedemptionID); err != nil && !errors.Is(err, payments.ErrNotFound) {
+			return payments.Order{}, false, fmt.Errorf("release promotion code for order %s: %w", id, err)
+		}
+	}
+
+	order.Status = status
+	s.record(&order, string(status), "")
+	if email != "" {
+		order.CustomerEmail = email
+	}
+	if err := s.orders.SaveOrder(ctx, order); err != nil {
+		return payments.Order{}, false, err
+	}
+	return order, true, nil
+}
+
+// commitHolds turns the stock and promotion code held for a paid order into
+// a sale.
+func (s *CheckoutService) commitHolds(ctx context.Context, order payments.Order) error {
+	if s.inventory != nil && order.ReservationID != "" {
+		if err := s.inventory.Commit(ctx, order.ReservationID, order.SKU, order.Quantity); err != nil {
+			return fmt.Errorf("commit stock for order %s: %w", order.ID, err)
+		}
+	}
+	if s.coupons != nil && order.RedemptionID != "" {
+		if err := s.coupons.Commit(ctx, order.RedemptionID, order.PromoCode); err != nil {
+			return fmt.Errorf("commit promotion code for order %s: %w", order.ID, err)
+		}
+	}
+	return nil
+}
+
+// applyTotals takes an order's total from what the provider charged, which
+// includes discounts and tax only the provider worked out: its promotion
+// codes and automatic tax.
+func applyTotals(order *payments.Order, totals payments.Totals) {
+	order.TotalCents = totals.AmountCents
+	order.DiscountCents = max(order.DiscountCents, totals.DiscountCents)
+	if order.Tax != nil && order.Tax.Automatic {
+		tax := *order.Tax
+		tax.TaxCents = totals.TaxCents
+		tax.GrossCents = totals.AmountCents - order.ShippingCents
+		tax.NetCents = tax.GrossCents - tax.TaxCents
+		order.Tax = &tax
+	}
+}
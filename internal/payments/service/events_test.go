@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+func TestHandleEvent_CompletesOrder(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen, TotalCents: 2000}}}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders))
+
+	address := &payments.Address{Line1: "1 Rue de Rivoli", City: "Paris", PostalCode: "75001", Country: "FR"}
+	err := svc.HandleEvent(context.Background(), payments.Event{
+		Type:            payments.EventCheckoutCompleted,
+		SessionID:       "cs_1",
+		Paid:            true,
+		CustomerEmail:   "buyer@example.com",
+		ShippingAddress: address,
+		ShippingRate:    "Standard",
+		ShippingCents:   500,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	order, _ := orders.Order(context.Background(), "cs_1")
+	if order.Status != payments.OrderStatusPaid || order.PaidAt.IsZero() {
+		t.Fatalf("expected paid order, got %#v", order)
+	}
+	if order.ShippingAddress == nil || order.ShippingAddress.City != "Paris" {
+		t.Fatalf("expected shipping address, got %#v", order.ShippingAddress)
+	}
+	if order.ShippingCents != 500 || order.TotalCents != 2500 {
+		t.Fatalf("expected shipping to be added to total, got %#v", order)
+	}
+	if order.CustomerEmail != "buyer@example.com" {
+		t.Fatalf("unexpected email: %q", order.CustomerEmail)
+	}
+}
+
+func TestHandleEvent_TakesTotalsFromProvider(t *testing.T) {
+	tax := &payments.TaxBreakdown{Automatic: true, Country: "FR", NetCents: 2000, GrossCents: 2000}
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen, SubtotalCents: 2000, TotalCents: 2000, Tax: tax}}}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders))
+
+	err := svc.HandleEvent(context.Background(), payments.Event{
+		Type:          payments.EventCheckoutCompleted,
+		SessionID:     "cs_1",
+		Paid:          true,
+		ShippingRate:  "Standard",
+		ShippingCents: 500,
+		Totals:        &payments.Totals{AmountCents: 2660, DiscountCents: 200, TaxCents: 360},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	order, _ := orders.Order(context.Background(), "cs_1")
+	if order.TotalCents != 2660 || order.DiscountCents != 200 {
+		t.Fatalf("expected the charged total and discount, got %#v", order)
+	}
+	if order.Tax.TaxCents != 360 || order.Tax.GrossCents != 2160 || order.Tax.NetCents != 1800 {
+		t.Fatalf("expected the provider's tax recorded, got %#v", order.Tax)
+	}
+	if tax.TaxCents != 0 {
+		t.Fatal("expected the stored breakdown not to be modified in place")
+	}
+}
+
+func TestHandleEvent_IgnoresUnknownSession(t *testing.T) {
+	orders := &fakeOrders{}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders))
+
+	err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventCheckoutCompleted, SessionID: "cs_missing"})
+	if err != nil {
+		t.Fatalf("expected unknown session to be ignored, got %v", err)
+	}
+	if len(orders.saved) != 0 {
+		t.Fatalf("expected no order writes, got %d", len(orders.saved))
+	}
+}
+
+func TestHandleEvent_CommitsReservationWhenPaid(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen, ReservationID: "res_1"}}}
+	inv := &fakeInventory{}
+	svc := NewCheckoutService(&fakeDriver{}, WithInventory(inv), WithOrders(orders))
+
+	if err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventCheckoutCompleted, SessionID: "cs_1", Paid: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(inv.committed) != 1 || inv.committed[0] != "res_1" {
+		t.Fatalf("expected reservation to be committed, got %v", inv.committed)
+	}
+
+	// Stripe may deliver the same event twice; the reservation must not be committed again.
+	if err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventCheckoutCompleted, SessionID: "cs_1", Paid: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(inv.committed) != 1 {
+		t.Fatalf("expected a single commit, got %v", inv.committed)
+	}
+}
+
+func TestHandleEvent_ReleasesReservationOnExpiry(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen, ReservationID: "res_1"}}}
+	inv := &fakeInventory{}
+	svc := NewCheckoutService(&fakeDriver{}, WithInventory(inv), WithOrders(orders))
+
+	if err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventCheckoutExpired, SessionID: "cs_1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(inv.released) != 1 || inv.released[0] != "res_1" {
+		t.Fatalf("expected reservation to be released, got %v", inv.released)
+	}
+	order, _ := orders.Order(context.Background(), "cs_1")
+	if order.Status != payments.OrderStatusExpired {
+		t.Fatalf("expected expired order, got %s", order.Status)
+	}
+}
+
+func TestCancelOwnSession_NeedsCancelToken(t *testing.T) {
+	drv := &fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_1"}}
+	orders := &fakeOrders{}
+	svc := NewCheckoutService(drv, WithOrders(orders))
+	ctx := context.Background()
+
+	session, err := svc.CreateSession(ctx, payments.CheckoutSessionRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session.CancelToken == "" {
+		t.Fatal("expected the session to come with a cancel token")
+	}
+	if err := svc.CancelOwnSession(ctx, "cs_1", "guessed"); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected a wrong token to be refused, got %v", err)
+	}
+	if err := svc.CancelOwnSession(ctx, "cs_1", session.CancelToken); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(drv.expired) != 1 {
+		t.Fatalf("expected the session expired once, got %v", drv.expired)
+	}
+}
+
+func TestCancelSession(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen, ReservationID: "res_1"}}}
+	inv := &fakeInventory{}
+	drv := &fakeDriver{}
+	svc := NewCheckoutService(drv, WithInventory(inv), WithOrders(orders))
+
+	if err := svc.CancelSession(context.Background(), "cs_1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(drv.expired) != 1 || drv.expired[0] != "cs_1" {
+		t.Fatalf("expected session to be expired at the provider, got %v", drv.expired)
+	}
+	if len(inv.released) != 1 {
+		t.Fatalf("expected reservation to be released, got %v", inv.released)
+	}
+	order, _ := orders.Order(context.Background(), "cs_1")
+	if order.Status != payments.OrderStatusCanceled {
+		t.Fatalf("expected canceled order, got %s", order.Status)
+	}
+
+	if err := svc.CancelSession(context.Background(), "cs_1"); !errors.Is(err, payments.ErrOrderNotOpen) {
+		t.Fatalf("expected ErrOrderNotOpen on second cancel, got %v", err)
+	}
+}
+
+type fakeNotifier struct {
+	paid     []string
+	refunds  []int64
+	renewals []string
+	err      error
+}
+
+func (f *fakeNotifier) OrderPaid(ctx context.Context, order payments.Order) error {
+	f.paid = append(f.paid, order.ID)
+	return f.err
+}
+
+func (f *fakeNotifier) RefundIssued(ctx context.Context, order payments.Order, amountCents int64) error {
+	f.refunds = append(f.refunds, amountCents)
+	return f.err
+}
+
+func (f *fakeNotifier) RenewalFailed(ctx context.Context, event payments.Event) error {
+	f.renewals = append(f.renewals, event.SubscriptionID)
+	return f.err
+}
+
+func TestHandleEvent_NotifiesOncePerPayment(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen}}}
+	notifier := &fakeNotifier{err: errors.New("smtp down")}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithNotifier(notifier))
+
+	event := payments.Event{Type: payments.EventCheckoutCompleted, SessionID: "cs_1", Paid: true}
+	for range 2 {
+		if err := svc.HandleEvent(context.Background(), event); err != nil {
+			t.Fatalf("notification failures must not fail the webhook, got %v", err)
+		}
+	}
+	if len(notifier.paid) != 1 || notifier.paid[0] != "cs_1" {
+		t.Fatalf("expected a single receipt, got %v", notifier.paid)
+	}
+}
+
+func TestHandleEvent_RecordsRefunds(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusPaid, PaymentIntentID: "pi_1", TotalCents: 5000}}}
+	notifier := &fakeNotifier{}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithNotifier(notifier))
+
+	// Stripe reports the cumulative refunded amount on each charge.refunded event.
+	for _, amount := range []int64{2000, 5000} {
+		err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventRefundIssued, PaymentIntentID: "pi_1", AmountCents: amount})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	order, _ := orders.Order(context.Background(), "cs_1")
+	if order.RefundedCents != 5000 || order.Status != payments.OrderStatusRefunded {
+		t.Fatalf("expected fully refunded order, got %#v", order)
+	}
+	if len(notifier.refunds) != 2 || notifier.refunds[0] != 2000 || notifier.refunds[1] != 3000 {
+		t.Fatalf("expected refund deltas to be notified, got %v", notifier.refunds)
+	}
+}
+
+func TestHandleEvent_NotifiesFailedRenewal(t *testing.T) {
+	notifier := &fakeNotifier{}
+	svc := NewCheckoutService(&fakeDriver{}, WithNotifier(notifier))
+
+	err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventRenewalFailed, SubscriptionID: "sub_1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(notifier.renewals) != 1 || notifier.renewals[0] != "sub_1" {
+		t.Fatalf("expected renewal failure notification, got %v", notifier.renewals)
+	}
+}
+
+type fakeCompleter struct {
+	fakeDriver
+	event     payments.Event
+	completed int
+}
+
+func (f *fakeCompleter) CompleteSession(ctx context.Context, id string) (payments.Event, error) {
+	f.completed++
+	return f.event, f.err
+}
+
+func TestCompleteSession(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "PP-1", Status: payments.OrderStatusOpen, TotalCents: 2500, Currency: "eur", Provider: "paypal"}}}
+	drv := &fakeCompleter{event: payments.Event{Type: payments.EventCheckoutCompleted, SessionID: "PP-1", PaymentIntentID: "CAP-1", Paid: true, CustomerEmail: "ada@example.com"}}
+	notifier := &fakeNotifier{}
+	svc := NewCheckoutService(drv, WithOrders(orders), WithNotifier(notifier))
+
+	order, err := svc.CompleteSession(context.Background(), "PP-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order.Status != payments.OrderStatusPaid || order.PaymentIntentID != "CAP-1" || order.CustomerEmail != "ada@example.com" {
+		t.Fatalf("expected paid order, got %#v", order)
+	}
+
+	// Reloading the return page must not capture or notify again.
+	if _, err := svc.CompleteSession(context.Background(), "PP-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if drv.completed != 1 || len(notifier.paid) != 1 {
+		t.Fatalf("expected one capture and one receipt, got %d and %v", drv.completed, notifier.paid)
+	}
+}
+
+func TestCompleteSession_RejectsClosedOrders(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "PP-1", Status: payments.OrderStatusCanceled}}}
+	drv := &fakeCompleter{}
+	svc := NewCheckoutService(drv, WithOrders(orders))
+
+	if _, err := svc.CompleteSession(context.Background(), "PP-1"); !errors.Is(err, payments.ErrOrderNotOpen) || drv.completed != 0 {
+		t.Fatalf("expected a canceled order to stay uncaptured, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// PaymentIntentDriver creates payments that buyers confirm on payit's own
+// payment form instead of a provider-hosted checkout page.
+type PaymentIntentDriver interface {
+	CreatePaymentIntent(ctx context.Context, req payments.CheckoutSessionRequest) (payments.PaymentIntent, error)
+	PaymentIntent(ctx context.Context, id string) (payments.PaymentIntent, error)
+	CancelPaymentIntent(ctx context.Context, id string) error
+}
+
+// WithPaymentIntents lets buyers pay on a custom payment form backed by
+// intents. Like a hosted checkout session, a payment left unconfirmed for ttl
+// is canceled by ExpirePaymentIntents.
+func WithPaymentIntents(intents PaymentIntentDriver, ttl time.Duration) Option {
+	return func(s *CheckoutService) {
+		s.intents = intents
+		s.intentTTL = ttl
+	}
+}
+
+// CreatePaymentIntent prices the cart as CreateSession does and opens a
+// payment for the total that the buyer confirms on a custom form. The form
+// cannot collect shipping or have the provider compute tax, so checkouts
+// needing either are rejected.
+func (s *CheckoutService) CreatePaymentIntent(ctx context.Context, req payments.CheckoutSessionRequest) (_ payments.PaymentIntent, err error) {
+	if s.intents == nil {
+		return payments.PaymentIntent{}, fmt.Errorf("%w: payment intents are not enabled", payments.ErrUnsupportedCheckout)
+	}
+	req, order, err := s.newOrder(ctx, req, "")
+	if err != nil {
+		return payments.PaymentIntent{}, err
+	}
+	defer func() {
+		if err != nil {
+			s.releaseHolds(ctx, order)
+		}
+	}()
+
+	switch {
+	case req.Subscription != nil:
+		return payments.PaymentIntent{}, fmt.Errorf("%w: subscriptions need hosted checkout", payments.ErrUnsupportedCheckout)
+	case req.Shipping != nil:
+		return payments.PaymentIntent{}, fmt.Errorf("%w: shipping needs hosted checkout", payments.ErrUnsupportedCheckout)
+	case req.Tax != nil && req.Tax.Automatic:
+		return payments.PaymentIntent{}, fmt.Errorf("%w: automatic tax needs hosted checkout", payments.ErrUnsupportedCheckout)
+	}
+
+	intent, err := s.intents.CreatePaymentIntent(ctx, req)
+	if err != nil {
+		return payments.PaymentIntent{}, err
+	}
+	defer func() {
+		if err != nil {
+			// The buyer must not pay for an order payit kept no record of.
+			_ = s.intents.CancelPaymentIntent(context.WithoutCancel(ctx), intent.ID)
+		}
+	}()
+	if err := s.keepCustomer(ctx, req.Customer); err != nil {
+		return payments.PaymentIntent{}, err
+	}
+
+	if s.orders != nil {
+		order.ID = intent.ID
+		order.PaymentIntentID = intent.ID
+		order.Provider = intent.Provider
+		order.ExpiresAt = s.now().Add(s.intentTTL).UTC()
+		order.CancelToken = rand.Text()
+		if err := s.orders.SaveOrder(ctx, order); err != nil {
+			return payments.PaymentIntent{}, err
+		}
+		intent.CancelToken = order.CancelToken
+		intent.ExpiresAt = order.ExpiresAt
+	}
+	return intent, nil
+}
+
+// RunIntentExpiry expires lapsed payment intents every interval until ctx is
+// done.
+func (s *CheckoutService) RunIntentExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.ExpirePaymentIntents(ctx); err != nil {
+				log.Printf("expire payment intents: %v", err)
+			}
+		}
+	}
+}
+
+// ExpirePaymentIntents closes intent-backed orders left open past their
+// expiry the way an expired checkout session is closed: the intent is
+// canceled at the provider, the held stock and promotion code are released
+// and the buyer is sent a recovery link. A payment that went through without
+// its notification arriving completes the order instead.
+func (s *CheckoutService) ExpirePaymentIntents(ctx context.Context) error {
+	if s.intents == nil || s.orders == nil {
+		return nil
+	}
+	orders, err := s.orders.Orders(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	now := s.now()
+	for _, order := range orders {
+		if order.Status != payments.OrderStatusOpen || !paidByIntent(order) || order.ExpiresAt.IsZero() || now.Before(order.ExpiresAt) {
+			continue
+		}
+		if err := s.expirePaymentIntent(ctx, order); err != nil {
+			errs = append(errs, fmt.Errorf("order %s: %w", order.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *CheckoutService) expirePaymentIntent(ctx context.Context, order payments.Order) error {
+	intent, err := s.intents.PaymentIntent(ctx, order.ID)
+	if err != nil {
+		return fmt.Errorf("load payment intent: %w", err)
+	}
+	switch intent.Status {
+	case payments.PaymentIntentSucceeded, payments.PaymentIntentRequiresCapture:
+		return s.completeOrder(ctx, payments.Event{
+			Type:            payments.EventCheckoutCompleted,
+			SessionID:       intent.ID,
+			PaymentIntentID: intent.ID,
+			Paid:            intent.Status == payments.PaymentIntentSucceeded,
+			CustomerEmail:   intent.CustomerEmail,
+		})
+	case payments.PaymentIntentCanceled:
+	default:
+		if err := s.intents.CancelPaymentIntent(ctx, order.ID); err != nil {
+			return fmt.Errorf("cancel payment intent: %w", err)
+		}
+	}
+
+	expired, closed, err := s.closeOrder(ctx, order.ID, payments.OrderStatusExpired, intent.CustomerEmail)
+	if err != nil || !closed {
+		return err
+	}
+	return s.queueRecovery(ctx, expired)
+}
+
+// PaymentIntentStatus reports where the payment for an intent-backed order
+// stands. Once the provider has taken or authorized the payment the order is
+// completed right away, so the buyer does not wait on the webhook.
+func (s *CheckoutService) PaymentIntentStatus(ctx context.Context, id string) (payments.PaymentIntent, error) {
+	if s.intents == nil || s.orders == nil {
+		return payments.PaymentIntent{}, payments.ErrNotFound
+	}
+	order, err := s.orders.Order(ctx, id)
+	if err != nil {
+		return payments.PaymentIntent{}, err
+	}
+	if !paidByIntent(order) {
+		return payments.PaymentIntent{}, fmt.Errorf("%w: order %s has no payment intent", payments.ErrNotFound, id)
+	}
+
+	intent, err := s.intents.PaymentIntent(ctx, id)
+	if err != nil {
+		return payments.PaymentIntent{}, fmt.Errorf("payment intent %s: %w", id, err)
+	}
+	switch intent.Status {
+	case payments.PaymentIntentSucceeded, payments.PaymentIntentRequiresCapture:
+		err := s.completeOrder(ctx, payments.Event{
+			Type:            payments.EventCheckoutCompleted,
+			SessionID:       intent.ID,
+			PaymentIntentID: intent.ID,
+			Paid:            intent.Status == payments.PaymentIntentSucceeded,
+			CustomerEmail:   intent.CustomerEmail,
+		})
+		if err != nil {
+			return payments.PaymentIntent{}, err
+		}
+	}
+	return intent, nil
+}
+
+// paidByIntent reports whether order was opened by CreatePaymentIntent; those
+// orders are keyed by the intent itself rather than a checkout session.
+func paidByIntent(order payments.Order) bool {
+	return order.PaymentIntentID != "" && order.ID == order.PaymentIntentID
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+type fakeIntents struct {
+	lastReq  payments.CheckoutSessionRequest
+	intent   payments.PaymentIntent
+	canceled []string
+}
+
+func (f *fakeIntents) CreatePaymentIntent(ctx context.Context, req payments.CheckoutSessionRequest) (payments.PaymentIntent, error) {
+	f.lastReq = req
+	return f.intent, nil
+}
+
+func (f *fakeIntents) PaymentIntent(ctx context.Context, id string) (payments.PaymentIntent, error) {
+	return f.intent, nil
+}
+
+func (f *fakeIntents) CancelPaymentIntent(ctx context.Context, id string) error {
+	f.canceled = append(f.canceled, id)
+	return nil
+}
+
+func TestCreatePaymentIntent_RecordsOrder(t *testing.T) {
+	intents := &fakeIntents{intent: payments.PaymentIntent{ID: "pi_1", ClientSecret: "pi_1_secret", Provider: "stripe"}}
+	orders := &fakeOrders{}
+	svc := NewCheckoutService(&fakeDriver{},
+		WithProduct(config.ProductConfig{PriceCents: 2000, Currency: "eur"}),
+		WithCoupons(&fakeCoupons{discount: payments.Discount{Code: "TEN", UnitAmountOffCents: 200}}),
+		WithOrders(orders),
+		WithPaymentIntents(intents, time.Hour),
+	)
+
+	intent, err := svc.CreatePaymentIntent(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: 2, PromoCode: "TEN"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if intent.ClientSecret != "pi_1_secret" {
+		t.Fatalf("expected the client secret to be returned, got %#v", intent)
+	}
+	if intents.lastReq.AmountCents != 3600 || intents.lastReq.Currency != "eur" {
+		t.Fatalf("expected the discounted total to reach the driver, got %#v", intents.lastReq)
+	}
+
+	order, err := orders.Order(context.Background(), "pi_1")
+	if err != nil {
+		t.Fatalf("expected an order keyed by the intent: %v", err)
+	}
+	if order.Status != payments.OrderStatusOpen || order.PaymentIntentID != "pi_1" || order.Provider != "stripe" || order.TotalCents != 3600 {
+		t.Fatalf("unexpected order: %#v", order)
+	}
+}
+
+func TestCreatePaymentIntent_CancelsIntentWhenOrderIsNotSaved(t *testing.T) {
+	intents := &fakeIntents{intent: payments.PaymentIntent{ID: "pi_1", Provider: "stripe"}}
+	svc := NewCheckoutService(&fakeDriver{},
+		WithProduct(config.ProductConfig{PriceCents: 2000, Currency: "eur"}),
+		WithOrders(&fakeOrders{err: errors.New("disk full")}),
+		WithPaymentIntents(intents, time.Hour),
+	)
+
+	if _, err := svc.CreatePaymentIntent(context.Background(), payments.CheckoutSessionRequest{}); err == nil {
+		t.Fatal("expected the save error")
+	}
+	if len(intents.canceled) != 1 || intents.canceled[0] != "pi_1" {
+		t.Fatalf("expected the intent to be canceled, got %v", intents.canceled)
+	}
+}
+
+func TestCreatePaymentIntent_RejectsShipping(t *testing.T) {
+	inv := &fakeInventory{}
+	quote := &payments.Shipping{Options: []payments.ShippingOption{{Name: "Standard", AmountCents: 500}}}
+	svc := NewCheckoutService(&fakeDriver{},
+		WithShipping(&fakeShipping{quote: quote}),
+		WithInventory(inv),
+		WithPaymentIntents(&fakeIntents{}, time.Hour),
+	)
+
+	_, err := svc.CreatePaymentIntent(context.Background(), payments.CheckoutSessionRequest{})
+	if !errors.Is(err, payments.ErrUnsupportedCheckout) {
+		t.Fatalf("expected ErrUnsupportedCheckout, got %v", err)
+	}
+	if len(inv.released) != 1 {
+		t.Fatalf("expected the reservation to be released, got %v", inv.released)
+	}
+}
+
+func TestCreatePaymentIntent_RejectsSubscriptions(t *testing.T) {
+	intents := &fakeIntents{}
+	svc := NewCheckoutService(&fakeDriver{}, WithPlans(testPlans), WithPaymentIntents(intents, time.Hour))
+
+	_, err := svc.CreatePaymentIntent(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Plan: "api_requests"}})
+	if !errors.Is(err, payments.ErrUnsupportedCheckout) || !strings.Contains(err.Error(), "subscriptions") {
+		t.Fatalf("expected ErrUnsupportedCheckout, got %v", err)
+	}
+	if intents.lastReq.Subscription != nil {
+		t.Fatal("expected no intent to be created for a subscription")
+	}
+}
+
+func TestPaymentIntentStatus_CompletesSucceededOrders(t *testing.T) {
+	intents := &fakeIntents{intent: payments.PaymentIntent{ID: "pi_1", Status: payments.PaymentIntentRequiresAction}}
+	orders := &fakeOrders{saved: []payments.Order{{ID: "pi_1", PaymentIntentID: "pi_1", Status: payments.OrderStatusOpen, TotalCents: 2000}}}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithPaymentIntents(intents, time.Hour))
+
+	intent, err := svc.PaymentIntentStatus(context.Background(), "pi_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if intent.Status != payments.PaymentIntentRequiresAction {
+		t.Fatalf("unexpected status: %q", intent.Status)
+	}
+	if order, _ := orders.Order(context.Background(), "pi_1"); order.Status != payments.OrderStatusOpen {
+		t.Fatalf("expected order to stay open while 3-D Secure is pending, got %q", order.Status)
+	}
+
+	intents.intent.Status = payments.PaymentIntentSucceeded
+	intents.intent.CustomerEmail = "buyer@example.com"
+	if _, err := svc.PaymentIntentStatus(context.Background(), "pi_1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	order, _ := orders.Order(context.Background(), "pi_1")
+	if order.Status != payments.OrderStatusPaid || order.CustomerEmail != "buyer@example.com" {
+		t.Fatalf("expected a paid order, got %#v", order)
+	}
+}
+
+func TestPaymentIntentStatus_IgnoresCheckoutSessions(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", PaymentIntentID: "pi_1", Status: payments.OrderStatusPaid}}}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithPaymentIntents(&fakeIntents{}, time.Hour))
+
+	if _, err := svc.PaymentIntentStatus(context.Background(), "cs_1"); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCancelSession_CancelsPaymentIntent(t *testing.T) {
+	drv := &fakeDriver{}
+	intents := &fakeIntents{}
+	orders := &fakeOrders{saved: []payments.Order{{ID: "pi_1", PaymentIntentID: "pi_1", Status: payments.OrderStatusOpen}}}
+	svc := NewCheckoutService(drv, WithOrders(orders), WithPaymentIntents(intents, time.Hour))
+
+	if err := svc.CancelSession(context.Background(), "pi_1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(intents.canceled) != 1 || len(drv.expired) != 0 {
+		t.Fatalf("expected the intent to be canceled rather than a session expired, got %v %v", intents.canceled, drv.expired)
+	}
+}
+
+func TestExpirePaymentIntents_CancelsLapsedOrders(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	intents := &fakeIntents{intent: payments.PaymentIntent{ID: "pi_1", Status: payments.PaymentIntentRequiresAction}}
+	orders := &fakeOrders{saved: []payments.Order{
+		{ID: "pi_1", PaymentIntentID: "pi_1", Status: payments.OrderStatusOpen, CustomerEmail: "buyer@example.com", ExpiresAt: now.Add(-time.Minute)},
+		{ID: "pi_2", PaymentIntentID: "pi_2", Status: payments.OrderStatusOpen, ExpiresAt: now.Add(time.Minute)},
+	}}
+	queue := &fakeRecoveryQueue{}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithPaymentIntents(intents, time.Hour), WithRecovery(queue, "https://shop.example"))
+	svc.now = func() time.Time { return now }
+
+	if err := svc.ExpirePaymentIntents(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(intents.canceled) != 1 || intents.canceled[0] != "pi_1" {
+		t.Fatalf("expected only the lapsed intent to be canceled, got %v", intents.canceled)
+	}
+	if order, _ := orders.Order(context.Background(), "pi_1"); order.Status != payments.OrderStatusExpired {
+		t.Fatalf("expected the lapsed order to expire, got %q", order.Status)
+	}
+	if order, _ := orders.Order(context.Background(), "pi_2"); order.Status != payments.OrderStatusOpen {
+		t.Fatalf("expected the current order to stay open, got %q", order.Status)
+	}
+	if len(queue.notices) != 1 || queue.notices[0].OrderID != "pi_1" {
+		t.Fatalf("expected a recovery notice for the lapsed order, got %#v", queue.notices)
+	}
+}
+
+func TestExpirePaymentIntents_CompletesPaidOrders(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	intents := &fakeIntents{intent: payments.PaymentIntent{ID: "pi_1", Status: payments.PaymentIntentSucceeded}}
+	orders := &fakeOrders{saved: []payments.Order{{ID: "pi_1", PaymentIntentID: "pi_1", Status: payments.OrderStatusOpen, ExpiresAt: now.Add(-time.Minute)}}}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithPaymentIntents(intents, time.Hour))
+	svc.now = func() time.Time { return now }
+
+	if err := svc.ExpirePaymentIntents(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(intents.canceled) != 0 {
+		t.Fatalf("expected a paid intent not to be canceled, got %v", intents.canceled)
+	}
+	if order, _ := orders.Order(context.Background(), "pi_1"); order.Status != payments.OrderStatusPaid {
+		t.Fatalf("expected the order to complete, got %q", order.Status)
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+// OffSessionDriver charges payment methods customers saved at an earlier
+// checkout, without them on a payment page.
+type OffSessionDriver interface {
+	// PaymentMethods lists the cards saved on customer's provider customer.
+	PaymentMethods(ctx context.Context, customer payments.Customer) ([]payments.PaymentMethod, error)
+	// ChargeOffSession takes charge right away. It fails with
+	// payments.ErrAuthenticationRequired or payments.ErrCardDeclined when the
+	// customer has to pay on a checkout page instead.
+	ChargeOffSession(ctx context.Context, charge payments.OffSessionCharge) (payments.PaymentIntent, error)
+}
+
+// WithOffSessionPayments lets signed-in customers buy again with a card saved
+// on an earlier order, charged through d.
+func WithOffSessionPayments(d OffSessionDriver) Option {
+	return func(s *CheckoutService) {
+		s.offSession = d
+	}
+}
+
+// errNeedsCheckout reports a repurchase that cannot be charged to a saved
+// card, so the customer is sent to checkout.
+var errNeedsCheckout = errors.New("repurchase needs checkout")
+
+// SavedPaymentMethods lists the unexpired cards the customer with email can
+// buy again with.
+func (s *CheckoutService) SavedPaymentMethods(ctx context.Context, email string) ([]payments.PaymentMethod, error) {
+	if s.offSession == nil || s.customers == nil {
+		return nil, nil
+	}
+	customer, err := s.customers.CustomerByEmail(ctx, email)
+	if errors.Is(err, payments.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	methods, err := s.offSession.PaymentMethods(ctx, customer)
+	if err != nil {
+		return nil, fmt.Errorf("list payment methods for %s: %w", customer.ID, err)
+	}
+	now := s.now().UTC()
+	return slices.DeleteFunc(methods, func(m payments.PaymentMethod) bool {
+		return m.ExpYear < int64(now.Year()) || m.ExpYear == int64(now.Year()) && m.ExpMonth < int64(now.Month())
+	}), nil
+}
+
+// Repurchase buys a previous order of the customer with email again, at
+// today's price. The customer's saved card is charged straight away when
+// possible. Otherwise, and whenever their bank wants them to authenticate
+// the payment or declines the card, a checkout is opened for them to finish
+// paying. Repeating a call with the same idempotencyKey does not charge the
+// card twice.
+func (s *CheckoutService) Repurchase(ctx context.Context, email, orderID, idempotencyKey string) (payments.Repurchase, error) {
+	prior, err := s.CustomerOrder(ctx, email, orderID)
+	if err != nil {
+		return payments.Repurchase{}, err
+	}
+	req := payments.CheckoutSessionRequest{
+		CheckoutSessionRequest: payit.CheckoutSessionRequest{
+			Quantity:      prior.Quantity,
+			CustomerEmail: prior.CustomerEmail,
+			Metadata:      map[string]string{"repurchase_of": prior.ID},
+		},
+		SavePaymentMethod: true,
+		EmailVerified:     true,
+	}
+	if prior.Tax != nil {
+		req.Country, req.Region, req.TaxID = prior.Tax.Country, prior.Tax.Region, prior.Tax.TaxID
+	}
+
+	order, err := s.chargeSavedCard(ctx, req, prior, idempotencyKey)
+	switch {
+	case err == nil:
+		return payments.Repurchase{Order: &order}, nil
+	case !errors.Is(err, errNeedsCheckout) && !errors.Is(err, payments.ErrAuthenticationRequired) &&
+		!errors.Is(err, payments.ErrCardDeclined):
+		return payments.Repurchase{}, err
+	}
+
+	session, err := s.createSession(ctx, req, "")
+	if err != nil {
+		return payments.Repurchase{}, err
+	}
+	return payments.Repurchase{Checkout: &session}, nil
+}
+
+// chargeSavedCard prices req as a new order and charges it to the
+// customer's first saved card, shipping to where prior went. It fails with
+// errNeedsCheckout when the order can only be paid at checkout.
+func (s *CheckoutService) chargeSavedCard(ctx context.Context, req payments.CheckoutSessionRequest, prior payments.Order, idempotencyKey string) (_ payments.Order, err error) {
+	if s.offSession == nil || s.orders == nil {
+		return payments.Order{}, errNeedsCheckout
+	}
+	req, order, err := s.newOrder(ctx, req, "")
+	if err != nil {
+		return payments.Order{}, err
+	}
+	// Once the order is saved its stock belongs to the payment taken for it.
+	saved := false
+	defer func() {
+		if err != nil && !saved {
+			s.releaseHolds(ctx, order)
+		}
+	}()
+
+	switch {
+	case req.Customer == nil:
+		return payments.Order{}, fmt.Errorf("%w: no customer record", errNeedsCheckout)
+	case req.Tax != nil && req.Tax.Automatic:
+		return payments.Order{}, fmt.Errorf("%w: automatic tax", errNeedsCheckout)
+	}
+	methods, err := s.SavedPaymentMethods(ctx, req.CustomerEmail)
+	if err != nil {
+		return payments.Order{}, err
+	}
+	if len(methods) == 0 {
+		return payments.Order{}, fmt.Errorf("%w: no saved card", errNeedsCheckout)
+	}
+	card := methods[0]
+
+	charge := payments.OffSessionCharge{
+		Customer:        *req.Customer,
+		PaymentMethodID: card.ID,
+		Quantity:        req.Quantity,
+		AmountCents:     req.AmountCents,
+		Currency:        req.Currency,
+		Metadata:        req.Metadata,
+		IdempotencyKey:  idempotencyKey,
+	}
+	if req.Shipping != nil {
+		option, ok := repeatShipping(req.Shipping, prior)
+		if !ok {
+			return payments.Order{}, fmt.Errorf("%w: shipping changed", errNeedsCheckout)
+		}
+		charge.ShippingAddress = prior.ShippingAddress
+		charge.AmountCents += option.AmountCents
+		order.ShippingAddress = prior.ShippingAddress
+		order.ShippingRate = option.Name
+		order.ShippingCents = option.AmountCents
+		order.TotalCents += option.AmountCents
+	}
+
+	intent, err := s.offSession.ChargeOffSession(ctx, charge)
+	if err != nil {
+		return payments.Order{}, err
+	}
+	// A repeated idempotency key hands back the payment already taken,
+	// whose order is on record.
+	if existing, err := s.orders.Order(ctx, intent.ID); err == nil {
+		s.releaseHolds(ctx, order)
+		return existing, nil
+	}
+
+	order.ID = intent.ID
+	order.PaymentIntentID = intent.ID
+	order.Provider = intent.Provider
+	s.record(&order, "charged saved card", card.Brand+" ending "+card.Last4)
+	if err := s.orders.SaveOrder(ctx, order); err != nil {
+		return payments.Order{}, err
+	}
+	saved = true
+
+	switch intent.Status {
+	case payments.PaymentIntentSucceeded, payments.PaymentIntentRequiresCapture:
+		err := s.completeOrder(ctx, payments.Event{
+			Type:            payments.EventCheckoutCompleted,
+			SessionID:       intent.ID,
+			PaymentIntentID: intent.ID,
+			Paid:            intent.Status == payments.PaymentIntentSucceeded,
+		})
+		if err != nil {
+			return payments.Order{}, err
+		}
+	}
+	return s.orders.Order(ctx, intent.ID)
+}
+
+// repeatShipping picks the rate prior shipped with from today's quote, if it
+// is still offered for prior's address.
+func repeatShipping(quote *payments.Shipping, prior payments.Order) (payments.ShippingOption, bool) {
+	addr := prior.ShippingAddress
+	if addr == nil || len(quote.AllowedCountries) > 0 && !slices.Contains(quote.AllowedCountries, addr.Country) {
+		return payments.ShippingOption{}, false
+	}
+	i := slices.IndexFunc(quote.Options, func(o payments.ShippingOption) bool { return o.Name == prior.ShippingRate })
+	if i < 0 {
+		return payments.ShippingOption{}, false
+	}
+	return quote.Options[i], true
+}
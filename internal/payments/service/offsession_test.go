@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeOffSession struct {
+	methods []payments.PaymentMethod
+	intent  payments.PaymentIntent
+	err     error
+	charges []payments.OffSessionCharge
+}
+
+func (f *fakeOffSession) PaymentMethods(ctx context.Context, customer payments.Customer) ([]payments.PaymentMethod, error) {
+	return f.methods, nil
+}
+
+func (f *fakeOffSession) ChargeOffSession(ctx context.Context, charge payments.OffSessionCharge) (payments.PaymentIntent, error) {
+	f.charges = append(f.charges, charge)
+	return f.intent, f.err
+}
+
+// newRepurchaseService sets up ada@example.com with a paid, shipped order
+// cs_1 and a linked Stripe customer.
+func newRepurchaseService(offSession *fakeOffSession, opts ...Option) (*CheckoutService, *fakeCustomerDriver, *fakeOrders, *fakeInventory) {
+	drv := &fakeCustomerDriver{fakeDriver: fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_2", URL: "https://checkout.example/cs_2"}}}
+	orders := &fakeOrders{saved: []payments.Order{{
+		ID:              "cs_1",
+		Status:          payments.OrderStatusPaid,
+		Quantity:        2,
+		CustomerEmail:   "ada@example.com",
+		CustomerID:      "cust_1",
+		ShippingAddress: &payments.Address{Line1: "1 Rue de Rivoli", City: "Paris", PostalCode: "75001", Country: "FR"},
+		ShippingRate:    "Standard",
+	}}}
+	customers := &fakeCustomers{byID: map[string]payments.Customer{
+		"cust_1": {ID: "cust_1", Email: "ada@example.com", ProviderIDs: map[string]string{"stripe": "cus_1"}},
+	}}
+	inventory := &fakeInventory{}
+	quote := &payments.Shipping{AllowedCountries: []string{"FR"}, Options: []payments.ShippingOption{{Name: "Standard", AmountCents: 500}}}
+	opts = append([]Option{
+		WithProduct(config.ProductConfig{SKU: "beans", PriceCents: 1000, Currency: "eur"}),
+		WithOrders(orders),
+		WithCustomers(customers),
+		WithInventory(inventory),
+		WithShipping(&fakeShipping{quote: quote}),
+		WithOffSessionPayments(offSession),
+	}, opts...)
+	return NewCheckoutService(drv, opts...), drv, orders, inventory
+}
+
+func TestCheckoutService_RepurchaseChargesSavedCard(t *testing.T) {
+	offSession := &fakeOffSession{
+		methods: []payments.PaymentMethod{
+			{ID: "pm_old", Brand: "visa", Last4: "0001", ExpMonth: 1, ExpYear: 2000},
+			{ID: "pm_1", Brand: "visa", Last4: "4242", ExpMonth: 12, ExpYear: 2099},
+		},
+		intent: payments.PaymentIntent{ID: "pi_1", Status: payments.PaymentIntentSucceeded, Provider: "stripe"},
+	}
+	svc, _, orders, inventory := newRepurchaseService(offSession)
+	ctx := context.Background()
+
+	result, err := svc.Repurchase(ctx, "ada@example.com", "cs_1", "click-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Checkout != nil || result.Order == nil {
+		t.Fatalf("expected the saved card to be charged, got %#v", result)
+	}
+	charge := offSession.charges[0]
+	if charge.PaymentMethodID != "pm_1" || charge.AmountCents != 2500 || charge.Customer.ProviderIDs["stripe"] != "cus_1" ||
+		charge.ShippingAddress.Country != "FR" || charge.IdempotencyKey != "click-1" {
+		t.Fatalf("unexpected charge: %#v", charge)
+	}
+	order := *result.Order
+	if order.ID != "pi_1" || order.Status != payments.OrderStatusPaid || order.TotalCents != 2500 ||
+		order.ShippingRate != "Standard" || order.Metadata["repurchase_of"] != "cs_1" {
+		t.Fatalf("unexpected order: %#v", order)
+	}
+	if len(inventory.committed) != 1 {
+		t.Fatalf("expected the stock to be committed, got %v", inventory.committed)
+	}
+
+	// A double-clicked button repeats the key and gets the same payment back.
+	saves := len(orders.saved)
+	again, err := svc.Repurchase(ctx, "ada@example.com", "cs_1", "click-1")
+	if err != nil || again.Order == nil || again.Order.Status != payments.OrderStatusPaid {
+		t.Fatalf("expected the first order back, got %#v, %v", again, err)
+	}
+	if len(orders.saved) != saves || len(inventory.released) != 1 {
+		t.Fatalf("expected no second order and the extra stock released, got %d saves, %v released", len(orders.saved)-saves, inventory.released)
+	}
+}
+
+func TestCheckoutService_RepurchaseFallsBackToCheckout(t *testing.T) {
+	offSession := &fakeOffSession{
+		methods: []payments.PaymentMethod{{ID: "pm_1", ExpMonth: 12, ExpYear: 2099}},
+		err:     payments.ErrAuthenticationRequired,
+	}
+	svc, drv, orders, inventory := newRepurchaseService(offSession)
+
+	result, err := svc.Repurchase(context.Background(), "ada@example.com", "cs_1", "click-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Order != nil || result.Checkout == nil || result.Checkout.URL != "https://checkout.example/cs_2" {
+		t.Fatalf("expected a checkout to finish paying in, got %#v", result)
+	}
+	if !drv.lastReq.SavePaymentMethod || drv.lastReq.Quantity != 2 || drv.lastReq.Customer == nil {
+		t.Fatalf("expected checkout for the same items on the customer, got %#v", drv.lastReq)
+	}
+	if len(inventory.released) != 1 {
+		t.Fatalf("expected the off-session reservation to be released, got %v", inventory.released)
+	}
+	if last := orders.saved[len(orders.saved)-1]; last.ID != "cs_2" || last.Status != payments.OrderStatusOpen {
+		t.Fatalf("expected an open checkout order, got %#v", last)
+	}
+}
+
+func TestCheckoutService_RepurchaseWithoutSavedCard(t *testing.T) {
+	offSession := &fakeOffSession{}
+	svc, _, _, _ := newRepurchaseService(offSession)
+	ctx := context.Background()
+
+	result, err := svc.Repurchase(ctx, "ada@example.com", "cs_1", "")
+	if err != nil || result.Checkout == nil {
+		t.Fatalf("expected checkout when no card is saved, got %#v, %v", result, err)
+	}
+	if len(offSession.charges) != 0 {
+		t.Fatalf("expected no charge, got %#v", offSession.charges)
+	}
+
+	if _, err := svc.Repurchase(ctx, "grace@example.com", "cs_1", ""); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected someone else's order to be refused, got %v", err)
+	}
+}
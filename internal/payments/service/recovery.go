@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+// RecoveryQueue collects recovery notices for abandoned checkouts until they
+// are delivered to the customer.
+type RecoveryQueue interface {
+	EnqueueRecovery(ctx context.Context, notice payments.RecoveryNotice) error
+}
+
+// WithRecovery queues a recovery link for every expired checkout where the
+// customer left an email address. publicURL is payit's externally reachable
+// base URL.
+func WithRecovery(queue RecoveryQueue, publicURL string) Option {
+	return func(s *CheckoutService) {
+		s.recovery = queue
+		s.publicURL = publicURL
+	}
+}
+
+// RecoverSession starts a fresh checkout with the same cart as an expired
+// order. The order is marked recovered, and recovering it again hands back
+// the same checkout while it can still be paid.
+func (s *CheckoutService) RecoverSession(ctx context.Context, orderID string) (payments.CheckoutSessionResult, error) {
+	if s.orders == nil {
+		return payments.CheckoutSessionResult{}, payments.ErrNotFound
+	}
+	s.recovering.Lock()
+	defer s.recovering.Unlock()
+
+	order, err := s.orders.Order(ctx, orderID)
+	if err != nil {
+		return payments.CheckoutSessionResult{}, err
+	}
+	if order.Status != payments.OrderStatusExpired {
+		return payments.CheckoutSessionResult{}, fmt.Errorf("%w: order %s is %s", payments.ErrNotRecoverable, orderID, order.Status)
+	}
+	if order.RecoveredBy != "" {
+		return s.recoveredSession(ctx, order)
+	}
+
+	req := payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: order.Quantity, PromoCode: order.PromoCode, CustomerEmail: order.CustomerEmail, Plan: order.Plan}}
+	if order.Tax != nil {
+		req.Country = order.Tax.Country
+		req.Region = order.Tax.Region
+		req.TaxID = order.Tax.TaxID
+	}
+
+	result, err := s.createSession(ctx, req, order.ID)
+	if err != nil {
+		return payments.CheckoutSessionResult{}, err
+	}
+	order.RecoveredBy = result.ID
+	s.record(&order, "recovered", result.ID)
+	if err := s.orders.SaveOrder(ctx, order); err != nil {
+		return payments.CheckoutSessionResult{}, err
+	}
+	return result, nil
+}
+
+// recoveredSession hands back the checkout already opened to recover order,
+// as long as it can still be paid.
+func (s *CheckoutService) recoveredSession(ctx context.Context, order payments.Order) (payments.CheckoutSessionResult, error) {
+	recovery, err := s.orders.Order(ctx, order.RecoveredBy)
+	if err != nil {
+		return payments.CheckoutSessionResult{}, fmt.Errorf("load recovery of order %s: %w", order.ID, err)
+	}
+	if recovery.Status != payments.OrderStatusOpen || !recovery.ExpiresAt.IsZero() && !s.now().Before(recovery.ExpiresAt) {
+		return payments.CheckoutSessionResult{}, fmt.Errorf("%w: order %s was recovered by %s, which is %s", payments.ErrNotRecoverable, order.ID, recovery.ID, recovery.Status)
+	}
+	return payments.CheckoutSessionResult{
+		ID:        recovery.ID,
+		URL:       recovery.CheckoutURL,
+		ExpiresAt: recovery.ExpiresAt,
+		Provider:  recovery.Provider,
+	}, nil
+}
+
+// AbandonmentReport summarises checkouts started since the given time.
+func (s *CheckoutService) AbandonmentReport(ctx context.Context, since time.Time) (payments.AbandonmentReport, error) {
+	report := payments.AbandonmentReport{Since: since}
+	if s.orders == nil {
+		return report, nil
+	}
+
+	orders, err := s.orders.Orders(ctx)
+	if err != nil {
+		return payments.AbandonmentReport{}, err
+	}
+
+	for _, o := range orders {
+		if o.CreatedAt.Before(since) {
+			continue
+		}
+		report.Sessions++
+		switch o.Status {
+		case payments.OrderStatusOpen:
+			report.Open++
+		case payments.OrderStatusExpired, payments.OrderStatusCanceled:
+			report.Abandoned++
+		case payments.OrderStatusFailed:
+			// The customer tried to pay, so the checkout was not abandoned.
+		default:
+			report.Paid++
+			if o.RecoveredFrom != "" {
+				report.Recovered++
+			}
+		}
+	}
+
+	if closed := report.Paid + report.Abandoned; closed > 0 {
+		report.AbandonmentRate = float64(report.Abandoned) / float64(closed)
+	}
+	if report.Abandoned > 0 {
+		report.RecoveryRate = float64(report.Recovered) / float64(report.Abandoned)
+	}
+
+	return report, nil
+}
+
+func (s *CheckoutService) queueRecovery(ctx context.Context, order payments.Order) error {
+	if s.recovery == nil || order.CustomerEmail == "" {
+		return nil
+	}
+
+	return s.recovery.EnqueueRecovery(ctx, payments.RecoveryNotice{
+		OrderID:   order.ID,
+		Email:     order.CustomerEmail,
+		URL:       s.publicURL + "/checkout/recover/" + url.PathEscape(order.ID),
+		CreatedAt: s.now().UTC(),
+	})
+}
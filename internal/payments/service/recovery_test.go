@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeRecoveryQueue struct {
+	notices []payments.RecoveryNotice
+}
+
+func (f *fakeRecoveryQueue) EnqueueRecovery(ctx context.Context, notice payments.RecoveryNotice) error {
+	f.notices = append(f.notices, notice)
+	return nil
+}
+
+func TestHandleEvent_QueuesRecoveryForExpiredCheckout(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen}}}
+	queue := &fakeRecoveryQueue{}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithRecovery(queue, "https://shop.example"))
+
+	err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventCheckoutExpired, SessionID: "cs_1", CustomerEmail: "lost@example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(queue.notices) != 1 {
+		t.Fatalf("expected one recovery notice, got %d", len(queue.notices))
+	}
+	notice := queue.notices[0]
+	if notice.Email != "lost@example.com" || notice.URL != "https://shop.example/checkout/recover/cs_1" {
+		t.Fatalf("unexpected notice: %#v", notice)
+	}
+}
+
+func TestHandleEvent_SkipsRecoveryWithoutEmail(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusOpen}}}
+	queue := &fakeRecoveryQueue{}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders), WithRecovery(queue, "https://shop.example"))
+
+	if err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventCheckoutExpired, SessionID: "cs_1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queue.notices) != 0 {
+		t.Fatalf("expected no recovery notice, got %d", len(queue.notices))
+	}
+}
+
+func TestRecoverSession(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{
+		ID:        "cs_old",
+		Status:    payments.OrderStatusExpired,
+		Quantity:  3,
+		PromoCode: "LAUNCH",
+		Tax:       &payments.TaxBreakdown{Country: "DE"},
+	}}}
+	drv := &fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_new", URL: "https://stripe.test/new"}}
+	coupons := &fakeCoupons{}
+	svc := NewCheckoutService(drv, WithCoupons(coupons), WithOrders(orders))
+
+	res, err := svc.RecoverSession(context.Background(), "cs_old")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res.ID != "cs_new" {
+		t.Fatalf("unexpected result: %#v", res)
+	}
+	if drv.lastReq.Quantity != 3 || drv.lastReq.Country != "DE" || coupons.code != "LAUNCH" {
+		t.Fatalf("expected cart to be restored, got %#v", drv.lastReq)
+	}
+	recovered, _ := orders.Order(context.Background(), "cs_new")
+	if recovered.RecoveredFrom != "cs_old" {
+		t.Fatalf("expected recovery link on new order, got %#v", recovered)
+	}
+	expired, _ := orders.Order(context.Background(), "cs_old")
+	if expired.RecoveredBy != "cs_new" || expired.Status != payments.OrderStatusExpired {
+		t.Fatalf("expected the expired order marked recovered, got %#v", expired)
+	}
+
+	// Following the link again goes back to the same checkout.
+	drv.result = payments.CheckoutSessionResult{ID: "cs_other", URL: "https://stripe.test/other"}
+	saves := len(orders.saved)
+	again, err := svc.RecoverSession(context.Background(), "cs_old")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again.ID != "cs_new" || again.URL != "https://stripe.test/new" || len(orders.saved) != saves {
+		t.Fatalf("expected the recovery checkout reused, got %#v and %d orders", again, len(orders.saved))
+	}
+
+	if err := svc.HandleEvent(context.Background(), payments.Event{Type: payments.EventCheckoutCompleted, SessionID: "cs_new", Paid: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.RecoverSession(context.Background(), "cs_old"); !errors.Is(err, payments.ErrNotRecoverable) {
+		t.Fatalf("expected a paid recovery to end the link, got %v", err)
+	}
+}
+
+func TestRecoverSessionRejectsPaidOrder(t *testing.T) {
+	orders := &fakeOrders{saved: []payments.Order{{ID: "cs_paid", Status: payments.OrderStatusPaid}}}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders))
+
+	if _, err := svc.RecoverSession(context.Background(), "cs_paid"); !errors.Is(err, payments.ErrNotRecoverable) {
+		t.Fatalf("expected ErrNotRecoverable, got %v", err)
+	}
+}
+
+func TestAbandonmentReport(t *testing.T) {
+	now := time.Now()
+	orders := &fakeOrders{saved: []payments.Order{
+		{ID: "a", Status: payments.OrderStatusPaid, CreatedAt: now},
+		{ID: "b", Status: payments.OrderStatusPaid, RecoveredFrom: "c", CreatedAt: now},
+		{ID: "c", Status: payments.OrderStatusExpired, CreatedAt: now},
+		{ID: "d", Status: payments.OrderStatusCanceled, CreatedAt: now},
+		{ID: "e", Status: payments.OrderStatusOpen, CreatedAt: now},
+		{ID: "old", Status: payments.OrderStatusExpired, CreatedAt: now.Add(-48 * time.Hour)},
+	}}
+	svc := NewCheckoutService(&fakeDriver{}, WithOrders(orders))
+
+	report, err := svc.AbandonmentReport(context.Background(), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Sessions != 5 || report.Paid != 2 || report.Abandoned != 2 || report.Open != 1 || report.Recovered != 1 {
+		t.Fatalf("unexpected counts: %#v", report)
+	}
+	if report.AbandonmentRate != 0.5 || report.RecoveryRate != 0.5 {
+		t.Fatalf("unexpected rates: %#v", report)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/validate"
+)
+
+// TrialNotifier is implemented by notifiers that follow free trials.
+type TrialNotifier interface {
+	// TrialEnding warns that sub's trial ends in daysLeft days.
+	TrialEnding(ctx context.Context, sub payments.Subscription, daysLeft int) error
+	// TrialEnded reports whether sub became a paying subscription when its
+	// trial ended.
+	TrialEnded(ctx context.Context, sub payments.Subscription, converted bool) error
+}
+
+// WithPlans lets buyers subscribe to prices at checkout by naming their meter.
+func WithPlans(prices []config.MeteredPriceConfig) Option {
+	return func(s *CheckoutService) {
+		s.plans = prices
+	}
+}
+
+// expiredTrialStatuses are the provider states of a subscription whose trial
+// ended without it being paid for.
+var expiredTrialStatuses = []string{"canceled", "incomplete_expired", "paused"}
+
+// newPlanOrder prices a subscription checkout for the plan req names. The
+// provider bills the subscription itself, so there is no stock, shipping,
+// tax or discount to work out and nothing is due up front.
+func (s *CheckoutService) newPlanOrder(ctx context.Context, req payments.CheckoutSessionRequest, recoveredFrom string) (payments.CheckoutSessionRequest, payments.Order, error) {
+	i := slices.IndexFunc(s.plans, func(p config.MeteredPriceConfig) bool { return p.Meter == req.Plan })
+	var v validate.Validator
+	v.Check(i >= 0, "plan", validate.CodeInvalid, "must be the meter of a metered price in the catalog")
+	v.Check(req.PromoCode == "", "promo_code", validate.CodeNotAllowed, "is not accepted on subscriptions")
+	v.Check(req.Quantity <= 1, "quantity", validate.CodeNotAllowed, "subscriptions are billed by usage")
+	if err := v.Err(); err != nil {
+		return req, payments.Order{}, err
+	}
+	plan := s.plans[i]
+
+	req.Quantity = 1
+	req.Discount, req.Tax, req.Shipping = nil, nil, nil
+	req.SavePaymentMethod = false
+	req.Subscription = &payments.SubscriptionPlan{
+		Meter:            plan.Meter,
+		StripePriceID:    plan.StripePriceID,
+		TrialDays:        plan.TrialDays,
+		TrialWithoutCard: plan.TrialWithoutCard,
+	}
+
+	order := payments.Order{
+		Status:        payments.OrderStatusOpen,
+		Plan:          plan.Meter,
+		Quantity:      1,
+		Currency:      plan.Currency,
+		CustomerEmail: req.CustomerEmail,
+		Metadata:      req.Metadata,
+		RecoveredFrom: recoveredFrom,
+		CreatedAt:     s.now().UTC(),
+	}
+	detail := ""
+	if plan.TrialDays > 0 {
+		detail = fmt.Sprintf("%d-day trial", plan.TrialDays)
+	}
+	s.record(&order, "created", detail)
+	if err := validate.Order(order, s.limits); err != nil {
+		return req, payments.Order{}, err
+	}
+	var err error
+	if req.Customer, err = s.checkoutCustomer(ctx, req); err != nil {
+		return req, payments.Order{}, err
+	}
+	order.CustomerID = customerID(req.Customer)
+
+	req.Currency = order.Currency
+	req.AmountCents = 0
+	return req, order, nil
+}
+
+// trialEnding mirrors the subscription and warns its customer that billing
+// starts soon.
+func (s *CheckoutService) trialEnding(ctx context.Context, event payments.Event) error {
+	if s.subscriptions == nil || event.Subscription == nil {
+		return nil
+	}
+	incoming := *event.Subscription
+	s.recordSubscription(&incoming, "trial ending", "ends "+incoming.TrialEnd.Format("2 Jan 2006"))
+	event.Subscription = &incoming
+	sub, err := s.mirrorSubscription(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	daysLeft := max(int(math.Ceil(sub.TrialEnd.Sub(s.now()).Hours()/24)), 0)
+	s.notify(ctx, "trial ending for "+sub.ID, func(n Notifier) error {
+		if tn, ok := n.(TrialNotifier); ok {
+			return tn.TrialEnding(ctx, sub, daysLeft)
+		}
+		return nil
+	})
+	return nil
+}
+
+// linkSubscription gives the subscription started by a checkout the buyer's
+// email, which the provider's subscription events do not carry.
+func (s *CheckoutService) linkSubscription(ctx context.Context, id, email string) error {
+	if s.subscriptions == nil || id == "" || email == "" {
+		return nil
+	}
+	sub, found, err := s.findSubscription(ctx, id)
+	if err != nil {
+		return err
+	}
+	if found && sub.CustomerEmail != "" {
+		return nil
+	}
+	if !found {
+		sub = payments.Subscription{ID: id}
+	}
+	sub.CustomerEmail = email
+	return s.storeSubscription(ctx, sub)
+}
+
+// trialOutcome reports whether sub just left its trial, moving from
+// previous, and if so whether it converted into a paying subscription. Only
+// an active subscription has converted. One whose first payment failed is
+// neither: it is chased by dunning like any other unpaid renewal.
+func trialOutcome(previous string, sub payments.Subscription) (ended, converted bool) {
+	if previous != "trialing" {
+		return false, false
+	}
+	switch {
+	case sub.Status == "active":
+		return true, true
+	case slices.Contains(expiredTrialStatuses, sub.Status):
+		return true, false
+	}
+	return false, false
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+type fakeTrialNotifier struct {
+	fakeNotifier
+	ending []int
+	ended  []bool
+}
+
+func (f *fakeTrialNotifier) TrialEnding(ctx context.Context, sub payments.Subscription, daysLeft int) error {
+	f.ending = append(f.ending, daysLeft)
+	return nil
+}
+
+func (f *fakeTrialNotifier) TrialEnded(ctx context.Context, sub payments.Subscription, converted bool) error {
+	f.ended = append(f.ended, converted)
+	return nil
+}
+
+var testPlans = []config.MeteredPriceConfig{
+	{Meter: "api_requests", Currency: "eur", StripePriceID: "price_metered", TrialDays: 14, TrialWithoutCard: true},
+}
+
+func TestCheckoutService_SubscribesToPlan(t *testing.T) {
+	drv := &fakeDriver{result: payments.CheckoutSessionResult{ID: "cs_sub"}}
+	orders := &fakeOrders{}
+	inventory := &fakeInventory{}
+	svc := NewCheckoutService(drv, WithOrders(orders), WithInventory(inventory), WithPlans(testPlans))
+
+	_, err := svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Plan: "api_requests", CustomerEmail: "ada@example.com"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plan := drv.lastReq.Subscription
+	if plan == nil || plan.StripePriceID != "price_metered" || plan.TrialDays != 14 || !plan.TrialWithoutCard {
+		t.Fatalf("expected the plan's trial passed to the driver, got %#v", plan)
+	}
+	order := orders.saved[0]
+	if order.Plan != "api_requests" || order.TotalCents != 0 || order.Timeline[0].Detail != "14-day trial" {
+		t.Fatalf("unexpected subscription order: %#v", order)
+	}
+	if len(inventory.reserved) != 0 {
+		t.Fatalf("subscriptions must not hold stock, got %v", inventory.reserved)
+	}
+
+	_, err = svc.CreateSession(context.Background(), payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Plan: "storage", PromoCode: "LAUNCH"}})
+	var invalid *payments.ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Fields) != 2 {
+		t.Fatalf("expected unknown plans and promo codes to be rejected, got %v", err)
+	}
+}
+
+func TestHandleEvent_FollowsTrials(t *testing.T) {
+	subs := &fakeSubscriptions{}
+	notifier := &fakeTrialNotifier{}
+	svc := NewCheckoutService(&fakeDriver{}, WithSubscriptions(subs), WithNotifier(notifier))
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	trialing := payments.Subscription{ID: "sub_1", Status: "trialing", TrialEnd: now.Add(70 * time.Hour)}
+	if err := svc.HandleEvent(ctx, payments.Event{Type: payments.EventSubscriptionUpdated, Subscription: &trialing}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The checkout that started the subscription knows who the subscriber is.
+	if err := svc.linkSubscription(ctx, "sub_1", "ada@example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := svc.HandleEvent(ctx, payments.Event{Type: payments.EventTrialEnding, Subscription: &trialing}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(notifier.ending) != 1 || notifier.ending[0] != 3 {
+		t.Fatalf("expected a warning three days out, got %v", notifier.ending)
+	}
+	if sub := subs.saved[0]; sub.CustomerEmail != "ada@example.com" || sub.Timeline[0].Action != "trial ending" {
+		t.Fatalf("expected the warning recorded on the subscriber's subscription, got %#v", sub)
+	}
+
+	active := payments.Subscription{ID: "sub_1", Status: "active"}
+	if err := svc.HandleEvent(ctx, payments.Event{Type: payments.EventSubscriptionUpdated, Subscription: &active}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(notifier.ended) != 1 || !notifier.ended[0] || subs.saved[0].Timeline[1].Action != "trial converted" {
+		t.Fatalf("expected a conversion, got %v and %#v", notifier.ended, subs.saved[0].Timeline)
+	}
+
+	// Without a local copy, the provider's previous status tells an expiry.
+	canceled := payments.Subscription{ID: "sub_2", Status: "canceled"}
+	if err := svc.HandleEvent(ctx, payments.Event{Type: payments.EventSubscriptionUpdated, Subscription: &canceled, PreviousStatus: "trialing"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(notifier.ended) != 2 || notifier.ended[1] {
+		t.Fatalf("expected an expired trial, got %v", notifier.ended)
+	}
+
+	// A trial whose first payment failed is left to dunning.
+	pastDue := payments.Subscription{ID: "sub_3", Status: "past_due"}
+	if err := svc.HandleEvent(ctx, payments.Event{Type: payments.EventSubscriptionUpdated, Subscription: &pastDue, PreviousStatus: "trialing"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(notifier.ended) != 2 {
+		t.Fatalf("expected a past-due trial to be neither converted nor expired, got %v", notifier.ended)
+	}
+}
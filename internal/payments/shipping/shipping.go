@@ -0,0 +1,50 @@
+package shipping
+
+import (
+	"context"
+	"slices"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// Table prices delivery for the configured product from a rate table.
+type Table struct {
+	product config.ProductConfig
+	cfg     config.ShippingConfig
+}
+
+// NewTable builds a shipping rate table for product.
+func NewTable(product config.ProductConfig, cfg config.ShippingConfig) *Table {
+	return &Table{product: product, cfg: cfg}
+}
+
+// Quote returns the shipping options for quantity units with the given
+// subtotal, or nil when the product is digital.
+func (t *Table) Quote(_ context.Context, quantity, subtotalCents int64) (*payments.Shipping, error) {
+	if !t.product.Physical {
+		return nil, nil
+	}
+
+	weightGrams := t.product.WeightGrams * quantity
+	kilograms := (weightGrams + 999) / 1000
+
+	options := make([]payments.ShippingOption, 0, len(t.cfg.Rates))
+	for _, r := range t.cfg.Rates {
+		amount := r.AmountCents + r.PerKgCents*kilograms
+		if r.FreeOverCents > 0 && subtotalCents >= r.FreeOverCents {
+			amount = 0
+		}
+		options = append(options, payments.ShippingOption{
+			Name:        r.Name,
+			AmountCents: amount,
+			MinDays:     r.MinDays,
+			MaxDays:     r.MaxDays,
+		})
+	}
+
+	return &payments.Shipping{
+		AllowedCountries: slices.Clone(t.cfg.Countries),
+		Options:          options,
+	}, nil
+}
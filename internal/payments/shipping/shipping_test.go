@@ -0,0 +1,67 @@
+package shipping
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rjNemo/payit/config"
+)
+
+func TestTable_QuoteDigitalProduct(t *testing.T) {
+	table := NewTable(config.ProductConfig{PriceCents: 1000}, testShippingConfig())
+
+	got, err := table.Quote(context.Background(), 1, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("expected no shipping for digital product, got %#v", got)
+	}
+}
+
+func TestTable_QuotePhysicalProduct(t *testing.T) {
+	product := config.ProductConfig{PriceCents: 1000, Physical: true, WeightGrams: 600}
+	table := NewTable(product, testShippingConfig())
+
+	got, err := table.Quote(context.Background(), 2, 2000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got == nil || len(got.Options) != 3 {
+		t.Fatalf("expected three options, got %#v", got)
+	}
+	if len(got.AllowedCountries) != 2 || got.AllowedCountries[0] != "FR" {
+		t.Fatalf("unexpected countries: %v", got.AllowedCountries)
+	}
+
+	want := map[string]int64{"Standard": 500, "Express": 1000 + 2*300, "Free over 50": 700}
+	for _, opt := range got.Options {
+		if opt.AmountCents != want[opt.Name] {
+			t.Fatalf("%s: expected %d, got %d", opt.Name, want[opt.Name], opt.AmountCents)
+		}
+	}
+}
+
+func TestTable_QuoteFreeOverThreshold(t *testing.T) {
+	product := config.ProductConfig{PriceCents: 3000, Physical: true}
+	table := NewTable(product, testShippingConfig())
+
+	got, err := table.Quote(context.Background(), 2, 6000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Options[2].AmountCents != 0 {
+		t.Fatalf("expected free shipping over threshold, got %d", got.Options[2].AmountCents)
+	}
+}
+
+func testShippingConfig() config.ShippingConfig {
+	return config.ShippingConfig{
+		Countries: []string{"FR", "DE"},
+		Rates: []config.ShippingRateConfig{
+			{Name: "Standard", AmountCents: 500, MinDays: 3, MaxDays: 5},
+			{Name: "Express", AmountCents: 1000, PerKgCents: 300, MinDays: 1, MaxDays: 2},
+			{Name: "Free over 50", AmountCents: 700, FreeOverCents: 5000},
+		},
+	}
+}
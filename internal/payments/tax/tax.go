@@ -0,0 +1,145 @@
+package tax
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// Automatic hands tax calculation to the payment provider. Drivers that see an
+// automatic breakdown enable the provider's own tax engine.
+type Automatic struct{}
+
+// Calculate returns a breakdown that defers amounts to the provider.
+func (Automatic) Calculate(_ context.Context, in payments.TaxInput) (payments.TaxBreakdown, error) {
+	return payments.TaxBreakdown{
+		Automatic:  true,
+		Country:    strings.ToUpper(in.Country),
+		Region:     strings.ToUpper(in.Region),
+		TaxID:      in.TaxID,
+		NetCents:   in.AmountCents,
+		GrossCents: in.AmountCents,
+	}, nil
+}
+
+// Table computes VAT/GST locally from a table of rates by country and region.
+type Table struct {
+	origin         string
+	defaultCountry string
+	inclusive      bool
+	rates          map[string]config.TaxRateConfig
+	// vat confirms VAT numbers before reverse charge applies; nil only
+	// checks their format.
+	vat VATChecker
+}
+
+// TableOption customises a Table.
+type TableOption func(*Table)
+
+// WithVATChecker only applies reverse charge to VAT numbers vat confirms
+// are registered.
+func WithVATChecker(vat VATChecker) TableOption {
+	return func(t *Table) {
+		t.vat = vat
+	}
+}
+
+// NewTable builds a table calculator. Prices are treated as tax-inclusive when
+// cfg.PricesIncludeTax is set.
+func NewTable(cfg config.TaxConfig, opts ...TableOption) *Table {
+	rates := make(map[string]config.TaxRateConfig, len(cfg.Rates))
+	for _, r := range cfg.Rates {
+		rates[rateKey(r.Country, r.Region)] = r
+	}
+
+	t := &Table{
+		origin:         strings.ToUpper(cfg.OriginCountry),
+		defaultCountry: strings.ToUpper(cfg.DefaultCountry),
+		inclusive:      cfg.PricesIncludeTax,
+		rates:          rates,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Calculate looks up the buyer's rate and splits the amount into net and tax.
+func (t *Table) Calculate(ctx context.Context, in payments.TaxInput) (payments.TaxBreakdown, error) {
+	country := strings.ToUpper(strings.TrimSpace(in.Country))
+	if country == "" {
+		country = t.defaultCountry
+	}
+	region := strings.ToUpper(strings.TrimSpace(in.Region))
+
+	rate, ok := t.rates[rateKey(country, region)]
+	if !ok {
+		rate, ok = t.rates[rateKey(country, "")]
+	}
+	if !ok {
+		return payments.TaxBreakdown{}, fmt.Errorf("%w: no tax rate for %s", payments.ErrUnsupportedTaxLocation, country)
+	}
+
+	breakdown := payments.TaxBreakdown{
+		Country:         country,
+		Region:          region,
+		Name:            rate.Name,
+		RateBasisPoints: rate.RateBasisPoints,
+		Inclusive:       t.inclusive,
+		TaxID:           strings.TrimSpace(in.TaxID),
+	}
+
+	if breakdown.TaxID != "" && rate.ReverseCharge && country != t.origin {
+		breakdown.TaxIDStatus = payments.TaxIDUnverified
+		if t.verifyVATID(ctx, country, breakdown.TaxID) {
+			breakdown.TaxIDStatus = payments.TaxIDVerified
+			breakdown.ReverseCharge = true
+			breakdown.RateBasisPoints = 0
+		}
+	}
+
+	bp := breakdown.RateBasisPoints
+	if t.inclusive {
+		breakdown.GrossCents = in.AmountCents
+		breakdown.NetCents = divRound(in.AmountCents*10000, 10000+bp)
+		breakdown.TaxCents = breakdown.GrossCents - breakdown.NetCents
+	} else {
+		breakdown.NetCents = in.AmountCents
+		breakdown.TaxCents = divRound(in.AmountCents*bp, 10000)
+		breakdown.GrossCents = breakdown.NetCents + breakdown.TaxCents
+	}
+
+	return breakdown, nil
+}
+
+// verifyVATID reports whether id is a VAT number of country, confirmed by
+// the VAT checker when there is one. A number that cannot be confirmed,
+// including while the checker is down, is charged VAT.
+func (t *Table) verifyVATID(ctx context.Context, country, id string) bool {
+	number, ok := parseVATID(country, id)
+	if !ok {
+		return false
+	}
+	if t.vat == nil {
+		return true
+	}
+	valid, err := t.vat.CheckVAT(ctx, country, number)
+	if err != nil {
+		log.Printf("verify VAT number %s%s: %v", vatPrefix(country), number, err)
+		return false
+	}
+	return valid
+}
+
+func rateKey(country, region string) string {
+	return strings.ToUpper(country) + "/" + strings.ToUpper(region)
+}
+
+// divRound divides non-negative integers rounding half up.
+func divRound(n, d int64) int64 {
+	return (n + d/2) / d
+}
@@ -0,0 +1,201 @@
+package tax
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+func TestTable_ExclusivePricing(t *testing.T) {
+	table := NewTable(testTaxConfig(false))
+
+	got, err := table.Calculate(context.Background(), payments.TaxInput{Country: "de", AmountCents: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.NetCents != 1000 || got.TaxCents != 190 || got.GrossCents != 1190 {
+		t.Fatalf("unexpected breakdown: %#v", got)
+	}
+	if got.Country != "DE" || got.Name != "VAT" {
+		t.Fatalf("unexpected jurisdiction: %#v", got)
+	}
+}
+
+func TestTable_InclusivePricing(t *testing.T) {
+	table := NewTable(testTaxConfig(true))
+
+	got, err := table.Calculate(context.Background(), payments.TaxInput{Country: "FR", AmountCents: 1200})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.GrossCents != 1200 || got.NetCents != 1000 || got.TaxCents != 200 {
+		t.Fatalf("unexpected breakdown: %#v", got)
+	}
+}
+
+func TestTable_RegionalRateAndDefaultCountry(t *testing.T) {
+	table := NewTable(testTaxConfig(false))
+
+	got, err := table.Calculate(context.Background(), payments.TaxInput{Country: "CA", Region: "on", AmountCents: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Name != "HST" || got.TaxCents != 130 {
+		t.Fatalf("expected Ontario HST, got %#v", got)
+	}
+
+	got, err = table.Calculate(context.Background(), payments.TaxInput{AmountCents: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Country != "FR" || got.TaxCents != 200 {
+		t.Fatalf("expected default country rate, got %#v", got)
+	}
+}
+
+func TestTable_ReverseCharge(t *testing.T) {
+	table := NewTable(testTaxConfig(false))
+
+	got, err := table.Calculate(context.Background(), payments.TaxInput{Country: "DE", TaxID: "DE123456789", AmountCents: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.ReverseCharge || got.TaxCents != 0 || got.GrossCents != 1000 || got.TaxIDStatus != payments.TaxIDVerified {
+		t.Fatalf("expected reverse charge, got %#v", got)
+	}
+
+	got, err = table.Calculate(context.Background(), payments.TaxInput{Country: "DE", TaxID: "not-a-vat-number", AmountCents: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ReverseCharge || got.TaxCents != 190 || got.TaxIDStatus != payments.TaxIDUnverified {
+		t.Fatalf("expected a malformed VAT number to be charged VAT, got %#v", got)
+	}
+
+	got, err = table.Calculate(context.Background(), payments.TaxInput{Country: "FR", TaxID: "FR123", AmountCents: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ReverseCharge || got.TaxCents != 200 {
+		t.Fatalf("expected domestic B2B sale to be taxed, got %#v", got)
+	}
+}
+
+type fakeVATChecker struct {
+	valid   bool
+	err     error
+	checked []string
+}
+
+func (f *fakeVATChecker) CheckVAT(ctx context.Context, country, number string) (bool, error) {
+	f.checked = append(f.checked, country+":"+number)
+	return f.valid, f.err
+}
+
+func TestTable_ReverseChargeNeedsConfirmedVATNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		checker *fakeVATChecker
+		reverse bool
+	}{
+		{name: "registered", checker: &fakeVATChecker{valid: true}, reverse: true},
+		{name: "not registered", checker: &fakeVATChecker{}},
+		{name: "checker down", checker: &fakeVATChecker{err: errors.New("VIES unavailable")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewTable(testTaxConfig(false), WithVATChecker(tt.checker))
+
+			got, err := table.Calculate(context.Background(), payments.TaxInput{Country: "DE", TaxID: "de 123.456.789", AmountCents: 1000})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tt.checker.checked) != 1 || tt.checker.checked[0] != "DE:123456789" {
+				t.Fatalf("expected the bare number checked, got %v", tt.checker.checked)
+			}
+			if got.ReverseCharge != tt.reverse || (got.TaxCents == 0) != tt.reverse {
+				t.Fatalf("unexpected breakdown: %#v", got)
+			}
+		})
+	}
+}
+
+func TestParseVATID(t *testing.T) {
+	tests := []struct {
+		country, id string
+		want        bool
+	}{
+		{"DE", "DE123456789", true},
+		{"DE", "DE12345678", false},
+		{"GR", "EL123456789", true},
+		{"NL", "NL123456789B01", true},
+		{"AT", "ATU12345678", true},
+		{"AT", "AT12345678", false},
+		{"GB", "GB123456789", false},
+	}
+	for _, tt := range tests {
+		if _, got := parseVATID(tt.country, tt.id); got != tt.want {
+			t.Fatalf("parseVATID(%s, %s) = %v, want %v", tt.country, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestTable_UnknownCountry(t *testing.T) {
+	table := NewTable(testTaxConfig(false))
+
+	_, err := table.Calculate(context.Background(), payments.TaxInput{Country: "ZZ", AmountCents: 1000})
+	if !errors.Is(err, payments.ErrUnsupportedTaxLocation) {
+		t.Fatalf("expected ErrUnsupportedTaxLocation, got %v", err)
+	}
+}
+
+func TestAutomatic_DefersToProvider(t *testing.T) {
+	got, err := Automatic{}.Calculate(context.Background(), payments.TaxInput{Country: "de", AmountCents: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Automatic || got.TaxCents != 0 || got.GrossCents != 1000 {
+		t.Fatalf("unexpected breakdown: %#v", got)
+	}
+}
+
+func testTaxConfig(inclusive bool) config.TaxConfig {
+	return config.TaxConfig{
+		Mode:             config.TaxModeLocal,
+		OriginCountry:    "FR",
+		DefaultCountry:   "FR",
+		PricesIncludeTax: inclusive,
+		Rates: []config.TaxRateConfig{
+			{Country: "FR", Name: "VAT", RateBasisPoints: 2000, ReverseCharge: true},
+			{Country: "DE", Name: "VAT", RateBasisPoints: 1900, ReverseCharge: true},
+			{Country: "CA", Name: "GST", RateBasisPoints: 500},
+			{Country: "CA", Region: "ON", Name: "HST", RateBasisPoints: 1300},
+		},
+	}
+}
+
+func TestVIES_CheckVAT(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"valid": true}`))
+	}))
+	defer srv.Close()
+
+	valid, err := NewVIES(srv.URL).CheckVAT(context.Background(), "GR", "123456789")
+	if err != nil || !valid {
+		t.Fatalf("expected a registered number, got %v and %v", valid, err)
+	}
+	if got["countryCode"] != "EL" || got["vatNumber"] != "123456789" {
+		t.Fatalf("unexpected VIES request: %v", got)
+	}
+}
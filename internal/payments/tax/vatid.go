@@ -0,0 +1,120 @@
+package tax
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// vatFormats are the shapes of EU VAT numbers, without their country
+// prefix, keyed by the ISO country of the rate they apply to.
+var vatFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^\d{9}$`),
+	"DK": regexp.MustCompile(`^\d{8}$`),
+	"EE": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}\d{9}$`),
+	"GR": regexp.MustCompile(`^\d{9}$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^(\d{7}[A-W][A-I]?|\d[A-Z+*]\d{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^\d{8}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{10}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^[1-9]\d{1,9}$`),
+	"SE": regexp.MustCompile(`^\d{10}01$`),
+	"SI": regexp.MustCompile(`^\d{8}$`),
+	"SK": regexp.MustCompile(`^\d{10}$`),
+}
+
+// vatPrefix is the prefix VAT numbers of country carry, which is the
+// country itself except for Greece.
+func vatPrefix(country string) string {
+	if country == "GR" {
+		return "EL"
+	}
+	return country
+}
+
+// parseVATID strips separators and the country prefix from id and reports
+// whether what is left has the shape of a VAT number of country.
+func parseVATID(country, id string) (string, bool) {
+	format, ok := vatFormats[country]
+	if !ok {
+		return "", false
+	}
+	number := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(id))
+	number = strings.TrimPrefix(number, vatPrefix(country))
+	return number, format.MatchString(number)
+}
+
+// VATChecker confirms with the tax authorities that a VAT number is
+// registered.
+type VATChecker interface {
+	CheckVAT(ctx context.Context, country, number string) (bool, error)
+}
+
+const viesTimeout = 5 * time.Second
+
+// VIES checks VAT numbers against the EU's VAT Information Exchange System.
+type VIES struct {
+	url    string
+	client *http.Client
+}
+
+// NewVIES checks VAT numbers against the VIES service at url.
+func NewVIES(url string) *VIES {
+	return &VIES{url: url, client: &http.Client{Timeout: viesTimeout}}
+}
+
+// CheckVAT reports whether number is registered for VAT in country.
+func (v *VIES) CheckVAT(ctx context.Context, country, number string) (bool, error) {
+	payload, err := json.Marshal(map[string]string{"countryCode": vatPrefix(country), "vatNumber": number})
+	if err != nil {
+		return false, fmt.Errorf("encode VIES check: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("build VIES check: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("check VAT number with VIES: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("check VAT number with VIES: %s", resp.Status)
+	}
+	var result struct {
+		Valid bool `json:"valid"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("decode VIES answer: %w", err)
+	}
+	return result.Valid, nil
+}
@@ -1,12 +1,283 @@
 package payments
 
-// CheckoutSessionRequest captures optional inputs for creating a checkout session.
+import (
+	"strings"
+	"time"
+
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+// Checkout and order types are part of the public API and live in pkg/payit.
+type (
+	CheckoutSessionResult   = payit.CheckoutSessionResult
+	Discount                = payit.Discount
+	SubscriptionPlan        = payit.SubscriptionPlan
+	TaxBreakdown            = payit.TaxBreakdown
+	Shipping                = payit.Shipping
+	ShippingOption          = payit.ShippingOption
+	Address                 = payit.Address
+	OrderStatus             = payit.OrderStatus
+	Order                   = payit.Order
+	TimelineEntry           = payit.TimelineEntry
+	Customer                = payit.Customer
+	FieldError              = payit.FieldError
+	UsageRecord             = payit.UsageRecord
+	UsageReconciliation     = payit.UsageReconciliation
+	UsageReconciliationLine = payit.UsageReconciliationLine
+)
+
+// CheckoutSessionRequest is a checkout as the service prices it and hands it
+// to a driver: what the client asked for, plus what payit resolved itself and
+// never accepts from clients.
 type CheckoutSessionRequest struct {
-	Quantity int64 `json:"quantity"`
+	payit.CheckoutSessionRequest
+
+	Discount     *Discount
+	Tax          *TaxBreakdown
+	Shipping     *Shipping
+	Customer     *Customer
+	Subscription *SubscriptionPlan
+	// SavePaymentMethod keeps the card on the buyer's provider customer for
+	// later one-click purchases. It is set for signed-in customers only.
+	SavePaymentMethod bool
+	// EmailVerified marks CustomerEmail as the signed-in buyer's own
+	// address, so the checkout may be linked to their customer record.
+	// Other checkouts are linked once the provider confirms the email.
+	EmailVerified bool
+	// Currency and AmountCents are the order total before shipping, set by
+	// the checkout service so drivers can route the payment.
+	Currency    string
+	AmountCents int64
+}
+
+// Order lifecycle states.
+const (
+	OrderStatusOpen       = payit.OrderStatusOpen
+	OrderStatusAuthorized = payit.OrderStatusAuthorized
+	OrderStatusPaid       = payit.OrderStatusPaid
+	OrderStatusExpired    = payit.OrderStatusExpired
+	OrderStatusFailed     = payit.OrderStatusFailed
+	OrderStatusCanceled   = payit.OrderStatusCanceled
+	OrderStatusRefunded   = payit.OrderStatusRefunded
+)
+
+// Outcomes of checking a buyer's tax ID.
+const (
+	TaxIDVerified   = payit.TaxIDVerified
+	TaxIDUnverified = payit.TaxIDUnverified
+)
+
+// PaymentIntentStatus is where a payment confirmed on payit's own form stands.
+type PaymentIntentStatus string
+
+// Payment intent states, as reported by the provider.
+const (
+	PaymentIntentRequiresPaymentMethod PaymentIntentStatus = "requires_payment_method"
+	PaymentIntentRequiresConfirmation  PaymentIntentStatus = "requires_confirmation"
+	// PaymentIntentRequiresAction waits on the buyer, usually for 3-D Secure.
+	PaymentIntentRequiresAction  PaymentIntentStatus = "requires_action"
+	PaymentIntentProcessing      PaymentIntentStatus = "processing"
+	PaymentIntentRequiresCapture PaymentIntentStatus = "requires_capture"
+	PaymentIntentSucceeded       PaymentIntentStatus = "succeeded"
+	PaymentIntentCanceled        PaymentIntentStatus = "canceled"
+)
+
+// PaymentIntent is a payment the buyer confirms on a custom payment form
+// instead of a provider-hosted checkout.
+type PaymentIntent struct {
+	ID     string              `json:"id"`
+	Status PaymentIntentStatus `json:"status"`
+	// ClientSecret lets the form confirm the payment; it is only returned
+	// when the intent is created.
+	ClientSecret string `json:"client_secret,omitempty"`
+	// CancelToken lets the buyer who started the payment cancel it; it is
+	// only returned when the intent is created.
+	CancelToken string `json:"cancel_token,omitempty"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	// NextActionURL is where the buyer authenticates the payment when Status
+	// is requires_action and the form cannot handle it in place.
+	NextActionURL string `json:"next_action_url,omitempty"`
+	// ExpiresAt is when an unconfirmed payment is canceled.
+	ExpiresAt     time.Time `json:"expires_at,omitzero"`
+	CustomerEmail string    `json:"-"`
+	Provider      string    `json:"-"`
+}
+
+// PaymentMethod is a card saved on a customer's provider account.
+type PaymentMethod struct {
+	ID       string `json:"id"`
+	Brand    string `json:"brand"`
+	Last4    string `json:"last4"`
+	ExpMonth int64  `json:"exp_month"`
+	ExpYear  int64  `json:"exp_year"`
+}
+
+// OffSessionCharge takes a payment from a saved payment method while the
+// customer is not on a payment page.
+type OffSessionCharge struct {
+	Customer        Customer
+	PaymentMethodID string
+	Quantity        int64
+	// AmountCents is the full amount to charge, shipping included.
+	AmountCents     int64
+	Currency        string
+	ShippingAddress *Address
+	Metadata        map[string]string
+	// IdempotencyKey makes a repeated charge, such as from a double-clicked
+	// button, return the first payment instead of taking a second one.
+	IdempotencyKey string
+}
+
+// Repurchase is the outcome of buying a previous order again. Exactly one of
+// Order and Checkout is set.
+type Repurchase struct {
+	// Order is the new order when the saved payment method was charged.
+	Order *Order
+	// Checkout is where the customer finishes paying when the charge needs
+	// them, for example to authenticate with their bank.
+	Checkout *CheckoutSessionResult
+}
+
+// UsageBatch is recorded usage of one meter by one customer within one
+// hour, reported to the provider as a single event.
+type UsageBatch struct {
+	// ID identifies the batch to the provider, which ignores a batch it has
+	// already counted, so a failed report can be retried safely.
+	ID         string `json:"id"`
+	CustomerID string `json:"customer_id"`
+	Meter      string `json:"meter"`
+	Quantity   int64  `json:"quantity"`
+	// Records counts the usage records aggregated into the batch.
+	Records int `json:"records"`
+	// Hour is the start of the hour the usage happened in.
+	Hour       time.Time `json:"hour"`
+	ReportedAt time.Time `json:"reported_at,omitzero"`
+}
+
+// OrderFilter narrows an order listing. Zero fields match everything.
+type OrderFilter struct {
+	Status OrderStatus
+	// Email matches customer emails case-insensitively by substring.
+	Email string
+	// From and To bound the creation time; To is exclusive.
+	From time.Time
+	To   time.Time
+}
+
+// Matches reports whether order satisfies every set field of the filter.
+func (f OrderFilter) Matches(order Order) bool {
+	if f.Status != "" && order.Status != f.Status {
+		return false
+	}
+	if f.Email != "" && !strings.Contains(strings.ToLower(order.CustomerEmail), strings.ToLower(f.Email)) {
+		return false
+	}
+	if !f.From.IsZero() && order.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !order.CreatedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// Subscription mirrors a provider subscription so staff can see it locally.
+type Subscription struct {
+	ID                string    `json:"id"`
+	Status            string    `json:"status"`
+	CustomerID        string    `json:"customer_id,omitempty"`
+	CustomerEmail     string    `json:"customer_email,omitempty"`
+	AmountCents       int64     `json:"amount_cents"`
+	Currency          string    `json:"currency"`
+	Interval          string    `json:"interval,omitempty"`
+	CurrentPeriodEnd  time.Time `json:"current_period_end,omitzero"`
+	CancelAtPeriodEnd bool      `json:"cancel_at_period_end,omitempty"`
+	// TrialEnd is when a free trial ends and billing starts.
+	TrialEnd  time.Time `json:"trial_end,omitzero"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Dunning is set once a renewal fails to pay and tracks chasing it.
+	Dunning *Dunning `json:"dunning,omitempty"`
+	// Timeline records what payit did about the subscription.
+	Timeline []TimelineEntry `json:"timeline,omitempty"`
+}
+
+// DunningOutcome is how chasing a failed renewal ended.
+type DunningOutcome string
+
+// Dunning outcomes; an empty outcome means the renewal is still being chased.
+const (
+	DunningRecovered  DunningOutcome = "recovered"
+	DunningCanceled   DunningOutcome = "canceled"
+	DunningDowngraded DunningOutcome = "downgraded"
+	// DunningLapsed means the grace period ended with no action configured.
+	DunningLapsed DunningOutcome = "lapsed"
+)
+
+// Dunning tracks the reminders sent for a failed renewal and what happened
+// when the grace period ran out.
+type Dunning struct {
+	StartedAt time.Time `json:"started_at"`
+	// GraceUntil is when the final action is taken if the renewal is still unpaid.
+	GraceUntil       time.Time      `json:"grace_until"`
+	AmountCents      int64          `json:"amount_cents"`
+	Currency         string         `json:"currency"`
+	PaymentUpdateURL string         `json:"payment_update_url,omitempty"`
+	RemindersSent    int            `json:"reminders_sent"`
+	Outcome          DunningOutcome `json:"outcome,omitempty"`
+	EndedAt          time.Time      `json:"ended_at,omitzero"`
+}
+
+// Job is a unit of work scheduled to run at a later time, kept so that it
+// survives restarts.
+type Job struct {
+	// ID identifies the job; scheduling an existing ID replaces it.
+	ID    string            `json:"id"`
+	Kind  string            `json:"kind"`
+	RunAt time.Time         `json:"run_at"`
+	Data  map[string]string `json:"data,omitempty"`
+	// Attempts counts failed runs; LastError is the most recent failure.
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// WebhookDelivery records one webhook received from a provider and how it was handled.
+type WebhookDelivery struct {
+	EventID    string    `json:"event_id,omitempty"`
+	Provider   string    `json:"provider"`
+	Type       string    `json:"type,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// RecoveryNotice asks for a customer who abandoned checkout to be sent a
+// fresh checkout link.
+type RecoveryNotice struct {
+	OrderID   string    `json:"order_id"`
+	Email     string    `json:"email"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AbandonmentReport summarises how many checkouts end without payment.
+type AbandonmentReport struct {
+	Since     time.Time `json:"since"`
+	Sessions  int       `json:"sessions"`
+	Open      int       `json:"open"`
+	Paid      int       `json:"paid"`
+	Abandoned int       `json:"abandoned"`
+	// Recovered counts paid orders that started from a recovery link.
+	Recovered       int     `json:"recovered"`
+	AbandonmentRate float64 `json:"abandonment_rate"`
+	RecoveryRate    float64 `json:"recovery_rate"`
 }
 
-// CheckoutSessionResult contains the data returned to callers initiating checkout.
-type CheckoutSessionResult struct {
-	ID  string `json:"id"`
-	URL string `json:"url"`
+// TaxInput is what a tax calculator needs to price a checkout.
+type TaxInput struct {
+	Country     string
+	Region      string
+	TaxID       string
+	AmountCents int64
+	Currency    string
 }
@@ -0,0 +1,204 @@
+// Package validate checks requests against the limits payit enforces before
+// anything is reserved or sent to a payment provider. Every broken field is
+// reported at once in a *payments.ValidationError.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// Field error codes.
+const (
+	CodeTooSmall   = "too_small"
+	CodeTooLarge   = "too_large"
+	CodeInvalid    = "invalid"
+	CodeNotAllowed = "not_allowed"
+)
+
+// Metadata limits match what Stripe accepts, so metadata can be passed on as is.
+const (
+	MaxMetadataKeys        = 50
+	MaxMetadataKeyLength   = 40
+	MaxMetadataValueLength = 500
+)
+
+const (
+	maxEmailLength        = 254
+	maxCustomerNameLength = 256
+	maxPromoCodeLength    = 64
+	maxRegionLength       = 10
+	maxTaxIDLength        = 32
+)
+
+// Validator collects field errors.
+type Validator struct {
+	fields []payments.FieldError
+}
+
+// Add records that field is invalid.
+func (v *Validator) Add(field, code, message string) {
+	v.fields = append(v.fields, payments.FieldError{Field: field, Code: code, Message: message})
+}
+
+// Check records the error unless ok holds.
+func (v *Validator) Check(ok bool, field, code, message string) {
+	if !ok {
+		v.Add(field, code, message)
+	}
+}
+
+// Err returns the collected errors, or nil when every check passed.
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &payments.ValidationError{Fields: v.fields}
+}
+
+// CheckoutSession checks the buyer-supplied fields of req, including the
+// quantity bounds of product. A zero quantity means the default of one.
+func CheckoutSession(req payments.CheckoutSessionRequest, product config.ProductConfig) error {
+	var v Validator
+	Quantity(&v, "quantity", req.Quantity, product)
+	v.Check(len(req.PromoCode) <= maxPromoCodeLength, "promo_code", CodeTooLarge,
+		fmt.Sprintf("must be at most %d characters", maxPromoCodeLength))
+	if req.Country != "" {
+		v.Check(isCountryCode(req.Country), "country", CodeInvalid, "must be an ISO 3166-1 alpha-2 code")
+	}
+	v.Check(len(req.Region) <= maxRegionLength, "region", CodeTooLarge,
+		fmt.Sprintf("must be at most %d characters", maxRegionLength))
+	v.Check(len(req.TaxID) <= maxTaxIDLength, "tax_id", CodeTooLarge,
+		fmt.Sprintf("must be at most %d characters", maxTaxIDLength))
+	if req.CustomerEmail != "" {
+		v.Check(IsEmail(req.CustomerEmail), "customer_email", CodeInvalid, "must be a valid email address")
+	}
+	v.Check(len(req.CustomerName) <= maxCustomerNameLength, "customer_name", CodeTooLarge,
+		fmt.Sprintf("must be at most %d characters", maxCustomerNameLength))
+	if req.Locale != "" {
+		v.Check(IsLocale(req.Locale), "locale", CodeInvalid, "must be a language tag such as fr or en-GB")
+	}
+	Metadata(&v, "metadata", req.Metadata)
+	return v.Err()
+}
+
+// Order checks a priced order against the store-wide limits.
+func Order(order payments.Order, limits config.LimitsConfig) error {
+	var v Validator
+	if limits.MaxOrderTotalCents > 0 && order.TotalCents > limits.MaxOrderTotalCents {
+		v.Add("quantity", CodeTooLarge, "order total must not exceed "+payments.FormatMoney(limits.MaxOrderTotalCents, order.Currency))
+	}
+	if len(limits.Currencies) > 0 {
+		v.Check(slices.Contains(limits.Currencies, strings.ToLower(order.Currency)), "currency", CodeNotAllowed,
+			fmt.Sprintf("%s is not accepted", strings.ToUpper(order.Currency)))
+	}
+	return v.Err()
+}
+
+// Quantity checks that quantity lies within product's bounds. Zero stands
+// for the default of one unit.
+func Quantity(v *Validator, field string, quantity int64, product config.ProductConfig) {
+	if quantity == 0 {
+		quantity = 1
+	}
+	minimum := max(product.MinQuantity, 1)
+	v.Check(quantity >= minimum, field, CodeTooSmall, fmt.Sprintf("must be at least %d", minimum))
+	if product.MaxQuantity > 0 {
+		v.Check(quantity <= product.MaxQuantity, field, CodeTooLarge, fmt.Sprintf("must be at most %d", product.MaxQuantity))
+	}
+}
+
+// Metadata checks the number and size of metadata entries.
+func Metadata(v *Validator, field string, metadata map[string]string) {
+	if len(metadata) > MaxMetadataKeys {
+		v.Add(field, CodeTooLarge, fmt.Sprintf("must have at most %d keys", MaxMetadataKeys))
+		return
+	}
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		switch {
+		case key == "" || len(key) > MaxMetadataKeyLength:
+			v.Add(field+"."+key, CodeInvalid, fmt.Sprintf("keys must be 1 to %d characters", MaxMetadataKeyLength))
+		case len(metadata[key]) > MaxMetadataValueLength:
+			v.Add(field+"."+key, CodeTooLarge, fmt.Sprintf("must be at most %d characters", MaxMetadataValueLength))
+		}
+	}
+}
+
+// IsEmail reports whether addr is a bare email address, without a display
+// name or angle brackets.
+func IsEmail(addr string) bool {
+	if len(addr) > maxEmailLength {
+		return false
+	}
+	parsed, err := mail.ParseAddress(addr)
+	return err == nil && parsed.Address == addr && strings.Contains(addr[strings.LastIndex(addr, "@"):], ".")
+}
+
+// IsLocale reports whether tag looks like a BCP 47 language tag: a two or
+// three letter language followed by alphanumeric subtags, such as "pt-BR".
+func IsLocale(tag string) bool {
+	parts := strings.Split(tag, "-")
+	if len(parts[0]) < 2 || len(parts[0]) > 3 || !isAlphanumeric(parts[0], false) {
+		return false
+	}
+	for _, part := range parts[1:] {
+		if part == "" || len(part) > 8 || !isAlphanumeric(part, true) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(s string, digits bool) bool {
+	for _, c := range strings.ToLower(s) {
+		if (c < 'a' || c > 'z') && (!digits || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range strings.ToUpper(code) {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// UsageRecord checks one usage record against the configured meters. Usage
+// is accepted from maxUsageAge ago up to a few minutes ahead of now, to
+// allow for clock skew, as providers refuse anything outside that window.
+func UsageRecord(v *Validator, field string, rec payments.UsageRecord, metering config.MeteringConfig, now time.Time) {
+	v.Check(rec.CustomerID != "", field+".customer_id", CodeInvalid, "is required")
+	if _, ok := metering.Price(rec.Meter); !ok {
+		v.Add(field+".meter", CodeNotAllowed, "is not a metered price")
+	}
+	v.Check(rec.Quantity > 0, field+".quantity", CodeTooSmall, "must be at least 1")
+	if !rec.Timestamp.IsZero() {
+		v.Check(rec.Timestamp.After(now.Add(-MaxUsageAge)), field+".timestamp", CodeTooSmall,
+			fmt.Sprintf("must be within the last %d days", MaxUsageAge/(24*time.Hour)))
+		v.Check(!rec.Timestamp.After(now.Add(maxUsageSkew)), field+".timestamp", CodeTooLarge, "must not be in the future")
+	}
+}
+
+// MaxUsageAge is how old usage may be when recorded; Stripe refuses meter
+// events older than 35 days, and payit needs time to report them.
+const MaxUsageAge = 30 * 24 * time.Hour
+
+const maxUsageSkew = 5 * time.Minute
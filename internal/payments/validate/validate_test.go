@@ -0,0 +1,122 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+func fieldsOf(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var invalid *payments.ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	fields := make(map[string]string)
+	for _, f := range invalid.Fields {
+		fields[f.Field] = f.Code
+	}
+	return fields
+}
+
+func TestCheckoutSessionAcceptsDefaults(t *testing.T) {
+	product := config.ProductConfig{MinQuantity: 1, MaxQuantity: 10}
+	if err := CheckoutSession(payments.CheckoutSessionRequest{}, product); err != nil {
+		t.Fatalf("expected an empty request to be valid, got %v", err)
+	}
+	req := payments.CheckoutSessionRequest{
+		CheckoutSessionRequest: payit.CheckoutSessionRequest{
+			Quantity:      10,
+			Country:       "fr",
+			CustomerEmail: "ada@example.com",
+			Metadata:      map[string]string{"order_ref": "A-1"},
+		},
+	}
+	if err := CheckoutSession(req, product); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckoutSessionReportsEveryField(t *testing.T) {
+	product := config.ProductConfig{MinQuantity: 1, MaxQuantity: 10}
+	req := payments.CheckoutSessionRequest{
+		CheckoutSessionRequest: payit.CheckoutSessionRequest{
+			Quantity:      10_000_000,
+			Country:       "France",
+			CustomerEmail: "Ada <ada@example.com>",
+			Locale:        "french",
+			Metadata: map[string]string{
+				"note":                  strings.Repeat("x", MaxMetadataValueLength+1),
+				strings.Repeat("k", 41): "v",
+			},
+		},
+	}
+
+	fields := fieldsOf(t, CheckoutSession(req, product))
+	want := map[string]string{
+		"quantity":                            CodeTooLarge,
+		"country":                             CodeInvalid,
+		"customer_email":                      CodeInvalid,
+		"locale":                              CodeInvalid,
+		"metadata.note":                       CodeTooLarge,
+		"metadata." + strings.Repeat("k", 41): CodeInvalid,
+	}
+	for field, code := range want {
+		if fields[field] != code {
+			t.Fatalf("expected %s to be %s, got %v", field, code, fields)
+		}
+	}
+
+	fields = fieldsOf(t, CheckoutSession(payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{Quantity: -1}}, product))
+	if fields["quantity"] != CodeTooSmall {
+		t.Fatalf("expected a negative quantity to be too small, got %v", fields)
+	}
+}
+
+func TestOrderLimits(t *testing.T) {
+	limits := config.LimitsConfig{MaxOrderTotalCents: 100_000, Currencies: []string{"eur"}}
+
+	if err := Order(payments.Order{TotalCents: 100_000, Currency: "eur"}, limits); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fields := fieldsOf(t, Order(payments.Order{TotalCents: 100_001, Currency: "usd"}, limits))
+	if fields["quantity"] != CodeTooLarge || fields["currency"] != CodeNotAllowed {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+}
+
+func TestIsEmail(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"ada@example.com":          true,
+		"ada+shop@mail.example.fr": true,
+		"ada@localhost":            false,
+		"ada example.com":          false,
+		"<ada@example.com>":        false,
+	} {
+		if got := IsEmail(addr); got != want {
+			t.Fatalf("IsEmail(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestIsLocale(t *testing.T) {
+	for tag, want := range map[string]bool{
+		"fr":      true,
+		"en-GB":   true,
+		"zh-Hant": true,
+		"es-419":  true,
+		"french":  false,
+		"en_GB":   false,
+		"en-":     false,
+		"1a":      false,
+	} {
+		if got := IsLocale(tag); got != want {
+			t.Fatalf("IsLocale(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package statefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveThenLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "counts.json")
+
+	var missing map[string]int
+	if err := Load(path, &missing); err != nil || missing != nil {
+		t.Fatalf("expected a missing file to load nothing, got %v and %v", missing, err)
+	}
+
+	if err := Save(path, map[string]int{"LAUNCH": 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var counts map[string]int
+	if err := Load(path, &counts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if counts["LAUNCH"] != 2 {
+		t.Fatalf("expected the saved counts back, got %v", counts)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected no temporary files left behind, got %v (%v)", entries, err)
+	}
+}
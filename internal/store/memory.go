@@ -0,0 +1,210 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/statefile"
+)
+
+// state is what the store keeps across restarts.
+type state struct {
+	Orders        map[string]payments.Order        `json:"orders"`
+	Customers     map[string]payments.Customer     `json:"customers"`
+	Recoveries    []payments.RecoveryNotice        `json:"recoveries"`
+	Subscriptions map[string]payments.Subscription `json:"subscriptions"`
+}
+
+// Memory is an in-process store for payit's local records. A store made
+// with Open also keeps them in a file, so orders opened before a restart can
+// still be completed after it; the webhook log is never written to disk.
+type Memory struct {
+	// path is the file the records are kept in; empty keeps them in memory.
+	path string
+
+	mu         sync.RWMutex
+	state      state
+	deliveries []payments.WebhookDelivery
+}
+
+// maxWebhookDeliveries bounds the webhook log; older deliveries are dropped.
+const maxWebhookDeliveries = 500
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{state: state{
+		Orders:        make(map[string]payments.Order),
+		Customers:     make(map[string]payments.Customer),
+		Subscriptions: make(map[string]payments.Subscription),
+	}}
+}
+
+// Open returns a store like NewMemory whose records are kept in the file at
+// path, resuming those recorded there.
+func Open(path string) (*Memory, error) {
+	m := NewMemory()
+	m.path = path
+	if err := statefile.Load(path, &m.state); err != nil {
+		return nil, fmt.Errorf("load records: %w", err)
+	}
+	if m.state.Orders == nil {
+		m.state.Orders = make(map[string]payments.Order)
+	}
+	if m.state.Customers == nil {
+		m.state.Customers = make(map[string]payments.Customer)
+	}
+	if m.state.Subscriptions == nil {
+		m.state.Subscriptions = make(map[string]payments.Subscription)
+	}
+	return m, nil
+}
+
+// Records counts the orders, customers and subscriptions the store holds.
+func (m *Memory) Records() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.state.Orders) + len(m.state.Customers) + len(m.state.Subscriptions)
+}
+
+// save writes the records to disk. m.mu must be held for writing.
+func (m *Memory) save() error {
+	if m.path == "" {
+		return nil
+	}
+	if err := statefile.Save(m.path, m.state); err != nil {
+		return fmt.Errorf("save records: %w", err)
+	}
+	return nil
+}
+
+// SaveOrder inserts or replaces an order.
+func (m *Memory) SaveOrder(_ context.Context, order payments.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Orders[order.ID] = order
+	return m.save()
+}
+
+// Order returns the order with the given ID.
+func (m *Memory) Order(_ context.Context, id string) (payments.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	order, ok := m.state.Orders[id]
+	if !ok {
+		return payments.Order{}, payments.ErrNotFound
+	}
+	return order, nil
+}
+
+// Orders returns every order, newest first.
+func (m *Memory) Orders(_ context.Context) ([]payments.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	orders := make([]payments.Order, 0, len(m.state.Orders))
+	for _, o := range m.state.Orders {
+		orders = append(orders, o)
+	}
+	slices.SortFunc(orders, func(a, b payments.Order) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return orders, nil
+}
+
+// SaveCustomer inserts or replaces a customer.
+func (m *Memory) SaveCustomer(_ context.Context, customer payments.Customer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Customers[customer.ID] = customer
+	return m.save()
+}
+
+// Customer returns the customer with the given ID.
+func (m *Memory) Customer(_ context.Context, id string) (payments.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	customer, ok := m.state.Customers[id]
+	if !ok {
+		return payments.Customer{}, payments.ErrNotFound
+	}
+	return customer, nil
+}
+
+// CustomerByEmail returns the customer with the given email, ignoring case.
+func (m *Memory) CustomerByEmail(_ context.Context, email string) (payments.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, customer := range m.state.Customers {
+		if strings.EqualFold(customer.Email, email) {
+			return customer, nil
+		}
+	}
+	return payments.Customer{}, payments.ErrNotFound
+}
+
+// EnqueueRecovery appends a recovery notice to the outbox.
+func (m *Memory) EnqueueRecovery(_ context.Context, notice payments.RecoveryNotice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Recoveries = append(m.state.Recoveries, notice)
+	return m.save()
+}
+
+// DrainRecoveries removes and returns every queued recovery notice.
+func (m *Memory) DrainRecoveries(_ context.Context) ([]payments.RecoveryNotice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	notices := m.state.Recoveries
+	m.state.Recoveries = nil
+	if err := m.save(); err != nil {
+		m.state.Recoveries = notices
+		return nil, err
+	}
+	return notices, nil
+}
+
+// SaveSubscription inserts or replaces a subscription.
+func (m *Memory) SaveSubscription(_ context.Context, sub payments.Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Subscriptions[sub.ID] = sub
+	return m.save()
+}
+
+// Subscriptions returns every subscription, most recently updated first.
+func (m *Memory) Subscriptions(_ context.Context) ([]payments.Subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	subs := make([]payments.Subscription, 0, len(m.state.Subscriptions))
+	for _, sub := range m.state.Subscriptions {
+		subs = append(subs, sub)
+	}
+	slices.SortFunc(subs, func(a, b payments.Subscription) int {
+		return cmp.Or(b.UpdatedAt.Compare(a.UpdatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return subs, nil
+}
+
+// RecordWebhook appends a delivery to the webhook log.
+func (m *Memory) RecordWebhook(_ context.Context, delivery payments.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries = append(m.deliveries, delivery)
+	if over := len(m.deliveries) - maxWebhookDeliveries; over > 0 {
+		m.deliveries = slices.Delete(m.deliveries, 0, over)
+	}
+	return nil
+}
+
+// WebhookDeliveries returns logged webhook deliveries, newest first.
+func (m *Memory) WebhookDeliveries(_ context.Context) ([]payments.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	deliveries := slices.Clone(m.deliveries)
+	slices.Reverse(deliveries)
+	return deliveries, nil
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+func TestMemory_Orders(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Now()
+
+	if err := m.SaveOrder(ctx, payments.Order{ID: "old", CreatedAt: now.Add(-time.Hour)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.SaveOrder(ctx, payments.Order{ID: "new", CreatedAt: now}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := m.Order(ctx, "old")
+	if err != nil || got.ID != "old" {
+		t.Fatalf("unexpected lookup result: %#v, %v", got, err)
+	}
+	if _, err := m.Order(ctx, "missing"); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	all, err := m.Orders(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(all) != 2 || all[0].ID != "new" {
+		t.Fatalf("expected newest first, got %#v", all)
+	}
+}
+
+func TestMemory_OrdersBreakTiesByID(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Now()
+	for _, id := range []string{"cs_c", "cs_a", "cs_b"} {
+		if err := m.SaveOrder(ctx, payments.Order{ID: id, CreatedAt: now}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for range 5 {
+		all, _ := m.Orders(ctx)
+		if all[0].ID != "cs_a" || all[1].ID != "cs_b" || all[2].ID != "cs_c" {
+			t.Fatalf("expected orders created together in ID order, got %#v", all)
+		}
+	}
+}
+
+func TestMemory_Customers(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	if err := m.SaveCustomer(ctx, payments.Customer{ID: "cust_1", Email: "Ada@Example.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := m.CustomerByEmail(ctx, "ada@example.com")
+	if err != nil || got.ID != "cust_1" {
+		t.Fatalf("unexpected lookup result: %#v, %v", got, err)
+	}
+	if got, err := m.Customer(ctx, "cust_1"); err != nil || got.Email != "Ada@Example.com" {
+		t.Fatalf("unexpected lookup result: %#v, %v", got, err)
+	}
+	if _, err := m.CustomerByEmail(ctx, "grace@example.com"); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemory_RecoveryOutbox(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	if err := m.EnqueueRecovery(ctx, payments.RecoveryNotice{OrderID: "cs_1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	notices, err := m.DrainRecoveries(ctx)
+	if err != nil || len(notices) != 1 || notices[0].OrderID != "cs_1" {
+		t.Fatalf("unexpected drain result: %#v, %v", notices, err)
+	}
+	if again, _ := m.DrainRecoveries(ctx); len(again) != 0 {
+		t.Fatalf("expected outbox to be empty after draining, got %d", len(again))
+	}
+}
+
+func TestMemory_WebhookDeliveriesNewestFirstAndBounded(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	for i := range maxWebhookDeliveries + 5 {
+		if err := m.RecordWebhook(ctx, payments.WebhookDelivery{EventID: fmt.Sprintf("evt_%d", i)}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got, err := m.WebhookDeliveries(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != maxWebhookDeliveries {
+		t.Fatalf("expected log to be capped at %d, got %d", maxWebhookDeliveries, len(got))
+	}
+	if want := fmt.Sprintf("evt_%d", maxWebhookDeliveries+4); got[0].EventID != want {
+		t.Fatalf("expected newest delivery first, got %s", got[0].EventID)
+	}
+}
+
+func TestOpen_ResumesRecords(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "orders.json")
+	m, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.SaveOrder(ctx, payments.Order{ID: "cs_1", Status: payments.OrderStatusOpen, ReservationID: "res_1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.SaveCustomer(ctx, payments.Customer{ID: "cust_1", Email: "ada@example.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.SaveSubscription(ctx, payments.Subscription{ID: "sub_1", Status: "active"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resumed, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order, err := resumed.Order(ctx, "cs_1"); err != nil || order.ReservationID != "res_1" {
+		t.Fatalf("expected the open order to survive a restart, got %#v, %v", order, err)
+	}
+	if _, err := resumed.CustomerByEmail(ctx, "ada@example.com"); err != nil {
+		t.Fatalf("expected the customer to survive a restart, got %v", err)
+	}
+	if subs, _ := resumed.Subscriptions(ctx); len(subs) != 1 {
+		t.Fatalf("expected the subscription to survive a restart, got %#v", subs)
+	}
+}
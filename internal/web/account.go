@@ -0,0 +1,320 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjNemo/payit/internal/audit"
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/validate"
+)
+
+type accountService interface {
+	CustomerOrders(ctx context.Context, email string) ([]payments.Order, error)
+	CustomerOrder(ctx context.Context, email, id string) (payments.Order, error)
+	CustomerSubscriptions(ctx context.Context, email string) ([]payments.Subscription, error)
+	CancelSubscription(ctx context.Context, email, id string) (payments.Subscription, error)
+	SavedPaymentMethods(ctx context.Context, email string) ([]payments.PaymentMethod, error)
+	Repurchase(ctx context.Context, email, orderID, idempotencyKey string) (payments.Repurchase, error)
+}
+
+type accountAuth interface {
+	IssueLink(email string) string
+	Redeem(ctx context.Context, token string) (string, string, error)
+	Session(ctx context.Context, token string) (string, error)
+	Logout(ctx context.Context, token string)
+}
+
+type signInMailer interface {
+	SignInLink(ctx context.Context, email, url string) error
+}
+
+// accountCookie holds a customer's account session token. It is sent to the
+// whole site so checkouts can tell a signed-in customer is paying.
+const accountCookie = "payit_account"
+
+// accountPage carries the fields every account template reads from the layout.
+type accountPage struct {
+	Title string
+	// Email is the signed-in customer; empty on the sign-in pages.
+	Email  string
+	Error  string
+	Notice string
+}
+
+type accountLoginPage struct {
+	accountPage
+	Address string
+	// Sent confirms a sign-in link was requested for Address.
+	Sent bool
+}
+
+type accountVerifyPage struct {
+	accountPage
+	Token string
+}
+
+type accountHomePage struct {
+	accountPage
+	Orders        []payments.Order
+	Subscriptions []payments.Subscription
+	// Card is the saved card "Buy again" charges; nil sends the customer to checkout.
+	Card *payments.PaymentMethod
+	// RepurchaseKey is posted back with "Buy again" so a double click
+	// charges the card only once.
+	RepurchaseKey string
+}
+
+type accountReceiptPage struct {
+	accountPage
+	Order payments.Order
+}
+
+// accountCheckoutPage mounts the embedded checkout a repurchase fell back to.
+type accountCheckoutPage struct {
+	accountPage
+	StripePublishableKey string
+	ClientSecret         string
+}
+
+// requireCustomer only lets signed-in customers through, sending everyone
+// else to the sign-in form, and hands next the customer's email.
+func (h *Handler) requireCustomer(next func(w http.ResponseWriter, r *http.Request, email string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(accountCookie)
+		if err != nil {
+			http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+			return
+		}
+		email, err := h.accountAuth.Session(r.Context(), c.Value)
+		if err != nil {
+			http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+			return
+		}
+		next(w, r, email)
+	}
+}
+
+func (h *Handler) accountLoginForm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.renderAccount(w, http.StatusOK, "login.html", accountLoginPage{accountPage: accountPage{Title: "Your account"}})
+	}
+}
+
+// accountLogin emails a sign-in link. The response is the same whether or
+// not the address has ever paid, so it cannot be used to probe for buyers.
+// Every request counts against the sign-in throttle, so it cannot be used to
+// flood an inbox either.
+func (h *Handler) accountLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address := strings.TrimSpace(r.FormValue("email"))
+		data := accountLoginPage{accountPage: accountPage{Title: "Your account"}, Address: address}
+		if !validate.IsEmail(address) {
+			data.Error = "Enter the email address you paid with."
+			h.renderAccount(w, http.StatusUnprocessableEntity, "login.html", data)
+			return
+		}
+
+		throttleKeys := []string{"account-ip:" + clientIP(r), "account-email:" + strings.ToLower(address)}
+		if wait := h.logins.blocked(throttleKeys...); wait > 0 {
+			log.Printf("account: throttled sign-in link for %q from %s", address, clientIP(r))
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+			data.Error = "Too many sign-in links requested. Try again later."
+			h.renderAccount(w, http.StatusTooManyRequests, "login.html", data)
+			return
+		}
+		h.logins.fail(throttleKeys...)
+
+		link := h.cfg.PublicURL + "/account/verify?token=" + url.QueryEscape(h.accountAuth.IssueLink(address))
+		if err := h.mailer.SignInLink(r.Context(), address, link); err != nil {
+			log.Printf("account: send sign-in link: %v", err)
+			data.Error = "We couldn't send the email. Please try again in a moment."
+			h.renderAccount(w, http.StatusServiceUnavailable, "login.html", data)
+			return
+		}
+		data.Sent = true
+		h.renderAccount(w, http.StatusOK, "login.html", data)
+	}
+}
+
+// accountVerifyForm asks the buyer to confirm the sign-in. Mail scanners and
+// link previews fetch emailed links on their own, so following the link must
+// not spend it; only the confirming POST does.
+func (h *Handler) accountVerifyForm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := accountVerifyPage{accountPage: accountPage{Title: "Your account"}, Token: r.URL.Query().Get("token")}
+		h.renderAccount(w, http.StatusOK, "verify.html", data)
+	}
+}
+
+func (h *Handler) accountVerify() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _, err := h.accountAuth.Redeem(r.Context(), r.PostFormValue("token"))
+		if err != nil {
+			data := accountLoginPage{accountPage: accountPage{Title: "Your account", Error: "That sign-in link is invalid. Request a new one below."}}
+			switch {
+			case errors.Is(err, auth.ErrLinkExpired):
+				data.Error = "That sign-in link has expired. Request a new one below."
+			case errors.Is(err, auth.ErrLinkUsed):
+				data.Error = "That sign-in link has already been used. Request a new one below."
+			}
+			h.renderAccount(w, http.StatusUnauthorized, "login.html", data)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     accountCookie,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(h.cfg.Accounts.SessionTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(h.cfg.PublicURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+	}
+}
+
+func (h *Handler) accountLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(accountCookie); err == nil {
+			h.accountAuth.Logout(r.Context(), c.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: accountCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+		http.Redirect(w, r, "/account/login", http.StatusSeeOther)
+	}
+}
+
+func (h *Handler) accountHome() http.HandlerFunc {
+	return h.requireCustomer(func(w http.ResponseWriter, r *http.Request, email string) {
+		data := accountHomePage{accountPage: accountPage{Title: "Your account", Email: email}}
+		switch r.URL.Query().Get("done") {
+		case "canceled":
+			data.Notice = "Your subscription will end at the close of the current period."
+		case "repurchased":
+			data.Notice = "Thanks! Your new order is paid and on its way."
+		}
+		status := http.StatusOK
+
+		orders, ordersErr := h.accounts.CustomerOrders(r.Context(), email)
+		subs, subsErr := h.accounts.CustomerSubscriptions(r.Context(), email)
+		cards, cardsErr := h.accounts.SavedPaymentMethods(r.Context(), email)
+		if err := errors.Join(ordersErr, subsErr); err != nil {
+			log.Printf("account: load account: %v", err)
+			status, data.Error = http.StatusInternalServerError, "Your account could not be loaded."
+		}
+		if cardsErr != nil {
+			// Buying again still works through checkout.
+			log.Printf("account: load saved cards: %v", cardsErr)
+		}
+		data.Orders, data.Subscriptions = orders, subs
+		if len(cards) > 0 {
+			data.Card = &cards[0]
+		}
+		data.RepurchaseKey = rand.Text()
+
+		h.renderAccount(w, status, "account.html", data)
+	})
+}
+
+func (h *Handler) accountReceipt() http.HandlerFunc {
+	return h.requireCustomer(func(w http.ResponseWriter, r *http.Request, email string) {
+		order, err := h.accounts.CustomerOrder(r.Context(), email, r.PathValue("id"))
+		if errors.Is(err, payments.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("account: load receipt: %v", err)
+			http.Error(w, "receipt could not be loaded", http.StatusInternalServerError)
+			return
+		}
+		data := accountReceiptPage{accountPage: accountPage{Title: "Receipt", Email: email}, Order: order}
+		h.renderAccount(w, http.StatusOK, "receipt.html", data)
+	})
+}
+
+func (h *Handler) accountCancelSubscription() http.HandlerFunc {
+	return h.requireCustomer(func(w http.ResponseWriter, r *http.Request, email string) {
+		ctx := audit.WithActor(r.Context(), "customer:"+email)
+		if _, err := h.accounts.CancelSubscription(ctx, email, r.PathValue("id")); err != nil {
+			if errors.Is(err, payments.ErrNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			log.Printf("account: cancel subscription %s: %v", r.PathValue("id"), err)
+			http.Error(w, "subscription could not be canceled", http.StatusBadGateway)
+			return
+		}
+		http.Redirect(w, r, "/account?done=canceled", http.StatusSeeOther)
+	})
+}
+
+// accountRepurchase buys an earlier order again, charging the customer's
+// saved card or, when that needs them, sending them to checkout.
+func (h *Handler) accountRepurchase() http.HandlerFunc {
+	return h.requireCustomer(func(w http.ResponseWriter, r *http.Request, email string) {
+		result, err := h.accounts.Repurchase(r.Context(), email, r.PathValue("id"), r.FormValue("key"))
+		if err != nil {
+			status, msg := checkoutErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				log.Printf("account: repurchase %s: %v", r.PathValue("id"), err)
+				status, msg = http.StatusBadGateway, "your order could not be placed"
+			}
+			http.Error(w, msg, status)
+			return
+		}
+
+		switch {
+		case result.Order != nil:
+			http.Redirect(w, r, "/account?done=repurchased", http.StatusSeeOther)
+		case result.Checkout.URL != "":
+			http.Redirect(w, r, result.Checkout.URL, http.StatusSeeOther)
+		default:
+			data := accountCheckoutPage{
+				accountPage:          accountPage{Title: "Confirm your payment", Email: email},
+				StripePublishableKey: h.cfg.StripePublishableKey,
+				ClientSecret:         result.Checkout.ClientSecret,
+			}
+			h.renderAccount(w, http.StatusOK, "checkout.html", data)
+		}
+	})
+}
+
+// forSignedInCustomer links a storefront checkout to the signed-in customer,
+// if any, and saves the card they pay with so they can buy again from their
+// account. Only checkouts under the customer's own email are linked.
+func (h *Handler) forSignedInCustomer(r *http.Request, req *payments.CheckoutSessionRequest) {
+	if h.accountAuth == nil {
+		return
+	}
+	c, err := r.Cookie(accountCookie)
+	if err != nil {
+		return
+	}
+	email, err := h.accountAuth.Session(r.Context(), c.Value)
+	if err != nil {
+		return
+	}
+	if req.CustomerEmail == "" {
+		req.CustomerEmail = email
+	}
+	req.EmailVerified = strings.EqualFold(req.CustomerEmail, email)
+	req.SavePaymentMethod = req.EmailVerified
+}
+
+func (h *Handler) renderAccount(w http.ResponseWriter, status int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := h.accountPages.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("account: render %s: %v", name, err)
+	}
+}
@@ -0,0 +1,318 @@
+package web
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+	webassets "github.com/rjNemo/payit/web"
+)
+
+type fakeAccountService struct {
+	orders     []payments.Order
+	subs       []payments.Subscription
+	cards      []payments.PaymentMethod
+	canceled   []string
+	repurchase payments.Repurchase
+	// repurchased records "orderID:key" per repurchase.
+	repurchased []string
+}
+
+func (f *fakeAccountService) CustomerOrders(ctx context.Context, email string) ([]payments.Order, error) {
+	var owned []payments.Order
+	for _, o := range f.orders {
+		if o.CustomerEmail == email {
+			owned = append(owned, o)
+		}
+	}
+	return owned, nil
+}
+
+func (f *fakeAccountService) CustomerOrder(ctx context.Context, email, id string) (payments.Order, error) {
+	for _, o := range f.orders {
+		if o.ID == id && o.CustomerEmail == email {
+			return o, nil
+		}
+	}
+	return payments.Order{}, payments.ErrNotFound
+}
+
+func (f *fakeAccountService) CustomerSubscriptions(ctx context.Context, email string) ([]payments.Subscription, error) {
+	return f.subs, nil
+}
+
+func (f *fakeAccountService) CancelSubscription(ctx context.Context, email, id string) (payments.Subscription, error) {
+	f.canceled = append(f.canceled, id)
+	return payments.Subscription{ID: id, CancelAtPeriodEnd: true}, nil
+}
+
+func (f *fakeAccountService) SavedPaymentMethods(ctx context.Context, email string) ([]payments.PaymentMethod, error) {
+	return f.cards, nil
+}
+
+func (f *fakeAccountService) Repurchase(ctx context.Context, email, orderID, key string) (payments.Repurchase, error) {
+	if _, err := f.CustomerOrder(ctx, email, orderID); err != nil {
+		return payments.Repurchase{}, err
+	}
+	f.repurchased = append(f.repurchased, orderID+":"+key)
+	return f.repurchase, nil
+}
+
+type fakeMailer struct {
+	to, link string
+}
+
+func (f *fakeMailer) SignInLink(ctx context.Context, email, link string) error {
+	f.to, f.link = email, link
+	return nil
+}
+
+func newAccountTestServer(t *testing.T, svc *fakeAccountService) (http.Handler, *fakeMailer) {
+	t.Helper()
+	pages, err := template.New("account").Funcs(adminFuncs).ParseFS(webassets.Assets, "templates/account/*.html")
+	if err != nil {
+		t.Fatalf("parse account templates: %v", err)
+	}
+	accounts := config.AccountConfig{Enabled: true, LinkTTL: time.Minute, SessionTTL: time.Hour}
+	mailer := &fakeMailer{}
+	h := &Handler{
+		cfg:          config.Config{PublicURL: "https://shop.example", Accounts: accounts},
+		accounts:     svc,
+		accountAuth:  auth.NewAccounts(accounts),
+		mailer:       mailer,
+		accountPages: pages,
+		logins:       newLoginThrottle(),
+	}
+	mux := http.NewServeMux()
+	h.registerAccountRoutes(mux)
+	return mux, mailer
+}
+
+// signIn requests a magic link for email and follows it, returning the
+// account session cookie.
+func signIn(t *testing.T, srv http.Handler, mailer *fakeMailer, email string) *http.Cookie {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/account/login", strings.NewReader(url.Values{"email": {email}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || mailer.to != email || !strings.HasPrefix(mailer.link, "https://shop.example/account/verify?token=") {
+		t.Fatalf("expected a sign-in link to be emailed, got %d %q %q", rec.Code, mailer.to, mailer.link)
+	}
+
+	rec = followLink(t, srv, mailer.link)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/account" {
+		t.Fatalf("expected the link to sign in, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == accountCookie {
+			return c
+		}
+	}
+	t.Fatal("expected an account session cookie")
+	return nil
+}
+
+// followLink opens an emailed sign-in link, which only asks for
+// confirmation, then confirms it.
+func followLink(t *testing.T, srv http.Handler, link string) *httptest.ResponseRecorder {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse link: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+	if rec.Code != http.StatusOK || len(rec.Result().Cookies()) != 0 || !strings.Contains(rec.Body.String(), `action="/account/verify"`) {
+		t.Fatalf("expected a confirmation form without signing in, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/account/verify", strings.NewReader(url.Values{"token": {u.Query().Get("token")}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAccountRequiresSignIn(t *testing.T) {
+	srv, _ := newAccountTestServer(t, &fakeAccountService{})
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/account", nil))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/account/login" {
+		t.Fatalf("expected a redirect to sign in, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = followLink(t, srv, "https://shop.example/account/verify?token=forged.token")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "invalid") {
+		t.Fatalf("expected a forged link to be refused, got %d", rec.Code)
+	}
+}
+
+func TestAccountLinksAreThrottledAndSingleUse(t *testing.T) {
+	srv, mailer := newAccountTestServer(t, &fakeAccountService{})
+	signIn(t, srv, mailer, "ada@example.com")
+
+	rec := followLink(t, srv, mailer.link)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "already been used") {
+		t.Fatalf("expected a used link to be refused, got %d", rec.Code)
+	}
+
+	var code int
+	for range maxLoginFailures {
+		req := httptest.NewRequest(http.MethodPost, "/account/login", strings.NewReader(url.Values{"email": {"ada@example.com"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		code = rec.Code
+	}
+	if code != http.StatusTooManyRequests {
+		t.Fatalf("expected repeated link requests to be throttled, got %d", code)
+	}
+}
+
+func TestAccountListsOrdersAndSubscriptions(t *testing.T) {
+	svc := &fakeAccountService{
+		orders: []payments.Order{
+			{ID: "cs_1", Status: payments.OrderStatusPaid, CustomerEmail: "ada@example.com", TotalCents: 2500, Currency: "eur"},
+			{ID: "cs_2", Status: payments.OrderStatusPaid, CustomerEmail: "grace@example.com", TotalCents: 900, Currency: "eur"},
+		},
+		subs: []payments.Subscription{
+			{ID: "sub_1", Status: "active", AmountCents: 999, Currency: "eur", Interval: "month"},
+			{ID: "sub_2", Status: "past_due", AmountCents: 500, Currency: "eur", Interval: "month", Dunning: &payments.Dunning{PaymentUpdateURL: "https://pay.example/inv_2"}},
+		},
+	}
+	srv, mailer := newAccountTestServer(t, svc)
+	cookie := signIn(t, srv, mailer, "ada@example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/account", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "/account/orders/cs_1") || strings.Contains(body, "cs_2") {
+		t.Fatalf("expected only ada's orders, got %d %s", rec.Code, body)
+	}
+	if !strings.Contains(body, "/account/subscriptions/sub_1/cancel") {
+		t.Fatalf("expected a cancel link for the subscription, got %s", body)
+	}
+	if !strings.Contains(body, `href="https://pay.example/inv_2"`) {
+		t.Fatalf("expected a payment update link for the failed renewal, got %s", body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/account/orders/cs_2", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected someone else's receipt to be hidden, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/account/orders/cs_1", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "25.00 EUR") {
+		t.Fatalf("expected the receipt, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAccountCancelsSubscription(t *testing.T) {
+	svc := &fakeAccountService{subs: []payments.Subscription{{ID: "sub_1", Status: "active"}}}
+	srv, mailer := newAccountTestServer(t, svc)
+	cookie := signIn(t, srv, mailer, "ada@example.com")
+
+	req := httptest.NewRequest(http.MethodPost, "/account/subscriptions/sub_1/cancel", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther || len(svc.canceled) != 1 || svc.canceled[0] != "sub_1" {
+		t.Fatalf("expected the subscription to be canceled, got %d %v", rec.Code, svc.canceled)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/account/logout", nil)
+	req.AddCookie(cookie)
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodGet, "/account", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected the session to end on sign out, got %d", rec.Code)
+	}
+}
+
+func TestAccountRepurchase(t *testing.T) {
+	svc := &fakeAccountService{
+		orders: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusPaid, CustomerEmail: "ada@example.com"}},
+		cards:  []payments.PaymentMethod{{ID: "pm_1", Brand: "visa", Last4: "4242"}},
+	}
+	srv, mailer := newAccountTestServer(t, svc)
+	cookie := signIn(t, srv, mailer, "ada@example.com")
+	buyAgain := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/account/orders/cs_1/repurchase", strings.NewReader("key=click-1"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/account", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "visa card ending 4242") || !strings.Contains(body, "/account/orders/cs_1/repurchase") {
+		t.Fatalf("expected a buy again button on the saved card, got %s", body)
+	}
+
+	svc.repurchase = payments.Repurchase{Order: &payments.Order{ID: "pi_1", Status: payments.OrderStatusPaid}}
+	rec = buyAgain()
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/account?done=repurchased" || svc.repurchased[0] != "cs_1:click-1" {
+		t.Fatalf("expected the card to be charged, got %d %q %v", rec.Code, rec.Header().Get("Location"), svc.repurchased)
+	}
+
+	svc.repurchase = payments.Repurchase{Checkout: &payments.CheckoutSessionResult{ID: "cs_2", URL: "https://checkout.stripe.com/cs_2"}}
+	rec = buyAgain()
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "https://checkout.stripe.com/cs_2" {
+		t.Fatalf("expected a redirect to checkout when the bank wants the customer, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	svc.repurchase = payments.Repurchase{Checkout: &payments.CheckoutSessionResult{ID: "cs_3", ClientSecret: "cs_3_secret"}}
+	rec = buyAgain()
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `data-client-secret="cs_3_secret"`) {
+		t.Fatalf("expected the embedded checkout to be mounted, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCheckoutSavesCardForSignedInCustomer(t *testing.T) {
+	accounts := auth.NewAccounts(config.AccountConfig{LinkTTL: time.Minute, SessionTTL: time.Hour})
+	session, _, err := accounts.Redeem(context.Background(), accounts.IssueLink("ada@example.com"))
+	if err != nil {
+		t.Fatalf("sign in: %v", err)
+	}
+	h := &Handler{accountAuth: accounts}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout", nil)
+	req.AddCookie(&http.Cookie{Name: accountCookie, Value: session})
+	checkout := payments.CheckoutSessionRequest{}
+	h.forSignedInCustomer(req, &checkout)
+	if checkout.CustomerEmail != "ada@example.com" || !checkout.EmailVerified || !checkout.SavePaymentMethod {
+		t.Fatalf("expected the checkout to save the card for ada, got %#v", checkout)
+	}
+
+	checkout = payments.CheckoutSessionRequest{CheckoutSessionRequest: payit.CheckoutSessionRequest{CustomerEmail: "grace@example.com"}}
+	h.forSignedInCustomer(req, &checkout)
+	if checkout.EmailVerified || checkout.SavePaymentMethod {
+		t.Fatal("expected no card to be saved for someone else's email")
+	}
+}
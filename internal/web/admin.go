@@ -0,0 +1,301 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type adminService interface {
+	Orders(ctx context.Context, filter payments.OrderFilter) ([]payments.Order, error)
+	Order(ctx context.Context, id string) (payments.Order, error)
+	RefundOrder(ctx context.Context, id string, amountCents int64) (payments.Order, error)
+	CaptureOrder(ctx context.Context, id string) (payments.Order, error)
+	Subscriptions(ctx context.Context) ([]payments.Subscription, error)
+}
+
+type webhookLog interface {
+	RecordWebhook(ctx context.Context, delivery payments.WebhookDelivery) error
+	WebhookDeliveries(ctx context.Context) ([]payments.WebhookDelivery, error)
+}
+
+// adminPage carries the fields every admin template reads from the layout.
+type adminPage struct {
+	Title   string
+	Section string
+	// User is the signed-in staff member; empty for API key callers.
+	User   string
+	Error  string
+	Notice string
+}
+
+func newAdminPage(r *http.Request, title, section string) adminPage {
+	page := adminPage{Title: title, Section: section}
+	if p, ok := auth.FromContext(r.Context()); ok {
+		page.User = p.Name
+	}
+	return page
+}
+
+type adminOrdersPage struct {
+	adminPage
+	Filter   payments.OrderFilter
+	From     string
+	To       string
+	Statuses []payments.OrderStatus
+	Orders   []payments.Order
+}
+
+type adminOrderPage struct {
+	adminPage
+	Order      payments.Order
+	CanCapture bool
+	CanRefund  bool
+	Refundable int64
+}
+
+type adminSubscriptionsPage struct {
+	adminPage
+	Subscriptions []payments.Subscription
+}
+
+type adminWebhooksPage struct {
+	adminPage
+	Deliveries []payments.WebhookDelivery
+}
+
+var orderStatuses = []payments.OrderStatus{
+	payments.OrderStatusOpen,
+	payments.OrderStatusAuthorized,
+	payments.OrderStatusPaid,
+	payments.OrderStatusRefunded,
+	payments.OrderStatusExpired,
+	payments.OrderStatusFailed,
+	payments.OrderStatusCanceled,
+}
+
+// adminNotices are the confirmations shown after a redirect from an admin action.
+var adminNotices = map[string]string{
+	"refunded": "Refund issued.",
+	"captured": "Payment captured.",
+}
+
+var adminFuncs = template.FuncMap{
+	"money": func(cents int64, currency string) string {
+		return fmt.Sprintf("%s %s", payments.FormatDecimal(cents), strings.ToUpper(currency))
+	},
+	"decimal": payments.FormatDecimal,
+	"datetime": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04 MST")
+	},
+}
+
+func (h *Handler) adminOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		data := adminOrdersPage{
+			adminPage: newAdminPage(r, "Orders", "orders"),
+			Filter: payments.OrderFilter{
+				Status: payments.OrderStatus(q.Get("status")),
+				Email:  strings.TrimSpace(q.Get("email")),
+			},
+			From:     q.Get("from"),
+			To:       q.Get("to"),
+			Statuses: orderStatuses,
+		}
+
+		status := http.StatusOK
+		var err error
+		if data.From != "" {
+			if data.Filter.From, err = time.Parse(time.DateOnly, data.From); err != nil {
+				status, data.Error = http.StatusBadRequest, "From must be a date formatted as YYYY-MM-DD."
+			}
+		}
+		if data.To != "" {
+			to, err := time.Parse(time.DateOnly, data.To)
+			if err != nil {
+				status, data.Error = http.StatusBadRequest, "To must be a date formatted as YYYY-MM-DD."
+			}
+			// The end date is inclusive in the form.
+			data.Filter.To = to.AddDate(0, 0, 1)
+		}
+
+		if status == http.StatusOK {
+			data.Orders, err = h.admin.Orders(r.Context(), data.Filter)
+			if err != nil {
+				log.Printf("admin: list orders: %v", err)
+				status, data.Error = http.StatusInternalServerError, "Orders could not be loaded."
+			}
+		}
+
+		h.renderAdmin(w, status, "orders.html", data)
+	}
+}
+
+func (h *Handler) adminOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		order, err := h.admin.Order(r.Context(), r.PathValue("id"))
+		if err != nil {
+			status, msg := adminErrorStatus(err)
+			http.Error(w, msg, status)
+			return
+		}
+
+		data := newAdminOrderPage(r, order)
+		data.Notice = adminNotices[r.URL.Query().Get("done")]
+		h.renderAdmin(w, http.StatusOK, "order.html", data)
+	}
+}
+
+func (h *Handler) adminRefundOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		amount, err := parseDecimalCents(r.FormValue("amount"))
+		if err != nil {
+			h.renderOrderError(w, r, id, http.StatusBadRequest, "Amount must be a positive number such as 12.50.")
+			return
+		}
+
+		if _, err := h.admin.RefundOrder(r.Context(), id, amount); err != nil {
+			log.Printf("admin: refund order %s: %v", id, err)
+			status, msg := adminErrorStatus(err)
+			h.renderOrderError(w, r, id, status, msg)
+			return
+		}
+		http.Redirect(w, r, "/admin/orders/"+id+"?done=refunded", http.StatusSeeOther)
+	}
+}
+
+func (h *Handler) adminCaptureOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, err := h.admin.CaptureOrder(r.Context(), id); err != nil {
+			log.Printf("admin: capture order %s: %v", id, err)
+			status, msg := adminErrorStatus(err)
+			h.renderOrderError(w, r, id, status, msg)
+			return
+		}
+		http.Redirect(w, r, "/admin/orders/"+id+"?done=captured", http.StatusSeeOther)
+	}
+}
+
+func (h *Handler) adminSubscriptions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := adminSubscriptionsPage{adminPage: newAdminPage(r, "Subscriptions", "subscriptions")}
+		status := http.StatusOK
+
+		subs, err := h.admin.Subscriptions(r.Context())
+		if err != nil {
+			log.Printf("admin: list subscriptions: %v", err)
+			status, data.Error = http.StatusInternalServerError, "Subscriptions could not be loaded."
+		}
+		data.Subscriptions = subs
+
+		h.renderAdmin(w, status, "subscriptions.html", data)
+	}
+}
+
+func (h *Handler) adminWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := adminWebhooksPage{adminPage: newAdminPage(r, "Webhook deliveries", "webhooks")}
+		status := http.StatusOK
+
+		if h.webhookLog != nil {
+			deliveries, err := h.webhookLog.WebhookDeliveries(r.Context())
+			if err != nil {
+				log.Printf("admin: list webhook deliveries: %v", err)
+				status, data.Error = http.StatusInternalServerError, "Webhook deliveries could not be loaded."
+			}
+			data.Deliveries = deliveries
+		}
+
+		h.renderAdmin(w, status, "webhooks.html", data)
+	}
+}
+
+// newAdminOrderPage offers refund and capture buttons only when the order
+// allows them and the caller holds refunds:write.
+func newAdminOrderPage(r *http.Request, order payments.Order) adminOrderPage {
+	p, _ := auth.FromContext(r.Context())
+	canMoveMoney := p.Can(auth.ScopeRefundsWrite)
+	return adminOrderPage{
+		adminPage:  newAdminPage(r, "Order "+order.ID, "orders"),
+		Order:      order,
+		CanCapture: canMoveMoney && order.Status == payments.OrderStatusAuthorized,
+		CanRefund:  canMoveMoney && order.Status == payments.OrderStatusPaid && order.PaymentIntentID != "",
+		Refundable: order.TotalCents - order.RefundedCents,
+	}
+}
+
+// renderOrderError re-renders the order page with an error after a failed action.
+func (h *Handler) renderOrderError(w http.ResponseWriter, r *http.Request, id string, status int, msg string) {
+	order, err := h.admin.Order(r.Context(), id)
+	if err != nil {
+		http.Error(w, msg, status)
+		return
+	}
+	data := newAdminOrderPage(r, order)
+	data.Error = msg
+	h.renderAdmin(w, status, "order.html", data)
+}
+
+func (h *Handler) renderAdmin(w http.ResponseWriter, status int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := h.adminPages.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("admin: render %s: %v", name, err)
+	}
+}
+
+// adminErrorStatus maps admin action errors to an HTTP status and a message
+// for staff.
+func adminErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, payments.ErrNotFound):
+		return http.StatusNotFound, "order not found"
+	case errors.Is(err, payments.ErrNotRefundable), errors.Is(err, payments.ErrNotCapturable):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, payments.ErrProviderUnavailable):
+		return http.StatusServiceUnavailable, "the payment provider is unavailable, try again shortly"
+	case errors.Is(err, payments.ErrProviderRejected):
+		return http.StatusBadGateway, "the payment provider rejected the request"
+	default:
+		return http.StatusInternalServerError, "the action could not be completed"
+	}
+}
+
+// parseDecimalCents turns an amount in major units such as "12.5" into cents.
+// An empty amount parses as zero, meaning "everything that is left".
+func parseDecimalCents(raw string) (int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	whole, frac, _ := strings.Cut(raw, ".")
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("amount %q has more than two decimals", raw)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q: %w", raw, err)
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q: %w", raw, err)
+	}
+	total := units*100 + cents
+	if units < 0 || total <= 0 {
+		return 0, fmt.Errorf("amount %q must be positive", raw)
+	}
+	return total, nil
+}
@@ -0,0 +1,336 @@
+package web
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/audit"
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/payments"
+	webassets "github.com/rjNemo/payit/web"
+)
+
+type fakeAdminService struct {
+	orders   []payments.Order
+	filter   payments.OrderFilter
+	refunded int64
+	captured string
+	err      error
+}
+
+func (f *fakeAdminService) Orders(ctx context.Context, filter payments.OrderFilter) ([]payments.Order, error) {
+	f.filter = filter
+	return f.orders, nil
+}
+
+func (f *fakeAdminService) Order(ctx context.Context, id string) (payments.Order, error) {
+	for _, o := range f.orders {
+		if o.ID == id {
+			return o, nil
+		}
+	}
+	return payments.Order{}, payments.ErrNotFound
+}
+
+func (f *fakeAdminService) RefundOrder(ctx context.Context, id string, amountCents int64) (payments.Order, error) {
+	f.refunded = amountCents
+	return payments.Order{}, f.err
+}
+
+func (f *fakeAdminService) CaptureOrder(ctx context.Context, id string) (payments.Order, error) {
+	f.captured = id
+	return payments.Order{}, f.err
+}
+
+func (f *fakeAdminService) Subscriptions(ctx context.Context) ([]payments.Subscription, error) {
+	return nil, nil
+}
+
+// Test credentials: opsKey holds every scope, readKey only orders:read, and
+// the "admin" user logs in with adminPassword.
+const (
+	opsKey        = "ops-key"
+	readKey       = "read-key"
+	meterKey      = "meter-key"
+	adminPassword = "s3cret"
+)
+
+func newAdminTestPages(t *testing.T) *template.Template {
+	t.Helper()
+	pages, err := template.New("admin").Funcs(adminFuncs).ParseFS(webassets.Assets, "templates/admin/*.html")
+	if err != nil {
+		t.Fatalf("parse admin templates: %v", err)
+	}
+	return pages
+}
+
+func newAdminTestServer(t *testing.T, svc *fakeAdminService) http.Handler {
+	t.Helper()
+	h := newAuthTestHandler(t)
+	h.admin = svc
+	h.adminPages = newAdminTestPages(t)
+	mux := http.NewServeMux()
+	h.registerAdminRoutes(mux)
+	return mux
+}
+
+// newAuthTestHandler returns a Handler that accepts the test credentials.
+func newAuthTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	adminCfg := config.AdminConfig{
+		Users: []config.AdminUserConfig{{Username: "admin", PasswordHash: string(hash)}},
+		APIKeys: []config.APIKeyConfig{
+			{ID: "ops", Hash: auth.HashAPIKey(opsKey), Scopes: []string{"orders:read", "refunds:write"}},
+			{ID: "reader", Hash: auth.HashAPIKey(readKey), Scopes: []string{"orders:read"}},
+			{ID: "meter", Hash: auth.HashAPIKey(meterKey), Scopes: []string{"usage:write"}},
+		},
+		SessionTTL: time.Hour,
+	}
+	authenticator, err := auth.NewAuthenticator(adminCfg)
+	if err != nil {
+		t.Fatalf("build authenticator: %v", err)
+	}
+	return &Handler{cfg: config.Config{Admin: adminCfg}, auth: authenticator, logins: newLoginThrottle()}
+}
+
+func TestAdminRequiresCredentials(t *testing.T) {
+	srv := newAdminTestServer(t, &fakeAdminService{})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/orders", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+
+	// Browsers without a session are sent to the login form instead.
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/orders/cs_1", nil))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/login?next=/admin/orders/cs_1" {
+		t.Fatalf("expected redirect to login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestAdminEnforcesScopes(t *testing.T) {
+	svc := &fakeAdminService{orders: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusPaid, PaymentIntentID: "pi_1", TotalCents: 5000}}}
+	srv := newAdminTestServer(t, svc)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/orders/cs_1", nil)
+	req.Header.Set("Authorization", "Bearer "+readKey)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected read access, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "/refund") {
+		t.Fatal("expected refund form to be hidden without refunds:write")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/orders/cs_1/refund", nil)
+	req.Header.Set("Authorization", "Bearer "+readKey)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || svc.refunded != 0 {
+		t.Fatalf("expected refund to be forbidden, got %d", rec.Code)
+	}
+}
+
+func TestAdminLoginSession(t *testing.T) {
+	srv := newAdminTestServer(t, &fakeAdminService{})
+
+	login := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"admin"}, "password": {password}, "next": {"/admin/webhooks"}}
+		req := httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := login("wrong"); rec.Code != http.StatusUnauthorized || len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("expected failed login, got %d", rec.Code)
+	}
+
+	rec := login(adminPassword)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/webhooks" {
+		t.Fatalf("expected redirect after login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected session cookie: %#v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/webhooks", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Sign out") {
+		t.Fatalf("expected signed-in page, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/logout", nil)
+	req.AddCookie(cookies[0])
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/webhooks", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected session to end on logout, got %d", rec.Code)
+	}
+}
+
+func TestAdminLoginThrottlesRepeatedFailures(t *testing.T) {
+	srv := newAdminTestServer(t, &fakeAdminService{})
+
+	login := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"admin"}, "password": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for range maxLoginFailures {
+		if rec := login("wrong"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected failed login, got %d", rec.Code)
+		}
+	}
+	rec := login(adminPassword)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" || len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("expected the correct password to be refused while throttled, got %d", rec.Code)
+	}
+}
+
+func TestAdminOrdersFilters(t *testing.T) {
+	svc := &fakeAdminService{orders: []payments.Order{
+		{ID: "cs_1", Status: payments.OrderStatusPaid, CustomerEmail: "ana@example.com", TotalCents: 1999, Currency: "eur", CreatedAt: time.Now()},
+	}}
+	srv := newAdminTestServer(t, svc)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/orders?status=paid&email=ana&from=2026-03-01&to=2026-03-31", nil)
+	req.Header.Set("Authorization", "Bearer "+opsKey)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := payments.OrderFilter{
+		Status: payments.OrderStatusPaid,
+		Email:  "ana",
+		From:   time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if svc.filter != want {
+		t.Fatalf("unexpected filter: %#v", svc.filter)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "cs_1") || !strings.Contains(body, "19.99 EUR") {
+		t.Fatalf("expected order row in page, got:\n%s", body)
+	}
+}
+
+func TestAdminRefundOrder(t *testing.T) {
+	svc := &fakeAdminService{orders: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusPaid, PaymentIntentID: "pi_1", TotalCents: 5000}}}
+	srv := newAdminTestServer(t, svc)
+
+	form := url.Values{"amount": {"12.5"}}
+	req := httptest.NewRequest(http.MethodPost, "/admin/orders/cs_1/refund", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+opsKey)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/admin/orders/cs_1?done=refunded" {
+		t.Fatalf("expected redirect to order, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if svc.refunded != 1250 {
+		t.Fatalf("expected 1250 cents refunded, got %d", svc.refunded)
+	}
+}
+
+func TestAdminRefundOrderRejected(t *testing.T) {
+	svc := &fakeAdminService{
+		orders: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusRefunded}},
+		err:    payments.ErrNotRefundable,
+	}
+	srv := newAdminTestServer(t, svc)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/orders/cs_1/refund", nil)
+	req.Header.Set("Authorization", "Bearer "+opsKey)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "cannot be refunded") {
+		t.Fatalf("expected conflict page, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminRejectsCrossOriginActions(t *testing.T) {
+	svc := &fakeAdminService{orders: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusAuthorized}}}
+	srv := newAdminTestServer(t, svc)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/orders/cs_1/capture", nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	req.Header.Set("Authorization", "Bearer "+opsKey)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden || svc.captured != "" {
+		t.Fatalf("expected cross-origin capture to be blocked, got %d", rec.Code)
+	}
+}
+
+func TestParseDecimalCents(t *testing.T) {
+	cases := map[string]int64{"": 0, "12": 1200, "12.5": 1250, "0.05": 5}
+	for raw, want := range cases {
+		got, err := parseDecimalCents(raw)
+		if err != nil || got != want {
+			t.Fatalf("parseDecimalCents(%q) = %d, %v; want %d", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"-1", "1.234", "abc", "0"} {
+		if _, err := parseDecimalCents(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestAdminAuditShowsBrokenChain(t *testing.T) {
+	entries := []audit.Entry{{Seq: 1, Action: payments.AuditOrderRefund, Target: "cs_1", Hash: "forged"}}
+	h := &Handler{auditTrail: fakeAuditTrail(entries), adminPages: newAdminTestPages(t)}
+
+	rec := httptest.NewRecorder()
+	h.adminAudit()(rec, httptest.NewRequest(http.MethodGet, "/admin/audit", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Hash chain broken: audit entry 1") {
+		t.Fatalf("expected broken chain warning, got %d:\n%s", rec.Code, rec.Body.String())
+	}
+}
+
+type fakeAuditTrail []audit.Entry
+
+func (f fakeAuditTrail) Entries(ctx context.Context) ([]audit.Entry, error) {
+	return f, nil
+}
+
+func (f fakeAuditTrail) Verify(ctx context.Context) error {
+	return audit.Verify(f, audit.Head{Seq: int64(len(f))}, nil)
+}
@@ -0,0 +1,358 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjNemo/payit/internal/audit"
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+	webassets "github.com/rjNemo/payit/web"
+)
+
+// apiRoute is one operation of the /api/v1 surface. The table below is the
+// single source for both the mux and the OpenAPI document test.
+type apiRoute struct {
+	Method string
+	Path   string
+	// Scope is required of callers; empty routes are public.
+	Scope   auth.Scope
+	Handler func(*Handler) http.HandlerFunc
+}
+
+var apiV1Routes = []apiRoute{
+	{Method: http.MethodGet, Path: "/api/v1/openapi.json", Handler: (*Handler).apiOpenAPI},
+	{Method: http.MethodPost, Path: "/api/v1/checkout-sessions", Handler: (*Handler).apiCreateCheckoutSession},
+	{Method: http.MethodPost, Path: "/api/v1/checkout-sessions/{id}/cancel", Handler: (*Handler).apiCancelCheckoutSession},
+	{Method: http.MethodGet, Path: "/api/v1/orders", Scope: auth.ScopeOrdersRead, Handler: (*Handler).apiListOrders},
+	{Method: http.MethodGet, Path: "/api/v1/orders/{id}", Scope: auth.ScopeOrdersRead, Handler: (*Handler).apiGetOrder},
+	{Method: http.MethodPost, Path: "/api/v1/orders/{id}/refunds", Scope: auth.ScopeRefundsWrite, Handler: (*Handler).apiCreateRefund},
+	{Method: http.MethodGet, Path: "/api/v1/products", Handler: (*Handler).apiListProducts},
+	{Method: http.MethodGet, Path: "/api/v1/products/{sku}", Handler: (*Handler).apiGetProduct},
+	{Method: http.MethodPost, Path: "/api/v1/usage", Scope: auth.ScopeUsageWrite, Handler: (*Handler).apiRecordUsage},
+	{Method: http.MethodGet, Path: "/api/v1/usage/reconciliation", Scope: auth.ScopeOrdersRead, Handler: (*Handler).apiUsageReconciliation},
+}
+
+func (h *Handler) registerAPIV1Routes(mux *http.ServeMux) {
+	for _, route := range apiV1Routes {
+		handler := withDeadline(route.Handler(h))
+		if route.Method == http.MethodPost {
+			handler = h.idempotent(handler)
+		}
+		if route.Scope != "" {
+			handler = h.requireScope(route.Scope, handler)
+		}
+		mux.Handle(route.Method+" "+route.Path, handler)
+	}
+}
+
+// openAPIDocument is the embedded description of the /api/v1 surface.
+const openAPIDocument = "api/openapi.json"
+
+// Pagination bounds for list endpoints.
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+func (h *Handler) apiOpenAPI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		doc, err := webassets.Assets.ReadFile(openAPIDocument)
+		if err != nil {
+			writeAPIError(w, r, http.StatusInternalServerError, "internal_error", "the API description is unavailable")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(doc)
+	}
+}
+
+func (h *Handler) apiCreateCheckoutSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req payit.CheckoutSessionRequest
+		if err := decodeAPIRequest(r, &req); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+
+		session, err := h.checkout.CreateSession(r.Context(), payments.CheckoutSessionRequest{CheckoutSessionRequest: req})
+		if err != nil {
+			writeAPIFailure(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, session)
+	}
+}
+
+func (h *Handler) apiCancelCheckoutSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req payit.CancelCheckoutSessionRequest
+		if err := decodeOptionalJSON(w, r, &req); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "request body must be a cancel_token object")
+			return
+		}
+		if err := h.cancelSession(r, req.CancelToken); err != nil {
+			writeAPIFailure(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) apiListOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := payments.OrderFilter{
+			Status: payments.OrderStatus(q.Get("status")),
+			Email:  strings.TrimSpace(q.Get("email")),
+		}
+		if filter.Status != "" && !slices.Contains(orderStatuses, filter.Status) {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "status is not a known order status")
+			return
+		}
+		var err error
+		if filter.From, err = parseAPITime(q.Get("created_from")); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "created_from must be an RFC 3339 timestamp")
+			return
+		}
+		if filter.To, err = parseAPITime(q.Get("created_to")); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "created_to must be an RFC 3339 timestamp")
+			return
+		}
+
+		orders, err := h.admin.Orders(r.Context(), filter)
+		if err != nil {
+			log.Printf("api: list orders: %v", err)
+			writeAPIFailure(w, r, err)
+			return
+		}
+		page, err := paginate(r, orders, func(o payments.Order) string { return o.ID })
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func (h *Handler) apiGetOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		order, err := h.admin.Order(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeAPIFailure(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, order)
+	}
+}
+
+func (h *Handler) apiCreateRefund() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		var req payit.RefundRequest
+		if err := decodeAPIRequest(r, &req); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if req.AmountCents < 0 {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "amount_cents must not be negative")
+			return
+		}
+
+		before, err := h.admin.Order(r.Context(), id)
+		if err != nil {
+			writeAPIFailure(w, r, err)
+			return
+		}
+		order, err := h.admin.RefundOrder(r.Context(), id, req.AmountCents)
+		if err != nil {
+			log.Printf("api: refund order %s: %v", id, err)
+			writeAPIFailure(w, r, err)
+			return
+		}
+
+		amount := req.AmountCents
+		if amount == 0 {
+			amount = before.TotalCents - before.RefundedCents
+		}
+		writeJSON(w, http.StatusCreated, payit.Refund{OrderID: id, AmountCents: amount, Currency: before.Currency, Order: order})
+	}
+}
+
+func (h *Handler) apiListProducts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := paginate(r, h.products(), func(p payit.Product) string { return p.SKU })
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func (h *Handler) apiGetProduct() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		products := h.products()
+		idx := slices.IndexFunc(products, func(p payit.Product) bool { return p.SKU == r.PathValue("sku") })
+		if idx < 0 {
+			writeAPIError(w, r, http.StatusNotFound, "not_found", "product not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, products[idx])
+	}
+}
+
+// products lists the catalog; payit sells the single configured product,
+// with any metered prices subscribers are billed for by usage.
+func (h *Handler) products() []payit.Product {
+	p := h.cfg.Product
+	product := payit.Product{
+		SKU:         p.SKU,
+		Name:        p.Name,
+		Description: p.Description,
+		PriceCents:  p.PriceCents,
+		Currency:    p.Currency,
+		Physical:    p.Physical,
+	}
+	for _, m := range h.cfg.Metering.Prices {
+		product.MeteredPrices = append(product.MeteredPrices, payit.MeteredPrice{
+			Meter:             m.Meter,
+			Name:              m.Name,
+			UnitAmountDecimal: m.UnitAmountDecimal,
+			Currency:          m.Currency,
+			Interval:          m.Interval,
+			TrialDays:         m.TrialDays,
+			TrialWithoutCard:  m.TrialWithoutCard,
+		})
+	}
+	return []payit.Product{product}
+}
+
+// paginate cuts the page requested by ?limit= and ?cursor= out of items, which
+// must already be in a stable order. The cursor is the ID of the last item of
+// the previous page.
+func paginate[T any](r *http.Request, items []T, id func(T) string) (payit.List[T], error) {
+	q := r.URL.Query()
+	limit := defaultPageLimit
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return payit.List[T]{}, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+		limit = n
+	}
+
+	start := 0
+	if cursor := q.Get("cursor"); cursor != "" {
+		idx := slices.IndexFunc(items, func(item T) bool { return id(item) == cursor })
+		if idx < 0 {
+			return payit.List[T]{}, errors.New("cursor does not match any item")
+		}
+		start = idx + 1
+	}
+
+	end := min(start+limit, len(items))
+	page := payit.List[T]{Data: items[start:end], HasMore: end < len(items)}
+	if page.Data == nil {
+		page.Data = []T{}
+	}
+	if page.HasMore {
+		page.NextCursor = id(items[end-1])
+	}
+	return page, nil
+}
+
+// decodeAPIRequest reads a JSON body into v. An empty body leaves v untouched.
+func decodeAPIRequest(r *http.Request, v any) error {
+	if r.Body == nil {
+		return nil
+	}
+	defer func() { _ = r.Body.Close() }()
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return errors.New("request body is not valid JSON for this endpoint")
+	}
+	if dec.More() {
+		return errors.New("unexpected data in request body")
+	}
+	return nil
+}
+
+func parseAPITime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("api: encode response: %v", err)
+	}
+}
+
+// writeAPIError sends the shared error envelope, tagged with the request ID so
+// callers can quote it when reporting problems.
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeJSON(w, status, payit.ErrorEnvelope{Error: &payit.Error{
+		Code:      code,
+		Message:   message,
+		RequestID: audit.RequestID(r.Context()),
+	}})
+}
+
+// writeAPIFailure maps a service error to its status and error code.
+func writeAPIFailure(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *payments.ValidationError
+	if errors.As(err, &invalid) {
+		writeJSON(w, http.StatusUnprocessableEntity, validationEnvelope(invalid, audit.RequestID(r.Context())))
+		return
+	}
+	status, code, message := apiErrorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", providerRetryAfter)
+	}
+	writeAPIError(w, r, status, code, message)
+}
+
+func apiErrorStatus(err error) (int, string, string) {
+	switch {
+	case errors.Is(err, payments.ErrInvalidPromoCode):
+		return http.StatusBadRequest, "invalid_promo_code", err.Error()
+	case errors.Is(err, payments.ErrUnsupportedTaxLocation):
+		return http.StatusBadRequest, "unsupported_tax_location", err.Error()
+	case errors.Is(err, payments.ErrUnsupportedCheckout):
+		return http.StatusBadRequest, "unsupported_checkout", err.Error()
+	case errors.Is(err, payments.ErrNoRoute):
+		return http.StatusUnprocessableEntity, "no_route", "no payment provider accepts this checkout"
+	case errors.Is(err, payments.ErrOutOfStock):
+		return http.StatusConflict, "out_of_stock", "not enough stock to complete this order"
+	case errors.Is(err, payments.ErrOrderNotOpen):
+		return http.StatusConflict, "order_not_open", err.Error()
+	case errors.Is(err, payments.ErrNotRefundable):
+		return http.StatusConflict, "not_refundable", err.Error()
+	case errors.Is(err, payments.ErrNotFound):
+		return http.StatusNotFound, "not_found", "resource not found"
+	case errors.Is(err, payments.ErrProviderUnavailable):
+		return http.StatusServiceUnavailable, "provider_unavailable", "the payment provider is temporarily unavailable"
+	case errors.Is(err, payments.ErrProviderRejected):
+		return http.StatusBadGateway, "provider_error", "the payment provider rejected the request"
+	default:
+		return http.StatusInternalServerError, "internal_error", "the request could not be completed"
+	}
+}
@@ -0,0 +1,356 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+	webassets "github.com/rjNemo/payit/web"
+)
+
+func newAPITestServer(t *testing.T, checkout *fakeCheckoutService, admin *fakeAdminService) http.Handler {
+	t.Helper()
+	h := newAuthTestHandler(t)
+	h.checkout = checkout
+	h.admin = admin
+	h.idempotency = newIdempotencyCache()
+	h.cfg.Product = config.ProductConfig{SKU: "demo", Name: "Demo", PriceCents: 2500, Currency: "eur"}
+	mux := http.NewServeMux()
+	h.registerAPIV1Routes(mux)
+	return RequestIDMiddleware(mux)
+}
+
+func serveAPI(srv http.Handler, method, target, key, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIV1RoutesMatchOpenAPI(t *testing.T) {
+	raw, err := webassets.Assets.ReadFile(openAPIDocument)
+	if err != nil {
+		t.Fatalf("read openapi document: %v", err)
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			Security []map[string][]string `json:"security"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("parse openapi document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("expected an OpenAPI 3 document, got %q", doc.OpenAPI)
+	}
+
+	documented := map[string][]string{}
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			var scopes []string
+			for _, req := range op.Security {
+				scopes = append(scopes, req["bearerAuth"]...)
+			}
+			documented[strings.ToUpper(method)+" "+path] = scopes
+		}
+	}
+
+	for _, route := range apiV1Routes {
+		key := route.Method + " " + route.Path
+		scopes, ok := documented[key]
+		if !ok {
+			t.Errorf("route %s is missing from the OpenAPI document", key)
+			continue
+		}
+		delete(documented, key)
+		var want []string
+		if route.Scope != "" {
+			want = []string{string(route.Scope)}
+		}
+		if !slices.Equal(scopes, want) {
+			t.Errorf("route %s: document requires scopes %v, server requires %v", key, scopes, want)
+		}
+	}
+	for key := range documented {
+		t.Errorf("documented operation %s is not served", key)
+	}
+}
+
+func TestAPIV1ServesOpenAPIDocument(t *testing.T) {
+	srv := newAPITestServer(t, &fakeCheckoutService{}, &fakeAdminService{})
+
+	rec := serveAPI(srv, http.MethodGet, "/api/v1/openapi.json", "", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected json document, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestAPIV1CreateCheckoutSession(t *testing.T) {
+	checkout := &fakeCheckoutService{result: payments.CheckoutSessionResult{ID: "cs_1", URL: "https://stripe.test/cs_1"}}
+	srv := newAPITestServer(t, checkout, &fakeAdminService{})
+
+	rec := serveAPI(srv, http.MethodPost, "/api/v1/checkout-sessions", "", `{"quantity":3}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var session payments.CheckoutSessionResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &session); err != nil || session.ID != "cs_1" {
+		t.Fatalf("unexpected session %s: %v", rec.Body.String(), err)
+	}
+	if checkout.req.Quantity != 3 {
+		t.Fatalf("expected quantity 3, got %d", checkout.req.Quantity)
+	}
+
+	checkout.err = payments.ErrOutOfStock
+	rec = serveAPI(srv, http.MethodPost, "/api/v1/checkout-sessions", "", `{"quantity":3}`)
+	var envelope payit.ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("expected error envelope, got %s", rec.Body.String())
+	}
+	if rec.Code != http.StatusConflict || envelope.Error.Code != "out_of_stock" || envelope.Error.RequestID == "" {
+		t.Fatalf("unexpected error response %d: %#v", rec.Code, envelope)
+	}
+
+	checkout.err = &payments.ValidationError{Fields: []payments.FieldError{{Field: "customer_email", Code: "invalid", Message: "must be an email address"}}}
+	rec = serveAPI(srv, http.MethodPost, "/api/v1/checkout-sessions", "", `{"customer_email":"nope"}`)
+	envelope = payit.ErrorEnvelope{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("expected error envelope, got %s", rec.Body.String())
+	}
+	if rec.Code != http.StatusUnprocessableEntity || envelope.Error.Code != "validation_failed" || envelope.Error.RequestID == "" || len(envelope.Error.Fields) != 1 {
+		t.Fatalf("unexpected validation response %d: %#v", rec.Code, envelope)
+	}
+
+	for _, tc := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("%w: card declined", payments.ErrProviderRejected), http.StatusBadGateway, "provider_error"},
+		{errors.New("save order: disk full"), http.StatusInternalServerError, "internal_error"},
+		{fmt.Errorf("%w: 50 usd to \"\"", payments.ErrNoRoute), http.StatusUnprocessableEntity, "no_route"},
+	} {
+		checkout.err = tc.err
+		rec = serveAPI(srv, http.MethodPost, "/api/v1/checkout-sessions", "", `{"quantity":1}`)
+		envelope = payit.ErrorEnvelope{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil || rec.Code != tc.status || envelope.Error.Code != tc.code {
+			t.Fatalf("expected %d %s for %v, got %d: %s", tc.status, tc.code, tc.err, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestAPIV1ListOrdersPaginates(t *testing.T) {
+	admin := &fakeAdminService{orders: []payments.Order{{ID: "cs_3"}, {ID: "cs_2"}, {ID: "cs_1"}}}
+	srv := newAPITestServer(t, &fakeCheckoutService{}, admin)
+
+	var page payit.List[payments.Order]
+	rec := serveAPI(srv, http.MethodGet, "/api/v1/orders?limit=2&status=paid", readKey, "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(page.Data) != 2 || !page.HasMore || page.NextCursor != "cs_2" {
+		t.Fatalf("unexpected first page: %#v", page)
+	}
+	if admin.filter.Status != payments.OrderStatusPaid {
+		t.Fatalf("expected status filter, got %#v", admin.filter)
+	}
+
+	cursor := page.NextCursor
+	page = payit.List[payments.Order]{}
+	rec = serveAPI(srv, http.MethodGet, "/api/v1/orders?limit=2&cursor="+cursor, readKey, "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(page.Data) != 1 || page.Data[0].ID != "cs_1" || page.HasMore || page.NextCursor != "" {
+		t.Fatalf("unexpected last page: %#v", page)
+	}
+
+	for _, query := range []string{"limit=0", "limit=101", "cursor=cs_9", "status=lost", "created_from=yesterday"} {
+		if rec := serveAPI(srv, http.MethodGet, "/api/v1/orders?"+query, readKey, ""); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestAPIV1RequiresScopes(t *testing.T) {
+	admin := &fakeAdminService{orders: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusPaid, TotalCents: 5000}}}
+	srv := newAPITestServer(t, &fakeCheckoutService{}, admin)
+
+	cases := []struct {
+		method, target, key string
+		status              int
+		code                string
+	}{
+		{http.MethodGet, "/api/v1/orders/cs_1", "", http.StatusUnauthorized, "unauthenticated"},
+		{http.MethodPost, "/api/v1/orders/cs_1/refunds", readKey, http.StatusForbidden, "forbidden"},
+		{http.MethodGet, "/api/v1/orders/cs_9", readKey, http.StatusNotFound, "not_found"},
+	}
+	for _, tc := range cases {
+		rec := serveAPI(srv, tc.method, tc.target, tc.key, "")
+		var envelope payit.ErrorEnvelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("%s %s: expected error envelope, got %s", tc.method, tc.target, rec.Body.String())
+		}
+		if rec.Code != tc.status || envelope.Error.Code != tc.code {
+			t.Fatalf("%s %s: expected %d %s, got %d %#v", tc.method, tc.target, tc.status, tc.code, rec.Code, envelope)
+		}
+	}
+	if admin.refunded != 0 {
+		t.Fatal("expected no refund without refunds:write")
+	}
+}
+
+func TestAPIV1CreateRefund(t *testing.T) {
+	admin := &fakeAdminService{orders: []payments.Order{{ID: "cs_1", Status: payments.OrderStatusPaid, TotalCents: 5000, RefundedCents: 1000, Currency: "eur"}}}
+	srv := newAPITestServer(t, &fakeCheckoutService{}, admin)
+
+	rec := serveAPI(srv, http.MethodPost, "/api/v1/orders/cs_1/refunds", opsKey, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var refund payit.Refund
+	if err := json.Unmarshal(rec.Body.Bytes(), &refund); err != nil {
+		t.Fatalf("unexpected refund %s: %v", rec.Body.String(), err)
+	}
+	// An empty body asks the service for everything that is left.
+	if refund.OrderID != "cs_1" || refund.AmountCents != 4000 || refund.Currency != "eur" || admin.refunded != 0 {
+		t.Fatalf("expected the remaining 4000 refunded, got %#v", refund)
+	}
+
+	admin.err = payments.ErrNotRefundable
+	rec = serveAPI(srv, http.MethodPost, "/api/v1/orders/cs_1/refunds", opsKey, `{"amount_cents":999999}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), `"not_refundable"`) {
+		t.Fatalf("expected conflict, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPIV1Products(t *testing.T) {
+	srv := newAPITestServer(t, &fakeCheckoutService{}, &fakeAdminService{})
+
+	var page payit.List[payit.Product]
+	rec := serveAPI(srv, http.MethodGet, "/api/v1/products", "", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || len(page.Data) != 1 || page.Data[0].PriceCents != 2500 {
+		t.Fatalf("unexpected products %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveAPI(srv, http.MethodGet, "/api/v1/products/other", "", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown product to be missing, got %d", rec.Code)
+	}
+}
+
+func TestAPIV1ReplaysIdempotentRequests(t *testing.T) {
+	checkout := &fakeCheckoutService{result: payments.CheckoutSessionResult{ID: "cs_1", URL: "https://stripe.test/cs_1"}}
+	srv := newAPITestServer(t, checkout, &fakeAdminService{})
+
+	first := serveAPI(srv, http.MethodPost, "/api/v1/checkout-sessions", "", `{"quantity":2}`, "Idempotency-Key", "k1")
+	second := serveAPI(srv, http.MethodPost, "/api/v1/checkout-sessions", "", `{"quantity":2}`, "Idempotency-Key", "k1")
+	if checkout.created != 1 {
+		t.Fatalf("expected one session to be created, got %d", checkout.created)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected replayed response, got %d %s", second.Code, second.Body.String())
+	}
+
+	rec := serveAPI(srv, http.MethodPost, "/api/v1/checkout-sessions", "", `{"quantity":3}`, "Idempotency-Key", "k1")
+	if rec.Code != http.StatusUnprocessableEntity || checkout.created != 1 {
+		t.Fatalf("expected key reuse with a different body to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestAPIV1RejectsServerResolvedCheckoutFields(t *testing.T) {
+	checkout := &fakeCheckoutService{result: payments.CheckoutSessionResult{ID: "cs_1"}}
+	srv := newAPITestServer(t, checkout, &fakeAdminService{})
+
+	rec := serveAPI(srv, http.MethodPost, "/api/v1/checkout-sessions", "", `{"quantity":1,"Discount":{"UnitAmountOffCents":2500}}`)
+	if rec.Code != http.StatusBadRequest || checkout.created != 0 {
+		t.Fatalf("expected a client-supplied discount to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestAPIV1ScopesAnonymousIdempotencyKeysPerClient(t *testing.T) {
+	checkout := &fakeCheckoutService{result: payments.CheckoutSessionResult{ID: "cs_1"}}
+	srv := newAPITestServer(t, checkout, &fakeAdminService{})
+
+	for _, addr := range []string{"203.0.113.1:5000", "203.0.113.2:5000"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/checkout-sessions", strings.NewReader(`{"quantity":1}`))
+		req.RemoteAddr = addr
+		req.Header.Set("Idempotency-Key", "k1")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("expected %s not to be served another client's response", addr)
+		}
+	}
+	if checkout.created != 2 {
+		t.Fatalf("expected one session per client, got %d", checkout.created)
+	}
+}
+
+func TestIdempotencyKeyIsReleasedWhenHandlerPanics(t *testing.T) {
+	h := &Handler{idempotency: newIdempotencyCache()}
+	calls := 0
+	srv := h.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/refunds", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "k1")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	func() {
+		defer func() { _ = recover() }()
+		serve()
+	}()
+	if rec := serve(); rec.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("expected the key to be usable after a panic, got %d after %d calls", rec.Code, calls)
+	}
+}
+
+func TestIdempotencyCacheExpiresAndBoundsEntries(t *testing.T) {
+	now := time.Now()
+	c := newIdempotencyCache()
+	c.now = func() time.Time { return now }
+	c.max = 2
+
+	_, pending := c.begin("a", "fp")
+	if seen, again := c.begin("a", "fp"); again != nil || seen.done {
+		t.Fatal("expected a second request to find the key in progress")
+	}
+	now = now.Add(idempotencyPendingTTL)
+	if _, again := c.begin("a", "fp"); again == nil {
+		t.Fatal("expected a stalled request to give up its key")
+	}
+	c.finish(pending, &recordingWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusCreated})
+	if seen, _ := c.begin("a", "fp"); seen.done {
+		t.Fatal("expected a lapsed request not to overwrite its successor")
+	}
+
+	now = now.Add(time.Second)
+	c.begin("b", "fp")
+	c.begin("c", "fp")
+	if len(c.entries) != 2 || c.entries["a"] != nil {
+		t.Fatalf("expected the oldest entry to make room, got %d entries", len(c.entries))
+	}
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/rjNemo/payit/internal/audit"
+)
+
+type auditTrail interface {
+	Entries(ctx context.Context) ([]audit.Entry, error)
+	Verify(ctx context.Context) error
+}
+
+type adminAuditPage struct {
+	adminPage
+	Entries []audit.Entry
+	// Verified is false when the chain is broken; Broken explains where.
+	Verified bool
+	Broken   string
+}
+
+func (h *Handler) adminAudit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := adminAuditPage{adminPage: newAdminPage(r, "Audit log", "audit")}
+		status := http.StatusOK
+
+		if h.auditTrail != nil {
+			entries, err := h.auditTrail.Entries(r.Context())
+			if err != nil {
+				log.Printf("admin: read audit log: %v", err)
+				status, data.Error = http.StatusInternalServerError, "The audit log could not be read."
+			}
+
+			var chainErr *audit.ChainError
+			switch err := h.auditTrail.Verify(r.Context()); {
+			case errors.As(err, &chainErr):
+				data.Broken = chainErr.Error()
+			case err == nil:
+				data.Verified = true
+			}
+
+			slices.Reverse(entries)
+			data.Entries = entries
+		}
+
+		h.renderAdmin(w, status, "audit.html", data)
+	}
+}
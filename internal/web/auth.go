@@ -0,0 +1,158 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjNemo/payit/internal/auth"
+)
+
+type authenticator interface {
+	AuthenticateKey(ctx context.Context, key string) (auth.Principal, error)
+	Login(ctx context.Context, username, password string) (string, auth.Principal, error)
+	Session(ctx context.Context, token string) (auth.Principal, error)
+	Logout(ctx context.Context, token string)
+}
+
+// sessionCookie holds the dashboard session token.
+const sessionCookie = "payit_admin"
+
+type adminLoginPage struct {
+	adminPage
+	Username string
+	Next     string
+}
+
+// requireScope only lets callers holding scope through, authenticating them
+// by "Authorization: Bearer <api key>" or a dashboard session cookie. The
+// principal is stored on the request context for downstream handlers.
+func (h *Handler) requireScope(scope auth.Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := h.authenticate(r)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			// Browsers are sent to the login form; everything else gets a 401.
+			if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/admin") && r.Header.Get("Authorization") == "" {
+				http.Redirect(w, r, "/admin/login?next="+r.URL.EscapedPath(), http.StatusSeeOther)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="payit"`)
+			denyAccess(w, r, http.StatusUnauthorized, "unauthenticated", "authentication required")
+			return
+		}
+		if err != nil {
+			log.Printf("auth: %v", err)
+			denyAccess(w, r, http.StatusInternalServerError, "internal_error", "authentication failed")
+			return
+		}
+		if !p.Can(scope) {
+			denyAccess(w, r, http.StatusForbidden, "forbidden", "missing scope "+string(scope))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+	})
+}
+
+// denyAccess answers /api/v1 callers with the API error envelope and
+// everyone else with plain text.
+func denyAccess(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+		writeAPIError(w, r, status, code, message)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+func (h *Handler) authenticate(r *http.Request) (auth.Principal, error) {
+	if h.auth == nil {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+	if header := r.Header.Get("Authorization"); header != "" {
+		key, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return auth.Principal{}, auth.ErrInvalidCredentials
+		}
+		return h.auth.AuthenticateKey(r.Context(), strings.TrimSpace(key))
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return h.auth.Session(r.Context(), c.Value)
+	}
+	return auth.Principal{}, auth.ErrInvalidCredentials
+}
+
+func (h *Handler) adminLoginForm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := adminLoginPage{
+			adminPage: adminPage{Title: "Sign in", Section: "login"},
+			Next:      safeAdminRedirect(r.URL.Query().Get("next")),
+		}
+		h.renderAdmin(w, http.StatusOK, "login.html", data)
+	}
+}
+
+func (h *Handler) adminLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := strings.TrimSpace(r.FormValue("username"))
+		next := safeAdminRedirect(r.FormValue("next"))
+		throttleKeys := []string{"admin-ip:" + clientIP(r), "admin-user:" + username}
+
+		if wait := h.logins.blocked(throttleKeys...); wait > 0 {
+			log.Printf("admin: throttled login for %q from %s", username, clientIP(r))
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+			data := adminLoginPage{
+				adminPage: adminPage{Title: "Sign in", Section: "login", Error: "Too many failed sign-in attempts. Try again later."},
+				Username:  username,
+				Next:      next,
+			}
+			h.renderAdmin(w, http.StatusTooManyRequests, "login.html", data)
+			return
+		}
+
+		token, _, err := h.auth.Login(r.Context(), username, r.FormValue("password"))
+		if err != nil {
+			h.logins.fail(throttleKeys...)
+			log.Printf("admin: failed login for %q: %v", username, err)
+			data := adminLoginPage{
+				adminPage: adminPage{Title: "Sign in", Section: "login", Error: "Incorrect username or password."},
+				Username:  username,
+				Next:      next,
+			}
+			h.renderAdmin(w, http.StatusUnauthorized, "login.html", data)
+			return
+		}
+		h.logins.succeed(throttleKeys...)
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(h.cfg.Admin.SessionTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(h.cfg.PublicURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	}
+}
+
+func (h *Handler) adminLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			h.auth.Logout(r.Context(), c.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+	}
+}
+
+// safeAdminRedirect keeps post-login redirects inside the dashboard.
+func safeAdminRedirect(next string) string {
+	if next == "/admin" || strings.HasPrefix(next, "/admin/") {
+		return next
+	}
+	return "/admin/orders"
+}
@@ -4,38 +4,34 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/auth"
 	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
 )
 
 func (h *Handler) createCheckoutSession() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req payments.CheckoutSessionRequest
-
-		if r.Body != nil {
-			defer func(body io.ReadCloser) {
-				_ = body.Close()
-			}(r.Body)
-			dec := json.NewDecoder(r.Body)
-			dec.DisallowUnknownFields()
-
-			if err := dec.Decode(&req); err != nil {
-				if errors.Is(err, io.EOF) {
-					// Empty body is acceptable; default quantity applies.
-				} else {
-					http.Error(w, "invalid request payload", http.StatusBadRequest)
-					return
-				}
-			} else if dec.More() {
-				http.Error(w, "unexpected data in request body", http.StatusBadRequest)
-				return
-			}
+		if isFormPost(r) {
+			h.createCheckoutFromForm(w, r)
+			return
+		}
+
+		req, ok := decodeCheckoutRequest(w, r)
+		if !ok {
+			return
 		}
+		h.forSignedInCustomer(r, &req)
 
 		session, err := h.checkout.CreateSession(r.Context(), req)
 		if err != nil {
-			http.Error(w, "checkout session failed", http.StatusInternalServerError)
+			writeCheckoutError(w, err)
 			return
 		}
 
@@ -46,3 +42,252 @@ func (h *Handler) createCheckoutSession() http.HandlerFunc {
 		}
 	}
 }
+
+// maxFormBytes caps checkout form posts, which carry a handful of short fields.
+const maxFormBytes = 1 << 12
+
+// createCheckoutFromForm serves the checkout form posted without JavaScript,
+// redirecting the buyer to the hosted checkout page or rendering an error page
+// they can go back from.
+func (h *Handler) createCheckoutFromForm(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.CheckoutUI == config.CheckoutUIEmbedded {
+		h.renderErrorPage(w, http.StatusBadRequest, "This checkout needs JavaScript. Please enable it and try again.")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		h.renderErrorPage(w, http.StatusBadRequest, "We could not read your order. Please try again.")
+		return
+	}
+	req := payments.CheckoutSessionRequest{
+		CheckoutSessionRequest: payit.CheckoutSessionRequest{
+			PromoCode: r.PostForm.Get("promo_code"),
+			Country:   strings.ToUpper(strings.TrimSpace(r.PostForm.Get("country"))),
+			TaxID:     strings.TrimSpace(r.PostForm.Get("tax_id")),
+		},
+	}
+	if raw := strings.TrimSpace(r.PostForm.Get("quantity")); raw != "" {
+		quantity, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || quantity <= 0 {
+			h.renderErrorPage(w, http.StatusBadRequest, "Enter a quantity of at least 1.")
+			return
+		}
+		req.Quantity = quantity
+	}
+	h.forSignedInCustomer(r, &req)
+
+	session, err := h.checkout.CreateSession(r.Context(), req)
+	var invalid *payments.ValidationError
+	if errors.As(err, &invalid) {
+		h.renderErrorPage(w, http.StatusUnprocessableEntity, "Please correct your order and try again.", fieldProblems(invalid)...)
+		return
+	}
+	if err != nil {
+		status, msg := checkoutErrorStatus(err)
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", providerRetryAfter)
+		}
+		if status == http.StatusInternalServerError {
+			log.Printf("checkout form: %v", err)
+		}
+		h.renderErrorPage(w, status, msg)
+		return
+	}
+	http.Redirect(w, r, session.URL, http.StatusSeeOther)
+}
+
+// validationEnvelope describes invalid fields in the API error envelope.
+func validationEnvelope(invalid *payments.ValidationError, requestID string) payit.ErrorEnvelope {
+	return payit.ErrorEnvelope{Error: &payit.Error{
+		Code:      "validation_failed",
+		Message:   "some fields are invalid",
+		RequestID: requestID,
+		Fields:    invalid.Fields,
+	}}
+}
+
+// fieldProblems phrases each invalid field for people, as in "Quantity must
+// be at most 1000".
+func fieldProblems(invalid *payments.ValidationError) []string {
+	problems := make([]string, len(invalid.Fields))
+	for i, f := range invalid.Fields {
+		name := strings.ReplaceAll(f.Field, "_", " ")
+		problems[i] = strings.ToUpper(name[:1]) + name[1:] + " " + f.Message
+	}
+	return problems
+}
+
+// isFormPost reports whether r carries an HTML form rather than JSON.
+func isFormPost(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// decodeCheckoutRequest reads the cart a storefront checkout was started
+// with, answering 400 itself when the body is malformed. An empty body is a
+// cart with default quantity.
+func decodeCheckoutRequest(w http.ResponseWriter, r *http.Request) (payments.CheckoutSessionRequest, bool) {
+	var req payit.CheckoutSessionRequest
+	if r.Body == nil {
+		return payments.CheckoutSessionRequest{CheckoutSessionRequest: req}, true
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(r.Body)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		if errors.Is(err, io.EOF) {
+			// Empty body is acceptable; default quantity applies.
+			return payments.CheckoutSessionRequest{CheckoutSessionRequest: req}, true
+		}
+		http.Error(w, "invalid request payload", http.StatusBadRequest)
+		return payments.CheckoutSessionRequest{}, false
+	}
+	if dec.More() {
+		http.Error(w, "unexpected data in request body", http.StatusBadRequest)
+		return payments.CheckoutSessionRequest{}, false
+	}
+	return payments.CheckoutSessionRequest{CheckoutSessionRequest: req}, true
+}
+
+func (h *Handler) cancelCheckoutSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req payit.CancelCheckoutSessionRequest
+		if err := decodeOptionalJSON(w, r, &req); err != nil {
+			http.Error(w, "invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if err := h.cancelSession(r, req.CancelToken); err != nil {
+			writeCheckoutError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// cancelSession cancels the checkout named in the path for staff allowed to
+// refund, or for the buyer holding its cancel token.
+func (h *Handler) cancelSession(r *http.Request, cancelToken string) error {
+	id := r.PathValue("id")
+	if p, err := h.authenticate(r); err == nil && p.Can(auth.ScopeRefundsWrite) {
+		return h.checkout.CancelSession(r.Context(), id)
+	}
+	return h.checkout.CancelOwnSession(r.Context(), id, cancelToken)
+}
+
+// maxCancelBytes caps cancel requests, which carry a single token.
+const maxCancelBytes = 1 << 10
+
+// decodeOptionalJSON reads a small JSON body into v; an empty body leaves v
+// as it is.
+func decodeOptionalJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	if r.Body == nil {
+		return nil
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCancelBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// recoverCheckoutPage is where recovery emails link to. Opening it does not
+// start a checkout, so mail scanners that follow links cannot use the
+// recovery up; the buyer does that by posting its form.
+func (h *Handler) recoverCheckoutPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		data := struct{ OrderID string }{OrderID: r.PathValue("id")}
+		if err := h.page.ExecuteTemplate(w, "recover.html", data); err != nil {
+			log.Printf("render recovery page: %v", err)
+		}
+	}
+}
+
+func (h *Handler) recoverCheckoutSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := h.checkout.RecoverSession(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeCheckoutError(w, err)
+			return
+		}
+
+		http.Redirect(w, r, session.URL, http.StatusSeeOther)
+	}
+}
+
+// completeCheckoutSession finishes a checkout the buyer returned from, reading
+// the session ID from the named query parameter: PayPal sends it as token,
+// Stripe's embedded form as session_id.
+func (h *Handler) completeCheckoutSession(param string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get(param)
+		if id == "" {
+			http.Error(w, "missing checkout session", http.StatusBadRequest)
+			return
+		}
+		_, err := h.checkout.CompleteSession(r.Context(), id)
+		if errors.Is(err, payments.ErrCheckoutIncomplete) {
+			// The buyer left an embedded form before paying; let them retry.
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			log.Printf("complete checkout %s: %v", id, err)
+			writeCheckoutError(w, err)
+			return
+		}
+		http.Redirect(w, r, h.cfg.Product.SuccessURL, http.StatusSeeOther)
+	}
+}
+
+func writeCheckoutError(w http.ResponseWriter, err error) {
+	var invalid *payments.ValidationError
+	if errors.As(err, &invalid) {
+		writeJSON(w, http.StatusUnprocessableEntity, validationEnvelope(invalid, ""))
+		return
+	}
+	status, msg := checkoutErrorStatus(err)
+	if errors.Is(err, payments.ErrNoRoute) {
+		// Storefront scripts read every 422 as an error envelope.
+		writeJSON(w, status, payit.ErrorEnvelope{Error: &payit.Error{Code: "no_route", Message: msg}})
+		return
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", providerRetryAfter)
+	}
+	http.Error(w, msg, status)
+}
+
+// providerRetryAfter is the Retry-After, in seconds, sent while a payment
+// provider is unavailable.
+const providerRetryAfter = "30"
+
+// checkoutErrorStatus maps checkout errors to an HTTP status and a message
+// that is safe to show to the customer.
+func checkoutErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, payments.ErrInvalidPromoCode), errors.Is(err, payments.ErrUnsupportedTaxLocation),
+		errors.Is(err, payments.ErrUnsupportedCheckout):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, payments.ErrNoRoute):
+		return http.StatusUnprocessableEntity, "payment is not available for this order"
+	case errors.Is(err, payments.ErrOutOfStock):
+		return http.StatusConflict, "not enough stock to complete this order"
+	case errors.Is(err, payments.ErrOrderNotOpen), errors.Is(err, payments.ErrCheckoutIncomplete):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, payments.ErrNotRecoverable):
+		return http.StatusGone, "this checkout link is no longer valid"
+	case errors.Is(err, payments.ErrNotFound):
+		return http.StatusNotFound, "checkout session not found"
+	case errors.Is(err, payments.ErrProviderUnavailable):
+		return http.StatusServiceUnavailable, "payments are temporarily unavailable, please try again shortly"
+	default:
+		return http.StatusInternalServerError, "checkout session failed"
+	}
+}
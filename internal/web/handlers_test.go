@@ -5,27 +5,79 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+	webassets "github.com/rjNemo/payit/web"
 )
 
 type fakeCheckoutService struct {
-	result payments.CheckoutSessionResult
-	err    error
-	req    payments.CheckoutSessionRequest
+	result   payments.CheckoutSessionResult
+	err      error
+	req      payments.CheckoutSessionRequest
+	canceled string
+	// cancelToken is the token the buyer canceled with.
+	cancelToken string
+	recovered   string
+	completed   string
+	intent      payments.PaymentIntent
+	report      payments.AbandonmentReport
+	since       time.Time
+	created     int
 }
 
 func (f *fakeCheckoutService) CreateSession(ctx context.Context, req payments.CheckoutSessionRequest) (payments.CheckoutSessionResult, error) {
 	f.req = req
+	f.created++
 	if f.err != nil {
 		return payments.CheckoutSessionResult{}, f.err
 	}
 	return f.result, nil
 }
 
+func (f *fakeCheckoutService) CancelSession(ctx context.Context, id string) error {
+	f.canceled = id
+	return f.err
+}
+
+func (f *fakeCheckoutService) CancelOwnSession(ctx context.Context, id, cancelToken string) error {
+	f.canceled = id
+	f.cancelToken = cancelToken
+	return f.err
+}
+
+func (f *fakeCheckoutService) RecoverSession(ctx context.Context, orderID string) (payments.CheckoutSessionResult, error) {
+	f.recovered = orderID
+	return f.result, f.err
+}
+
+func (f *fakeCheckoutService) CompleteSession(ctx context.Context, id string) (payments.Order, error) {
+	f.completed = id
+	return payments.Order{ID: id, Status: payments.OrderStatusPaid}, f.err
+}
+
+func (f *fakeCheckoutService) CreatePaymentIntent(ctx context.Context, req payments.CheckoutSessionRequest) (payments.PaymentIntent, error) {
+	f.req = req
+	return f.intent, f.err
+}
+
+func (f *fakeCheckoutService) PaymentIntentStatus(ctx context.Context, id string) (payments.PaymentIntent, error) {
+	return f.intent, f.err
+}
+
+func (f *fakeCheckoutService) AbandonmentReport(ctx context.Context, since time.Time) (payments.AbandonmentReport, error) {
+	f.since = since
+	return f.report, f.err
+}
+
 func TestCreateCheckoutSessionSuccess(t *testing.T) {
 	handler := &Handler{
 		checkout: &fakeCheckoutService{
@@ -125,3 +177,283 @@ func TestCreateCheckoutSessionMethodNotAllowed(t *testing.T) {
 		t.Fatalf("expected Allow header to be POST, got %s", allow)
 	}
 }
+
+func TestCreateCheckoutSessionInvalidPromoCode(t *testing.T) {
+	handler := &Handler{
+		checkout: &fakeCheckoutService{err: fmt.Errorf("%w: NOPE is not recognised", payments.ErrInvalidPromoCode)},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout", bytes.NewBufferString(`{"quantity":1,"promo_code":"NOPE"}`))
+	rec := httptest.NewRecorder()
+
+	handler.createCheckoutSession()(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "NOPE") {
+		t.Fatalf("expected reason in body, got %q", rec.Body.String())
+	}
+}
+
+func TestCreateCheckoutSessionOutOfStock(t *testing.T) {
+	handler := &Handler{
+		checkout: &fakeCheckoutService{err: fmt.Errorf("%w: 3 of demo requested, 1 available", payments.ErrOutOfStock)},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout", bytes.NewBufferString(`{"quantity":3}`))
+	rec := httptest.NewRecorder()
+
+	handler.createCheckoutSession()(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", rec.Code)
+	}
+}
+
+func TestCreateCheckoutSessionProviderUnavailable(t *testing.T) {
+	handler := &Handler{
+		checkout: &fakeCheckoutService{err: fmt.Errorf("%w: circuit breaker open", payments.ErrProviderUnavailable)},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout", bytes.NewBufferString(`{}`))
+	rec := httptest.NewRecorder()
+
+	handler.createCheckoutSession()(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestCreateCheckoutSessionValidationFailed(t *testing.T) {
+	handler := &Handler{
+		checkout: &fakeCheckoutService{err: &payments.ValidationError{Fields: []payments.FieldError{
+			{Field: "quantity", Code: "too_large", Message: "must be at most 1000"},
+		}}},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout", bytes.NewBufferString(`{"quantity":5000}`))
+	rec := httptest.NewRecorder()
+
+	handler.createCheckoutSession()(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rec.Code)
+	}
+	var envelope payit.ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("expected error envelope, got %s", rec.Body.String())
+	}
+	if envelope.Error.Code != "validation_failed" || len(envelope.Error.Fields) != 1 || envelope.Error.Fields[0].Field != "quantity" {
+		t.Fatalf("unexpected envelope: %#v", envelope.Error)
+	}
+}
+
+func TestCreateCheckoutSessionNoRouteIsAnEnvelope(t *testing.T) {
+	handler := &Handler{checkout: &fakeCheckoutService{err: fmt.Errorf("%w: 50 usd to \"\"", payments.ErrNoRoute)}}
+
+	rec := httptest.NewRecorder()
+	handler.createCheckoutSession()(rec, httptest.NewRequest(http.MethodPost, "/api/checkout", bytes.NewBufferString(`{}`)))
+
+	var envelope payit.ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil || rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a 422 error envelope, got %d %s", rec.Code, rec.Body.String())
+	}
+	if envelope.Error.Code != "no_route" || envelope.Error.Message != "payment is not available for this order" {
+		t.Fatalf("unexpected envelope: %#v", envelope.Error)
+	}
+}
+
+func checkoutPages(t *testing.T) *template.Template {
+	t.Helper()
+	pages, err := template.ParseFS(webassets.Assets, "templates/index.html", "templates/error.html", "templates/recover.html")
+	if err != nil {
+		t.Fatalf("parse checkout pages: %v", err)
+	}
+	return pages
+}
+
+func TestCreateCheckoutSessionFromFormRedirects(t *testing.T) {
+	svc := &fakeCheckoutService{result: payments.CheckoutSessionResult{ID: "cs_test_1", URL: "https://stripe.test/checkout"}}
+	handler := &Handler{checkout: svc, page: checkoutPages(t)}
+
+	form := url.Values{"quantity": {"3"}, "promo_code": {"LAUNCH"}, "country": {" fr "}, "tax_id": {""}}
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.createCheckoutSession()(rec, req)
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "https://stripe.test/checkout" {
+		t.Fatalf("expected redirect to the hosted checkout, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if svc.req.Quantity != 3 || svc.req.PromoCode != "LAUNCH" || svc.req.Country != "FR" {
+		t.Fatalf("unexpected request: %#v", svc.req)
+	}
+}
+
+func TestCreateCheckoutSessionFromFormRendersErrors(t *testing.T) {
+	svc := &fakeCheckoutService{}
+	handler := &Handler{checkout: svc, page: checkoutPages(t)}
+	post := func(quantity string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/checkout", strings.NewReader(url.Values{"quantity": {quantity}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		rec := httptest.NewRecorder()
+		handler.createCheckoutSession()(rec, req)
+		return rec
+	}
+
+	rec := post("zero")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "quantity of at least 1") {
+		t.Fatalf("expected an error page for a bad quantity, got %d %s", rec.Code, rec.Body.String())
+	}
+	if svc.created != 0 {
+		t.Fatal("expected no session for an invalid form")
+	}
+
+	svc.err = payments.ErrOutOfStock
+	rec = post("2")
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected an HTML 409 page, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "not enough stock") || !strings.Contains(rec.Body.String(), `href="/"`) {
+		t.Fatalf("expected the reason and a way back, got %s", rec.Body.String())
+	}
+
+	svc.err = &payments.ValidationError{Fields: []payments.FieldError{{Field: "quantity", Code: "too_large", Message: "must be at most 1000"}}}
+	rec = post("5000")
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "Quantity must be at most 1000") {
+		t.Fatalf("expected a 422 page listing the problem, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCompleteCheckoutSessionRedirectsToSuccess(t *testing.T) {
+	svc := &fakeCheckoutService{}
+	handler := &Handler{checkout: svc}
+	handler.cfg.Product.SuccessURL = "https://shop.example/thanks"
+
+	req := httptest.NewRequest(http.MethodGet, "/checkout/paypal/return?token=5O190127TN364715T&PayerID=QYR5Z8XDVJNXQ", nil)
+	rec := httptest.NewRecorder()
+	handler.completeCheckoutSession("token")(rec, req)
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "https://shop.example/thanks" {
+		t.Fatalf("expected redirect to success page, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if svc.completed != "5O190127TN364715T" {
+		t.Fatalf("expected the PayPal order to be completed, got %q", svc.completed)
+	}
+
+	svc.err = fmt.Errorf("%w: not approved", payments.ErrOrderNotOpen)
+	rec = httptest.NewRecorder()
+	handler.completeCheckoutSession("token")(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for an unapproved order, got %d", rec.Code)
+	}
+}
+
+func TestCompleteEmbeddedCheckoutReturnsUnpaidBuyersToCheckout(t *testing.T) {
+	svc := &fakeCheckoutService{err: fmt.Errorf("%w: session is open", payments.ErrCheckoutIncomplete)}
+	handler := &Handler{checkout: svc}
+	handler.cfg.Product.SuccessURL = "https://shop.example/thanks"
+
+	req := httptest.NewRequest(http.MethodGet, "/checkout/return?session_id=cs_test_1", nil)
+	rec := httptest.NewRecorder()
+	handler.completeCheckoutSession("session_id")(rec, req)
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("expected redirect back to checkout, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if svc.completed != "cs_test_1" {
+		t.Fatalf("expected cs_test_1 to be completed, got %q", svc.completed)
+	}
+}
+
+func TestCancelCheckoutSession(t *testing.T) {
+	svc := &fakeCheckoutService{}
+	handler := &Handler{checkout: svc}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/checkout/{id}/cancel", handler.cancelCheckoutSession())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout/cs_test_1/cancel", strings.NewReader(`{"cancel_token":"tok_1"}`))
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", rec.Code)
+	}
+	if svc.canceled != "cs_test_1" || svc.cancelToken != "tok_1" {
+		t.Fatalf("expected cs_test_1 to be canceled with the buyer's token, got %q and %q", svc.canceled, svc.cancelToken)
+	}
+}
+
+func TestCancelCheckoutSessionNotOpen(t *testing.T) {
+	handler := &Handler{checkout: &fakeCheckoutService{err: payments.ErrOrderNotOpen}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/checkout/{id}/cancel", handler.cancelCheckoutSession())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/checkout/cs_paid/cancel", http.NoBody)
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", rec.Code)
+	}
+}
+
+func TestRecoverCheckoutPageOnlyOffersRecovery(t *testing.T) {
+	svc := &fakeCheckoutService{}
+	handler := &Handler{checkout: svc, page: checkoutPages(t)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /checkout/recover/{id}", handler.recoverCheckoutPage())
+
+	req := httptest.NewRequest(http.MethodGet, "/checkout/recover/cs_old", http.NoBody)
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `action="/checkout/recover/cs_old"`) {
+		t.Fatalf("expected a form posting the recovery, got %d %s", rec.Code, rec.Body.String())
+	}
+	if svc.recovered != "" {
+		t.Fatalf("expected opening the link not to start a checkout, got %q", svc.recovered)
+	}
+}
+
+func TestRecoverCheckoutSessionRedirects(t *testing.T) {
+	svc := &fakeCheckoutService{result: payments.CheckoutSessionResult{ID: "cs_new", URL: "https://stripe.test/new"}}
+	handler := &Handler{checkout: svc}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /checkout/recover/{id}", handler.recoverCheckoutSession())
+
+	req := httptest.NewRequest(http.MethodPost, "/checkout/recover/cs_old", http.NoBody)
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d", rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "https://stripe.test/new" {
+		t.Fatalf("unexpected redirect: %s", loc)
+	}
+	if svc.recovered != "cs_old" {
+		t.Fatalf("expected cs_old to be recovered, got %q", svc.recovered)
+	}
+}
+
+func TestRecoverCheckoutSessionGone(t *testing.T) {
+	handler := &Handler{checkout: &fakeCheckoutService{err: payments.ErrNotRecoverable}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /checkout/recover/{id}", handler.recoverCheckoutSession())
+
+	req := httptest.NewRequest(http.MethodPost, "/checkout/recover/cs_paid", http.NoBody)
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusGone {
+		t.Fatalf("expected status 410, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,226 @@
+package web
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rjNemo/payit/internal/auth"
+)
+
+// idempotencyTTL is how long a response is replayed for a repeated
+// Idempotency-Key.
+const idempotencyTTL = 24 * time.Hour
+
+// idempotencyPendingTTL is how long a key stays in use by a request that has
+// not finished, after which it may be retried.
+const idempotencyPendingTTL = time.Minute
+
+// maxIdempotencyEntries bounds the responses remembered at once; the ones
+// closest to expiring make room for new keys.
+const maxIdempotencyEntries = 10000
+
+// maxIdempotencyKeyLength bounds caller-supplied Idempotency-Key values.
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBody bounds the request bodies fingerprinted for replay.
+const maxIdempotentBody = 1 << 20
+
+// idempotencyCache remembers responses to POST requests that carried an
+// Idempotency-Key, so a client retrying after a timeout gets the original
+// outcome instead of a second charge or refund.
+type idempotencyCache struct {
+	now func() time.Time
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*idempotentResponse
+	// expiry orders entries by expiresAt so lapsed ones are dropped without
+	// scanning the whole cache.
+	expiry expiryHeap
+}
+
+type idempotentResponse struct {
+	key string
+	// fingerprint ties the key to the request it was first used with.
+	fingerprint string
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	// expiresAt is when a pending request gives up the key, or when a
+	// finished response stops being replayed.
+	expiresAt time.Time
+	index     int
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{now: time.Now, max: maxIdempotencyEntries, entries: make(map[string]*idempotentResponse)}
+}
+
+// idempotent replays the first completed response for a repeated
+// Idempotency-Key. Keys are scoped to the authenticated caller, or to the
+// client address for anonymous callers, and reusing one for a different
+// request is rejected. Server errors and requests that never finish are not
+// remembered so that the request can be retried.
+func (h *Handler) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || h.idempotency == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "Idempotency-Key is too long")
+			return
+		}
+		if p, ok := auth.FromContext(r.Context()); ok {
+			key = p.Name + "\x00" + key
+		} else {
+			key = "ip:" + clientIP(r) + "\x00" + key
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+		if err != nil || len(body) > maxIdempotentBody {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "request body could not be read")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		seen, pending := h.idempotency.begin(key, fingerprint)
+		if pending == nil {
+			switch {
+			case seen.fingerprint != fingerprint:
+				writeAPIError(w, r, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used for a different request")
+			case !seen.done:
+				writeAPIError(w, r, http.StatusConflict, "idempotency_key_in_use", "a request with this Idempotency-Key is still in progress")
+			default:
+				w.Header().Set("Content-Type", seen.contentType)
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(seen.status)
+				_, _ = w.Write(seen.body)
+			}
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		finished := false
+		defer func() {
+			// A handler that panicked must not hold the key until it lapses.
+			if !finished {
+				h.idempotency.drop(pending)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		finished = true
+		h.idempotency.finish(pending, rec)
+	})
+}
+
+// begin returns a copy of the entry for key when the key has been seen
+// before. Otherwise it claims the key with a pending entry and returns that.
+func (c *idempotencyCache) begin(key, fingerprint string) (seen idempotentResponse, pending *idempotentResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for len(c.expiry) > 0 && !now.Before(c.expiry[0].expiresAt) {
+		c.remove(c.expiry[0])
+	}
+	if e, ok := c.entries[key]; ok {
+		return *e, nil
+	}
+	if len(c.entries) >= c.max && len(c.expiry) > 0 {
+		c.remove(c.expiry[0])
+	}
+	pending = &idempotentResponse{key: key, fingerprint: fingerprint, expiresAt: now.Add(idempotencyPendingTTL)}
+	c.entries[key] = pending
+	heap.Push(&c.expiry, pending)
+	return idempotentResponse{}, pending
+}
+
+// finish remembers the response recorded for a pending entry, unless the
+// entry lapsed or was evicted in the meantime.
+func (c *idempotencyCache) finish(e *idempotentResponse, rec *recordingWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries[e.key] != e {
+		return
+	}
+	if rec.status >= http.StatusInternalServerError {
+		c.remove(e)
+		return
+	}
+	e.done = true
+	e.status = rec.status
+	e.contentType = rec.Header().Get("Content-Type")
+	e.body = rec.body.Bytes()
+	e.expiresAt = c.now().Add(idempotencyTTL)
+	heap.Fix(&c.expiry, e.index)
+}
+
+// drop forgets a pending entry so its key can be used again.
+func (c *idempotencyCache) drop(e *idempotentResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[e.key] == e {
+		c.remove(e)
+	}
+}
+
+// remove must be called with mu held.
+func (c *idempotencyCache) remove(e *idempotentResponse) {
+	delete(c.entries, e.key)
+	heap.Remove(&c.expiry, e.index)
+}
+
+// expiryHeap is a min-heap of entries by expiresAt.
+type expiryHeap []*idempotentResponse
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	e := x.(*idempotentResponse)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// recordingWriter copies a response as it is written.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
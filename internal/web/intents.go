@@ -0,0 +1,44 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// createPaymentIntent starts a payment the buyer confirms on payit's own
+// Stripe Elements form, returning the intent's client secret.
+func (h *Handler) createPaymentIntent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeCheckoutRequest(w, r)
+		if !ok {
+			return
+		}
+		h.forSignedInCustomer(r, &req)
+
+		intent, err := h.checkout.CreatePaymentIntent(r.Context(), req)
+		if err != nil {
+			writeCheckoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(intent)
+	}
+}
+
+// paymentIntentStatus reports whether a confirmed payment went through, still
+// needs the buyer to authenticate (3-D Secure), or must be retried.
+func (h *Handler) paymentIntentStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		intent, err := h.checkout.PaymentIntentStatus(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeCheckoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(intent)
+	}
+}
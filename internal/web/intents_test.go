@@ -0,0 +1,86 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+func TestCreatePaymentIntent(t *testing.T) {
+	svc := &fakeCheckoutService{intent: payments.PaymentIntent{
+		ID:           "pi_1",
+		Status:       payments.PaymentIntentRequiresPaymentMethod,
+		ClientSecret: "pi_1_secret",
+		AmountCents:  4000,
+		Currency:     "eur",
+	}}
+	handler := &Handler{checkout: svc}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/payment-intents", strings.NewReader(`{"quantity": 2}`))
+	rec := httptest.NewRecorder()
+	handler.createPaymentIntent()(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var got payments.PaymentIntent
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.ClientSecret != "pi_1_secret" || got.AmountCents != 4000 {
+		t.Fatalf("unexpected intent: %#v", got)
+	}
+	if svc.req.Quantity != 2 {
+		t.Fatalf("expected the cart to reach the service, got %#v", svc.req)
+	}
+}
+
+func TestCreatePaymentIntentRejectsUnsupportedCheckout(t *testing.T) {
+	handler := &Handler{checkout: &fakeCheckoutService{err: fmt.Errorf("%w: shipping needs hosted checkout", payments.ErrUnsupportedCheckout)}}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/payment-intents", http.NoBody)
+	rec := httptest.NewRecorder()
+	handler.createPaymentIntent()(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestPaymentIntentStatus(t *testing.T) {
+	svc := &fakeCheckoutService{intent: payments.PaymentIntent{
+		ID:            "pi_1",
+		Status:        payments.PaymentIntentRequiresAction,
+		NextActionURL: "https://hooks.stripe.com/3ds",
+	}}
+	handler := &Handler{checkout: svc}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/payment-intents/{id}", handler.paymentIntentStatus())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/payment-intents/pi_1", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var got payments.PaymentIntent
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Status != payments.PaymentIntentRequiresAction || got.NextActionURL == "" {
+		t.Fatalf("unexpected intent: %#v", got)
+	}
+
+	svc.err = payments.ErrNotFound
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
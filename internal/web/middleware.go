@@ -1,9 +1,14 @@
 package web
 
 import (
+	"context"
+	"crypto/rand"
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/audit"
 )
 
 type WrappedWriter struct {
@@ -24,3 +29,30 @@ func LoggerMiddleware(next http.Handler) http.Handler {
 		log.Printf("%s %s %d %v", r.Method, r.URL.Path, wrapped.StatusCode, time.Since(start))
 	})
 }
+
+// maxRequestIDLength bounds caller-supplied request IDs.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware tags each request with an ID, reusing a caller's
+// X-Request-ID when present, and records it with the client IP for the audit log.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > maxRequestIDLength {
+			id = rand.Text()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(audit.WithRequest(r.Context(), id, clientIP(r))))
+	})
+}
+
+// withDeadline gives up on the work behind a request at config.RequestTimeout,
+// before the server's write timeout drops the connection, so provider calls
+// stop retrying and the handler still gets to send its error.
+func withDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), config.RequestTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/audit"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = audit.RequestID(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "req_from_proxy")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if seen != "req_from_proxy" || rec.Header().Get("X-Request-ID") != "req_from_proxy" {
+		t.Fatalf("expected caller request ID to be kept, got %q", seen)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if seen == "" || rec.Header().Get("X-Request-ID") != seen {
+		t.Fatalf("expected a generated request ID, got %q", seen)
+	}
+}
+
+func TestWithDeadlineEndsBeforeTheWriteTimeout(t *testing.T) {
+	var remaining time.Duration
+	handler := withDeadline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok := r.Context().Deadline()
+		if !ok {
+			t.Fatal("expected the request to carry a deadline")
+		}
+		remaining = time.Until(deadline)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/checkout", nil))
+	if remaining <= 0 || remaining > config.RequestTimeout || config.RequestTimeout >= config.ServerWriteTimeout {
+		t.Fatalf("expected a deadline inside the write timeout, got %s", remaining)
+	}
+}
@@ -2,8 +2,11 @@ package web
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
+
+	"github.com/rjNemo/payit/config"
 )
 
 type checkoutPageData struct {
@@ -11,6 +14,17 @@ type checkoutPageData struct {
 	ProductDescription string
 	PriceDisplay       string
 	Currency           string
+	// MinQuantity and MaxQuantity bound the quantity input; zero MaxQuantity
+	// leaves it open.
+	MinQuantity int64
+	MaxQuantity int64
+	// CheckoutUI selects how the page takes payment; see config.CheckoutUI.
+	CheckoutUI string
+	// StripePublishableKey is only set when Stripe's form is mounted on this
+	// page, for embedded checkouts and Elements.
+	StripePublishableKey string
+	// SuccessURL is where the Elements form sends buyers once they have paid.
+	SuccessURL string
 }
 
 func (h *Handler) renderCheckoutPage() http.HandlerFunc {
@@ -21,6 +35,13 @@ func (h *Handler) renderCheckoutPage() http.HandlerFunc {
 			ProductDescription: h.cfg.Product.Description,
 			PriceDisplay:       fmt.Sprintf("$%.2f", price),
 			Currency:           strings.ToUpper(h.cfg.Product.Currency),
+			MinQuantity:        max(h.cfg.Product.MinQuantity, 1),
+			MaxQuantity:        h.cfg.Product.MaxQuantity,
+			CheckoutUI:         h.cfg.CheckoutUI,
+			SuccessURL:         h.cfg.Product.SuccessURL,
+		}
+		if h.cfg.CheckoutUI == config.CheckoutUIEmbedded || h.cfg.CheckoutUI == config.CheckoutUIElements {
+			data.StripePublishableKey = h.cfg.StripePublishableKey
 		}
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -30,3 +51,21 @@ func (h *Handler) renderCheckoutPage() http.HandlerFunc {
 		}
 	}
 }
+
+type errorPageData struct {
+	Title   string
+	Message string
+	// Problems lists what the buyer needs to fix, one line each.
+	Problems []string
+}
+
+// renderErrorPage answers a checkout started without JavaScript with a page
+// the buyer can read and go back from, rather than a bare status line.
+func (h *Handler) renderErrorPage(w http.ResponseWriter, status int, message string, problems ...string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	data := errorPageData{Title: http.StatusText(status), Message: message, Problems: problems}
+	if err := h.page.ExecuteTemplate(w, "error.html", data); err != nil {
+		log.Printf("render error page: %v", err)
+	}
+}
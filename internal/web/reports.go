@@ -0,0 +1,36 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// defaultReportWindow is used when a report request does not specify ?since=.
+const defaultReportWindow = 30 * 24 * time.Hour
+
+func (h *Handler) abandonedCheckoutReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since := time.Now().Add(-defaultReportWindow)
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			parsed, err := time.Parse(time.DateOnly, raw)
+			if err != nil {
+				http.Error(w, "since must be a date formatted as YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			since = parsed
+		}
+
+		report, err := h.checkout.AbandonmentReport(r.Context(), since)
+		if err != nil {
+			http.Error(w, "failed to build report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+func TestAbandonedCheckoutReport(t *testing.T) {
+	svc := &fakeCheckoutService{report: payments.AbandonmentReport{Sessions: 4, Paid: 1, Abandoned: 3, AbandonmentRate: 0.75}}
+	handler := &Handler{checkout: svc}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/reports/abandoned-checkouts?since=2025-01-02", http.NoBody)
+	rec := httptest.NewRecorder()
+
+	handler.abandonedCheckoutReport()(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if !svc.since.Equal(time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected since: %v", svc.since)
+	}
+
+	var report payments.AbandonmentReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("expected valid json response: %v", err)
+	}
+	if report.AbandonmentRate != 0.75 {
+		t.Fatalf("unexpected report: %#v", report)
+	}
+}
+
+func TestAbandonedCheckoutReportRejectsBadDate(t *testing.T) {
+	handler := &Handler{checkout: &fakeCheckoutService{}}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/reports/abandoned-checkouts?since=yesterday", http.NoBody)
+	rec := httptest.NewRecorder()
+
+	handler.abandonedCheckoutReport()(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestAbandonedCheckoutReportRequiresScope(t *testing.T) {
+	handler := &Handler{checkout: &fakeCheckoutService{}}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/reports/abandoned-checkouts", nil)
+	rec := httptest.NewRecorder()
+	handler.requireScope(auth.ScopeOrdersRead, handler.abandonedCheckoutReport()).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+}
@@ -2,10 +2,81 @@ package web
 
 import (
 	"net/http"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/payments/driver/paypal"
+	"github.com/rjNemo/payit/internal/payments/driver/stripe"
 )
 
 func (h *Handler) registerRoutes(mux *http.ServeMux) {
-	mux.Handle("POST /api/checkout", h.createCheckoutSession())
+	mux.Handle("POST /api/checkout", withDeadline(h.createCheckoutSession()))
+	mux.Handle("POST /api/checkout/{id}/cancel", withDeadline(h.cancelCheckoutSession()))
+	mux.Handle("POST /api/payment-intents", withDeadline(h.createPaymentIntent()))
+	mux.Handle("GET /api/payment-intents/{id}", withDeadline(h.paymentIntentStatus()))
+	mux.Handle("GET /checkout/recover/{id}", h.recoverCheckoutPage())
+	mux.Handle("POST /checkout/recover/{id}", http.NewCrossOriginProtection().Handler(withDeadline(h.recoverCheckoutSession())))
+	if h.cfg.CheckoutUI == config.CheckoutUIEmbedded {
+		mux.Handle("GET "+stripe.ReturnPath, withDeadline(h.completeCheckoutSession("session_id")))
+	}
+	if h.cfg.PayPal.Enabled() {
+		mux.Handle("GET "+paypal.ReturnPath, withDeadline(h.completeCheckoutSession("token")))
+	}
+	mux.Handle("GET /api/reports/abandoned-checkouts", h.requireScope(auth.ScopeOrdersRead, withDeadline(h.abandonedCheckoutReport())))
+	h.registerAPIV1Routes(mux)
+	if h.webhooks != nil {
+		mux.Handle("POST /api/webhooks/stripe", h.handleStripeWebhook())
+	}
+	if h.paypalWebhooks != nil {
+		mux.Handle("POST /api/webhooks/paypal", h.handlePayPalWebhook())
+	}
+	if h.auth != nil {
+		h.registerAdminRoutes(mux)
+	}
+	if h.accountAuth != nil {
+		h.registerAccountRoutes(mux)
+	}
 	mux.Handle("GET /", h.renderCheckoutPage())
 	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.FS(h.fs))))
 }
+
+// registerAdminRoutes serves the staff dashboard, each page behind the scope
+// it needs. Dashboard forms are protected against cross-origin submissions
+// because the session cookie would otherwise ride along with them.
+func (h *Handler) registerAdminRoutes(mux *http.ServeMux) {
+	csrf := http.NewCrossOriginProtection()
+	scoped := func(scope auth.Scope, next http.Handler) http.Handler {
+		return csrf.Handler(h.requireScope(scope, next))
+	}
+
+	mux.Handle("GET /admin/login", h.adminLoginForm())
+	mux.Handle("POST /admin/login", csrf.Handler(h.adminLogin()))
+	mux.Handle("POST /admin/logout", csrf.Handler(h.adminLogout()))
+
+	mux.Handle("GET /admin", scoped(auth.ScopeOrdersRead, http.RedirectHandler("/admin/orders", http.StatusSeeOther)))
+	mux.Handle("GET /admin/orders", scoped(auth.ScopeOrdersRead, h.adminOrders()))
+	mux.Handle("GET /admin/orders/{id}", scoped(auth.ScopeOrdersRead, h.adminOrder()))
+	mux.Handle("POST /admin/orders/{id}/refund", scoped(auth.ScopeRefundsWrite, h.adminRefundOrder()))
+	mux.Handle("POST /admin/orders/{id}/capture", scoped(auth.ScopeRefundsWrite, h.adminCaptureOrder()))
+	mux.Handle("GET /admin/subscriptions", scoped(auth.ScopeOrdersRead, h.adminSubscriptions()))
+	mux.Handle("GET /admin/webhooks", scoped(auth.ScopeOrdersRead, h.adminWebhooks()))
+	mux.Handle("GET /admin/audit", scoped(auth.ScopeOrdersRead, h.adminAudit()))
+}
+
+// registerAccountRoutes serves the customer self-service area, where buyers
+// sign in with a magic link. Its forms get the same cross-origin protection
+// as the dashboard's.
+func (h *Handler) registerAccountRoutes(mux *http.ServeMux) {
+	csrf := http.NewCrossOriginProtection()
+
+	mux.Handle("GET /account/login", h.accountLoginForm())
+	mux.Handle("POST /account/login", csrf.Handler(h.accountLogin()))
+	mux.Handle("GET /account/verify", h.accountVerifyForm())
+	mux.Handle("POST /account/verify", csrf.Handler(h.accountVerify()))
+	mux.Handle("POST /account/logout", csrf.Handler(h.accountLogout()))
+
+	mux.Handle("GET /account", h.accountHome())
+	mux.Handle("GET /account/orders/{id}", h.accountReceipt())
+	mux.Handle("POST /account/orders/{id}/repurchase", csrf.Handler(h.accountRepurchase()))
+	mux.Handle("POST /account/subscriptions/{id}/cancel", csrf.Handler(h.accountCancelSubscription()))
+}
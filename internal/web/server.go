@@ -6,40 +6,316 @@ import (
 	"html/template"
 	"io/fs"
 	"net/http"
+	"time"
 
 	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/audit"
+	"github.com/rjNemo/payit/internal/auth"
+	"github.com/rjNemo/payit/internal/jobs"
+	"github.com/rjNemo/payit/internal/notify"
 	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/internal/payments/coupon"
+	"github.com/rjNemo/payit/internal/payments/driver/paypal"
+	"github.com/rjNemo/payit/internal/payments/driver/router"
 	"github.com/rjNemo/payit/internal/payments/driver/stripe"
+	"github.com/rjNemo/payit/internal/payments/inventory"
+	"github.com/rjNemo/payit/internal/payments/metering"
+	"github.com/rjNemo/payit/internal/payments/resilience"
 	"github.com/rjNemo/payit/internal/payments/service"
+	"github.com/rjNemo/payit/internal/payments/shipping"
+	"github.com/rjNemo/payit/internal/payments/tax"
+	"github.com/rjNemo/payit/internal/store"
 	webassets "github.com/rjNemo/payit/web"
 )
 
 type checkoutService interface {
 	CreateSession(context.Context, payments.CheckoutSessionRequest) (payments.CheckoutSessionResult, error)
+	CancelSession(ctx context.Context, id string) error
+	CancelOwnSession(ctx context.Context, id, cancelToken string) error
+	RecoverSession(ctx context.Context, orderID string) (payments.CheckoutSessionResult, error)
+	CompleteSession(ctx context.Context, id string) (payments.Order, error)
+	CreatePaymentIntent(context.Context, payments.CheckoutSessionRequest) (payments.PaymentIntent, error)
+	PaymentIntentStatus(ctx context.Context, id string) (payments.PaymentIntent, error)
+	AbandonmentReport(ctx context.Context, since time.Time) (payments.AbandonmentReport, error)
+}
+
+type webhookParser interface {
+	ParseEvent(payload []byte, signature string) (payments.Event, error)
+}
+
+type paypalWebhookParser interface {
+	ParseWebhook(ctx context.Context, header http.Header, payload []byte) (payments.Event, error)
+}
+
+type eventHandler interface {
+	HandleEvent(context.Context, payments.Event) error
 }
 
 // Handler aggregates dependencies required by HTTP handlers.
 type Handler struct {
 	cfg      config.Config
 	checkout checkoutService
-	page     *template.Template
-	fs       fs.FS
+	webhooks webhookParser
+	// paypalWebhooks verifies PayPal deliveries when PayPal is configured.
+	paypalWebhooks paypalWebhookParser
+	events         eventHandler
+	admin          adminService
+	webhookLog     webhookLog
+	auth           authenticator
+	// logins throttles repeated failed sign-ins.
+	logins     *loginThrottle
+	auditTrail auditTrail
+	// accounts and accountAuth serve the customer self-service area; it is
+	// only mounted when accountAuth is set.
+	accounts    accountService
+	accountAuth accountAuth
+	mailer      signInMailer
+	// usage buffers metered usage reported through /api/v1/usage.
+	usage usageMeter
+	// idempotency replays /api/v1 POST responses for repeated Idempotency-Keys.
+	idempotency *idempotencyCache
+	page        *template.Template
+	adminPages  *template.Template
+	// accountPages renders the customer account area.
+	accountPages *template.Template
+	fs           fs.FS
+}
+
+// Check reports configuration NewServer would refuse to start with, such as
+// routes naming a payment provider that is not configured.
+func Check(cfg config.Config) error {
+	_, _, drivers := paymentDrivers(cfg)
+	if _, err := checkoutDriver(cfg, drivers); err != nil {
+		return fmt.Errorf("route payment providers: %w", err)
+	}
+	return nil
+}
+
+// paymentDrivers builds the Stripe driver, the PayPal driver when PayPal is
+// configured, and both keyed by provider name.
+func paymentDrivers(cfg config.Config) (*stripe.Driver, *paypal.Driver, map[string]service.CheckoutDriver) {
+	stripeOpts := []stripe.Option{
+		stripe.WithPromotionCodes(cfg.AllowPromotionCodes),
+		stripe.WithSessionTTL(cfg.CheckoutSessionTTL),
+		stripe.WithManualCapture(cfg.ManualCapture),
+		stripe.WithPolicy(resilience.New(cfg.Resilience)),
+	}
+	if cfg.CheckoutUI == config.CheckoutUIEmbedded {
+		stripeOpts = append(stripeOpts, stripe.WithEmbeddedUI(cfg.PublicURL))
+	}
+	stripeDriver := stripe.NewDriver(cfg.StripeSecretKey, cfg.Product, stripeOpts...)
+	drivers := map[string]service.CheckoutDriver{stripe.Name: stripeDriver}
+	var paypalDriver *paypal.Driver
+	if cfg.PayPal.Enabled() {
+		paypalDriver = paypal.NewDriver(cfg.PayPal, cfg.Product, cfg.PublicURL,
+			paypal.WithPolicy(resilience.New(cfg.Resilience)),
+		)
+		drivers[paypal.Name] = paypalDriver
+	}
+	return stripeDriver, paypalDriver, drivers
+}
+
+// checkoutDriver routes checkouts across drivers by cfg.Routes, or sends them
+// all to Stripe when no routes are configured.
+func checkoutDriver(cfg config.Config, drivers map[string]service.CheckoutDriver) (service.CheckoutDriver, error) {
+	if len(cfg.Routes) == 0 {
+		return drivers[stripe.Name], nil
+	}
+	return router.New(drivers, cfg.Routes)
 }
 
+// recoveryInterval is how often queued abandoned-checkout emails are sent.
+const recoveryInterval = time.Minute
+
+// intentExpiryInterval is how often payment intents left unconfirmed past
+// their expiry are canceled.
+const intentExpiryInterval = time.Minute
+
+// jobInterval is how often scheduled jobs, such as dunning steps, are checked.
+const jobInterval = time.Minute
+
 // NewServer constructs the root HTTP handler, wiring Stripe-backed endpoints as they are implemented.
-func NewServer(cfg config.Config) http.Handler {
-	driver := stripe.NewDriver(cfg.StripeSecretKey, cfg.Product)
-	checkoutSvc := service.NewCheckoutService(driver)
-	tmpl := template.Must(template.ParseFS(webassets.Assets, "templates/index.html"))
+// Background workers started here run until ctx is done.
+func NewServer(ctx context.Context, cfg config.Config) http.Handler {
+	stripeDriver, paypalDriver, drivers := paymentDrivers(cfg)
+	driver, err := checkoutDriver(cfg, drivers)
+	if err != nil {
+		panic(fmt.Errorf("failed to route payment providers: %w", err))
+	}
+	coupons, err := openCoupons(cfg)
+	if err != nil {
+		panic(fmt.Errorf("failed to load coupon redemptions: %w", err))
+	}
+	stock, err := openInventory(cfg)
+	if err != nil {
+		panic(fmt.Errorf("failed to load stock: %w", err))
+	}
+	orders, err := store.Open(cfg.StatePath(config.OrdersStateFile))
+	if err != nil {
+		panic(fmt.Errorf("failed to load orders: %w", err))
+	}
+	notifier, err := notify.New(webassets.Assets, mailTransport(cfg.Mail), cfg.Mail)
+	if err != nil {
+		panic(fmt.Errorf("failed to load email templates: %w", err))
+	}
+	auditLog, err := openAuditLog(ctx, cfg)
+	if err != nil {
+		panic(fmt.Errorf("failed to open audit log: %w", err))
+	}
+	opts := []service.Option{
+		service.WithProduct(cfg.Product),
+		service.WithLimits(cfg.Limits),
+		service.WithCoupons(coupons),
+		service.WithShipping(shipping.NewTable(cfg.Product, cfg.Shipping)),
+		service.WithInventory(stock),
+		service.WithOrders(orders),
+		service.WithRecovery(orders, cfg.PublicURL),
+		service.WithNotifier(notifier),
+		service.WithSubscriptions(orders),
+		service.WithSubscriptionDriver(stripeDriver),
+		service.WithCustomers(orders),
+		service.WithManualCapture(cfg.ManualCapture),
+		service.WithAuditor(auditLog),
+		service.WithPaymentIntents(stripeDriver, cfg.CheckoutSessionTTL),
+		service.WithOffSessionPayments(stripeDriver),
+		service.WithPlans(cfg.Metering.Prices),
+	}
+	var jobQueue *jobs.Queue
+	if cfg.Dunning.Enabled {
+		if jobQueue, err = jobs.Open(cfg.Dunning.JobsPath); err != nil {
+			panic(fmt.Errorf("failed to open job queue: %w", err))
+		}
+		opts = append(opts, service.WithDunning(cfg.Dunning, jobQueue))
+	}
+	if cfg.EventWebhook.URL != "" {
+		opts = append(opts, service.WithNotifier(notify.NewWebhookNotifier(cfg.EventWebhook)))
+	}
+	switch cfg.Tax.Mode {
+	case config.TaxModeStripe:
+		opts = append(opts, service.WithTax(tax.Automatic{}))
+	case config.TaxModeLocal:
+		var tableOpts []tax.TableOption
+		if cfg.Tax.VIESURL != "" {
+			tableOpts = append(tableOpts, tax.WithVATChecker(tax.NewVIES(cfg.Tax.VIESURL)))
+		}
+		opts = append(opts, service.WithTax(tax.NewTable(cfg.Tax, tableOpts...)))
+	}
+	checkoutSvc := service.NewCheckoutService(driver, opts...)
+	tmpl := template.Must(template.ParseFS(webassets.Assets, "templates/index.html", "templates/error.html", "templates/recover.html"))
+	adminPages := template.Must(template.New("admin").Funcs(adminFuncs).ParseFS(webassets.Assets, "templates/admin/*.html"))
+	accountPages := template.Must(template.New("account").Funcs(adminFuncs).ParseFS(webassets.Assets, "templates/account/*.html"))
 	staticFS, err := fs.Sub(webassets.Assets, "static")
 	if err != nil {
 		panic(fmt.Errorf("failed to load static assets: %w", err))
 	}
 
-	h := &Handler{cfg: cfg, checkout: checkoutSvc, page: tmpl, fs: staticFS}
+	go notifier.RunRecoveries(ctx, orders, recoveryInterval)
+	go checkoutSvc.RunIntentExpiry(ctx, intentExpiryInterval)
+	if jobQueue != nil {
+		go jobQueue.Run(ctx, jobInterval, checkoutSvc)
+	}
+	meter, err := openMeter(cfg, orders, stripeDriver)
+	if err != nil {
+		panic(fmt.Errorf("failed to load usage: %w", err))
+	}
+	if len(cfg.Metering.Prices) > 0 {
+		go meter.Run(ctx, cfg.Metering.FlushInterval)
+	}
+
+	h := &Handler{
+		cfg:          cfg,
+		checkout:     checkoutSvc,
+		events:       checkoutSvc,
+		admin:        checkoutSvc,
+		webhookLog:   orders,
+		auditTrail:   auditLog,
+		idempotency:  newIdempotencyCache(),
+		page:         tmpl,
+		adminPages:   adminPages,
+		fs:           staticFS,
+		accounts:     checkoutSvc,
+		mailer:       notifier,
+		accountPages: accountPages,
+		usage:        meter,
+	}
+	if cfg.StripeWebhookSecret != "" {
+		h.webhooks = stripe.NewWebhookParser(cfg.StripeWebhookSecret)
+	}
+	if paypalDriver != nil && cfg.PayPal.WebhookID != "" {
+		h.paypalWebhooks = paypalDriver
+	}
+	if cfg.Accounts.Enabled {
+		h.accountAuth = auth.NewAccounts(cfg.Accounts)
+	}
+	if len(cfg.Admin.Users) > 0 || len(cfg.Admin.APIKeys) > 0 {
+		authenticator, err := auth.NewAuthenticator(cfg.Admin)
+		if err != nil {
+			panic(fmt.Errorf("failed to load admin credentials: %w", err))
+		}
+		h.auth = authenticator
+	}
+	if h.auth != nil || h.accountAuth != nil {
+		h.logins = newLoginThrottle()
+	}
 
 	mux := http.NewServeMux()
 	h.registerRoutes(mux)
 
-	return LoggerMiddleware(mux)
+	return LoggerMiddleware(RequestIDMiddleware(mux))
+}
+
+// openCoupons resumes the coupon redemptions kept in cfg.StateDir. Without
+// coupons there is nothing to count, so nothing is written to disk.
+func openCoupons(cfg config.Config) (*coupon.Engine, error) {
+	if len(cfg.Coupons) == 0 {
+		return coupon.NewEngine(cfg.Product, nil, cfg.CheckoutSessionTTL), nil
+	}
+	return coupon.Open(cfg.StatePath(config.CouponsStateFile), cfg.Product, cfg.Coupons, cfg.CheckoutSessionTTL)
+}
+
+// openInventory resumes the stock levels and reservations kept in
+// cfg.StateDir. Without tracked SKUs every product is unlimited and nothing
+// is written to disk.
+func openInventory(cfg config.Config) (*inventory.Memory, error) {
+	if len(cfg.Inventory) == 0 {
+		return inventory.NewMemory(nil, cfg.CheckoutSessionTTL), nil
+	}
+	return inventory.Open(cfg.StatePath(config.InventoryStateFile), cfg.Inventory, cfg.CheckoutSessionTTL)
+}
+
+// openMeter resumes the usage batches kept in cfg.StateDir. Without metered
+// prices no usage can be recorded, so nothing is written to disk.
+func openMeter(cfg config.Config, customers metering.CustomerStore, reporter metering.Reporter) (*metering.Meter, error) {
+	if len(cfg.Metering.Prices) == 0 {
+		return metering.New(cfg.Metering, customers, reporter), nil
+	}
+	return metering.Open(cfg.StatePath(config.MeteringStateFile), cfg.Metering, customers, reporter)
+}
+
+// openAuditLog resumes the audit trail and records the configuration payit
+// is starting with.
+func openAuditLog(ctx context.Context, cfg config.Config) (*audit.Log, error) {
+	store, err := audit.NewFileStore(cfg.AuditLogPath)
+	if err != nil {
+		return nil, err
+	}
+	auditLog, err := audit.Open(ctx, store, []byte(cfg.AuditKey))
+	if err != nil {
+		return nil, err
+	}
+	if err := audit.RecordConfigLoad(ctx, auditLog, cfg); err != nil {
+		return nil, fmt.Errorf("record configuration: %w", err)
+	}
+	return auditLog, nil
+}
+
+func mailTransport(cfg config.MailConfig) notify.Transport {
+	switch cfg.Transport {
+	case config.MailTransportSMTP:
+		return notify.SMTPTransport{Host: cfg.SMTPHost, Port: cfg.SMTPPort, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}
+	case config.MailTransportFile:
+		return notify.FileTransport{Dir: cfg.Dir}
+	default:
+		return notify.LogTransport{}
+	}
 }
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLoginFailures is how many failed sign-ins a client or account may
+	// make within loginLockout before further attempts are refused.
+	maxLoginFailures = 5
+	loginLockout     = 15 * time.Minute
+	// maxThrottledKeys bounds the failures remembered at once.
+	maxThrottledKeys = 10000
+)
+
+// loginThrottle slows down password guessing by refusing sign-ins for a
+// key, such as a client IP or a username, after repeated failures.
+type loginThrottle struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]loginFailures
+}
+
+type loginFailures struct {
+	count int
+	// until is when the failures are forgotten.
+	until time.Time
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{now: time.Now, failures: make(map[string]loginFailures)}
+}
+
+// blocked reports how long keys must wait before trying again, or zero when
+// none of them is locked out. A nil throttle never blocks.
+func (t *loginThrottle) blocked(keys ...string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var wait time.Duration
+	for _, key := range keys {
+		f, ok := t.failures[key]
+		if !ok {
+			continue
+		}
+		if !now.Before(f.until) {
+			delete(t.failures, key)
+			continue
+		}
+		if f.count >= maxLoginFailures {
+			wait = max(wait, f.until.Sub(now))
+		}
+	}
+	return wait
+}
+
+// fail records a failed sign-in against every key.
+func (t *loginThrottle) fail(keys ...string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if len(t.failures) >= maxThrottledKeys {
+		for key, f := range t.failures {
+			if !now.Before(f.until) {
+				delete(t.failures, key)
+			}
+		}
+	}
+	for _, key := range keys {
+		f := t.failures[key]
+		if !now.Before(f.until) {
+			f = loginFailures{}
+		}
+		if f.count == 0 && len(t.failures) >= maxThrottledKeys {
+			continue
+		}
+		f.count++
+		f.until = now.Add(loginLockout)
+		t.failures[key] = f
+	}
+}
+
+// succeed forgets the failures of keys after a successful sign-in.
+func (t *loginThrottle) succeed(keys ...string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		delete(t.failures, key)
+	}
+}
+
+// clientIP returns the address a request came from.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
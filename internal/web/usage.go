@@ -0,0 +1,71 @@
+package web
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+type usageMeter interface {
+	Record(ctx context.Context, records []payments.UsageRecord) error
+	Reconcile(ctx context.Context, from, to time.Time) (payments.UsageReconciliation, error)
+}
+
+// defaultReconciliationPeriod is how far back a usage reconciliation reaches
+// when the caller does not say.
+const defaultReconciliationPeriod = 30 * 24 * time.Hour
+
+func (h *Handler) apiRecordUsage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req payit.UsageRequest
+		if err := decodeAPIRequest(r, &req); err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if err := h.usage.Record(r.Context(), req.Records); err != nil {
+			writeAPIFailure(w, r, err)
+			return
+		}
+		// Usage reaches the provider at the next flush.
+		writeJSON(w, http.StatusAccepted, payit.UsageReceipt{Accepted: len(req.Records)})
+	}
+}
+
+func (h *Handler) apiUsageReconciliation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from, err := parseAPITime(q.Get("from"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "from must be an RFC 3339 timestamp")
+			return
+		}
+		to, err := parseAPITime(q.Get("to"))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "to must be an RFC 3339 timestamp")
+			return
+		}
+		if to.IsZero() {
+			// Round up so usage recorded this hour is included.
+			to = time.Now().Truncate(time.Hour).Add(time.Hour)
+		}
+		if from.IsZero() {
+			from = to.Add(-defaultReconciliationPeriod)
+		}
+		if !from.Before(to) {
+			writeAPIError(w, r, http.StatusBadRequest, "invalid_request", "from must be before to")
+			return
+		}
+
+		report, err := h.usage.Reconcile(r.Context(), from, to)
+		if err != nil {
+			log.Printf("api: reconcile usage: %v", err)
+			writeAPIFailure(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/config"
+	"github.com/rjNemo/payit/internal/payments"
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+type fakeUsageMeter struct {
+	records  []payments.UsageRecord
+	err      error
+	report   payments.UsageReconciliation
+	from, to time.Time
+}
+
+func (f *fakeUsageMeter) Record(ctx context.Context, records []payments.UsageRecord) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.records = append(f.records, records...)
+	return nil
+}
+
+func (f *fakeUsageMeter) Reconcile(ctx context.Context, from, to time.Time) (payments.UsageReconciliation, error) {
+	f.from, f.to = from, to
+	return f.report, nil
+}
+
+func newUsageTestServer(t *testing.T, meter *fakeUsageMeter) http.Handler {
+	t.Helper()
+	h := newAuthTestHandler(t)
+	h.usage = meter
+	h.idempotency = newIdempotencyCache()
+	mux := http.NewServeMux()
+	h.registerAPIV1Routes(mux)
+	return RequestIDMiddleware(mux)
+}
+
+func TestAPIV1RecordUsage(t *testing.T) {
+	meter := &fakeUsageMeter{}
+	srv := newUsageTestServer(t, meter)
+	body := `{"records":[{"customer_id":"cust_1","meter":"api_requests","quantity":3},{"customer_id":"cust_1","meter":"api_requests","quantity":1}]}`
+
+	if rec := serveAPI(srv, http.MethodPost, "/api/v1/usage", readKey, body); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected usage:write to be required, got %d", rec.Code)
+	}
+
+	rec := serveAPI(srv, http.MethodPost, "/api/v1/usage", meterKey, body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var receipt payit.UsageReceipt
+	if err := json.Unmarshal(rec.Body.Bytes(), &receipt); err != nil || receipt.Accepted != 2 {
+		t.Fatalf("unexpected receipt: %s", rec.Body.String())
+	}
+	if len(meter.records) != 2 || meter.records[0].Quantity != 3 {
+		t.Fatalf("unexpected records: %#v", meter.records)
+	}
+
+	meter.err = &payments.ValidationError{Fields: []payments.FieldError{{Field: "records.0.meter", Code: "invalid", Message: "is not a metered price"}}}
+	rec = serveAPI(srv, http.MethodPost, "/api/v1/usage", meterKey, `{"records":[{"customer_id":"cust_1","meter":"nope","quantity":1}]}`)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "records.0.meter") {
+		t.Fatalf("expected field errors, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPIV1UsageReconciliation(t *testing.T) {
+	meter := &fakeUsageMeter{report: payments.UsageReconciliation{Lines: []payments.UsageReconciliationLine{
+		{CustomerID: "cust_1", Meter: "api_requests", Recorded: 9, Reported: 7, Pending: 2, Provider: 9, Difference: 2},
+	}}}
+	srv := newUsageTestServer(t, meter)
+
+	rec := serveAPI(srv, http.MethodGet, "/api/v1/usage/reconciliation?from=2026-03-01T00:00:00Z&to=2026-03-02T00:00:00Z", readKey, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report payit.UsageReconciliation
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || len(report.Lines) != 1 || report.Lines[0].Difference != 2 {
+		t.Fatalf("unexpected report: %s", rec.Body.String())
+	}
+	if meter.from != time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC) || meter.to.Sub(meter.from) != 24*time.Hour {
+		t.Fatalf("unexpected period %v to %v", meter.from, meter.to)
+	}
+
+	for _, query := range []string{"from=yesterday", "from=2026-03-02T00:00:00Z&to=2026-03-01T00:00:00Z"} {
+		if rec := serveAPI(srv, http.MethodGet, "/api/v1/usage/reconciliation?"+query, readKey, ""); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestAPIV1ProductsListMeteredPrices(t *testing.T) {
+	h := newAuthTestHandler(t)
+	h.cfg.Product = config.ProductConfig{SKU: "demo", PriceCents: 2500, Currency: "eur"}
+	h.cfg.Metering.Prices = []config.MeteredPriceConfig{{Meter: "api_requests", UnitAmountDecimal: "0.5", Currency: "eur", Interval: "month", StripePriceID: "price_1"}}
+
+	products := h.products()
+	if len(products[0].MeteredPrices) != 1 || products[0].MeteredPrices[0] != (payit.MeteredPrice{Meter: "api_requests", UnitAmountDecimal: "0.5", Currency: "eur", Interval: "month"}) {
+		t.Fatalf("unexpected metered prices: %#v", products[0].MeteredPrices)
+	}
+}
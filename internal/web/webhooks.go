@@ -0,0 +1,81 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rjNemo/payit/internal/audit"
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+// maxWebhookBytes caps webhook payloads well above anything providers send.
+const maxWebhookBytes = 1 << 16
+
+func (h *Handler) handleStripeWebhook() http.HandlerFunc {
+	return h.handleWebhook("stripe", func(r *http.Request, payload []byte) (payments.Event, error) {
+		return h.webhooks.ParseEvent(payload, r.Header.Get("Stripe-Signature"))
+	})
+}
+
+func (h *Handler) handlePayPalWebhook() http.HandlerFunc {
+	return h.handleWebhook("paypal", func(r *http.Request, payload []byte) (payments.Event, error) {
+		return h.paypalWebhooks.ParseWebhook(r.Context(), r.Header, payload)
+	})
+}
+
+// handleWebhook verifies a provider delivery with parse, applies the event
+// and records the delivery in the webhook log.
+func (h *Handler) handleWebhook(provider string, parse func(*http.Request, []byte) (payments.Event, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		delivery := payments.WebhookDelivery{Provider: provider, ReceivedAt: time.Now().UTC()}
+		fail := func(status int, message string, err error) {
+			delivery.StatusCode = status
+			delivery.Error = err.Error()
+			h.logWebhook(r.Context(), delivery)
+			http.Error(w, message, status)
+		}
+
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+		if err != nil {
+			fail(http.StatusRequestEntityTooLarge, "unable to read webhook payload", err)
+			return
+		}
+
+		event, err := parse(r, payload)
+		if errors.Is(err, payments.ErrInvalidWebhook) {
+			fail(http.StatusBadRequest, "invalid webhook signature", err)
+			return
+		}
+		if err != nil {
+			fail(http.StatusInternalServerError, "webhook processing failed", err)
+			return
+		}
+		delivery.EventID = event.ID
+		delivery.Type = string(event.Type)
+
+		ctx := audit.WithActor(r.Context(), provider)
+		if err := h.events.HandleEvent(ctx, event); err != nil {
+			log.Printf("webhook %s (%s) failed: %v", event.ID, event.Type, err)
+			fail(http.StatusInternalServerError, "webhook processing failed", err)
+			return
+		}
+
+		delivery.StatusCode = http.StatusNoContent
+		h.logWebhook(r.Context(), delivery)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// logWebhook records a delivery in the webhook log when one is configured.
+func (h *Handler) logWebhook(ctx context.Context, delivery payments.WebhookDelivery) {
+	if h.webhookLog == nil {
+		return
+	}
+	if err := h.webhookLog.RecordWebhook(context.WithoutCancel(ctx), delivery); err != nil {
+		log.Printf("record webhook delivery %s: %v", delivery.EventID, err)
+	}
+}
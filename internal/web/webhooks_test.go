@@ -0,0 +1,157 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rjNemo/payit/internal/payments"
+)
+
+type fakeWebhookParser struct {
+	event     payments.Event
+	err       error
+	signature string
+}
+
+func (f *fakeWebhookParser) ParseEvent(payload []byte, signature string) (payments.Event, error) {
+	f.signature = signature
+	return f.event, f.err
+}
+
+type fakeEventHandler struct {
+	events []payments.Event
+	err    error
+}
+
+func (f *fakeEventHandler) HandleEvent(ctx context.Context, event payments.Event) error {
+	f.events = append(f.events, event)
+	return f.err
+}
+
+func TestStripeWebhookDispatchesEvent(t *testing.T) {
+	parser := &fakeWebhookParser{event: payments.Event{ID: "evt_1", Type: payments.EventCheckoutCompleted}}
+	events := &fakeEventHandler{}
+	handler := &Handler{webhooks: parser, events: events}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/stripe", bytes.NewBufferString("{}"))
+	req.Header.Set("Stripe-Signature", "t=1,v1=abc")
+	rec := httptest.NewRecorder()
+
+	handler.handleStripeWebhook()(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", rec.Code)
+	}
+	if parser.signature != "t=1,v1=abc" {
+		t.Fatalf("expected signature header to be forwarded, got %q", parser.signature)
+	}
+	if len(events.events) != 1 || events.events[0].ID != "evt_1" {
+		t.Fatalf("expected event to be handled, got %#v", events.events)
+	}
+}
+
+func TestStripeWebhookRejectsInvalidSignature(t *testing.T) {
+	events := &fakeEventHandler{}
+	handler := &Handler{webhooks: &fakeWebhookParser{err: payments.ErrInvalidWebhook}, events: events}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/stripe", bytes.NewBufferString("{}"))
+	rec := httptest.NewRecorder()
+
+	handler.handleStripeWebhook()(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rec.Code)
+	}
+	if len(events.events) != 0 {
+		t.Fatal("expected no events to be handled")
+	}
+}
+
+func TestStripeWebhookHandlerFailure(t *testing.T) {
+	handler := &Handler{webhooks: &fakeWebhookParser{}, events: &fakeEventHandler{err: errors.New("db down")}}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/stripe", bytes.NewBufferString("{}"))
+	rec := httptest.NewRecorder()
+
+	handler.handleStripeWebhook()(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500 so Stripe retries, got %d", rec.Code)
+	}
+}
+
+type fakeWebhookLog struct {
+	deliveries []payments.WebhookDelivery
+}
+
+func (f *fakeWebhookLog) RecordWebhook(ctx context.Context, delivery payments.WebhookDelivery) error {
+	f.deliveries = append(f.deliveries, delivery)
+	return nil
+}
+
+func (f *fakeWebhookLog) WebhookDeliveries(ctx context.Context) ([]payments.WebhookDelivery, error) {
+	return f.deliveries, nil
+}
+
+func TestStripeWebhookLogsDeliveries(t *testing.T) {
+	log := &fakeWebhookLog{}
+	parser := &fakeWebhookParser{event: payments.Event{ID: "evt_1", Type: payments.EventCheckoutCompleted}}
+	events := &fakeEventHandler{}
+	handler := &Handler{webhooks: parser, events: events, webhookLog: log}
+
+	handler.handleStripeWebhook()(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/webhooks/stripe", bytes.NewBufferString("{}")))
+	events.err = errors.New("db down")
+	handler.handleStripeWebhook()(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/webhooks/stripe", bytes.NewBufferString("{}")))
+
+	if len(log.deliveries) != 2 {
+		t.Fatalf("expected two logged deliveries, got %#v", log.deliveries)
+	}
+	ok, failed := log.deliveries[0], log.deliveries[1]
+	if ok.EventID != "evt_1" || ok.StatusCode != http.StatusNoContent || ok.Error != "" {
+		t.Fatalf("unexpected successful delivery: %#v", ok)
+	}
+	if failed.StatusCode != http.StatusInternalServerError || failed.Error != "db down" {
+		t.Fatalf("unexpected failed delivery: %#v", failed)
+	}
+}
+
+type fakePayPalWebhooks struct {
+	event  payments.Event
+	err    error
+	header http.Header
+}
+
+func (f *fakePayPalWebhooks) ParseWebhook(ctx context.Context, header http.Header, payload []byte) (payments.Event, error) {
+	f.header = header
+	return f.event, f.err
+}
+
+func TestPayPalWebhookDispatchesEvent(t *testing.T) {
+	parser := &fakePayPalWebhooks{event: payments.Event{ID: "WH-1", Type: payments.EventCheckoutCompleted}}
+	events := &fakeEventHandler{}
+	log := &fakeWebhookLog{}
+	handler := &Handler{paypalWebhooks: parser, events: events, webhookLog: log}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/paypal", bytes.NewBufferString("{}"))
+	req.Header.Set("PAYPAL-TRANSMISSION-SIG", "sig")
+	rec := httptest.NewRecorder()
+	handler.handlePayPalWebhook()(rec, req)
+
+	if rec.Code != http.StatusNoContent || len(events.events) != 1 || parser.header.Get("PAYPAL-TRANSMISSION-SIG") != "sig" {
+		t.Fatalf("expected the event to be handled, got %d %#v", rec.Code, events.events)
+	}
+	if len(log.deliveries) != 1 || log.deliveries[0].Provider != "paypal" {
+		t.Fatalf("expected a logged paypal delivery, got %#v", log.deliveries)
+	}
+
+	parser.err = payments.ErrInvalidWebhook
+	rec = httptest.NewRecorder()
+	handler.handlePayPalWebhook()(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks/paypal", bytes.NewBufferString("{}")))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unverified delivery, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,340 @@
+// Package client talks to payit's /api/v1 HTTP API and verifies the webhooks
+// payit sends.
+//
+// Requests that fail with a network error, 429 or 503/504 are retried with
+// exponential backoff. Every POST carries an Idempotency-Key that is reused
+// across its retries, so a retried refund is never issued twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+// Defaults applied by New.
+const (
+	DefaultRetries = 3
+	DefaultBackoff = 250 * time.Millisecond
+	// maxBackoff caps the wait between two attempts.
+	maxBackoff = 10 * time.Second
+)
+
+// Client is a payit API client. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// Option customises a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends requests through hc instead of http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithRetries sets how many times a failed request is retried; zero disables
+// retries.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.retries = max(n, 0)
+	}
+}
+
+// WithBackoff sets the wait before the first retry; it doubles on every
+// further attempt.
+func WithBackoff(d time.Duration) Option {
+	return func(c *Client) {
+		c.backoff = d
+	}
+}
+
+// New returns a client for the payit server at baseURL, such as
+// "https://pay.example.com". apiKey is sent as a bearer token and may be
+// empty for the public checkout endpoints.
+func New(baseURL, apiKey string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    http.DefaultClient,
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey makes the next POST made with ctx use key instead of a
+// generated one. Reuse the same key when repeating an operation after a crash
+// so payit replays the original result.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// CreateCheckoutSession starts a hosted checkout; send the customer to the URL
+// of the result.
+func (c *Client) CreateCheckoutSession(ctx context.Context, req payit.CheckoutSessionRequest) (payit.CheckoutSessionResult, error) {
+	var session payit.CheckoutSessionResult
+	err := c.do(ctx, http.MethodPost, "/api/v1/checkout-sessions", nil, req, &session)
+	return session, err
+}
+
+// CancelCheckoutSession expires an open checkout session. cancelToken is the
+// one returned with the session; it may be empty for clients whose API key
+// has the refunds:write scope.
+func (c *Client) CancelCheckoutSession(ctx context.Context, id, cancelToken string) error {
+	req := payit.CancelCheckoutSessionRequest{CancelToken: cancelToken}
+	return c.do(ctx, http.MethodPost, "/api/v1/checkout-sessions/"+url.PathEscape(id)+"/cancel", nil, req, nil)
+}
+
+// Order fetches one order. It needs the orders:read scope.
+func (c *Client) Order(ctx context.Context, id string) (payit.Order, error) {
+	var order payit.Order
+	err := c.do(ctx, http.MethodGet, "/api/v1/orders/"+url.PathEscape(id), nil, nil, &order)
+	return order, err
+}
+
+// ListOrdersParams narrows an order listing. Zero fields are not sent.
+type ListOrdersParams struct {
+	Status payit.OrderStatus
+	// Email matches customer emails case-insensitively by substring.
+	Email string
+	// CreatedFrom and CreatedTo bound the creation time; CreatedTo is exclusive.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Limit is the page size, up to 100; the server default is 20.
+	Limit  int
+	Cursor string
+}
+
+func (p ListOrdersParams) query() url.Values {
+	q := url.Values{}
+	if p.Status != "" {
+		q.Set("status", string(p.Status))
+	}
+	if p.Email != "" {
+		q.Set("email", p.Email)
+	}
+	if !p.CreatedFrom.IsZero() {
+		q.Set("created_from", p.CreatedFrom.Format(time.RFC3339))
+	}
+	if !p.CreatedTo.IsZero() {
+		q.Set("created_to", p.CreatedTo.Format(time.RFC3339))
+	}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Cursor != "" {
+		q.Set("cursor", p.Cursor)
+	}
+	return q
+}
+
+// ListOrders fetches one page of orders, newest first. It needs the
+// orders:read scope.
+func (c *Client) ListOrders(ctx context.Context, params ListOrdersParams) (payit.List[payit.Order], error) {
+	var page payit.List[payit.Order]
+	err := c.do(ctx, http.MethodGet, "/api/v1/orders", params.query(), nil, &page)
+	return page, err
+}
+
+// AllOrders walks every page of orders matching params. Iteration stops at
+// the first error, which is yielded with a zero order.
+func (c *Client) AllOrders(ctx context.Context, params ListOrdersParams) iter.Seq2[payit.Order, error] {
+	return func(yield func(payit.Order, error) bool) {
+		for {
+			page, err := c.ListOrders(ctx, params)
+			if err != nil {
+				yield(payit.Order{}, err)
+				return
+			}
+			for _, order := range page.Data {
+				if !yield(order, nil) {
+					return
+				}
+			}
+			if !page.HasMore {
+				return
+			}
+			params.Cursor = page.NextCursor
+		}
+	}
+}
+
+// Refund returns amountCents of a paid order to the customer, or everything
+// that is left when amountCents is zero. It needs the refunds:write scope.
+func (c *Client) Refund(ctx context.Context, orderID string, amountCents int64) (payit.Refund, error) {
+	var refund payit.Refund
+	err := c.do(ctx, http.MethodPost, "/api/v1/orders/"+url.PathEscape(orderID)+"/refunds", nil,
+		payit.RefundRequest{AmountCents: amountCents}, &refund)
+	return refund, err
+}
+
+// RecordUsage reports usage of metered prices. payit aggregates it and
+// passes it on to the payment provider on a schedule. It needs the
+// usage:write scope.
+func (c *Client) RecordUsage(ctx context.Context, records []payit.UsageRecord) (payit.UsageReceipt, error) {
+	var receipt payit.UsageReceipt
+	err := c.do(ctx, http.MethodPost, "/api/v1/usage", nil, payit.UsageRequest{Records: records}, &receipt)
+	return receipt, err
+}
+
+// UsageReconciliation compares the usage recorded between from and to with
+// what the payment provider has on record. Zero bounds default to the last 30
+// days. It needs the orders:read scope.
+func (c *Client) UsageReconciliation(ctx context.Context, from, to time.Time) (payit.UsageReconciliation, error) {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+	var report payit.UsageReconciliation
+	err := c.do(ctx, http.MethodGet, "/api/v1/usage/reconciliation", query, nil, &report)
+	return report, err
+}
+
+// do sends a request, retrying transient failures, and decodes a successful
+// response into out. API failures come back as *payit.Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("payit: encode request: %w", err)
+		}
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var key string
+	if method == http.MethodPost {
+		key, _ = ctx.Value(idempotencyKey{}).(string)
+		if key == "" {
+			key = rand.Text()
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		wait, err := c.attempt(ctx, method, target, key, payload, out)
+		if wait < 0 || attempt >= c.retries {
+			return err
+		}
+		if wait == 0 {
+			wait = min(c.backoff<<attempt, maxBackoff)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt makes one request. A non-negative wait means the failure is
+// transient and the request may be retried, after wait when the server asked
+// for a delay.
+func (c *Client) attempt(ctx context.Context, method, target, key string, payload []byte, out any) (wait time.Duration, err error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return -1, fmt.Errorf("payit: build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		}
+		return 0, fmt.Errorf("payit: %s %s: %w", method, req.URL.Path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		apiErr := decodeError(resp)
+		if !retryable(method, resp.StatusCode) {
+			return -1, apiErr
+		}
+		return retryAfter(resp), apiErr
+	}
+	if out == nil {
+		return -1, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return -1, fmt.Errorf("payit: decode response: %w", err)
+	}
+	return -1, nil
+}
+
+// retryable reports whether a failed response may succeed on another try.
+// Other server errors are only retried for reads: payit may have acted before
+// failing, and replaying that is the caller's decision.
+func retryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return method == http.MethodGet && status >= http.StatusInternalServerError
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return min(time.Duration(secs)*time.Second, maxBackoff)
+}
+
+func decodeError(resp *http.Response) error {
+	var envelope payit.ErrorEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil || envelope.Error == nil {
+		return &payit.Error{StatusCode: resp.StatusCode, Code: "http_error", Message: resp.Status}
+	}
+	envelope.Error.StatusCode = resp.StatusCode
+	return envelope.Error
+}
+
+// IsNotFound reports whether err is payit's answer for a missing resource.
+func IsNotFound(err error) bool {
+	var apiErr *payit.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
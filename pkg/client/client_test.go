@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+func TestRefundRetriesWithSameIdempotencyKey(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if r.URL.Path != "/api/v1/orders/cs_1/refunds" || r.Header.Get("Authorization") != "Bearer key_1" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"amount_cents":1250}` {
+			t.Errorf("unexpected body %s", body)
+		}
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(payit.Refund{OrderID: "cs_1", AmountCents: 1250, Currency: "eur"})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, "key_1", WithBackoff(time.Millisecond))
+	refund, err := c.Refund(context.Background(), "cs_1", 1250)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if refund.AmountCents != 1250 {
+		t.Fatalf("unexpected refund: %#v", refund)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("expected one idempotency key reused across retries, got %q", keys)
+	}
+}
+
+func TestCallerIdempotencyKey(t *testing.T) {
+	var key string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get("Idempotency-Key")
+		_ = json.NewEncoder(w).Encode(payit.CheckoutSessionResult{ID: "cs_1"})
+	}))
+	defer srv.Close()
+
+	ctx := WithIdempotencyKey(context.Background(), "order-42")
+	if _, err := New(srv.URL, "").CreateCheckoutSession(ctx, payit.CheckoutSessionRequest{Quantity: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key != "order-42" {
+		t.Fatalf("expected caller key, got %q", key)
+	}
+}
+
+func TestAPIErrorsAreNotRetried(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"error":{"code":"not_refundable","message":"order cannot be refunded","request_id":"req_1"}}`))
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "key_1", WithBackoff(time.Millisecond)).Refund(context.Background(), "cs_1", 0)
+	var apiErr *payit.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *payit.Error, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusConflict || apiErr.Code != "not_refundable" || apiErr.RequestID != "req_1" {
+		t.Fatalf("unexpected error: %#v", apiErr)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls)
+	}
+}
+
+func TestRetriesStopWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "key_1", WithBackoff(time.Hour)).Order(ctx, "cs_1")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context cancellation, got %v", err)
+	}
+}
+
+func TestAllOrdersFollowsCursor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("status") != "paid" {
+			t.Errorf("expected status filter, got %s", r.URL.RawQuery)
+		}
+		page := payit.List[payit.Order]{Data: []payit.Order{{ID: "cs_2"}}, HasMore: true, NextCursor: "cs_2"}
+		if r.URL.Query().Get("cursor") == "cs_2" {
+			page = payit.List[payit.Order]{Data: []payit.Order{{ID: "cs_1"}}}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	var ids []string
+	for order, err := range New(srv.URL, "key_1").AllOrders(context.Background(), ListOrdersParams{Status: payit.OrderStatusPaid}) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, order.ID)
+	}
+	if len(ids) != 2 || ids[0] != "cs_2" || ids[1] != "cs_1" {
+		t.Fatalf("unexpected orders: %v", ids)
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := New(srv.URL, "key_1").Order(context.Background(), "cs_9")
+	if !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req payit.UsageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/api/v1/usage" || len(req.Records) != 1 {
+			t.Errorf("unexpected request %s: %#v", r.URL.Path, req)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(payit.UsageReceipt{Accepted: len(req.Records)})
+	}))
+	defer srv.Close()
+
+	receipt, err := New(srv.URL, "key_1").RecordUsage(context.Background(), []payit.UsageRecord{{CustomerID: "cust_1", Meter: "api_requests", Quantity: 3}})
+	if err != nil || receipt.Accepted != 1 {
+		t.Fatalf("unexpected receipt %#v: %v", receipt, err)
+	}
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+// WebhookTolerance is how old a signed delivery may be before ParseWebhook
+// rejects it as a possible replay.
+const WebhookTolerance = 5 * time.Minute
+
+// ErrInvalidSignature reports a webhook that was not signed by payit with the
+// expected secret, or that is too old to trust.
+var ErrInvalidSignature = errors.New("payit: invalid webhook signature")
+
+// ParseWebhook verifies a delivery from payit and decodes it. signature is the
+// value of the payit.SignatureHeader request header and payload the raw body.
+func ParseWebhook(payload []byte, signature, secret string) (payit.WebhookEvent, error) {
+	return parseWebhook(payload, signature, secret, time.Now())
+}
+
+func parseWebhook(payload []byte, signature, secret string, now time.Time) (payit.WebhookEvent, error) {
+	var timestamp string
+	var macs []string
+	for _, part := range strings.Split(signature, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			timestamp = value
+		case "v1":
+			macs = append(macs, value)
+		}
+	}
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(macs) == 0 {
+		return payit.WebhookEvent{}, fmt.Errorf("%w: malformed %s header", ErrInvalidSignature, payit.SignatureHeader)
+	}
+	if age := now.Sub(time.Unix(secs, 0)); age > WebhookTolerance || age < -WebhookTolerance {
+		return payit.WebhookEvent{}, fmt.Errorf("%w: signed %s ago", ErrInvalidSignature, age.Round(time.Second))
+	}
+
+	want := payit.WebhookSignature(payload, secret, timestamp)
+	verified := false
+	for _, mac := range macs {
+		if hmac.Equal([]byte(mac), []byte(want)) {
+			verified = true
+		}
+	}
+	if !verified {
+		return payit.WebhookEvent{}, ErrInvalidSignature
+	}
+
+	var event payit.WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return payit.WebhookEvent{}, fmt.Errorf("payit: decode webhook: %w", err)
+	}
+	return event, nil
+}
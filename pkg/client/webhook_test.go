@@ -0,0 +1,40 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjNemo/payit/pkg/payit"
+)
+
+func TestParseWebhook(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"order.paid","created_at":"2026-03-01T10:00:00Z","order":{"id":"cs_1"}}`)
+	sentAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	signature := payit.SignWebhook(payload, "whsec_1", sentAt)
+
+	event, err := parseWebhook(payload, signature, "whsec_1", sentAt.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Type != payit.WebhookOrderPaid || event.Order == nil || event.Order.ID != "cs_1" {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+
+	rejected := map[string]struct {
+		payload   []byte
+		signature string
+		secret    string
+		now       time.Time
+	}{
+		"wrong secret": {payload, signature, "whsec_2", sentAt},
+		"tampered":     {[]byte(`{"id":"evt_1","type":"order.refunded"}`), signature, "whsec_1", sentAt},
+		"stale":        {payload, signature, "whsec_1", sentAt.Add(time.Hour)},
+		"malformed":    {payload, "v1=abc", "whsec_1", sentAt},
+	}
+	for name, tc := range rejected {
+		if _, err := parseWebhook(tc.payload, tc.signature, tc.secret, tc.now); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+}
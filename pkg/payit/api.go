@@ -0,0 +1,136 @@
+// Package payit defines the request and response types of payit's HTTP API.
+// The server and pkg/client share them so the two cannot drift apart.
+package payit
+
+import (
+	"fmt"
+	"time"
+)
+
+// List is one page of a collection. While HasMore is true, pass NextCursor
+// back as the cursor of the next request.
+type List[T any] struct {
+	Data       []T    `json:"data"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ErrorEnvelope is the body of every failed API response.
+type ErrorEnvelope struct {
+	Error *Error `json:"error"`
+}
+
+// Error describes why an API request failed. Code is stable and meant for
+// programs; Message is meant for people.
+type Error struct {
+	// StatusCode is the HTTP status the error was returned with.
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RequestID  string `json:"request_id,omitempty"`
+	// Fields lists each invalid request field when Code is validation_failed.
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError explains why one request field was rejected. Field is the JSON
+// name, dotted for nested values such as metadata.order_ref.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.RequestID == "" {
+		return fmt.Sprintf("payit: %s: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("payit: %s: %s (request %s)", e.Code, e.Message, e.RequestID)
+}
+
+// Product is a catalog entry.
+type Product struct {
+	SKU         string `json:"sku"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	PriceCents  int64  `json:"price_cents"`
+	Currency    string `json:"currency"`
+	Physical    bool   `json:"physical"`
+	// MeteredPrices bill subscribers for what they use, per unit of a meter.
+	MeteredPrices []MeteredPrice `json:"metered_prices,omitempty"`
+}
+
+// MeteredPrice is a usage-based subscription price of a product.
+type MeteredPrice struct {
+	Meter string `json:"meter"`
+	Name  string `json:"name,omitempty"`
+	// UnitAmountDecimal is the price of one unit in cents and may be
+	// fractional, such as "0.05".
+	UnitAmountDecimal string `json:"unit_amount_decimal"`
+	Currency          string `json:"currency"`
+	Interval          string `json:"interval"`
+	// TrialDays is how long new subscribers use the price for free.
+	TrialDays int64 `json:"trial_days,omitempty"`
+	// TrialWithoutCard means the trial starts without asking for a card.
+	TrialWithoutCard bool `json:"trial_without_card,omitempty"`
+}
+
+// RefundRequest asks for part of a paid order to be refunded.
+type RefundRequest struct {
+	// AmountCents of zero refunds whatever is left on the order.
+	AmountCents int64 `json:"amount_cents"`
+}
+
+// Refund reports an issued refund and the order it was applied to.
+type Refund struct {
+	OrderID     string `json:"order_id"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	Order       Order  `json:"order"`
+}
+
+// UsageRecord reports Quantity units of a meter used by a customer.
+type UsageRecord struct {
+	// CustomerID is payit's customer ID, as on orders.
+	CustomerID string `json:"customer_id"`
+	Meter      string `json:"meter"`
+	Quantity   int64  `json:"quantity"`
+	// Timestamp is when the usage happened; it defaults to when payit
+	// receives the record.
+	Timestamp time.Time `json:"timestamp,omitzero"`
+}
+
+// UsageRequest reports a batch of usage records.
+type UsageRequest struct {
+	Records []UsageRecord `json:"records"`
+}
+
+// UsageReceipt acknowledges usage payit has recorded and will report to the
+// payment provider.
+type UsageReceipt struct {
+	Accepted int `json:"accepted"`
+}
+
+// UsageReconciliation compares the usage payit recorded in a period with
+// what the payment provider has on record.
+type UsageReconciliation struct {
+	From  time.Time                 `json:"from"`
+	To    time.Time                 `json:"to"`
+	Lines []UsageReconciliationLine `json:"lines"`
+}
+
+// UsageReconciliationLine is the usage of one meter by one customer.
+type UsageReconciliationLine struct {
+	CustomerID string `json:"customer_id"`
+	Meter      string `json:"meter"`
+	// Recorded is all usage payit received; Pending is the part not yet
+	// reported to the provider and Reported the part that was.
+	Recorded int64 `json:"recorded"`
+	Pending  int64 `json:"pending"`
+	Reported int64 `json:"reported"`
+	// Provider is the usage the provider has on record.
+	Provider int64 `json:"provider"`
+	// Difference is Provider minus Reported; anything but zero needs a look.
+	Difference int64 `json:"difference"`
+	// Error explains why the provider's figure could not be read.
+	Error string `json:"error,omitempty"`
+}
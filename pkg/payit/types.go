@@ -0,0 +1,207 @@
+package payit
+
+import "time"
+
+// CheckoutSessionRequest captures optional inputs for creating a checkout session.
+type CheckoutSessionRequest struct {
+	Quantity  int64  `json:"quantity"`
+	PromoCode string `json:"promo_code,omitempty"`
+	// Country and Region locate the buyer for tax purposes (ISO 3166 codes).
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+	// TaxID identifies a business buyer and may trigger reverse charge.
+	TaxID string `json:"tax_id,omitempty"`
+	// CustomerEmail prefills the buyer's email on the payment page and links
+	// the order to the customer with that email.
+	CustomerEmail string `json:"customer_email,omitempty"`
+	CustomerName  string `json:"customer_name,omitempty"`
+	// Locale is the buyer's preferred language as a BCP 47 tag, such as "fr"
+	// or "en-GB", remembered on their customer record.
+	Locale string `json:"locale,omitempty"`
+	// Metadata is kept on the order and passed to the payment provider.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Plan subscribes the buyer to the metered price with this meter instead
+	// of selling the product once.
+	Plan string `json:"plan,omitempty"`
+}
+
+// CheckoutSessionResult contains the data returned to callers initiating checkout.
+type CheckoutSessionResult struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// ClientSecret mounts an embedded checkout on payit's own page; URL is
+	// empty when it is set.
+	ClientSecret string `json:"client_secret,omitempty"`
+	// CancelToken lets the buyer who started the session cancel it.
+	CancelToken string `json:"cancel_token,omitempty"`
+	// Provider names the payment provider that created the session.
+	Provider string `json:"-"`
+}
+
+// CancelCheckoutSessionRequest cancels a checkout session on behalf of the
+// buyer who started it.
+type CancelCheckoutSessionRequest struct {
+	CancelToken string `json:"cancel_token"`
+}
+
+// SubscriptionPlan is the catalog price a subscription checkout signs the
+// buyer up to.
+type SubscriptionPlan struct {
+	Meter         string
+	StripePriceID string
+	// TrialDays delays the first bill; zero starts billing right away.
+	TrialDays int64
+	// TrialWithoutCard skips collecting a payment method for the trial.
+	TrialWithoutCard bool
+}
+
+// Discount describes a validated promotion applied to a checkout session.
+type Discount struct {
+	Code string
+	// UnitAmountOffCents is the reduction applied to each unit when the driver
+	// adjusts the price itself.
+	UnitAmountOffCents int64
+	// StripeCouponID, when set, lets the Stripe driver attach a native discount
+	// instead of adjusting the price.
+	StripeCouponID string
+}
+
+// TaxBreakdown records how tax was determined for a checkout.
+type TaxBreakdown struct {
+	// Automatic delegates calculation to the provider; amounts stay zero until
+	// the provider reports them.
+	Automatic       bool   `json:"automatic,omitempty"`
+	Country         string `json:"country,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Name            string `json:"name,omitempty"`
+	RateBasisPoints int64  `json:"rate_basis_points"`
+	Inclusive       bool   `json:"inclusive"`
+	ReverseCharge   bool   `json:"reverse_charge,omitempty"`
+	TaxID           string `json:"tax_id,omitempty"`
+	// TaxIDStatus is TaxIDVerified when TaxID was found to be a valid VAT
+	// number, and TaxIDUnverified when it was not and tax was charged.
+	TaxIDStatus string `json:"tax_id_status,omitempty"`
+	NetCents    int64  `json:"net_cents"`
+	TaxCents    int64  `json:"tax_cents"`
+	GrossCents  int64  `json:"gross_cents"`
+}
+
+// Outcomes of checking a buyer's tax ID, recorded in TaxBreakdown.TaxIDStatus.
+const (
+	TaxIDVerified   = "verified"
+	TaxIDUnverified = "unverified"
+)
+
+// Shipping lists where a physical order may ship and the rates on offer.
+type Shipping struct {
+	AllowedCountries []string
+	Options          []ShippingOption
+}
+
+// ShippingOption is a delivery method the customer can choose at checkout.
+type ShippingOption struct {
+	Name        string
+	AmountCents int64
+	MinDays     int64
+	MaxDays     int64
+}
+
+// Address is a postal address collected during checkout.
+type Address struct {
+	Name       string `json:"name,omitempty"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	State      string `json:"state,omitempty"`
+	Country    string `json:"country"`
+}
+
+// OrderStatus tracks where an order is in its lifecycle.
+type OrderStatus string
+
+// Order lifecycle states.
+const (
+	OrderStatusOpen OrderStatus = "open"
+	// OrderStatusAuthorized marks a payment held on the card, waiting for capture.
+	OrderStatusAuthorized OrderStatus = "authorized"
+	OrderStatusPaid       OrderStatus = "paid"
+	OrderStatusExpired    OrderStatus = "expired"
+	OrderStatusFailed     OrderStatus = "failed"
+	OrderStatusCanceled   OrderStatus = "canceled"
+	OrderStatusRefunded   OrderStatus = "refunded"
+)
+
+// Order is payit's local record of a checkout session and what it charges.
+type Order struct {
+	ID     string      `json:"id"`
+	Status OrderStatus `json:"status"`
+	SKU    string      `json:"sku,omitempty"`
+	// Plan is the meter of the metered price a subscription checkout signs up to.
+	Plan          string        `json:"plan,omitempty"`
+	Quantity      int64         `json:"quantity"`
+	Currency      string        `json:"currency"`
+	SubtotalCents int64         `json:"subtotal_cents"`
+	DiscountCents int64         `json:"discount_cents"`
+	PromoCode     string        `json:"promo_code,omitempty"`
+	Tax           *TaxBreakdown `json:"tax,omitempty"`
+	Physical      bool          `json:"physical,omitempty"`
+	ShippingRate  string        `json:"shipping_rate,omitempty"`
+	ShippingCents int64         `json:"shipping_cents,omitempty"`
+	// ShippingAddress is filled in once the provider reports the completed checkout.
+	ShippingAddress *Address `json:"shipping_address,omitempty"`
+	CustomerEmail   string   `json:"customer_email,omitempty"`
+	// CustomerID links the order to payit's record of the buyer.
+	CustomerID      string `json:"customer_id,omitempty"`
+	PaymentIntentID string `json:"payment_intent_id,omitempty"`
+	// Provider names the payment provider that served the order, such as
+	// "stripe"; refunds and captures go back to it.
+	Provider      string `json:"provider,omitempty"`
+	RefundedCents int64  `json:"refunded_cents,omitempty"`
+	// ReservationID holds the inventory reservation made for this order.
+	ReservationID string `json:"reservation_id,omitempty"`
+	// CancelToken is handed to the buyer with the session so they, and only
+	// they, can cancel the checkout. It is never serialized.
+	CancelToken string `json:"-"`
+	// RedemptionID holds the promotion code redemption made for this order.
+	RedemptionID string    `json:"redemption_id,omitempty"`
+	TotalCents   int64     `json:"total_cents"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`
+	PaidAt       time.Time `json:"paid_at,omitzero"`
+	// RecoveredFrom links an order started from a recovery link to the
+	// abandoned order it replaces.
+	RecoveredFrom string `json:"recovered_from,omitempty"`
+	// RecoveredBy is the order whose checkout was opened to recover this
+	// expired one; the recovery link keeps sending the buyer there.
+	RecoveredBy string `json:"recovered_by,omitempty"`
+	// CheckoutURL is the hosted payment page of the order's checkout.
+	CheckoutURL string `json:"checkout_url,omitempty"`
+	// Metadata is what the caller attached when starting the checkout.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Timeline lists what happened to the order, oldest first.
+	Timeline []TimelineEntry `json:"timeline,omitempty"`
+}
+
+// Customer is payit's stable record of a buyer, linked to the customer each
+// payment provider keeps for them.
+type Customer struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+	// Locale is the customer's preferred language as a BCP 47 tag.
+	Locale string `json:"locale,omitempty"`
+	// ProviderIDs maps a provider name, such as "stripe", to the customer's
+	// ID with that provider.
+	ProviderIDs map[string]string `json:"provider_ids,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// TimelineEntry is one step in an order's history.
+type TimelineEntry struct {
+	At     time.Time `json:"at"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail,omitempty"`
+}
@@ -0,0 +1,64 @@
+package payit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// WebhookEventType identifies an event payit announces to subscribers.
+type WebhookEventType string
+
+// Events payit delivers to its configured webhook endpoint.
+const (
+	WebhookOrderPaid     WebhookEventType = "order.paid"
+	WebhookOrderRefunded WebhookEventType = "order.refunded"
+	// WebhookRenewalFailed reports a subscription payment that could not be collected.
+	WebhookRenewalFailed WebhookEventType = "subscription.renewal_failed"
+	// WebhookTrialEnding warns that a free trial ends in TrialDaysLeft days.
+	WebhookTrialEnding WebhookEventType = "subscription.trial_ending"
+	// WebhookTrialConverted reports a trial that became a paying subscription.
+	WebhookTrialConverted WebhookEventType = "subscription.trial_converted"
+	// WebhookTrialExpired reports a trial that ended without being paid for.
+	WebhookTrialExpired WebhookEventType = "subscription.trial_expired"
+)
+
+// WebhookEvent is the JSON body of a webhook delivery.
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      WebhookEventType `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	// Order is set on order events.
+	Order *Order `json:"order,omitempty"`
+	// AmountCents is the newly refunded amount on order.refunded and the
+	// amount due on subscription.renewal_failed.
+	AmountCents    int64  `json:"amount_cents,omitempty"`
+	Currency       string `json:"currency,omitempty"`
+	SubscriptionID string `json:"subscription_id,omitempty"`
+	CustomerEmail  string `json:"customer_email,omitempty"`
+	// TrialEnd and TrialDaysLeft are set on subscription.trial_ending.
+	TrialEnd      time.Time `json:"trial_end,omitzero"`
+	TrialDaysLeft int       `json:"trial_days_left,omitempty"`
+}
+
+// SignatureHeader carries the webhook signature, formatted as
+// "t=<unix seconds>,v1=<hex HMAC-SHA256>".
+const SignatureHeader = "Payit-Signature"
+
+// SignWebhook returns the SignatureHeader value for payload sent at t.
+func SignWebhook(payload []byte, secret string, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + WebhookSignature(payload, secret, ts)
+}
+
+// WebhookSignature is the hex HMAC-SHA256 of "<timestamp>.<payload>". Signing
+// the timestamp stops a captured delivery from being replayed later.
+func WebhookSignature(payload []byte, secret, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -2,7 +2,8 @@ package webassets
 
 import "embed"
 
-// Assets bundles HTML templates and static files for the checkout UI.
+// Assets bundles the checkout, account and admin pages, email templates, static files
+// and the OpenAPI document.
 //
-//go:embed templates/*.html static/*
+//go:embed templates/*.html templates/email/* templates/admin/* templates/account/* static/* api/*
 var Assets embed.FS
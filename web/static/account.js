@@ -0,0 +1,13 @@
+// Mounts the embedded checkout a repurchase falls back to when the
+// customer's bank wants them to confirm the payment.
+(async () => {
+  const embedded = document.querySelector("div#embedded-checkout");
+  if (!embedded || typeof Stripe !== "function") {
+    return;
+  }
+  const stripe = Stripe(embedded.dataset.stripeKey);
+  const checkout = await stripe.initEmbeddedCheckout({
+    fetchClientSecret: async () => embedded.dataset.clientSecret,
+  });
+  checkout.mount(embedded);
+})();
@@ -2,7 +2,12 @@
   const form = document.querySelector("form");
   const button = document.querySelector("button");
   const qtyInput = document.querySelector("input#quantity");
+  const promoInput = document.querySelector("input#promo_code");
+  const countryInput = document.querySelector("input#country");
+  const taxIdInput = document.querySelector("input#tax_id");
   const message = document.querySelector("div#message");
+  const embedded = document.querySelector("div#embedded-checkout");
+  const paymentForm = document.querySelector("form#payment-form");
 
   if (!form || !button || !qtyInput) {
     console.error("Missing required form elements");
@@ -17,6 +22,113 @@
     message.style.color = isError ? "#dc2626" : "#16a34a";
   };
 
+  const loadStripe = (key) => {
+    if (typeof Stripe !== "function") {
+      throw new Error("Stripe.js failed to load.");
+    }
+    return Stripe(key);
+  };
+
+  // mountEmbeddedCheckout swaps the form for Stripe's embedded checkout,
+  // which returns the buyer to /checkout/return once they have paid.
+  const mountEmbeddedCheckout = async (clientSecret) => {
+    const stripe = loadStripe(embedded.dataset.stripeKey);
+    const checkout = await stripe.initEmbeddedCheckout({
+      fetchClientSecret: async () => clientSecret,
+    });
+    form.hidden = true;
+    setMessage("", false);
+    embedded.hidden = false;
+    checkout.mount(embedded);
+  };
+
+  // settlePayment asks payit where a confirmed payment stands, running any
+  // 3-D Secure challenge Stripe still needs before sending the buyer on.
+  const settlePayment = async (stripe, intentId, clientSecret) => {
+    for (;;) {
+      const response = await fetch(`/api/payment-intents/${encodeURIComponent(intentId)}`);
+      if (!response.ok) {
+        throw new Error((await response.text()) || "Payment status request failed.");
+      }
+      const intent = await response.json();
+      switch (intent.status) {
+        case "succeeded":
+        case "requires_capture":
+          setMessage("Payment received, thank you!", false);
+          window.location.href = paymentForm.dataset.successUrl;
+          return true;
+        case "processing":
+          setMessage("Your payment is processing. We'll email you once it is confirmed.", false);
+          return true;
+        case "requires_action": {
+          const { error } = await stripe.handleNextAction({ clientSecret });
+          if (error) {
+            setMessage(error.message || "Authentication failed. Please try again.");
+            return false;
+          }
+          continue;
+        }
+        default:
+          setMessage("Your payment was declined. Please try another card.");
+          return false;
+      }
+    }
+  };
+
+  // mountPaymentElement swaps the cart form for a Stripe Elements payment
+  // form confirming the given intent.
+  const mountPaymentElement = (intent) => {
+    const stripe = loadStripe(paymentForm.dataset.stripeKey);
+    const elements = stripe.elements({ clientSecret: intent.client_secret });
+    elements.create("payment").mount("#payment-element");
+    form.hidden = true;
+    paymentForm.hidden = false;
+    setMessage("", false);
+
+    const payButton = paymentForm.querySelector("button");
+    paymentForm.addEventListener("submit", async (event) => {
+      event.preventDefault();
+      payButton.disabled = true;
+      try {
+        const { error } = await stripe.confirmPayment({
+          elements,
+          redirect: "if_required",
+          confirmParams: { return_url: `${window.location.origin}/` },
+        });
+        if (error) {
+          setMessage(error.message || "Your payment could not be completed.");
+          payButton.disabled = false;
+          return;
+        }
+        if (!(await settlePayment(stripe, intent.id, intent.client_secret))) {
+          payButton.disabled = false;
+        }
+      } catch (err) {
+        console.error("Payment failed", err);
+        setMessage("Unable to complete payment. Please try again.");
+        payButton.disabled = false;
+      }
+    });
+  };
+
+  // Payment methods that leave the page come back here with the intent in
+  // the query string.
+  const returned = new URLSearchParams(window.location.search);
+  if (paymentForm && returned.has("payment_intent")) {
+    form.hidden = true;
+    settlePayment(
+      loadStripe(paymentForm.dataset.stripeKey),
+      returned.get("payment_intent"),
+      returned.get("payment_intent_client_secret"),
+    ).then((settled) => {
+      form.hidden = settled;
+    }, (err) => {
+      console.error("Payment status failed", err);
+      form.hidden = false;
+      setMessage("Unable to confirm your payment. Please contact us.");
+    });
+  }
+
   form.addEventListener("submit", async (event) => {
     event.preventDefault();
 
@@ -27,24 +139,69 @@
       return;
     }
 
+    const payload = { quantity };
+    const promoCode = promoInput ? promoInput.value.trim() : "";
+    if (promoCode) {
+      payload.promo_code = promoCode;
+    }
+    const country = countryInput ? countryInput.value.trim().toUpperCase() : "";
+    if (country) {
+      payload.country = country;
+    }
+    const taxId = taxIdInput ? taxIdInput.value.trim() : "";
+    if (taxId) {
+      payload.tax_id = taxId;
+    }
+
     try {
       button.disabled = true;
       setMessage("Contacting Stripe…", false);
 
-      const response = await fetch("/api/checkout", {
+      const response = await fetch(paymentForm ? "/api/payment-intents" : "/api/checkout", {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
         },
-        body: JSON.stringify({ quantity }),
+        body: JSON.stringify(payload),
       });
 
+      if (response.status === 422) {
+        const { error } = await response.json();
+        const fields = (error && error.fields) || [];
+        const quantityError = fields.find((f) => f.field === "quantity");
+        setMessage(
+          fields.map((f) => `${f.field.replaceAll("_", " ")} ${f.message}`).join(". ") ||
+            (error && error.message) ||
+            "Please check your details.",
+        );
+        if (quantityError) {
+          qtyInput.focus();
+        }
+        button.disabled = false;
+        return;
+      }
+
+      if (response.status === 400 || response.status === 409) {
+        const errorText = await response.text();
+        setMessage(errorText.trim() || "Please check your details.");
+        button.disabled = false;
+        return;
+      }
+
       if (!response.ok) {
         const errorText = await response.text();
         throw new Error(errorText || "Checkout request failed.");
       }
 
       const data = await response.json();
+      if (data && data.client_secret && paymentForm) {
+        mountPaymentElement(data);
+        return;
+      }
+      if (data && data.client_secret && embedded) {
+        await mountEmbeddedCheckout(data.client_secret);
+        return;
+      }
       if (!data || !data.url) {
         throw new Error("Checkout response missing redirect URL.");
       }